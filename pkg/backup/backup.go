@@ -0,0 +1,282 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// indexFile lists the files of a snapshot and where they came from.
+const indexFile = "snapshot.json"
+
+// idFormat names snapshots by when they were taken, so they sort in order.
+const idFormat = "20060102T150405.000000000"
+
+type (
+	// Store keeps snapshots of local files taken before they are
+	// overwritten, one directory per snapshot under root, keeping only the
+	// newest keep of them.
+	Store struct {
+		root string
+		keep int
+	}
+
+	// Snapshot is a set of files backed up together, e.g. by one pull,
+	// and the files that didn't exist before it.
+	Snapshot struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"createdAt"`
+		Files     []Entry   `json:"files"`
+		Created   []string  `json:"created,omitempty"`
+
+		store *Store
+	}
+
+	// Entry is one backed up file: the path it was copied from, and its
+	// name within the snapshot.
+	Entry struct {
+		Original string `json:"original"`
+		Name     string `json:"name"`
+	}
+)
+
+// NewStore returns the store of snapshots under root. A keep of zero or less
+// keeps every snapshot.
+func NewStore(root string, keep int) *Store {
+	return &Store{root: root, keep: keep}
+}
+
+// Start begins a snapshot taken at now. Nothing is written until a file is
+// saved or recorded in it.
+func (s *Store) Start(now time.Time) *Snapshot {
+	return &Snapshot{ID: now.UTC().Format(idFormat), CreatedAt: now, Files: make([]Entry, 0), store: s}
+}
+
+// Save copies the file at path into the snapshot, keeping its modification
+// time. The first file saved creates the snapshot and prunes the oldest
+// snapshots beyond the store's limit.
+func (sn *Snapshot) Save(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return eris.Wrapf(err, "failed to resolve %s", path)
+	}
+	dir := sn.store.dir(sn.ID)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return eris.Wrap(err, "failed to create backup directory")
+	}
+	entry := Entry{Original: abs, Name: fmt.Sprintf("%04d-%s", len(sn.Files)+1, filepath.Base(abs))}
+	err = copyFile(abs, filepath.Join(dir, entry.Name))
+	if err != nil {
+		return err
+	}
+	sn.Files = append(sn.Files, entry)
+	return sn.commit()
+}
+
+// Record notes that the file at path didn't exist before the snapshot, so
+// restoring it removes the file. Like Save, the first file recorded creates
+// the snapshot.
+func (sn *Snapshot) Record(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return eris.Wrapf(err, "failed to resolve %s", path)
+	}
+	err = os.MkdirAll(sn.store.dir(sn.ID), 0o755)
+	if err != nil {
+		return eris.Wrap(err, "failed to create backup directory")
+	}
+	sn.Created = append(sn.Created, abs)
+	return sn.commit()
+}
+
+// commit writes the index, and prunes the oldest snapshots when this one
+// was just created.
+func (sn *Snapshot) commit() error {
+	err := sn.writeIndex()
+	if err != nil {
+		return err
+	}
+	if len(sn.Files)+len(sn.Created) == 1 {
+		return sn.store.prune()
+	}
+	return nil
+}
+
+func (sn *Snapshot) writeIndex() error {
+	b, err := json.MarshalIndent(sn, "", "  ")
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal snapshot")
+	}
+	err = os.WriteFile(filepath.Join(sn.store.dir(sn.ID), indexFile), b, 0o644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write snapshot %s", sn.ID)
+	}
+	return nil
+}
+
+// List returns every snapshot, newest first. Directories without a readable
+// index are skipped.
+func (s *Store) List() ([]Snapshot, error) {
+	dirs, err := os.ReadDir(s.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to list backups in %s", s.root)
+	}
+	snapshots := make([]Snapshot, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		sn, err := s.Get(d.Name())
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, sn)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID > snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+// Get returns the snapshot with the given ID, or errors.NotFoundError.
+func (s *Store) Get(id string) (Snapshot, error) {
+	err := validID(id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir(id), indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, eris.Wrapf(rperrors.NotFoundError, "no backup %s", id)
+	}
+	if err != nil {
+		return Snapshot{}, eris.Wrapf(err, "failed to read backup %s", id)
+	}
+	var sn Snapshot
+	err = json.Unmarshal(b, &sn)
+	if err != nil {
+		return Snapshot{}, eris.Wrapf(err, "failed to parse backup %s", id)
+	}
+	sn.store = s
+	return sn, nil
+}
+
+// Restore copies every file of the snapshot back where it came from,
+// replacing what is there, and removes the files it recorded as created,
+// then deletes the snapshot. It returns the paths restored; those removed
+// are the snapshot's Created.
+func (s *Store) Restore(id string) ([]string, error) {
+	sn, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	restored := make([]string, 0, len(sn.Files))
+	for _, entry := range sn.Files {
+		err = os.MkdirAll(filepath.Dir(entry.Original), 0o755)
+		if err != nil {
+			return restored, eris.Wrapf(err, "failed to create %s", filepath.Dir(entry.Original))
+		}
+		// Copy beside the original, then rename, so a failed restore
+		// leaves it untouched.
+		tmp := entry.Original + ".restore.tmp"
+		err = copyFile(filepath.Join(s.dir(id), entry.Name), tmp)
+		if err != nil {
+			os.Remove(tmp)
+			return restored, err
+		}
+		err = os.Rename(tmp, entry.Original)
+		if err != nil {
+			os.Remove(tmp)
+			return restored, eris.Wrapf(err, "failed to restore %s", entry.Original)
+		}
+		restored = append(restored, entry.Original)
+	}
+	for _, p := range sn.Created {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return restored, eris.Wrapf(err, "failed to remove %s", p)
+		}
+	}
+	err = os.RemoveAll(s.dir(id))
+	if err != nil {
+		return restored, eris.Wrapf(err, "failed to remove backup %s", id)
+	}
+	return restored, nil
+}
+
+// prune deletes the oldest snapshots beyond the limit.
+func (s *Store) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	snapshots, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i := s.keep; i < len(snapshots); i++ {
+		err = os.RemoveAll(s.dir(snapshots[i].ID))
+		if err != nil {
+			return eris.Wrapf(err, "failed to remove backup %s", snapshots[i].ID)
+		}
+	}
+	return nil
+}
+
+// validID checks id names a snapshot, so it can't point anywhere outside
+// the store.
+func validID(id string) error {
+	_, err := time.Parse(idFormat, id)
+	if err != nil || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return eris.Errorf("invalid backup %q", id)
+	}
+	return nil
+}
+
+func (s *Store) dir(id string) string {
+	return filepath.Join(s.root, id)
+}
+
+// copyFile copies src to dst, keeping its modification time.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return eris.Wrapf(err, "failed to open %s", src)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return eris.Wrapf(err, "failed to stat %s", src)
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return eris.Wrapf(err, "failed to create %s", dst)
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err != nil {
+		return eris.Wrapf(err, "failed to copy %s to %s", src, dst)
+	}
+	if closeErr != nil {
+		return eris.Wrapf(closeErr, "failed to write %s", dst)
+	}
+	err = os.Chtimes(dst, time.Now(), info.ModTime())
+	if err != nil {
+		return eris.Wrapf(err, "failed to set modification time of %s", dst)
+	}
+	return nil
+}
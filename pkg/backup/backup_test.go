@@ -0,0 +1,103 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/backup"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		dir   string
+		save  string
+		store *backup.Store
+		start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		save = filepath.Join(dir, "roms", "snes", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(save), 0o755)).To(Succeed())
+		Expect(os.WriteFile(save, []byte("before"), 0o644)).To(Succeed())
+		Expect(os.Chtimes(save, start, start)).To(Succeed())
+		store = backup.NewStore(filepath.Join(dir, "backup"), 2)
+	})
+
+	It("restores files as they were before they were overwritten", func() {
+		snapshot := store.Start(start)
+		Expect(snapshot.Save(save)).To(Succeed())
+		Expect(os.WriteFile(save, []byte("after"), 0o644)).To(Succeed())
+
+		restored, err := store.Restore(snapshot.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(Equal([]string{save}))
+		Expect(os.ReadFile(save)).To(Equal([]byte("before")))
+		info, err := os.Stat(save)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ModTime()).To(BeTemporally("==", start))
+
+		_, err = store.Get(snapshot.ID)
+		Expect(err).To(MatchError(errors.NotFoundError))
+	})
+
+	It("removes files the snapshot recorded as created", func() {
+		created := filepath.Join(dir, "roms", "snes", "New.srm")
+		snapshot := store.Start(start)
+		Expect(snapshot.Save(save)).To(Succeed())
+		Expect(snapshot.Record(created)).To(Succeed())
+		Expect(os.WriteFile(created, []byte("pulled"), 0o644)).To(Succeed())
+
+		sn, err := store.Get(snapshot.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sn.Created).To(Equal([]string{created}))
+
+		restored, err := store.Restore(snapshot.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(Equal([]string{save}))
+		Expect(created).NotTo(BeAnExistingFile())
+		Expect(os.ReadFile(save)).To(Equal([]byte("before")))
+	})
+
+	DescribeTable("rejects IDs that aren't snapshots",
+		func(id string) {
+			Expect(os.WriteFile(filepath.Join(dir, "snapshot.json"), []byte(`{"files":[]}`), 0o644)).To(Succeed())
+			_, err := store.Get(id)
+			Expect(err).To(MatchError(ContainSubstring("invalid backup")))
+			_, err = store.Restore(id)
+			Expect(err).To(HaveOccurred())
+			Expect(dir).To(BeADirectory())
+			Expect(save).To(BeAnExistingFile())
+		},
+		Entry("parent", ".."),
+		Entry("nested parent", "../backup"),
+		Entry("absolute", "/tmp"),
+		Entry("not a time", "latest"),
+		Entry("empty", ""),
+	)
+
+	It("writes nothing until a file is saved", func() {
+		store.Start(start)
+		snapshots, err := store.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshots).To(BeEmpty())
+	})
+
+	It("keeps only the newest snapshots", func() {
+		for i := 0; i < 3; i++ {
+			Expect(store.Start(start.Add(time.Duration(i) * time.Hour)).Save(save)).To(Succeed())
+		}
+		snapshots, err := store.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshots).To(HaveLen(2))
+		Expect(snapshots[0].CreatedAt).To(BeTemporally("==", start.Add(2*time.Hour)))
+		Expect(snapshots[1].CreatedAt).To(BeTemporally("==", start.Add(time.Hour)))
+		Expect(snapshots[0].Files).To(HaveLen(1))
+		Expect(snapshots[0].Files[0].Original).To(Equal(save))
+	})
+})
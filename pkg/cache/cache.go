@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// Entry is what was last synced of a local file.
+	Entry struct {
+		SHA256  string    `json:"sha256"`
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"modTime"`
+		Key     string    `json:"key"`
+		// UploadedAt is when the file was last uploaded.
+		UploadedAt time.Time `json:"uploadedAt,omitempty"`
+	}
+
+	// Cache remembers the last synced state of local files, by absolute
+	// path, so a file whose size and modification time haven't changed can
+	// be skipped without reading it or asking the remote about it. A cache
+	// belongs to one sync target; loading it for another target starts it
+	// empty.
+	Cache struct {
+		path    string
+		target  string
+		entries map[string]Entry
+		dirty   bool
+	}
+
+	cacheFile struct {
+		Target string           `json:"target"`
+		Files  map[string]Entry `json:"files"`
+	}
+)
+
+// Load reads the cache at path for the given target. A missing or unreadable
+// cache, or one written for another target, is treated as empty: the worst
+// that costs is a file being synced again.
+func Load(path, target string) (*Cache, error) {
+	c := &Cache{path: path, target: target, entries: make(map[string]Entry)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read cache %s", path)
+	}
+	var f cacheFile
+	if json.Unmarshal(b, &f) != nil || f.Target != target {
+		// Rewrite it on the next Save.
+		c.dirty = true
+		return c, nil
+	}
+	if f.Files != nil {
+		c.entries = f.Files
+	}
+	return c, nil
+}
+
+// Get returns the entry for the file at path.
+func (c *Cache) Get(path string) (Entry, bool) {
+	e, ok := c.entries[path]
+	return e, ok
+}
+
+// Unchanged reports whether the file at path has the size and modification
+// time it had when it was last synced.
+func (c *Cache) Unchanged(path string, size int64, modTime time.Time) bool {
+	e, ok := c.entries[path]
+	return ok && e.Size == size && e.ModTime.Equal(modTime)
+}
+
+// Put records that the file at path was synced.
+func (c *Cache) Put(path string, e Entry) {
+	c.entries[path] = e
+	c.dirty = true
+}
+
+// Len is the number of files in the cache.
+func (c *Cache) Len() int {
+	return len(c.entries)
+}
+
+// Save writes the cache back to its file, if it changed. The file is
+// replaced atomically so an interrupted save leaves the previous cache.
+func (c *Cache) Save() error {
+	if !c.dirty {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm)
+	if err != nil {
+		return eris.Wrap(err, "failed to create cache directory")
+	}
+	b, err := json.Marshal(cacheFile{Target: c.target, Files: c.entries})
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal cache")
+	}
+	tmp := c.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write cache %s", tmp)
+	}
+	err = os.Rename(tmp, c.path)
+	if err != nil {
+		return eris.Wrapf(err, "failed to replace cache %s", c.path)
+	}
+	c.dirty = false
+	return nil
+}
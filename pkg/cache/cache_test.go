@@ -0,0 +1,76 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/cache"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		dir     string
+		path    string
+		modTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		entry   = cache.Entry{SHA256: "abc", Size: 10, ModTime: modTime, Key: "snes/Game.srm"}
+	)
+
+	BeforeEach(func() {
+		dir = filepath.Join(os.TempDir(), uuid.New().String())
+		path = filepath.Join(dir, "cache.json")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("starts empty when there is no cache file", func() {
+		c, err := cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Len()).To(BeZero())
+		Expect(c.Unchanged("/roms/snes/Game.srm", 10, modTime)).To(BeFalse())
+	})
+
+	It("remembers synced files across loads", func() {
+		c, err := cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		c.Put("/roms/snes/Game.srm", entry)
+		Expect(c.Save()).To(Succeed())
+
+		c, err = cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Unchanged("/roms/snes/Game.srm", 10, modTime.Local())).To(BeTrue())
+		Expect(c.Unchanged("/roms/snes/Game.srm", 11, modTime)).To(BeFalse())
+		Expect(c.Unchanged("/roms/snes/Game.srm", 10, modTime.Add(time.Second))).To(BeFalse())
+		got, ok := c.Get("/roms/snes/Game.srm")
+		Expect(ok).To(BeTrue())
+		Expect(got.Key).To(Equal("snes/Game.srm"))
+	})
+
+	It("starts empty for another target", func() {
+		c, err := cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		c.Put("/roms/snes/Game.srm", entry)
+		Expect(c.Save()).To(Succeed())
+
+		c, err = cache.Load(path, "s3://other")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Len()).To(BeZero())
+	})
+
+	It("starts empty when the cache file is corrupt", func() {
+		Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("{not json"), 0644)).To(Succeed())
+		c, err := cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Len()).To(BeZero())
+		Expect(c.Save()).To(Succeed())
+		_, err = cache.Load(path, "s3://bucket")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
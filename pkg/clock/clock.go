@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type clockKey struct{}
+
+type (
+	// Clock tells the time. Code that decides anything by the time reads it
+	// from the clock in its context, so tests can set it.
+	Clock interface {
+		Now() time.Time
+	}
+
+	systemClock struct{}
+
+	// Fake is a Clock that only moves when told to.
+	Fake struct {
+		mu  sync.Mutex
+		now time.Time
+	}
+)
+
+// System is the clock of the machine, used unless a context carries another.
+var System Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FromCtx returns the clock in ctx, or System.
+func FromCtx(ctx context.Context) Clock {
+	if ctx != nil {
+		if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+			return c
+		}
+	}
+	return System
+}
+
+func ToCtx(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// Now returns the time by the clock in ctx.
+func Now(ctx context.Context) time.Time {
+	return FromCtx(ctx).Now()
+}
+
+// NewFake returns a Fake clock stopped at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set stops the clock at now.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
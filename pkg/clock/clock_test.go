@@ -0,0 +1,26 @@
+package clock_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+)
+
+var _ = Describe("Clock", func() {
+	It("uses the system clock by default", func() {
+		Expect(clock.Now(context.Background())).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("uses the clock in the context", func() {
+		start := time.Date(2023, 12, 17, 13, 59, 59, 0, time.UTC)
+		fake := clock.NewFake(start)
+		ctx := clock.ToCtx(context.Background(), fake)
+		Expect(clock.Now(ctx)).To(Equal(start))
+		fake.Advance(time.Second)
+		Expect(clock.Now(ctx)).To(Equal(start.Add(time.Second)))
+	})
+})
@@ -0,0 +1,76 @@
+package cost
+
+import (
+	"strings"
+)
+
+// bytesPerGB is the gigabyte storage is billed by.
+const bytesPerGB = 1 << 30
+
+type (
+	// Tier is a storage backend and class, with its list prices in USD.
+	Tier struct {
+		Name              string  `json:"name"`
+		Description       string  `json:"description"`
+		StoragePerGBMonth float64 `json:"storagePerGBMonth"`
+		PutsPer1000       float64 `json:"putsPer1000"`
+	}
+
+	// Usage is what the library stores and uploads. Every upload is kept,
+	// so StoredBytes grows by MonthlyUploadBytes each month.
+	Usage struct {
+		StoredBytes        int64 `json:"storedBytes"`
+		MonthlyUploadBytes int64 `json:"monthlyUploadBytes"`
+		MonthlyUploads     int   `json:"monthlyUploads"`
+	}
+
+	// Estimate is the cost of a month of Usage on a Tier, in USD.
+	Estimate struct {
+		Tier     string  `json:"tier"`
+		StoredGB float64 `json:"storedGB"`
+		Storage  float64 `json:"storage"`
+		Requests float64 `json:"requests"`
+		Total    float64 `json:"total"`
+	}
+)
+
+// tiers are list prices for us-east-1 and Backblaze B2 as of 2024. Minimum
+// storage durations and object sizes, retrieval, and egress are not
+// included.
+var tiers = []Tier{
+	{Name: "s3-standard", Description: "S3 Standard", StoragePerGBMonth: 0.023, PutsPer1000: 0.005},
+	{Name: "s3-standard-ia", Description: "S3 Standard-Infrequent Access", StoragePerGBMonth: 0.0125, PutsPer1000: 0.01},
+	{Name: "s3-glacier-ir", Description: "S3 Glacier Instant Retrieval", StoragePerGBMonth: 0.004, PutsPer1000: 0.02},
+	{Name: "s3-glacier", Description: "S3 Glacier Flexible Retrieval", StoragePerGBMonth: 0.0036, PutsPer1000: 0.03},
+	{Name: "s3-deep-archive", Description: "S3 Glacier Deep Archive", StoragePerGBMonth: 0.00099, PutsPer1000: 0.05},
+	{Name: "b2", Description: "Backblaze B2", StoragePerGBMonth: 0.006, PutsPer1000: 0},
+}
+
+// Tiers returns the known tiers, cheapest to retrieve from first.
+func Tiers() []Tier {
+	return append([]Tier{}, tiers...)
+}
+
+// LookupTier returns the tier with the given name.
+func LookupTier(name string) (Tier, bool) {
+	for _, t := range tiers {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return Tier{}, false
+}
+
+// Estimate returns the cost of the coming month of usage on the tier,
+// billing storage for the average stored over the month.
+func (t Tier) Estimate(u Usage) Estimate {
+	storedGB := (float64(u.StoredBytes) + float64(u.MonthlyUploadBytes)/2) / bytesPerGB
+	e := Estimate{
+		Tier:     t.Name,
+		StoredGB: storedGB,
+		Storage:  storedGB * t.StoragePerGBMonth,
+		Requests: float64(u.MonthlyUploads) / 1000 * t.PutsPer1000,
+	}
+	e.Total = e.Storage + e.Requests
+	return e
+}
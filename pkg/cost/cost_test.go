@@ -0,0 +1,31 @@
+package cost_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/cost"
+)
+
+var _ = Describe("Tier", func() {
+	It("looks up tiers by name", func() {
+		tier, ok := cost.LookupTier("S3-Standard")
+		Expect(ok).To(BeTrue())
+		Expect(tier.Name).To(Equal("s3-standard"))
+		_, ok = cost.LookupTier("floppy")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("bills the average stored over the month and every upload", func() {
+		tier := cost.Tier{Name: "test", StoragePerGBMonth: 0.02, PutsPer1000: 0.005}
+		estimate := tier.Estimate(cost.Usage{
+			StoredBytes:        10 << 30,
+			MonthlyUploadBytes: 2 << 30,
+			MonthlyUploads:     4000,
+		})
+		Expect(estimate.StoredGB).To(BeNumerically("~", 11, 1e-9))
+		Expect(estimate.Storage).To(BeNumerically("~", 0.22, 1e-9))
+		Expect(estimate.Requests).To(BeNumerically("~", 0.02, 1e-9))
+		Expect(estimate.Total).To(BeNumerically("~", 0.24, 1e-9))
+	})
+})
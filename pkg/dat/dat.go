@@ -0,0 +1,166 @@
+package dat
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// File is a DAT file in the Logiqx XML format used by No-Intro and
+	// Redump, listing every known good dump of a system's games.
+	File struct {
+		Header struct {
+			Name string `xml:"name"`
+		} `xml:"header"`
+		Games []Game `xml:"game"`
+	}
+
+	Game struct {
+		Name string `xml:"name,attr"`
+		Roms []Rom  `xml:"rom"`
+	}
+
+	Rom struct {
+		Name   string `xml:"name,attr"`
+		Size   int64  `xml:"size,attr"`
+		SHA1   string `xml:"sha1,attr"`
+		Status string `xml:"status,attr"`
+	}
+
+	// Match is a DAT entry a ROM was matched to.
+	Match struct {
+		// System is the name of the DAT, e.g. "Nintendo - Super Nintendo
+		// Entertainment System".
+		System string `json:"system"`
+		// Game is the canonical name of the game, e.g. "Chrono Trigger (USA)".
+		Game string `json:"game"`
+		// Rom is the canonical file name of the ROM.
+		Rom     string `json:"rom"`
+		BadDump bool   `json:"badDump,omitempty"`
+	}
+
+	Status string
+
+	// Result is the outcome of verifying a ROM against the loaded DATs.
+	Result struct {
+		Status Status `json:"status"`
+		Match  *Match `json:"match,omitempty"`
+	}
+
+	// Index looks ROMs up in any number of DATs.
+	Index struct {
+		bySHA1 map[string]Match
+		byName map[string]Match
+	}
+)
+
+const (
+	// Verified means the ROM is a known good dump.
+	Verified Status = "verified"
+	// BadDump means the ROM is a dump the DAT marks as bad.
+	BadDump Status = "baddump"
+	// Mismatch means the ROM is named like a known dump but its contents
+	// differ: it is corrupt, hacked, or a bad dump the DAT doesn't list.
+	Mismatch Status = "mismatch"
+	// Unknown means the DATs know nothing about the ROM.
+	Unknown Status = "unknown"
+)
+
+// Parse reads a DAT file.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	err := xml.NewDecoder(r).Decode(f)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to parse DAT")
+	}
+	return f, nil
+}
+
+// LoadDir indexes every .dat file in dir.
+func LoadDir(dir string) (*Index, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.dat"))
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to list DATs in %s", dir)
+	}
+	files := make([]*File, 0, len(paths))
+	for _, p := range paths {
+		r, err := os.Open(p)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to open DAT %s", p)
+		}
+		f, err := Parse(r)
+		r.Close()
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid DAT %s", p)
+		}
+		files = append(files, f)
+	}
+	return NewIndex(files...), nil
+}
+
+// NewIndex indexes the DATs' ROMs by SHA-1 and by file name.
+func NewIndex(files ...*File) *Index {
+	idx := &Index{
+		bySHA1: make(map[string]Match),
+		byName: make(map[string]Match),
+	}
+	for _, f := range files {
+		for _, g := range f.Games {
+			for _, r := range g.Roms {
+				m := Match{
+					System:  f.Header.Name,
+					Game:    g.Name,
+					Rom:     r.Name,
+					BadDump: r.Status == "baddump",
+				}
+				if r.SHA1 != "" {
+					idx.bySHA1[strings.ToLower(r.SHA1)] = m
+				}
+				idx.byName[strings.ToLower(r.Name)] = m
+			}
+		}
+	}
+	return idx
+}
+
+// Len returns the number of ROMs indexed.
+func (idx *Index) Len() int {
+	return len(idx.bySHA1)
+}
+
+// Verify looks up the ROM with the given file name and hex-encoded SHA-1.
+func (idx *Index) Verify(name, sum string) Result {
+	if m, ok := idx.bySHA1[strings.ToLower(sum)]; ok {
+		if m.BadDump {
+			return Result{Status: BadDump, Match: &m}
+		}
+		return Result{Status: Verified, Match: &m}
+	}
+	if m, ok := idx.byName[strings.ToLower(name)]; ok {
+		return Result{Status: Mismatch, Match: &m}
+	}
+	return Result{Status: Unknown}
+}
+
+// SHA1File returns the hex-encoded SHA-1 of the file at path, the hash DATs
+// are keyed by.
+func SHA1File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+	h := sha1.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to hash %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,71 @@
+package dat_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+)
+
+const snesDat = `<?xml version="1.0"?>
+<datafile>
+	<header>
+		<name>Nintendo - Super Nintendo Entertainment System</name>
+	</header>
+	<game name="Chrono Trigger (USA)">
+		<description>Chrono Trigger (USA)</description>
+		<rom name="Chrono Trigger (USA).sfc" size="6" crc="00000000" sha1="4FBE4A465F758F9D6D1EA54042160414BA713BBF"/>
+	</game>
+	<game name="Secret of Mana (USA)">
+		<rom name="Secret of Mana (USA).sfc" size="4" sha1="0000000000000000000000000000000000000001" status="baddump"/>
+	</game>
+</datafile>`
+
+var _ = Describe("Index", func() {
+	var idx *dat.Index
+
+	BeforeEach(func() {
+		f, err := dat.Parse(strings.NewReader(snesDat))
+		Expect(err).NotTo(HaveOccurred())
+		idx = dat.NewIndex(f)
+	})
+
+	It("verifies known good dumps by hash, whatever their name", func() {
+		res := idx.Verify("chrono.sfc", "4fbe4a465f758f9d6d1ea54042160414ba713bbf")
+		Expect(res.Status).To(Equal(dat.Verified))
+		Expect(res.Match.Game).To(Equal("Chrono Trigger (USA)"))
+		Expect(res.Match.System).To(Equal("Nintendo - Super Nintendo Entertainment System"))
+	})
+
+	It("flags bad dumps", func() {
+		res := idx.Verify("mana.sfc", "0000000000000000000000000000000000000001")
+		Expect(res.Status).To(Equal(dat.BadDump))
+	})
+
+	It("flags known names with unknown contents", func() {
+		res := idx.Verify("Chrono Trigger (USA).sfc", "ffff")
+		Expect(res.Status).To(Equal(dat.Mismatch))
+		Expect(res.Match.Rom).To(Equal("Chrono Trigger (USA).sfc"))
+	})
+
+	It("knows nothing about other ROMs", func() {
+		Expect(idx.Verify("homebrew.sfc", "ffff").Status).To(Equal(dat.Unknown))
+	})
+
+	It("loads every DAT in a folder", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "snes.dat"), []byte(snesDat), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "chrono.sfc"), []byte("chrono"), 0644)).To(Succeed())
+
+		loaded, err := dat.LoadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Len()).To(Equal(2))
+		sum, err := dat.SHA1File(filepath.Join(dir, "chrono.sfc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Verify("chrono.sfc", sum).Status).To(Equal(dat.Verified))
+	})
+})
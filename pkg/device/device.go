@@ -0,0 +1,76 @@
+package device
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+)
+
+// filename is the file, in the state directory, the identity is kept in.
+const filename = "device.json"
+
+// Identity identifies the machine a sync ran on, so uploads from a handheld
+// and a living-room Pi can be told apart. ID is generated once and never
+// changes; Name is for people and defaults to the hostname.
+type Identity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Load returns the identity kept in stateDir, generating and saving one the
+// first time. A non-empty name overrides the saved name.
+func Load(stateDir, name string) (Identity, error) {
+	path := filepath.Join(stateDir, filename)
+	id := Identity{}
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		err = json.Unmarshal(b, &id)
+		if err != nil {
+			return Identity{}, eris.Wrapf(err, "failed to parse device identity %s", path)
+		}
+	case os.IsNotExist(err):
+		id, err = create(path)
+		if err != nil {
+			return Identity{}, err
+		}
+	default:
+		return Identity{}, eris.Wrapf(err, "failed to read device identity %s", path)
+	}
+	if name != "" {
+		id.Name = name
+	}
+	return id, nil
+}
+
+func create(path string) (Identity, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	id := Identity{ID: uuid.New().String(), Name: hostname}
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return Identity{}, eris.Wrap(err, "failed to create state directory")
+	}
+	b, err := json.Marshal(id)
+	if err != nil {
+		return Identity{}, eris.Wrap(err, "failed to marshal device identity")
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		return Identity{}, eris.Wrapf(err, "failed to write device identity %s", path)
+	}
+	return id, nil
+}
+
+// String describes the device by name, or by ID if it has none.
+func (id Identity) String() string {
+	if id.Name != "" {
+		return id.Name
+	}
+	return id.ID
+}
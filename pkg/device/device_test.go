@@ -0,0 +1,32 @@
+package device_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/device"
+)
+
+var _ = Describe("Load", func() {
+	It("keeps the generated ID across loads", func() {
+		dir := GinkgoT().TempDir()
+		first, err := device.Load(dir, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.ID).NotTo(BeEmpty())
+		Expect(first.Name).NotTo(BeEmpty())
+
+		second, err := device.Load(dir, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+	})
+
+	It("lets the name be overridden", func() {
+		dir := GinkgoT().TempDir()
+		first, err := device.Load(dir, "")
+		Expect(err).NotTo(HaveOccurred())
+		named, err := device.Load(dir, "living-room")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(named.ID).To(Equal(first.ID))
+		Expect(named.Name).To(Equal("living-room"))
+	})
+})
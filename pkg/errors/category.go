@@ -0,0 +1,88 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Category groups errors by how a caller, such as the CLI deciding its exit
+// status, should react to them.
+type Category int
+
+const (
+	UnknownCategory Category = iota
+	ConfigCategory
+	AuthCategory
+	NetworkCategory
+	ConflictCategory
+	CancelledCategory
+	// LocalCategory marks failures to read or write local files, which no
+	// retry of a storage operation fixes.
+	LocalCategory
+)
+
+type categorized struct {
+	category Category
+	err      error
+}
+
+func (c *categorized) Error() string {
+	return c.err.Error()
+}
+
+func (c *categorized) Unwrap() error {
+	return c.err
+}
+
+// WithCategory marks err as belonging to the category. It returns nil if err
+// is nil.
+func WithCategory(err error, category Category) error {
+	if err == nil {
+		return nil
+	}
+	return &categorized{category: category, err: err}
+}
+
+// CategoryOf returns the category err was marked with, the outermost mark
+// winning. Unmarked cancellations, network errors, open circuit breakers,
+// held locks, and exceeded limits are recognized on their own.
+func CategoryOf(err error) Category {
+	var c *categorized
+	if errors.As(err, &c) {
+		return c.category
+	}
+	if errors.Is(err, context.Canceled) {
+		return CancelledCategory
+	}
+	if errors.Is(err, CircuitOpenError) {
+		return NetworkCategory
+	}
+	if errors.Is(err, LockedError) || errors.Is(err, LimitError) {
+		return ConflictCategory
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return NetworkCategory
+	}
+	return UnknownCategory
+}
+
+func (c Category) String() string {
+	switch c {
+	case ConfigCategory:
+		return "config"
+	case AuthCategory:
+		return "auth"
+	case NetworkCategory:
+		return "network"
+	case ConflictCategory:
+		return "conflict"
+	case CancelledCategory:
+		return "cancelled"
+	case LocalCategory:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
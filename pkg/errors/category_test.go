@@ -0,0 +1,39 @@
+package errors_test
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+)
+
+var _ = Describe("Category", func() {
+	It("is unknown for plain errors", func() {
+		Expect(errors.CategoryOf(eris.New("boom"))).To(Equal(errors.UnknownCategory))
+	})
+
+	It("survives wrapping", func() {
+		err := errors.WithCategory(eris.New("bad key"), errors.AuthCategory)
+		err = eris.Wrap(err, "failed to upload")
+		Expect(errors.CategoryOf(err)).To(Equal(errors.AuthCategory))
+	})
+
+	It("leaves nil alone", func() {
+		Expect(errors.WithCategory(nil, errors.ConfigCategory)).To(BeNil())
+	})
+
+	DescribeTable("recognizes unmarked errors",
+		func(err error, category errors.Category) {
+			Expect(errors.CategoryOf(eris.Wrap(err, "failed"))).To(Equal(category))
+		},
+		Entry("cancellation", context.Canceled, errors.CancelledCategory),
+		Entry("open circuit breaker", errors.CircuitOpenError, errors.NetworkCategory),
+		Entry("held lock", errors.LockedError, errors.ConflictCategory),
+		Entry("exceeded limits", errors.LimitError, errors.ConflictCategory),
+		Entry("network", &net.OpError{Op: "dial", Err: eris.New("connection refused")}, errors.NetworkCategory),
+	)
+})
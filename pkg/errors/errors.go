@@ -4,4 +4,9 @@ import "github.com/rotisserie/eris"
 
 var (
 	NotImplementedError = eris.New("function not implemented")
+	CircuitOpenError    = eris.New("storage backend unavailable; circuit breaker open")
+	NotFoundError       = eris.New("not found")
+	LockedError         = eris.New("another sync is running")
+	ChecksumError       = eris.New("checksum mismatch")
+	LimitError          = eris.New("sync exceeds its safety limits")
 )
@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// compressedExts are formats whose data is already compressed, so
+// compressing them again before upload saves nothing.
+var compressedExts = map[string]bool{
+	".zip": true,
+	".7z":  true,
+	".chd": true,
+	".pbp": true,
+	".cso": true,
+	".rvz": true,
+}
+
+// IsCompressed reports whether a file with the given name is in a format
+// that is already compressed, such as a zipped ROM or a CHD disc image.
+func IsCompressed(filename string) bool {
+	return compressedExts[strings.ToLower(filepath.Ext(filename))]
+}
+
+// ContentChecksum returns the hex-encoded SHA-256 of what the file holds,
+// which for a zip archive is what is inside it rather than the archive
+// itself. A zip of a single file has the checksum of that file, so it
+// matches a loose copy; a zip of several files hashes their names and
+// checksums together. Other files, 7z archives included, have their
+// Checksum.
+func (f *File) ContentChecksum() (string, error) {
+	if !strings.EqualFold(filepath.Ext(f.Name), ".zip") {
+		return f.Checksum()
+	}
+	zr, err := zip.OpenReader(f.Absolute)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to open %s", f.Absolute)
+	}
+	defer zr.Close()
+
+	entries := make([]*zip.File, 0, len(zr.File))
+	for _, entry := range zr.File {
+		if !entry.FileInfo().IsDir() {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	sums := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sum, err := checksumEntry(entry)
+		if err != nil {
+			return "", eris.Wrapf(err, "failed to hash %s in %s", entry.Name, f.Absolute)
+		}
+		sums = append(sums, sum)
+	}
+	if len(sums) == 1 {
+		return sums[0], nil
+	}
+	h := sha256.New()
+	for i, entry := range entries {
+		fmt.Fprintf(h, "%s\x00%s\n", entry.Name, sums[i])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ContentSize returns the size of what the file holds: the uncompressed size
+// of a zip archive's contents, or the file's own size otherwise.
+func (f *File) ContentSize() (int64, error) {
+	if !strings.EqualFold(filepath.Ext(f.Name), ".zip") {
+		return f.size()
+	}
+	zr, err := zip.OpenReader(f.Absolute)
+	if err != nil {
+		return 0, eris.Wrapf(err, "failed to open %s", f.Absolute)
+	}
+	defer zr.Close()
+	var size int64
+	for _, entry := range zr.File {
+		size += int64(entry.UncompressedSize64)
+	}
+	return size, nil
+}
+
+// size returns the size recorded by the walk, or stats the file if there
+// is none.
+func (f *File) size() (int64, error) {
+	if f.Size > 0 {
+		return f.Size, nil
+	}
+	info, err := os.Stat(f.Absolute)
+	if err != nil {
+		return 0, eris.Wrapf(err, "failed to stat %s", f.Absolute)
+	}
+	return info.Size(), nil
+}
+
+func checksumEntry(entry *zip.File) (string, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
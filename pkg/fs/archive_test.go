@@ -0,0 +1,71 @@
+package fs_test
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+)
+
+var _ = Describe("Archive", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	write := func(name, content string) *fs.File {
+		p := filepath.Join(dir, name)
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		return fs.NewFile(p, time.Now())
+	}
+	zipOf := func(name string, entries map[string]string) *fs.File {
+		p := filepath.Join(dir, name)
+		out, err := os.Create(p)
+		Expect(err).NotTo(HaveOccurred())
+		zw := zip.NewWriter(out)
+		for entryName, content := range entries {
+			w, err := zw.Create(entryName)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = w.Write([]byte(content))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(zw.Close()).To(Succeed())
+		Expect(out.Close()).To(Succeed())
+		return fs.NewFile(p, time.Now())
+	}
+
+	It("recognizes zipped ROMs", func() {
+		Expect(fs.NewFile("/roms/snes/Game.zip", time.Now()).FileType).To(Equal(fs.Rom))
+		Expect(fs.NewFile("/roms/snes/Game.7z", time.Now()).FileType).To(Equal(fs.Rom))
+		Expect(fs.IsCompressed("Game.ZIP")).To(BeTrue())
+		Expect(fs.IsCompressed("Game.sfc")).To(BeFalse())
+	})
+
+	It("gives a zip of one file the checksum of that file", func() {
+		loose := write("Game.sfc", "rom")
+		zipped := zipOf("Game.zip", map[string]string{"Game.sfc": "rom"})
+
+		want, err := loose.Checksum()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zipped.ContentChecksum()).To(Equal(want))
+		Expect(zipped.Checksum()).NotTo(Equal(want))
+		Expect(zipped.ContentSize()).To(Equal(int64(3)))
+	})
+
+	It("tells zips of several files apart by their names and contents", func() {
+		a := zipOf("a.zip", map[string]string{"1.bin": "one", "2.bin": "two"})
+		b := zipOf("b.zip", map[string]string{"2.bin": "two", "1.bin": "one"})
+		c := zipOf("c.zip", map[string]string{"1.bin": "two", "2.bin": "one"})
+
+		sumA, err := a.ContentChecksum()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.ContentChecksum()).To(Equal(sumA))
+		Expect(c.ContentChecksum()).NotTo(Equal(sumA))
+	})
+})
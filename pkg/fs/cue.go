@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+const cueExt = ".cue"
+
+// parseCueSheet returns the names of the files referenced by the FILE
+// commands of a cue sheet, relative to the cue sheet's directory.
+func parseCueSheet(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open cue sheet %s", path)
+	}
+	defer f.Close()
+
+	names := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		rest, ok := strings.CutPrefix(line, "FILE ")
+		if !ok {
+			continue
+		}
+		// FILE "Game (Track 1).bin" BINARY
+		var name string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				continue
+			}
+			name = rest[1 : end+1]
+		} else {
+			name, _, _ = strings.Cut(rest, " ")
+		}
+		if name != "" {
+			names = append(names, filepath.FromSlash(name))
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read cue sheet %s", path)
+	}
+	return names, nil
+}
+
+// linkCueSheets marks the tracks referenced by each cue sheet as companions of
+// that cue sheet, so a disc image is synced as one logical ROM.
+func linkCueSheets(files []*File) error {
+	byPath := make(map[string]*File, len(files))
+	for _, f := range files {
+		byPath[f.Absolute] = f
+	}
+	for _, f := range files {
+		if !strings.EqualFold(filepath.Ext(f.Name), cueExt) {
+			continue
+		}
+		tracks, err := parseCueSheet(f.Absolute)
+		if err != nil {
+			return err
+		}
+		for _, track := range tracks {
+			// Only tracks alongside the cue sheet can be grouped with it.
+			if filepath.Base(track) != track {
+				continue
+			}
+			t, ok := byPath[filepath.Join(filepath.Dir(f.Absolute), track)]
+			if !ok || t == f || t.Parent != "" {
+				continue
+			}
+			t.FileType = f.FileType
+			t.Parent = f.Name
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 
@@ -16,19 +17,82 @@ type (
 		GetAllFiles() []*File
 		GetMatchingFiles(filetype FileType) ([]*File, error)
 		RepopulateFiles(ctx context.Context) error
+		// Walk reads the directory tree one directory at a time, calling fn
+		// with the files of each directory that has any, so a large library
+		// is never held in memory at once. It stops at the first error fn
+		// returns.
+		Walk(ctx context.Context, fn func(files []*File) error) error
+		// WalkMatching is Walk for the files GetMatchingFiles would return.
+		WalkMatching(ctx context.Context, filetype FileType, fn func(files []*File) error) error
 	}
 
 	directory struct {
 		Name     string
 		Absolute string
 		Files    []*File
+		filter   *Filter
+		types    FileTypes
+		scan     bool
+		workers  int
 	}
+
+	// listing is a directory as read by a walk: its files, and the paths of
+	// its subdirectories to walk, in order.
+	listing struct {
+		files   []*File
+		subdirs []string
+		err     error
+	}
+
+	DirectoryOption func(d *directory)
 )
 
-func NewDirectory(ctx context.Context, absolute string) (Directory, error) {
+// WithFilter restricts the files returned by GetMatchingFiles to those
+// selected by the filter.
+func WithFilter(filter *Filter) DirectoryOption {
+	return func(d *directory) {
+		d.filter = filter
+	}
+}
+
+// WithFileTypes classifies files using the given extension mapping instead
+// of the built-in one.
+func WithFileTypes(types FileTypes) DirectoryOption {
+	return func(d *directory) {
+		d.types = types
+	}
+}
+
+// WithoutScan leaves the directory unread until it is walked, or its files
+// repopulated; until then, GetAllFiles and GetMatchingFiles return nothing.
+func WithoutScan() DirectoryOption {
+	return func(d *directory) {
+		d.scan = false
+	}
+}
+
+// WithScanWorkers reads up to n directories at once while walking, for
+// libraries on slow SD cards or network mounts. The files are still passed
+// on in the order a walk one directory at a time would.
+func WithScanWorkers(n int) DirectoryOption {
+	return func(d *directory) {
+		d.workers = n
+	}
+}
+
+func NewDirectory(ctx context.Context, absolute string, opts ...DirectoryOption) (Directory, error) {
 	d := &directory{
 		Absolute: absolute,
 		Name:     filepath.Base(absolute),
+		types:    defaultFileTypes,
+		scan:     true,
+		workers:  1,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if !d.scan {
+		return d, nil
 	}
 	err := d.RepopulateFiles(ctx)
 	if err != nil {
@@ -50,9 +114,21 @@ func (d *directory) GetAllFiles() []*File {
 }
 
 func (d *directory) GetMatchingFiles(filetype FileType) ([]*File, error) {
+	return d.matching(d.Files, filetype)
+}
+
+// matching returns those of files of the type that the filter selects.
+func (d *directory) matching(files []*File, filetype FileType) ([]*File, error) {
 	matching := make([]*File, 0)
-	for _, f := range d.Files {
-		if f.FileType == filetype {
+	for _, f := range files {
+		if f.FileType != filetype {
+			continue
+		}
+		rel, err := filepath.Rel(d.Absolute, f.Absolute)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to determine relative path of %s", f.Absolute)
+		}
+		if d.filter.Match(rel) {
 			matching = append(matching, f)
 		}
 	}
@@ -62,18 +138,8 @@ func (d *directory) GetMatchingFiles(filetype FileType) ([]*File, error) {
 
 func (d *directory) RepopulateFiles(ctx context.Context) error {
 	files := make([]*File, 0)
-	err := filepath.Walk(d.Absolute, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			files = append(files, NewFile(
-				path,
-				info.ModTime(),
-			))
-		} else {
-			log.FromCtx(ctx).Sugar().Debugf("Found sub-directory %s", info.Name())
-		}
+	err := d.Walk(ctx, func(batch []*File) error {
+		files = append(files, batch...)
 		return nil
 	})
 	if err != nil {
@@ -83,3 +149,110 @@ func (d *directory) RepopulateFiles(ctx context.Context) error {
 
 	return nil
 }
+
+func (d *directory) Walk(ctx context.Context, fn func(files []*File) error) error {
+	sem := make(chan struct{}, max(d.workers, 1))
+	return d.walk(ctx, d.read(ctx, d.Absolute), sem, fn)
+}
+
+func (d *directory) WalkMatching(ctx context.Context, filetype FileType, fn func(files []*File) error) error {
+	return d.Walk(ctx, func(files []*File) error {
+		matching, err := d.matching(files, filetype)
+		if err != nil || len(matching) == 0 {
+			return err
+		}
+		return fn(matching)
+	})
+}
+
+// walk passes the files of a directory read to fn, then walks its
+// subdirectories in order. Up to as many subdirectories as sem holds are
+// read ahead at once, so fn is called in the same order regardless.
+func (d *directory) walk(ctx context.Context, l listing, sem chan struct{}, fn func(files []*File) error) error {
+	if l.err != nil {
+		return l.err
+	}
+	if len(l.files) > 0 {
+		err := fn(l.files)
+		if err != nil {
+			return err
+		}
+	}
+	pending := make([]chan listing, len(l.subdirs))
+	next := 0
+	for i, sub := range l.subdirs {
+		for ; next < len(l.subdirs) && next < i+cap(sem); next++ {
+			pending[next] = d.readAhead(ctx, l.subdirs[next], sem)
+		}
+		log.FromCtx(ctx).Sugar().Debugf("Found sub-directory %s", filepath.Base(sub))
+		err := d.walk(ctx, <-pending[i], sem, fn)
+		pending[i] = nil
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAhead reads dir in the background once sem has room for it.
+func (d *directory) readAhead(ctx context.Context, dir string, sem chan struct{}) chan listing {
+	done := make(chan listing, 1)
+	go func() {
+		sem <- struct{}{}
+		l := d.read(ctx, dir)
+		<-sem
+		done <- l
+	}()
+	return done
+}
+
+// read lists the files of dir, cue sheets linked to their tracks and
+// playlists to their discs, and the
+// subdirectories to walk, leaving out those the filter excludes whole.
+func (d *directory) read(ctx context.Context, dir string) listing {
+	if ctx.Err() != nil {
+		return listing{err: ctx.Err()}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return listing{err: eris.Wrapf(err, "failed to read directory %s", dir)}
+	}
+	l := listing{files: make([]*File, 0, len(entries)), subdirs: make([]string, 0)}
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			rel, err := filepath.Rel(d.Absolute, p)
+			if err != nil {
+				return listing{err: eris.Wrapf(err, "failed to determine relative path of %s", p)}
+			}
+			if d.filter.SkipDir(rel) {
+				log.FromCtx(ctx).Sugar().Debugf("Skipping excluded sub-directory %s", rel)
+				continue
+			}
+			l.subdirs = append(l.subdirs, p)
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted since the directory was read.
+			continue
+		}
+		if err != nil {
+			return listing{err: eris.Wrapf(err, "failed to stat %s", p)}
+		}
+		f := newFile(d.Absolute, p, info.ModTime(), d.types)
+		f.Size = info.Size()
+		l.files = append(l.files, f)
+	}
+	// Tracks and discs are only grouped with a cue sheet or playlist
+	// alongside them, so a directory at a time is enough to link them.
+	err = linkCueSheets(l.files)
+	if err != nil {
+		return listing{err: err}
+	}
+	err = linkPlaylists(l.files)
+	if err != nil {
+		return listing{err: err}
+	}
+	return l
+}
@@ -73,6 +73,26 @@ var _ = Describe("Directory", func() {
 			))
 			Expect(matchingFiles[0].Dir).To(Equal("flat"))
 		})
+
+		It("records the size of each file", func() {
+			Expect(os.WriteFile(filepath.Join(dir, "eeee.sav"), []byte("save data"), 0644)).To(Succeed())
+			d, err := fs.NewDirectory(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			saves, err := d.GetMatchingFiles(fs.Save)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saves).To(HaveLen(1))
+			Expect(saves[0].Size).To(Equal(int64(len("save data"))))
+		})
+
+		It("excludes filtered files from matching files", func() {
+			filter, err := fs.NewFilter(nil, []string{"ffff.*"})
+			Expect(err).NotTo(HaveOccurred())
+			d, err := fs.NewDirectory(ctx, dir, fs.WithFilter(filter))
+			Expect(err).NotTo(HaveOccurred())
+			matchingFiles, err := d.GetMatchingFiles(fs.Rom)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matchingFiles).To(BeEmpty())
+		})
 	})
 
 	When("subdirectories exist", func() {
@@ -135,5 +155,150 @@ var _ = Describe("Directory", func() {
 				Expect(mf.Dir).To(ContainSubstring("sub"))
 			}
 		})
+
+		It("walks one directory at a time without reading ahead", func() {
+			d, err := fs.NewDirectory(ctx, dir, fs.WithoutScan())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.GetAllFiles()).To(BeEmpty())
+
+			dirs := make([]string, 0)
+			err = d.WalkMatching(ctx, fs.Rom, func(files []*fs.File) error {
+				Expect(files).To(HaveLen(1))
+				Expect(files[0].Name).To(Equal("ffff.gb"))
+				dirs = append(dirs, files[0].Dir)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dirs).To(Equal([]string{"subA", "subB", "subC"}))
+		})
+
+		It("walks in the same order when reading directories at once", func() {
+			for _, subdir := range subDirs {
+				nested := filepath.Join(dir, subdir, "nested")
+				Expect(os.MkdirAll(nested, os.ModePerm)).To(Succeed())
+				_, err := os.Create(filepath.Join(nested, "gggg.gb"))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			d, err := fs.NewDirectory(ctx, dir, fs.WithoutScan(), fs.WithScanWorkers(3))
+			Expect(err).NotTo(HaveOccurred())
+
+			dirs := make([]string, 0)
+			err = d.WalkMatching(ctx, fs.Rom, func(files []*fs.File) error {
+				dirs = append(dirs, files[0].Dir)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dirs).To(Equal([]string{"subA", "subA/nested", "subB", "subB/nested", "subC", "subC/nested"}))
+		})
+
+		It("does not descend into excluded directories", func() {
+			filter, err := fs.NewFilter(nil, []string{"subB/**"})
+			Expect(err).NotTo(HaveOccurred())
+			d, err := fs.NewDirectory(ctx, dir, fs.WithFilter(filter))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(d.GetAllFiles()).To(HaveLen(2 * len(addedFiles)))
+			for _, f := range d.GetAllFiles() {
+				Expect(f.Dir).NotTo(Equal("subB"))
+			}
+		})
+	})
+
+	When("disc images and custom file types are present", func() {
+		var (
+			dir = filepath.Join(tempDir, "discs")
+		)
+
+		BeforeEach(func() {
+			err := os.MkdirAll(dir, os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			cue := "FILE \"Game (Track 1).bin\" BINARY\n  TRACK 01 MODE2/2352\nFILE \"Game (Track 2).bin\" BINARY\n  TRACK 02 AUDIO\n"
+			err = os.WriteFile(filepath.Join(dir, "Game.cue"), []byte(cue), 0644)
+			Expect(err).NotTo(HaveOccurred())
+			for _, file := range []string{"Game (Track 1).bin", "Game (Track 2).bin", "Other.bin", "aaaa.bak"} {
+				_, err := os.Create(filepath.Join(dir, file))
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("groups cue sheet tracks with their cue sheet", func() {
+			d, err := fs.NewDirectory(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			matchingFiles, err := d.GetMatchingFiles(fs.Rom)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matchingFiles).To(HaveLen(4))
+			sets, orphans := fs.GroupFiles(matchingFiles)
+			Expect(orphans).To(BeEmpty())
+			Expect(sets).To(HaveLen(2))
+			Expect(sets[0].Primary.Name).To(Equal("Game.cue"))
+			Expect(sets[0].Companions).To(HaveLen(2))
+			Expect(sets[1].Primary.Name).To(Equal("Other.bin"))
+			Expect(sets[1].Companions).To(BeEmpty())
+		})
+
+		It("groups a playlist's discs, and their tracks, with the playlist", func() {
+			m3u := "# Multi-disc\nGame.cue\nGame (Disc 2).chd\nmissing.chd\n"
+			Expect(os.WriteFile(filepath.Join(dir, "Game.m3u"), []byte(m3u), 0644)).To(Succeed())
+			_, err := os.Create(filepath.Join(dir, "Game (Disc 2).chd"))
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(filepath.Join(dir, "Game.m3u"))
+			defer os.Remove(filepath.Join(dir, "Game (Disc 2).chd"))
+
+			d, err := fs.NewDirectory(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			matchingFiles, err := d.GetMatchingFiles(fs.Rom)
+			Expect(err).NotTo(HaveOccurred())
+			sets, orphans := fs.GroupFiles(matchingFiles)
+			Expect(orphans).To(BeEmpty())
+			Expect(sets).To(HaveLen(2))
+			Expect(sets[0].Primary.Name).To(Equal("Game.m3u"))
+			Expect(sets[0].Companions).To(HaveLen(4))
+		})
+
+		It("uses the configured file types", func() {
+			types := fs.DefaultFileTypes()
+			types[".bak"] = fs.Save
+			d, err := fs.NewDirectory(ctx, dir, fs.WithFileTypes(types))
+			Expect(err).NotTo(HaveOccurred())
+			matchingFiles, err := d.GetMatchingFiles(fs.Save)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matchingFiles).To(HaveLen(1))
+			Expect(matchingFiles[0].Name).To(Equal("aaaa.bak"))
+		})
+	})
+
+	When("directories are nested", func() {
+		var (
+			dir = filepath.Join(tempDir, "deep")
+		)
+
+		BeforeEach(func() {
+			for _, sub := range []string{"a", "b"} {
+				subdir := filepath.Join(dir, sub, "level1", "level2")
+				err := os.MkdirAll(subdir, os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = os.Create(filepath.Join(subdir, "rom.gb"))
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("preserves the full path relative to the root", func() {
+			d, err := fs.NewDirectory(ctx, dir)
+			Expect(err).NotTo(HaveOccurred())
+			matchingFiles, err := d.GetMatchingFiles(fs.Rom)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matchingFiles).To(HaveLen(2))
+			dirs := []string{matchingFiles[0].Dir, matchingFiles[1].Dir}
+			Expect(dirs).To(ConsistOf("a/level1/level2", "b/level1/level2"))
+		})
 	})
 })
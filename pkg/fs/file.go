@@ -1,28 +1,57 @@
 package fs
 
 import (
+	"mime"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/rotisserie/eris"
 )
 
-type FileType int
+type (
+	FileType int
+
+	// FileTypes maps file extensions (including the leading ".") to FileTypes.
+	FileTypes map[string]FileType
+)
 
 const (
 	Rom FileType = iota
 	Save
 	State
 	Other
+	// Config is a RetroArch configuration file. Configs live outside the
+	// roms folder, so they are only recognized with ConfigFileTypes.
+	Config
+	// Bios is a BIOS image. BIOS files live in their own folder, so they are
+	// only recognized with BiosFileTypes.
+	Bios
+	// Screenshot is an image RetroArch wrote on request, by default next to
+	// the game. Savestate thumbnails are States, not Screenshots.
+	Screenshot
 )
 
 var (
-	suffixToFileType = map[string]FileType{
+	defaultFileTypes = FileTypes{
 		// Roms
 		".gb":  Rom,
 		".gbc": Rom,
 		".gba": Rom,
 		".smc": Rom,
+		".sfc": Rom,
 		".z64": Rom,
 		".nes": Rom,
+		".md":  Rom,
+		".pce": Rom,
+		".iso": Rom,
+		".cue": Rom,
+		".bin": Rom,
+		".chd": Rom,
+		".pbp": Rom,
+		".m3u": Rom,
+		".zip": Rom,
+		".7z":  Rom,
 		// Saves
 		".srm": Save,
 		".sav": Save,
@@ -33,38 +62,211 @@ var (
 		".state2": State,
 		".state3": State,
 		".state4": State,
+		".state5": State,
+		".state6": State,
+		".state7": State,
+		".state8": State,
+		".state9": State,
+		// Screenshots
+		".png": Screenshot,
+	}
+
+	fileTypeNames = map[FileType]string{
+		Rom:    "rom",
+		Save:   "save",
+		State:  "state",
+		Other:  "other",
+		Config: "config",
+		Bios:   "bios",
+
+		Screenshot: "screenshot",
 	}
+
+	configFileTypes = FileTypes{
+		".cfg":    Config, // retroarch.cfg and core/game overrides
+		".rmp":    Config, // input remaps
+		".opt":    Config, // core options
+		".slangp": Config, // shader presets
+		".glslp":  Config,
+		".cgp":    Config,
+	}
+
+	biosFileTypes = FileTypes{
+		".bin":  Bios,
+		".rom":  Bios,
+		".img":  Bios,
+		".zip":  Bios, // MAME and FBNeo BIOS sets, e.g. neogeo.zip
+		".bios": Bios,
+		".mx1":  Bios,
+		".mx2":  Bios,
+		".dat":  Bios,
+	}
+
+	// stateAuxSuffixes are appended to a savestate's filename by RetroArch for
+	// files that are only meaningful alongside that state, e.g. the
+	// "Game.state1.png" thumbnail of "Game.state1".
+	stateAuxSuffixes = []string{".png"}
+
+	// defaultContentType is the MIME type of files of unknown format.
+	defaultContentType = "application/octet-stream"
+
+	// autoStateSuffix marks RetroArch's automatic savestate ("Game.state.auto"),
+	// which is a complete state in its own right.
+	autoStateSuffix = ".auto"
 )
 
 type (
 	File struct {
+		// Dir is the directory containing the file, relative to the root of
+		// the Directory it was found in (e.g. "psx/multidisc/Game"), using "/"
+		// as the separator. Files directly under the root, and files created
+		// with NewFile, use the name of their immediate parent directory.
 		Dir          string
 		Absolute     string
 		Name         string
 		LastModified time.Time
-		FileType     FileType
+		// Size is the size of the file in bytes when it was found by a
+		// walk. It is zero for files made with NewFile.
+		Size     int64
+		FileType FileType
+		// Parent is the name of the file, in the same directory, that this
+		// file is only meaningful alongside: the savestate of a thumbnail,
+		// the cue sheet of a .bin track, or the playlist of a disc. It is
+		// empty for standalone files.
+		Parent string
+
+		// checksum caches the result of Checksum.
+		checksum string
 	}
 )
 
+// DefaultFileTypes returns a copy of the built-in extension mapping.
+func DefaultFileTypes() FileTypes {
+	types := make(FileTypes, len(defaultFileTypes))
+	for ext, ft := range defaultFileTypes {
+		types[ext] = ft
+	}
+	return types
+}
+
+// ConfigFileTypes returns a copy of the extension mapping for RetroArch's
+// configuration folder.
+func ConfigFileTypes() FileTypes {
+	types := make(FileTypes, len(configFileTypes))
+	for ext, ft := range configFileTypes {
+		types[ext] = ft
+	}
+	return types
+}
+
+// BiosFileTypes returns a copy of the extension mapping for the BIOS folder.
+func BiosFileTypes() FileTypes {
+	types := make(FileTypes, len(biosFileTypes))
+	for ext, ft := range biosFileTypes {
+		types[ext] = ft
+	}
+	return types
+}
+
+// ParseFileType parses the name of a FileType ("rom", "save", "state",
+// "config", "bios", "screenshot", or "other").
+func ParseFileType(name string) (FileType, error) {
+	for ft, n := range fileTypeNames {
+		if strings.EqualFold(n, name) {
+			return ft, nil
+		}
+	}
+	return Other, eris.Errorf("unknown file type %q", name)
+}
+
+func (ft FileType) String() string {
+	name, ok := fileTypeNames[ft]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
 func NewFile(absolutePath string, lastModified time.Time) *File {
-	return &File{
-		Dir:          filepath.Base(filepath.Dir(absolutePath)),
+	return newFile("", absolutePath, lastModified, defaultFileTypes)
+}
+
+func newFile(root, absolutePath string, lastModified time.Time, types FileTypes) *File {
+	name := filepath.Base(absolutePath)
+	f := &File{
+		Dir:          relativeDir(root, absolutePath),
 		Absolute:     absolutePath,
-		Name:         filepath.Base(absolutePath),
+		Name:         name,
 		LastModified: lastModified,
-		FileType:     parseFiletype(filepath.Base(absolutePath)),
+		FileType:     types.parse(name),
+	}
+	if parent, ok := types.parseStateParent(name); ok {
+		f.FileType = State
+		f.Parent = parent
+	}
+	return f
+}
+
+// relativeDir returns the directory of the file relative to root. Files
+// directly under root, or outside of it, use their parent directory's name.
+func relativeDir(root, absolutePath string) string {
+	dir := filepath.Dir(absolutePath)
+	if root == "" {
+		return filepath.Base(dir)
 	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(dir)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ContentType returns the MIME type of the file by its extension, or
+// "application/octet-stream" for the many ROM and save formats without one.
+func (f *File) ContentType() string {
+	ct := mime.TypeByExtension(filepath.Ext(f.Name))
+	if ct == "" {
+		return defaultContentType
+	}
+	return ct
 }
 
 func (f *File) IsOlderThan(other *File) bool {
 	return f.LastModified.Before(other.LastModified)
 }
 
-func parseFiletype(filename string) FileType {
-	ext := filepath.Ext(filename)
-	ft, ok := suffixToFileType[ext]
+// TypeOf returns the type a file with the given name is synced as, counting
+// savestate thumbnails as states.
+func (types FileTypes) TypeOf(filename string) FileType {
+	if _, ok := types.parseStateParent(filename); ok {
+		return State
+	}
+	return types.parse(filename)
+}
+
+func (types FileTypes) parse(filename string) FileType {
+	if base, found := strings.CutSuffix(filename, autoStateSuffix); found {
+		if types.parse(base) == State {
+			return State
+		}
+		return Other
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	ft, ok := types[ext]
 	if !ok {
 		return Other
 	}
 	return ft
 }
+
+// parseStateParent reports whether the file is an auxiliary file of a
+// savestate and, if so, the name of that savestate.
+func (types FileTypes) parseStateParent(filename string) (string, bool) {
+	for _, suffix := range stateAuxSuffixes {
+		parent, found := strings.CutSuffix(filename, suffix)
+		if found && types.parse(parent) == State {
+			return parent, true
+		}
+	}
+	return "", false
+}
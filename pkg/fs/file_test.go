@@ -28,4 +28,37 @@ var _ = Describe("File", func() {
 		}
 		Expect(files[0].IsOlderThan(files[1])).To(BeTrue())
 	})
+
+	It("guesses the MIME type from the extension", func() {
+		Expect(fs.NewFile("/roms/snes/Game.png", time.Now()).ContentType()).To(Equal("image/png"))
+		Expect(fs.NewFile("/roms/snes/Game.srm", time.Now()).ContentType()).To(Equal("application/octet-stream"))
+	})
+
+	It("recognizes RetroArch configs only with the config file types", func() {
+		types := fs.ConfigFileTypes()
+		Expect(types.TypeOf("retroarch.cfg")).To(Equal(fs.Config))
+		Expect(types.TypeOf("Super Mario World.rmp")).To(Equal(fs.Config))
+		Expect(types.TypeOf("game.srm")).To(Equal(fs.Other))
+		Expect(fs.DefaultFileTypes().TypeOf("retroarch.cfg")).To(Equal(fs.Other))
+	})
+
+	It("recognizes disc images as ROMs", func() {
+		types := fs.DefaultFileTypes()
+		for _, name := range []string{"Game.chd", "Game.iso", "Game.cue", "Game (Track 1).bin", "Game.pbp"} {
+			Expect(types.TypeOf(name)).To(Equal(fs.Rom), name)
+		}
+	})
+
+	It("recognizes BIOS files only with the BIOS file types", func() {
+		Expect(fs.BiosFileTypes().TypeOf("scph1001.bin")).To(Equal(fs.Bios))
+		Expect(fs.BiosFileTypes().TypeOf("neogeo.zip")).To(Equal(fs.Bios))
+		Expect(fs.BiosFileTypes().TypeOf("kick34005.rom")).To(Equal(fs.Bios))
+		Expect(fs.DefaultFileTypes().TypeOf("kick34005.rom")).To(Equal(fs.Other))
+	})
+
+	It("tells screenshots from savestate thumbnails", func() {
+		types := fs.DefaultFileTypes()
+		Expect(types.TypeOf("Chrono Trigger-240301-120000.png")).To(Equal(fs.Screenshot))
+		Expect(types.TypeOf("Chrono Trigger.state1.png")).To(Equal(fs.State))
+	})
 })
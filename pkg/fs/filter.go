@@ -0,0 +1,193 @@
+package fs
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// regexPrefix marks a filter pattern as a regular expression rather than a glob.
+const regexPrefix = "regex:"
+
+type (
+	// Filter selects files by their path relative to the directory being
+	// synced. A file matches if it matches any include pattern (or no include
+	// patterns are configured) and does not match any exclude pattern.
+	//
+	// Patterns are globs where "*" matches within a path segment, "**" matches
+	// across segments, and "?" matches a single character. Globs without a
+	// "/" are matched against the file name only, so "*.bak" excludes backups
+	// anywhere in the tree. Patterns prefixed with "regex:" are regular
+	// expressions matched against the full relative path.
+	//
+	// Directories excluded whole, by an exclude glob ending in "/**" such as
+	// "**/media/**", or outside the directories the filter is within, are
+	// not walked at all.
+	Filter struct {
+		include []*regexp.Regexp
+		exclude []*regexp.Regexp
+		// excludeDirs matches the directories whose every file is
+		// excluded.
+		excludeDirs []*regexp.Regexp
+		// nameOnly records which patterns apply to the file name only.
+		nameOnly map[*regexp.Regexp]bool
+		// within, if not empty, holds the only top-level directories
+		// matched.
+		within map[string]bool
+	}
+)
+
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := &Filter{nameOnly: make(map[*regexp.Regexp]bool)}
+	var err error
+	f.include, err = f.compile(include)
+	if err != nil {
+		return nil, err
+	}
+	f.exclude, err = f.compile(exclude)
+	if err != nil {
+		return nil, err
+	}
+	f.excludeDirs = excludedDirs(exclude)
+	return f, nil
+}
+
+// SkipDir reports whether nothing in the directory at the given path,
+// relative to the root of the directory being synced, can match, so it
+// needn't be read. A nil Filter skips nothing.
+func (f *Filter) SkipDir(relDir string) bool {
+	if f == nil {
+		return false
+	}
+	relDir = filepath.ToSlash(relDir)
+	if len(f.within) > 0 {
+		top, _, _ := strings.Cut(relDir, "/")
+		if !f.within[top] {
+			return true
+		}
+	}
+	for _, re := range f.excludeDirs {
+		if re.MatchString(relDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the file at the given path, relative to the root of
+// the directory, is selected by the filter. A nil Filter matches everything.
+func (f *Filter) Match(relPath string) bool {
+	if f == nil {
+		return true
+	}
+	relPath = filepath.ToSlash(relPath)
+	if len(f.within) > 0 {
+		top, _, found := strings.Cut(relPath, "/")
+		if !found || !f.within[top] {
+			return false
+		}
+	}
+	if len(f.include) > 0 && !f.matchAny(f.include, relPath) {
+		return false
+	}
+	return !f.matchAny(f.exclude, relPath)
+}
+
+// Within restricts the filter to files under the given top-level
+// directories, such as systems ("gba", "snes") of a roms folder, on top of
+// its patterns. No directories leaves it unrestricted.
+func (f *Filter) Within(dirs ...string) *Filter {
+	if len(dirs) == 0 {
+		return f
+	}
+	f.within = make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		f.within[strings.Trim(filepath.ToSlash(dir), "/")] = true
+	}
+	return f
+}
+
+func (f *Filter) matchAny(patterns []*regexp.Regexp, relPath string) bool {
+	name := relPath[strings.LastIndex(relPath, "/")+1:]
+	for _, re := range patterns {
+		target := relPath
+		if f.nameOnly[re] {
+			target = name
+		}
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) compile(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, eris.Wrapf(err, "invalid filter pattern %q", pattern)
+			}
+			compiled = append(compiled, re)
+			continue
+		}
+		re, err := regexp.Compile(globToRegex(pattern))
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid filter pattern %q", pattern)
+		}
+		if !strings.Contains(pattern, "/") {
+			f.nameOnly[re] = true
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// excludedDirs compiles the exclude globs ending in "/**" to match the
+// directories they exclude everything under. The patterns have already been
+// compiled whole, so they are known to be valid.
+func excludedDirs(patterns []string) []*regexp.Regexp {
+	dirs := make([]*regexp.Regexp, 0)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, regexPrefix) {
+			continue
+		}
+		dir, ok := strings.CutSuffix(pattern, "/**")
+		if !ok || dir == "" {
+			continue
+		}
+		dirs = append(dirs, regexp.MustCompile(globToRegex(dir)))
+	}
+	return dirs
+}
+
+// globToRegex translates a glob into an anchored regular expression.
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			i++
+			if i+1 < len(glob) && glob[i+1] == '/' {
+				// "**/" matches zero or more leading directories.
+				i++
+				b.WriteString("(.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package fs_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+)
+
+var _ = Describe("Filter", func() {
+	It("matches everything when empty", func() {
+		var filter *fs.Filter
+		Expect(filter.Match("gba/aaaa.sav")).To(BeTrue())
+		filter, err := fs.NewFilter(nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.Match("gba/aaaa.sav")).To(BeTrue())
+	})
+
+	It("applies include and exclude patterns", func() {
+		filter, err := fs.NewFilter(
+			[]string{"gba/**", "regex:^snes/.*\\.srm$"},
+			[]string{"**/media/**", "*.bak"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.Match("gba/aaaa.sav")).To(BeTrue())
+		Expect(filter.Match("gba/sub/aaaa.sav")).To(BeTrue())
+		Expect(filter.Match("snes/bbbb.srm")).To(BeTrue())
+		Expect(filter.Match("snes/bbbb.sav")).To(BeFalse())
+		Expect(filter.Match("gb/cccc.sav")).To(BeFalse())
+		Expect(filter.Match("gba/media/images/aaaa.png")).To(BeFalse())
+		Expect(filter.Match("gba/aaaa.sav.bak")).To(BeFalse())
+	})
+
+	It("restricts matches to the given top-level directories", func() {
+		filter, err := fs.NewFilter(nil, []string{"*.bak"})
+		Expect(err).NotTo(HaveOccurred())
+		filter = filter.Within("gba", "snes/")
+		Expect(filter.Match("gba/aaaa.sav")).To(BeTrue())
+		Expect(filter.Match("snes/sub/bbbb.srm")).To(BeTrue())
+		Expect(filter.Match("gb/cccc.sav")).To(BeFalse())
+		Expect(filter.Match("gba.sav")).To(BeFalse())
+		Expect(filter.Match("gba/aaaa.sav.bak")).To(BeFalse())
+	})
+
+	It("skips directories nothing under can match", func() {
+		var filter *fs.Filter
+		Expect(filter.SkipDir("gba")).To(BeFalse())
+		filter, err := fs.NewFilter(nil, []string{"**/media/**", "downloaded_media/**", "*.bak", "regex:^images/"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filter.SkipDir("gba/media")).To(BeTrue())
+		Expect(filter.SkipDir("media")).To(BeTrue())
+		Expect(filter.SkipDir("downloaded_media")).To(BeTrue())
+		Expect(filter.SkipDir("gba/downloaded_media")).To(BeFalse())
+		Expect(filter.SkipDir("gba/media.bak")).To(BeFalse())
+		Expect(filter.SkipDir("images")).To(BeFalse())
+		Expect(filter.SkipDir("gba")).To(BeFalse())
+
+		filter = filter.Within("gba")
+		Expect(filter.SkipDir("gba/sub")).To(BeFalse())
+		Expect(filter.SkipDir("snes")).To(BeTrue())
+		Expect(filter.SkipDir("snes/sub")).To(BeTrue())
+	})
+
+	It("rejects invalid regular expressions", func() {
+		_, err := fs.NewFilter(nil, []string{"regex:("})
+		Expect(err).To(HaveOccurred())
+	})
+})
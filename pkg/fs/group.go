@@ -0,0 +1,67 @@
+package fs
+
+import "path/filepath"
+
+// FileSet is a primary file together with the companion files that are only
+// meaningful alongside it, such as a savestate and its thumbnail, a cue sheet
+// and its .bin tracks, or a playlist and every disc of a multi-disc game. A
+// set is only useful when synced in full.
+type FileSet struct {
+	Primary    *File
+	Companions []*File
+}
+
+// Files returns the primary file followed by its companions.
+func (s *FileSet) Files() []*File {
+	return append([]*File{s.Primary}, s.Companions...)
+}
+
+// GroupFiles groups files into FileSets, preserving the order in which the
+// primary files appear. A companion of a companion, such as the track of a
+// cue sheet listed in a playlist, joins the set of the file at the top of
+// the chain. Companion files whose primary file is not among the files are
+// returned separately as orphans, since syncing them alone would be useless.
+func GroupFiles(files []*File) ([]*FileSet, []*File) {
+	sets := make([]*FileSet, 0)
+	byPath := make(map[string]*File, len(files))
+	setOf := make(map[*File]*FileSet)
+	for _, f := range files {
+		byPath[f.Absolute] = f
+		if f.Parent != "" {
+			continue
+		}
+		set := &FileSet{Primary: f}
+		sets = append(sets, set)
+		setOf[f] = set
+	}
+
+	orphans := make([]*File, 0)
+	for _, f := range files {
+		if f.Parent == "" {
+			continue
+		}
+		set, ok := setOf[root(f, byPath)]
+		if !ok {
+			orphans = append(orphans, f)
+			continue
+		}
+		set.Companions = append(set.Companions, f)
+	}
+	return sets, orphans
+}
+
+// root follows f's parents to the first file without one, returning nil if
+// the chain leaves files or loops.
+func root(f *File, byPath map[string]*File) *File {
+	for i := 0; i <= len(byPath); i++ {
+		if f.Parent == "" {
+			return f
+		}
+		parent, ok := byPath[filepath.Join(filepath.Dir(f.Absolute), f.Parent)]
+		if !ok {
+			return nil
+		}
+		f = parent
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package fs_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+)
+
+var _ = Describe("Group", func() {
+	It("recognizes auxiliary state files", func() {
+		thumbnail := fs.NewFile("/roms/gba/aaaa.state1.png", time.Now())
+		Expect(thumbnail.FileType).To(Equal(fs.State))
+		Expect(thumbnail.Parent).To(Equal("aaaa.state1"))
+
+		auto := fs.NewFile("/roms/gba/aaaa.state.auto", time.Now())
+		Expect(auto.FileType).To(Equal(fs.State))
+		Expect(auto.Parent).To(BeEmpty())
+
+		screenshot := fs.NewFile("/roms/gba/aaaa.png", time.Now())
+		Expect(screenshot.FileType).To(Equal(fs.Screenshot))
+	})
+
+	It("groups states with their auxiliary files", func() {
+		files := []*fs.File{
+			fs.NewFile("/roms/gba/aaaa.state", time.Now()),
+			fs.NewFile("/roms/gba/aaaa.state.png", time.Now()),
+			fs.NewFile("/roms/gbc/aaaa.state.png", time.Now()),
+			fs.NewFile("/roms/gba/bbbb.state.auto", time.Now()),
+		}
+		sets, orphans := fs.GroupFiles(files)
+		Expect(sets).To(HaveLen(2))
+		Expect(sets[0].Primary.Name).To(Equal("aaaa.state"))
+		Expect(sets[0].Companions).To(HaveLen(1))
+		Expect(sets[0].Files()).To(HaveLen(2))
+		Expect(sets[1].Primary.Name).To(Equal("bbbb.state.auto"))
+		Expect(sets[1].Companions).To(BeEmpty())
+		Expect(orphans).To(HaveLen(1))
+		Expect(orphans[0].Dir).To(Equal("gbc"))
+	})
+
+	It("groups companions of companions with the file at the top", func() {
+		playlist := fs.NewFile("/roms/psx/Game.m3u", time.Now())
+		cue := fs.NewFile("/roms/psx/Game.cue", time.Now())
+		cue.Parent = "Game.m3u"
+		track := fs.NewFile("/roms/psx/Game.bin", time.Now())
+		track.Parent = "Game.cue"
+		stray := fs.NewFile("/roms/psx/Other.bin", time.Now())
+		stray.Parent = "Other.cue"
+
+		sets, orphans := fs.GroupFiles([]*fs.File{track, cue, playlist, stray})
+		Expect(sets).To(HaveLen(1))
+		Expect(sets[0].Primary).To(Equal(playlist))
+		Expect(sets[0].Companions).To(ConsistOf(cue, track))
+		Expect(orphans).To(ConsistOf(stray))
+	})
+})
@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/rotisserie/eris"
+)
+
+// Checksum returns the hex-encoded SHA-256 of the file's contents. The file
+// is only read the first time; later calls return the same checksum.
+func (f *File) Checksum() (string, error) {
+	if f.checksum != "" {
+		return f.checksum, nil
+	}
+	sum, err := ChecksumPath(f.Absolute)
+	if err != nil {
+		return "", err
+	}
+	f.checksum = sum
+	return sum, nil
+}
+
+// ChecksumPath returns the hex-encoded SHA-256 of the contents of the file at path.
+func ChecksumPath(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to open %s", path)
+	}
+	defer file.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to hash %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
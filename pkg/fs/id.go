@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// PathID identifies the file at the given "/"-separated path the same way on
+// every device. The path is normalized to NFC, so the decomposed names macOS
+// writes match the composed ones of Linux and Windows. It is case folded,
+// letters outside ASCII included. Each run of whitespace, such as a tab or a
+// no-break space, becomes a single space, trimmed from the ends of each
+// segment. Paths with the same ID are taken to be the same file.
+func PathID(p string) string {
+	// Casers keep state, so each call needs its own.
+	fold := cases.Fold()
+	segments := strings.Split(norm.NFC.String(p), "/")
+	for i, segment := range segments {
+		segments[i] = fold.String(strings.Join(strings.FieldsFunc(segment, unicode.IsSpace), " "))
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,35 @@
+package fs_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+)
+
+var _ = Describe("PathID", func() {
+	It("matches names composed and decomposed", func() {
+		// "é" as written by Linux, and as written by macOS.
+		composed := "snes/Pokémon.srm"
+		decomposed := "snes/Pokémon.srm"
+		Expect(composed).NotTo(Equal(decomposed))
+		Expect(fs.PathID(composed)).To(Equal(fs.PathID(decomposed)))
+	})
+
+	It("ignores case, outside ASCII too", func() {
+		Expect(fs.PathID("SNES/Chrono Trigger.SRM")).To(Equal(fs.PathID("snes/chrono trigger.srm")))
+		Expect(fs.PathID("psx/ÉTÉ.srm")).To(Equal(fs.PathID("psx/été.srm")))
+	})
+
+	It("treats any run of whitespace as a single space", func() {
+		Expect(fs.PathID("snes/Chrono Trigger .srm")).To(Equal(fs.PathID("snes/Chrono Trigger .srm")))
+		Expect(fs.PathID("snes/Chrono \t Trigger.srm")).To(Equal(fs.PathID("snes/Chrono Trigger.srm")))
+		Expect(fs.PathID(" snes /Chrono Trigger.srm ")).To(Equal(fs.PathID("snes/Chrono Trigger.srm")))
+	})
+
+	It("keeps different files apart", func() {
+		Expect(fs.PathID("snes/Game 1.srm")).NotTo(Equal(fs.PathID("snes/Game1.srm")))
+		Expect(fs.PathID("snes/Game.srm")).NotTo(Equal(fs.PathID("gba/Game.srm")))
+		Expect(fs.PathID("snes/a/b.srm")).NotTo(Equal(fs.PathID("snes/a b.srm")))
+	})
+})
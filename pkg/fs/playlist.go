@@ -0,0 +1,70 @@
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+const playlistExt = ".m3u"
+
+// parsePlaylist returns the entries of an M3U playlist, relative to the
+// playlist's directory, skipping blank lines and "#" comments.
+func parsePlaylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open playlist %s", path)
+	}
+	defer f.Close()
+
+	entries := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, filepath.FromSlash(line))
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read playlist %s", path)
+	}
+	return entries, nil
+}
+
+// linkPlaylists marks the discs listed in each M3U playlist as companions of
+// that playlist, so a multi-disc game is synced as one logical ROM. A disc
+// that is a cue sheet brings its tracks along, so it must be linked after
+// linkCueSheets.
+func linkPlaylists(files []*File) error {
+	byPath := make(map[string]*File, len(files))
+	for _, f := range files {
+		byPath[f.Absolute] = f
+	}
+	for _, f := range files {
+		if !strings.EqualFold(filepath.Ext(f.Name), playlistExt) {
+			continue
+		}
+		discs, err := parsePlaylist(f.Absolute)
+		if err != nil {
+			return err
+		}
+		for _, disc := range discs {
+			// Only discs alongside the playlist can be grouped with it.
+			if filepath.Base(disc) != disc {
+				continue
+			}
+			d, ok := byPath[filepath.Join(filepath.Dir(f.Absolute), disc)]
+			if !ok || d == f || d.Parent != "" || strings.EqualFold(filepath.Ext(d.Name), playlistExt) {
+				continue
+			}
+			d.FileType = f.FileType
+			d.Parent = f.Name
+		}
+	}
+	return nil
+}
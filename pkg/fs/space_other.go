@@ -0,0 +1,12 @@
+//go:build !unix
+
+package fs
+
+import (
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+)
+
+// FreeSpace is not supported on this platform.
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.NotImplementedError
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package fs
+
+import (
+	"syscall"
+
+	"github.com/rotisserie/eris"
+)
+
+// FreeSpace returns the number of bytes available to unprivileged users on
+// the filesystem holding path.
+func FreeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, eris.Wrapf(err, "failed to stat filesystem of %s", path)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,145 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+type (
+	// Run records the outcome of a single sync.
+	Run struct {
+		ID              string    `json:"id"`
+		StartedAt       time.Time `json:"startedAt"`
+		FinishedAt      time.Time `json:"finishedAt"`
+		Status          string    `json:"status"`
+		FilesUploaded   int       `json:"filesUploaded"`
+		FilesDownloaded int       `json:"filesDownloaded"`
+		FilesSkipped    int       `json:"filesSkipped"`
+		// FilesUnchanged counts files the sync cache showed were unchanged
+		// since they were last uploaded.
+		FilesUnchanged int `json:"filesUnchanged,omitempty"`
+		// FilesFailed counts files that failed to sync without stopping
+		// the run; Failures says why.
+		FilesFailed     int           `json:"filesFailed,omitempty"`
+		BytesUploaded   int64         `json:"bytesUploaded"`
+		BytesDownloaded int64         `json:"bytesDownloaded"`
+		Errors          []string      `json:"errors,omitempty"`
+		Failures        []FileOutcome `json:"failures,omitempty"`
+		// Skips says why each of the FilesSkipped was skipped.
+		Skips []FileOutcome `json:"skips,omitempty"`
+		// Conflicts lists files last uploaded from another device that
+		// differed from this device's copy.
+		Conflicts []string `json:"conflicts,omitempty"`
+		// Connectivity is what checking the storage before using it
+		// found, e.g. "online" or "offline"; empty if it wasn't checked.
+		Connectivity string `json:"connectivity,omitempty"`
+		// DeviceID and DeviceName identify the machine the sync ran on.
+		DeviceID   string `json:"deviceId,omitempty"`
+		DeviceName string `json:"deviceName,omitempty"`
+	}
+
+	// FileOutcome is why a file was skipped or failed to sync.
+	FileOutcome struct {
+		Path   string `json:"path"`
+		Reason string `json:"reason"`
+	}
+
+	// Journal is an append-only record of sync runs, stored as one JSON
+	// object per line.
+	Journal struct {
+		path string
+	}
+)
+
+// Skip counts files as skipped for the given reason.
+func (r *Run) Skip(reason string, paths ...string) {
+	r.FilesSkipped += len(paths)
+	for _, p := range paths {
+		r.Skips = append(r.Skips, FileOutcome{Path: p, Reason: reason})
+	}
+}
+
+// Fail counts files as having failed to sync with err.
+func (r *Run) Fail(err error, paths ...string) {
+	r.FilesFailed += len(paths)
+	for _, p := range paths {
+		r.Failures = append(r.Failures, FileOutcome{Path: p, Reason: err.Error()})
+	}
+}
+
+// Duration is how long the run took.
+func (r Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Append records the run at the end of the journal.
+func (j *Journal) Append(run Run) error {
+	err := os.MkdirAll(filepath.Dir(j.path), os.ModePerm)
+	if err != nil {
+		return eris.Wrap(err, "failed to create history directory")
+	}
+	b, err := json.Marshal(run)
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal run")
+	}
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to open history %s", j.path)
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		return eris.Wrapf(err, "failed to write history %s", j.path)
+	}
+	return nil
+}
+
+// List returns up to limit of the most recent runs, newest first. A limit of
+// zero or less returns every run. Lines that cannot be parsed are skipped.
+func (j *Journal) List(limit int) ([]Run, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return []Run{}, nil
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open history %s", j.path)
+	}
+	defer f.Close()
+
+	runs := make([]Run, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		run := Run{}
+		if json.Unmarshal(scanner.Bytes(), &run) != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read history %s", j.path)
+	}
+
+	for i, k := 0, len(runs)-1; i < k; i, k = i+1, k-1 {
+		runs[i], runs[k] = runs[k], runs[i]
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
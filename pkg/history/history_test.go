@@ -0,0 +1,69 @@
+package history_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+)
+
+var _ = Describe("History", func() {
+	var (
+		dir = filepath.Join(os.TempDir(), uuid.New().String())
+	)
+
+	AfterEach(func() {
+		err := os.RemoveAll(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("is empty before any run is recorded", func() {
+		runs, err := history.NewJournal(filepath.Join(dir, "history.jsonl")).List(0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(BeEmpty())
+	})
+
+	It("lists the most recent runs first", func() {
+		journal := history.NewJournal(filepath.Join(dir, "history.jsonl"))
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			err := journal.Append(history.Run{
+				ID:            uuid.New().String(),
+				StartedAt:     start.Add(time.Duration(i) * time.Hour),
+				FinishedAt:    start.Add(time.Duration(i)*time.Hour + time.Minute),
+				Status:        history.StatusSucceeded,
+				FilesUploaded: i,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		runs, err := journal.List(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].FilesUploaded).To(Equal(2))
+		Expect(runs[1].FilesUploaded).To(Equal(1))
+		Expect(runs[0].Duration()).To(Equal(time.Minute))
+	})
+
+	It("keeps why files were skipped or failed", func() {
+		journal := history.NewJournal(filepath.Join(dir, "history.jsonl"))
+		run := history.Run{ID: uuid.New().String(), StartedAt: time.Now()}
+		run.Skip("open for writing", "/roms/snes/Game.srm", "/roms/snes/Game.png")
+		run.Fail(errors.New("access denied"), "/roms/gba/Game.sav")
+		Expect(journal.Append(run)).To(Succeed())
+
+		runs, err := journal.List(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(1))
+		Expect(runs[0].FilesSkipped).To(Equal(2))
+		Expect(runs[0].Skips[1]).To(Equal(history.FileOutcome{Path: "/roms/snes/Game.png", Reason: "open for writing"}))
+		Expect(runs[0].FilesFailed).To(Equal(1))
+		Expect(runs[0].Failures).To(Equal([]history.FileOutcome{{Path: "/roms/gba/Game.sav", Reason: "access denied"}}))
+	})
+})
@@ -0,0 +1,23 @@
+package library
+
+// requiredBios lists, for systems that can't run without one, the BIOS files
+// any one of which makes the system playable. Paths are relative to the BIOS
+// folder and compared case-insensitively.
+var requiredBios = map[string][]string{
+	"psx":          {"scph1001.bin", "scph5500.bin", "scph5501.bin", "scph5502.bin", "scph7001.bin", "scph101.bin", "psxonpsp660.bin"},
+	"segacd":       {"bios_CD_U.bin", "bios_CD_E.bin", "bios_CD_J.bin"},
+	"saturn":       {"saturn_bios.bin", "sega_101.bin", "mpr-17933.bin"},
+	"dreamcast":    {"dc/dc_boot.bin", "dc_boot.bin"},
+	"neogeo":       {"neogeo.zip"},
+	"pcenginecd":   {"syscard3.pce"},
+	"fds":          {"disksys.rom"},
+	"lynx":         {"lynxboot.img"},
+	"atari5200":    {"5200.rom"},
+	"colecovision": {"colecovision.rom", "coleco.rom"},
+}
+
+// RequiredBios returns the BIOS files, any one of which the system needs, or
+// nil if the system runs without one.
+func RequiredBios(system string) []string {
+	return requiredBios[system]
+}
@@ -0,0 +1,24 @@
+package library
+
+import (
+	"os"
+
+	"github.com/rotisserie/eris"
+)
+
+// Hardlink replaces the file at dup with a hard link to keep, so both names
+// share one copy on disk. dup is only replaced once the link exists, so a
+// failure leaves it untouched.
+func Hardlink(keep, dup string) error {
+	tmp := dup + ".dedupe"
+	err := os.Link(keep, tmp)
+	if err != nil {
+		return eris.Wrapf(err, "failed to link %s to %s", dup, keep)
+	}
+	err = os.Rename(tmp, dup)
+	if err != nil {
+		os.Remove(tmp)
+		return eris.Wrapf(err, "failed to replace %s", dup)
+	}
+	return nil
+}
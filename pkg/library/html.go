@@ -0,0 +1,50 @@
+package library
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/rotisserie/eris"
+)
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": progress.FormatBytes,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ROM library report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.warn { color: #b00; }
+</style>
+</head>
+<body>
+<h1>ROM library report</h1>
+<p>{{.TotalFiles}} files, {{bytes .TotalBytes}}, generated {{.GeneratedAt.Format "2006-01-02 15:04"}}</p>
+<table>
+<tr><th>System</th><th>ROMs</th><th>Saves</th><th>States</th><th>Screenshots</th><th>Size</th><th>BIOS</th></tr>
+{{range .Systems}}<tr><td>{{.System}}</td><td>{{.Roms}}</td><td>{{.Saves}}</td><td>{{.States}}</td><td>{{.Screenshots}}</td><td>{{bytes .Bytes}}</td>
+<td>{{if .MissingBios}}<span class="warn">{{.Unplayable}} unplayable; needs one of {{range $i, $b := .MissingBios}}{{if $i}}, {{end}}{{$b}}{{end}}</span>{{else}}ok{{end}}</td></tr>
+{{end}}</table>
+<h2>Duplicates</h2>
+{{if .Duplicates}}<table>
+<tr><th>Files</th><th>Size</th></tr>
+{{range .Duplicates}}<tr><td>{{range $i, $p := .Paths}}{{if $i}}<br>{{end}}{{$p}}{{end}}</td><td>{{bytes .Size}}</td></tr>
+{{end}}</table>{{else}}<p>None</p>{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders the report as a standalone HTML page.
+func (r Report) WriteHTML(w io.Writer) error {
+	err := htmlTemplate.Execute(w, r)
+	if err != nil {
+		return eris.Wrap(err, "failed to render report")
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// Report summarizes a ROM library.
+	Report struct {
+		GeneratedAt time.Time       `json:"generatedAt"`
+		Systems     []SystemSummary `json:"systems"`
+		Duplicates  []Duplicate     `json:"duplicates"`
+		TotalFiles  int             `json:"totalFiles"`
+		TotalBytes  int64           `json:"totalBytes"`
+	}
+
+	// SystemSummary describes the files of one system, i.e. one top-level
+	// folder of the library. When the system needs a BIOS that is missing,
+	// MissingBios lists the files any one of which would fix it, and
+	// Unplayable counts the ROMs that can't run until then.
+	SystemSummary struct {
+		System      string   `json:"system"`
+		Roms        int      `json:"roms"`
+		Saves       int      `json:"saves"`
+		States      int      `json:"states"`
+		Screenshots int      `json:"screenshots"`
+		Bytes       int64    `json:"bytes"`
+		MissingBios []string `json:"missingBios,omitempty"`
+		Unplayable  int      `json:"unplayable,omitempty"`
+	}
+
+	// Duplicate is a set of byte-identical files, or of files holding the
+	// same contents when found by FindContentDuplicates.
+	Duplicate struct {
+		SHA256 string   `json:"sha256"`
+		Size   int64    `json:"size"`
+		Paths  []string `json:"paths"`
+	}
+)
+
+// Build summarizes the files, which are grouped into systems by the first
+// folder of their Dir. bios lists the paths, relative to the BIOS folder, of
+// the BIOS files present. ROMs are hashed to find duplicates.
+func Build(ctx context.Context, files []*fs.File, bios []string) (Report, error) {
+	present := make(map[string]bool, len(bios))
+	for _, b := range bios {
+		present[strings.ToLower(b)] = true
+	}
+
+	report := Report{GeneratedAt: clock.Now(ctx)}
+	bySystem := make(map[string]*SystemSummary)
+	roms := make([]*fs.File, 0)
+	for _, f := range files {
+		system, _, _ := strings.Cut(f.Dir, "/")
+		summary, ok := bySystem[system]
+		if !ok {
+			summary = &SystemSummary{System: system, MissingBios: missingBios(system, present)}
+			bySystem[system] = summary
+		}
+		size, err := fileSize(f)
+		if err != nil {
+			return Report{}, err
+		}
+		summary.Bytes += size
+		report.TotalBytes += size
+		report.TotalFiles++
+		switch f.FileType {
+		case fs.Rom:
+			summary.Roms++
+			roms = append(roms, f)
+			if len(summary.MissingBios) > 0 {
+				summary.Unplayable++
+			}
+		case fs.Save:
+			summary.Saves++
+		case fs.State:
+			summary.States++
+		case fs.Screenshot:
+			summary.Screenshots++
+		}
+	}
+	for _, summary := range bySystem {
+		report.Systems = append(report.Systems, *summary)
+	}
+	sort.Slice(report.Systems, func(i, j int) bool {
+		return report.Systems[i].System < report.Systems[j].System
+	})
+
+	duplicates, err := FindDuplicates(roms)
+	if err != nil {
+		return Report{}, err
+	}
+	report.Duplicates = duplicates
+	return report, nil
+}
+
+func missingBios(system string, present map[string]bool) []string {
+	required := RequiredBios(system)
+	for _, b := range required {
+		if present[strings.ToLower(b)] {
+			return nil
+		}
+	}
+	return required
+}
+
+// FindDuplicates returns the sets of byte-identical files, largest first.
+// Only files sharing a size are hashed.
+func FindDuplicates(files []*fs.File) ([]Duplicate, error) {
+	return findDuplicates(files, fileSize, (*fs.File).Checksum)
+}
+
+// FindContentDuplicates is FindDuplicates comparing what zip archives hold
+// rather than the archives themselves, so a zipped ROM matches a loose copy
+// or another zip of it. Sizes are those of the contents.
+func FindContentDuplicates(files []*fs.File) ([]Duplicate, error) {
+	return findDuplicates(files, (*fs.File).ContentSize, (*fs.File).ContentChecksum)
+}
+
+func findDuplicates(files []*fs.File, sizeOf func(*fs.File) (int64, error), checksum func(*fs.File) (string, error)) ([]Duplicate, error) {
+	bySize := make(map[int64][]*fs.File)
+	for _, f := range files {
+		size, err := sizeOf(f)
+		if err != nil {
+			return nil, err
+		}
+		bySize[size] = append(bySize[size], f)
+	}
+
+	duplicates := make([]Duplicate, 0)
+	for size, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, f := range candidates {
+			sum, err := checksum(f)
+			if err != nil {
+				return nil, err
+			}
+			byHash[sum] = append(byHash[sum], path.Join(f.Dir, f.Name))
+		}
+		for sum, paths := range byHash {
+			if len(paths) < 2 {
+				continue
+			}
+			sort.Strings(paths)
+			duplicates = append(duplicates, Duplicate{SHA256: sum, Size: size, Paths: paths})
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Size != duplicates[j].Size {
+			return duplicates[i].Size > duplicates[j].Size
+		}
+		return duplicates[i].Paths[0] < duplicates[j].Paths[0]
+	})
+	return duplicates, nil
+}
+
+func fileSize(f *fs.File) (int64, error) {
+	if f.Size > 0 {
+		return f.Size, nil
+	}
+	info, err := os.Stat(f.Absolute)
+	if err != nil {
+		return 0, eris.Wrapf(err, "failed to stat %s", f.Absolute)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,138 @@
+package library_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/library"
+)
+
+var _ = Describe("Build", func() {
+	var (
+		ctx  context.Context
+		now  time.Time
+		root string
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		ctx = clock.ToCtx(context.Background(), clock.NewFake(now))
+		root = GinkgoT().TempDir()
+	})
+
+	file := func(rel, content string) *fs.File {
+		p := filepath.Join(root, rel)
+		Expect(os.MkdirAll(filepath.Dir(p), 0755)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		f := fs.NewFile(p, time.Now())
+		f.Dir = filepath.ToSlash(filepath.Dir(rel))
+		return f
+	}
+
+	It("summarizes each system", func() {
+		files := []*fs.File{
+			file("snes/Chrono Trigger.sfc", "rom"),
+			file("snes/Chrono Trigger.srm", "save!"),
+			file("psx/Crash.cue", "cue"),
+		}
+		report, err := library.Build(ctx, files, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.GeneratedAt).To(Equal(now))
+		Expect(report.TotalFiles).To(Equal(3))
+		Expect(report.TotalBytes).To(Equal(int64(11)))
+		Expect(report.Systems).To(HaveLen(2))
+
+		psx := report.Systems[0]
+		Expect(psx.System).To(Equal("psx"))
+		Expect(psx.Roms).To(Equal(1))
+		Expect(psx.MissingBios).To(ContainElement("scph1001.bin"))
+		Expect(psx.Unplayable).To(Equal(1))
+
+		snes := report.Systems[1]
+		Expect(snes.Roms).To(Equal(1))
+		Expect(snes.Saves).To(Equal(1))
+		Expect(snes.Bytes).To(Equal(int64(8)))
+		Expect(snes.MissingBios).To(BeEmpty())
+	})
+
+	It("accepts any one of a system's BIOS files", func() {
+		report, err := library.Build(ctx, []*fs.File{file("psx/Crash.cue", "cue")}, []string{"SCPH5501.BIN"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Systems[0].MissingBios).To(BeEmpty())
+		Expect(report.Systems[0].Unplayable).To(BeZero())
+	})
+
+	It("finds byte-identical ROMs", func() {
+		files := []*fs.File{
+			file("snes/Mario.sfc", "same"),
+			file("snes/hacks/Mario (copy).sfc", "same"),
+			file("snes/Zelda.sfc", "diff"),
+		}
+		report, err := library.Build(ctx, files, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Duplicates).To(HaveLen(1))
+		Expect(report.Duplicates[0].Paths).To(Equal([]string{"snes/Mario.sfc", "snes/hacks/Mario (copy).sfc"}))
+		Expect(report.Duplicates[0].Size).To(Equal(int64(4)))
+	})
+
+	It("finds zipped copies of loose ROMs by their contents", func() {
+		p := filepath.Join(root, "snes/Mario.zip")
+		Expect(os.MkdirAll(filepath.Dir(p), 0755)).To(Succeed())
+		out, err := os.Create(p)
+		Expect(err).NotTo(HaveOccurred())
+		zw := zip.NewWriter(out)
+		w, err := zw.Create("Mario.sfc")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("same"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		Expect(out.Close()).To(Succeed())
+		zipped := fs.NewFile(p, time.Now())
+		zipped.Dir = "snes"
+		files := []*fs.File{file("snes/Mario.sfc", "same"), zipped}
+
+		duplicates, err := library.FindDuplicates(files)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(duplicates).To(BeEmpty())
+
+		duplicates, err = library.FindContentDuplicates(files)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(duplicates).To(HaveLen(1))
+		Expect(duplicates[0].Paths).To(Equal([]string{"snes/Mario.sfc", "snes/Mario.zip"}))
+		Expect(duplicates[0].Size).To(Equal(int64(4)))
+	})
+
+	It("renders HTML", func() {
+		report, err := library.Build(ctx, []*fs.File{file("snes/<b>.sfc", "rom")}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		out := &bytes.Buffer{}
+		Expect(report.WriteHTML(out)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("<td>snes</td>"))
+	})
+})
+
+var _ = Describe("Hardlink", func() {
+	It("makes both names share one file", func() {
+		dir := GinkgoT().TempDir()
+		keep := filepath.Join(dir, "Mario.sfc")
+		dup := filepath.Join(dir, "Mario (copy).sfc")
+		Expect(os.WriteFile(keep, []byte("same"), 0644)).To(Succeed())
+		Expect(os.WriteFile(dup, []byte("same"), 0644)).To(Succeed())
+
+		Expect(library.Hardlink(keep, dup)).To(Succeed())
+		keepInfo, err := os.Stat(keep)
+		Expect(err).NotTo(HaveOccurred())
+		dupInfo, err := os.Stat(dup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.SameFile(keepInfo, dupInfo)).To(BeTrue())
+	})
+})
@@ -0,0 +1,154 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// unreadableGrace is how long an unreadable lockfile is still treated as
+// held, so a lock being written by a process of an older version isn't
+// broken before its owner is recorded.
+const unreadableGrace = 10 * time.Second
+
+type (
+	// Lock is an exclusive, cross-process lock held by creating a lockfile.
+	Lock struct {
+		path  string
+		owner []byte
+	}
+
+	// Owner describes the process holding a lock.
+	Owner struct {
+		PID        int       `json:"pid"`
+		Hostname   string    `json:"hostname"`
+		AcquiredAt time.Time `json:"acquiredAt"`
+	}
+)
+
+// Acquire takes the lock at path, failing with errors.LockedError if another
+// live process holds it. A lock is stale, and taken over, if the process that
+// took it on this host has exited, or if it was taken more than staleAfter ago
+// (on any host). A zero staleAfter never expires a lock by age.
+//
+// The owner is written to a temporary file that is then linked into place,
+// so the lockfile never exists without its owner.
+func Acquire(ctx context.Context, path string, staleAfter time.Duration) (*Lock, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create lock directory")
+	}
+	hostname, _ := os.Hostname()
+	now := clock.Now(ctx)
+	owner := Owner{PID: os.Getpid(), Hostname: hostname, AcquiredAt: now}
+	b, err := json.Marshal(owner)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to marshal lock owner")
+	}
+	tmp, err := writeTemp(path, b)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	// A second attempt follows removing a stale lock; if another process
+	// takes the lock in between, that process wins.
+	for attempt := 0; attempt < 2; attempt++ {
+		err = os.Link(tmp, path)
+		if err == nil {
+			return &Lock{path: path, owner: b}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, eris.Wrap(err, "failed to create lock")
+		}
+
+		current, err := ReadOwner(path)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			info, err := os.Stat(path)
+			if err == nil && now.Sub(info.ModTime()) < unreadableGrace {
+				return nil, eris.Wrap(errors.LockedError, "lockfile is being written by another process")
+			}
+		} else if !current.stale(now, hostname, staleAfter) {
+			return nil, eris.Wrapf(errors.LockedError, "held by pid %d on %s since %s",
+				current.PID, current.Hostname, current.AcquiredAt.Format(time.RFC3339))
+		}
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, eris.Wrap(err, "failed to remove stale lock")
+		}
+	}
+	return nil, eris.Wrap(errors.LockedError, "lock was taken by another process")
+}
+
+// writeTemp writes the owner to a new file beside the lockfile at path.
+func writeTemp(path string, owner []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", eris.Wrap(err, "failed to create lock")
+	}
+	_, err = f.Write(owner)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", eris.Wrap(err, "failed to write lock")
+	}
+	return f.Name(), nil
+}
+
+// ReadOwner returns the owner of the lock at path, or nil if it isn't held.
+// An unreadable lockfile, e.g. one left half-written by a crash, is reported
+// as held by nobody; Acquire only breaks one after a grace period.
+func ReadOwner(path string) (*Owner, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read lock")
+	}
+	owner := &Owner{}
+	if json.Unmarshal(b, owner) != nil {
+		return nil, nil
+	}
+	return owner, nil
+}
+
+func (o *Owner) stale(now time.Time, hostname string, staleAfter time.Duration) bool {
+	if staleAfter > 0 && now.Sub(o.AcquiredAt) > staleAfter {
+		return true
+	}
+	return o.Hostname == hostname && !processAlive(o.PID)
+}
+
+// Release gives up the lock. A lock taken over by another process, e.g.
+// after this one was judged stale, is left to its new owner.
+func (l *Lock) Release() error {
+	b, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return eris.Wrap(err, "failed to release lock")
+	}
+	if !bytes.Equal(b, l.owner) {
+		return eris.Wrap(errors.LockedError, "lock was taken over by another process")
+	}
+	err = os.Remove(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return eris.Wrap(err, "failed to release lock")
+	}
+	return nil
+}
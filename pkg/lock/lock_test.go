@@ -0,0 +1,107 @@
+package lock_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/lock"
+)
+
+var _ = Describe("Lock", func() {
+	var (
+		ctx  context.Context
+		now  *clock.Fake
+		path string
+	)
+
+	BeforeEach(func() {
+		now = clock.NewFake(time.Now())
+		ctx = clock.ToCtx(context.Background(), now)
+		path = filepath.Join(GinkgoT().TempDir(), "state", "sync.lock")
+	})
+
+	writeOwner := func(owner lock.Owner) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		b, err := json.Marshal(owner)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, b, 0644)).To(Succeed())
+	}
+
+	It("is exclusive until released", func() {
+		l, err := lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		owner, err := lock.ReadOwner(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.PID).To(Equal(os.Getpid()))
+
+		_, err = lock.Acquire(ctx, path, 0)
+		Expect(err).To(MatchError(errors.LockedError))
+
+		Expect(l.Release()).To(Succeed())
+		l, err = lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Release()).To(Succeed())
+	})
+
+	It("takes over a lock whose process has exited", func() {
+		hostname, _ := os.Hostname()
+		writeOwner(lock.Owner{PID: 1 << 30, Hostname: hostname, AcquiredAt: now.Now()})
+		l, err := lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Release()).To(Succeed())
+	})
+
+	It("takes over a lock older than staleAfter", func() {
+		writeOwner(lock.Owner{PID: 1, Hostname: "other-pi", AcquiredAt: now.Now()})
+		_, err := lock.Acquire(ctx, path, time.Hour)
+		Expect(err).To(MatchError(errors.LockedError))
+
+		now.Advance(2 * time.Hour)
+		_, err = lock.Acquire(ctx, path, 0)
+		Expect(err).To(MatchError(errors.LockedError))
+		l, err := lock.Acquire(ctx, path, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Release()).To(Succeed())
+	})
+
+	It("leaves only the lockfile behind", func() {
+		l, err := lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		entries, err := os.ReadDir(filepath.Dir(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("sync.lock"))
+		Expect(l.Release()).To(Succeed())
+	})
+
+	It("breaks an unreadable lock only after a grace period", func() {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+		_, err := lock.Acquire(ctx, path, 0)
+		Expect(err).To(MatchError(errors.LockedError))
+
+		now.Advance(time.Minute)
+		l, err := lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Release()).To(Succeed())
+	})
+
+	It("doesn't release a lock taken over by another process", func() {
+		l, err := lock.Acquire(ctx, path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		writeOwner(lock.Owner{PID: 1, Hostname: "other-pi", AcquiredAt: now.Now()})
+
+		Expect(l.Release()).To(MatchError(errors.LockedError))
+		owner, err := lock.ReadOwner(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.Hostname).To(Equal("other-pi"))
+	})
+})
@@ -2,13 +2,50 @@ package log
 
 import (
 	"context"
+	"os"
+	"strings"
 
+	"github.com/rotisserie/eris"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type loggerKey struct{}
 
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+type (
+	// Config controls how log lines are written. Level is one of debug,
+	// info (the default), warn, or error. Format is "console" (the default)
+	// or "json". Output is "stdout" (the default) or "stderr". When
+	// File.Path is set, log lines are also written to that file.
+	Config struct {
+		Level  string
+		Format string
+		Output string
+		File   FileConfig
+	}
+
+	// FileConfig describes a log file that is rotated once it reaches
+	// MaxSizeMB megabytes (default 10). Up to MaxBackups rotated files are
+	// kept, for at most MaxAgeDays days; zero keeps them all. Rotated files
+	// are gzipped when Compress is set.
+	FileConfig struct {
+		Path       string
+		MaxSizeMB  int
+		MaxBackups int
+		MaxAgeDays int
+		Compress   bool
+	}
+)
+
 var (
 	defaultLogger *zap.Logger
 )
@@ -26,27 +63,80 @@ func ToCtx(ctx context.Context, logger *zap.Logger) context.Context {
 	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
+// SetDefault replaces the logger returned by FromCtx for contexts without one.
+func SetDefault(logger *zap.Logger) {
+	defaultLogger = logger
+}
+
 func init() {
-	cfg := zap.Config{
-		Encoding:         "console",
-		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
-		OutputPaths:      []string{"stdout"},
-		ErrorOutputPaths: []string{"stderr"},
-		EncoderConfig: zapcore.EncoderConfig{
-			// Customize the encoder configuration as needed
-			MessageKey:     "msg",
-			LevelKey:       "level",
-			TimeKey:        "time",
-			NameKey:        "logger",
-			CallerKey:      "caller",
-			StacktraceKey:  "stacktrace",
-			LineEnding:     zapcore.DefaultLineEnding,
-			EncodeLevel:    zapcore.CapitalLevelEncoder,
-			EncodeTime:     zapcore.ISO8601TimeEncoder,
-			EncodeDuration: zapcore.SecondsDurationEncoder,
-			EncodeCaller:   zapcore.ShortCallerEncoder,
-		},
-	}
-
-	defaultLogger, _ = cfg.Build()
+	defaultLogger, _ = New(Config{})
+}
+
+// New builds a logger from the given configuration.
+func New(cfg Config) (*zap.Logger, error) {
+	level := zapcore.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		level, err = zapcore.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid log level %q", cfg.Level)
+		}
+	}
+
+	encoderCfg := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		LevelKey:       "level",
+		TimeKey:        "time",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.SecondsDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+	var encoder zapcore.Encoder
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatConsole:
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	case FormatJSON:
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	default:
+		return nil, eris.Errorf("invalid log format %q", cfg.Format)
+	}
+
+	var out zapcore.WriteSyncer
+	switch strings.ToLower(cfg.Output) {
+	case "", OutputStdout:
+		out = zapcore.Lock(os.Stdout)
+	case OutputStderr:
+		out = zapcore.Lock(os.Stderr)
+	default:
+		return nil, eris.Errorf("invalid log output %q", cfg.Output)
+	}
+	if cfg.File.Path != "" {
+		out = zapcore.NewMultiWriteSyncer(out, zapcore.AddSync(cfg.File.rotator()))
+	}
+
+	core := zapcore.NewCore(encoder, out, zap.NewAtomicLevelAt(level))
+	return zap.New(core,
+		zap.AddCaller(),
+		zap.AddStacktrace(zapcore.ErrorLevel),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+	), nil
+}
+
+func (c FileConfig) rotator() *lumberjack.Logger {
+	maxSize := c.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = 10
+	}
+	return &lumberjack.Logger{
+		Filename:   c.Path,
+		MaxSize:    maxSize,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAgeDays,
+		Compress:   c.Compress,
+	}
 }
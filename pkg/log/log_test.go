@@ -0,0 +1,52 @@
+package log_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+)
+
+var _ = Describe("Log", func() {
+	var (
+		dir = filepath.Join(os.TempDir(), uuid.New().String())
+	)
+
+	AfterEach(func() {
+		err := os.RemoveAll(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("writes to the log file at the configured level and format", func() {
+		path := filepath.Join(dir, "syncer.log")
+		logger, err := log.New(log.Config{
+			Level:  "warn",
+			Format: log.FormatJSON,
+			Output: log.OutputStderr,
+			File:   log.FileConfig{Path: path},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		logger.Info("hidden")
+		logger.Warn("shown")
+		_ = logger.Sync()
+
+		b, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).NotTo(ContainSubstring("hidden"))
+		Expect(string(b)).To(ContainSubstring(`"msg":"shown"`))
+	})
+
+	DescribeTable("rejects invalid configuration",
+		func(cfg log.Config) {
+			_, err := log.New(cfg)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("level", log.Config{Level: "loud"}),
+		Entry("format", log.Config{Format: "xml"}),
+		Entry("output", log.Config{Output: "/dev/null"}),
+	)
+})
@@ -0,0 +1,184 @@
+package manifest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// Filename is the name under which manifests are stored.
+	Filename = "manifest.json"
+
+	version = 1
+)
+
+var (
+	InvalidSignatureError = eris.New("manifest signature is invalid")
+	UnsignedError         = eris.New("manifest is not signed")
+)
+
+type (
+	// Manifest records the state of a library at the time of a sync: every
+	// file's path relative to the library root, its size, and its checksum.
+	// A signed manifest carries an HMAC-SHA256 of its contents.
+	Manifest struct {
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"createdAt"`
+		Entries   []Entry   `json:"entries"`
+		Signature string    `json:"signature,omitempty"`
+	}
+
+	Entry struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+
+	// Report describes how a directory differs from a manifest.
+	Report struct {
+		Verified   int      `json:"verified"`
+		Missing    []string `json:"missing"`
+		Mismatched []string `json:"mismatched"`
+	}
+)
+
+// Build creates a manifest for the files, which must live under root.
+func Build(root string, files []*fs.File, createdAt time.Time) (*Manifest, error) {
+	m := &Manifest{
+		Version:   version,
+		CreatedAt: createdAt.UTC(),
+		Entries:   make([]Entry, 0, len(files)),
+	}
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Absolute)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to determine relative path of %s", f.Absolute)
+		}
+		info, err := os.Stat(f.Absolute)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to stat %s", f.Absolute)
+		}
+		sum, err := f.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, Entry{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			SHA256: sum,
+		})
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+	return m, nil
+}
+
+// Sign sets the manifest's signature using the key.
+func (m *Manifest) Sign(key []byte) error {
+	sig, err := m.signature(key)
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+// VerifySignature checks the manifest's signature against the key.
+func (m *Manifest) VerifySignature(key []byte) error {
+	if m.Signature == "" {
+		return UnsignedError
+	}
+	expected, err := m.signature(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(m.Signature)) {
+		return InvalidSignatureError
+	}
+	return nil
+}
+
+func (m *Manifest) signature(key []byte) (string, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to marshal manifest")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Check verifies that every file in the manifest exists under root with the
+// recorded size and checksum.
+func (m *Manifest) Check(root string) (*Report, error) {
+	report := &Report{}
+	for _, e := range m.Entries {
+		path := filepath.Join(root, filepath.FromSlash(e.Path))
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, e.Path)
+			continue
+		}
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to stat %s", path)
+		}
+		if info.Size() != e.Size {
+			report.Mismatched = append(report.Mismatched, e.Path)
+			continue
+		}
+		sum, err := fs.ChecksumPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if sum != e.SHA256 {
+			report.Mismatched = append(report.Mismatched, e.Path)
+			continue
+		}
+		report.Verified++
+	}
+	return report, nil
+}
+
+// OK reports whether the checked directory fully matched the manifest.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// Write saves the manifest as JSON to path.
+func (m *Manifest) Write(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal manifest")
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write manifest %s", path)
+	}
+	return nil
+}
+
+// Read loads a manifest from a JSON file.
+func Read(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read manifest %s", path)
+	}
+	m := &Manifest{}
+	err = json.Unmarshal(b, m)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to parse manifest %s", path)
+	}
+	return m, nil
+}
@@ -0,0 +1,75 @@
+package manifest_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/manifest"
+)
+
+var _ = Describe("Manifest", func() {
+	var (
+		root  = filepath.Join(os.TempDir(), uuid.New().String())
+		key   = []byte("secret")
+		files []*fs.File
+	)
+
+	BeforeEach(func() {
+		files = nil
+		for name, contents := range map[string]string{
+			"gba/aaaa.sav":  "save data",
+			"gb/bbbb.state": "state data",
+		} {
+			path := filepath.Join(root, name)
+			err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+			Expect(err).NotTo(HaveOccurred())
+			err = os.WriteFile(path, []byte(contents), 0644)
+			Expect(err).NotTo(HaveOccurred())
+			files = append(files, fs.NewFile(path, time.Now()))
+		}
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(root)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("round-trips a signed manifest", func() {
+		m, err := manifest.Build(root, files, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Entries).To(HaveLen(2))
+		Expect(m.Entries[0].Path).To(Equal("gb/bbbb.state"))
+		Expect(m.Sign(key)).To(Succeed())
+
+		path := filepath.Join(root, manifest.Filename)
+		Expect(m.Write(path)).To(Succeed())
+		read, err := manifest.Read(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read.VerifySignature(key)).To(Succeed())
+		Expect(read.VerifySignature([]byte("wrong"))).To(MatchError(manifest.InvalidSignatureError))
+	})
+
+	It("reports missing and mismatched files", func() {
+		m, err := manifest.Build(root, files, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := m.Check(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.OK()).To(BeTrue())
+		Expect(report.Verified).To(Equal(2))
+
+		Expect(os.Remove(filepath.Join(root, "gba", "aaaa.sav"))).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "gb", "bbbb.state"), []byte("STATE DATA"), 0644)).To(Succeed())
+		report, err = m.Check(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.OK()).To(BeFalse())
+		Expect(report.Missing).To(ConsistOf("gba/aaaa.sav"))
+		Expect(report.Mismatched).To(ConsistOf("gb/bbbb.state"))
+	})
+})
@@ -0,0 +1,156 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/rotisserie/eris"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	latestBucket   = []byte("latest")
+	versionsBucket = []byte("versions")
+)
+
+// openTimeout bounds how long to wait for another process holding the
+// database, e.g. a daemon sync while 'syncer sync' is run by hand.
+const openTimeout = 5 * time.Second
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+var _ Store = &boltStore{}
+
+// NewBoltStore opens, or creates, a metadata store in a single bbolt file.
+// bbolt is pure Go and needs no server, which suits a Raspberry Pi.
+func NewBoltStore(path string) (Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create metadata directory")
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to open metadata store %s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{latestBucket, versionsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, eris.Wrap(err, "failed to initialize metadata store")
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) StoreFileMetadata(ctx context.Context, md FileMetadata) error {
+	if md.UploadedAt.IsZero() {
+		md.UploadedAt = clock.Now(ctx)
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal file metadata")
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(latestBucket).Put([]byte(md.Path), b)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(versionsBucket).Put(versionKey(md.Path, md.UploadedAt), b)
+	})
+	if err != nil {
+		return eris.Wrapf(err, "failed to store metadata for %s", md.Path)
+	}
+	return nil
+}
+
+func (s *boltStore) GetFileMetadata(ctx context.Context, path string) (*FileMetadata, error) {
+	var md *FileMetadata
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(latestBucket).Get([]byte(path))
+		if b == nil {
+			return nil
+		}
+		md = &FileMetadata{}
+		return json.Unmarshal(b, md)
+	})
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to get metadata for %s", path)
+	}
+	return md, nil
+}
+
+func (s *boltStore) ListVersions(ctx context.Context, path string) ([]FileMetadata, error) {
+	versions := make([]FileMetadata, 0)
+	prefix := versionPrefix(path)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(versionsBucket).Cursor()
+		// Seek past the newest possible version of path, then walk back.
+		k, v := c.Seek(append(prefix, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			md := FileMetadata{}
+			err := json.Unmarshal(v, &md)
+			if err != nil {
+				return err
+			}
+			versions = append(versions, md)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to list versions of %s", path)
+	}
+	return versions, nil
+}
+
+func (s *boltStore) ListFiles(ctx context.Context) ([]FileMetadata, error) {
+	files := make([]FileMetadata, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(latestBucket).ForEach(func(k, v []byte) error {
+			md := FileMetadata{}
+			err := json.Unmarshal(v, &md)
+			if err != nil {
+				return err
+			}
+			files = append(files, md)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to list files")
+	}
+	return files, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// versionKey sorts a file's versions together, oldest first: the path, a
+// NUL separator (which paths cannot contain), and the upload time.
+func versionKey(path string, uploadedAt time.Time) []byte {
+	key := versionPrefix(path)
+	return binary.BigEndian.AppendUint64(key, uint64(uploadedAt.UnixNano()))
+}
+
+func versionPrefix(path string) []byte {
+	return append([]byte(path), 0)
+}
@@ -0,0 +1,86 @@
+package metadata_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+)
+
+var _ = Describe("Bolt", func() {
+	var (
+		ctx   = context.Background()
+		dir   string
+		store metadata.Store
+		start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		dir = filepath.Join(os.TempDir(), uuid.New().String())
+		var err error
+		store, err = metadata.NewBoltStore(filepath.Join(dir, "metadata.db"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(store.Close()).To(Succeed())
+		err := os.RemoveAll(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	upload := func(path string, hour int) metadata.FileMetadata {
+		md := metadata.FileMetadata{
+			Path:       path,
+			Key:        path + "@" + time.Duration(hour).String(),
+			SHA256:     uuid.New().String(),
+			UploadedAt: start.Add(time.Duration(hour) * time.Hour),
+		}
+		Expect(store.StoreFileMetadata(ctx, md)).To(Succeed())
+		return md
+	}
+
+	It("returns nil for files never uploaded", func() {
+		md, err := store.GetFileMetadata(ctx, "snes/Game.srm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md).To(BeNil())
+	})
+
+	It("returns the latest upload", func() {
+		upload("snes/Game.srm", 0)
+		latest := upload("snes/Game.srm", 1)
+		md, err := store.GetFileMetadata(ctx, "snes/Game.srm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md.Key).To(Equal(latest.Key))
+	})
+
+	It("lists every version of a file, newest first", func() {
+		first := upload("snes/Game.srm", 0)
+		second := upload("snes/Game.srm", 1)
+		upload("snes/Game.srm.bak", 2)
+		upload("snes/Another.srm", 3)
+
+		versions, err := store.ListVersions(ctx, "snes/Game.srm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(HaveLen(2))
+		Expect(versions[0].Key).To(Equal(second.Key))
+		Expect(versions[1].Key).To(Equal(first.Key))
+	})
+
+	It("lists the latest upload of every file", func() {
+		upload("snes/Game.srm", 0)
+		upload("snes/Game.srm", 1)
+		upload("gba/Other.sav", 2)
+
+		files, err := store.ListFiles(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+		Expect(files[0].Path).To(Equal("gba/Other.sav"))
+		Expect(files[1].Path).To(Equal("snes/Game.srm"))
+	})
+})
@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// FileMetadata describes one upload of a file.
+	FileMetadata struct {
+		// Path is the file's path relative to the synced root, e.g.
+		// "snes/Chrono Trigger.srm".
+		Path string `json:"path"`
+		// Key is where the upload was stored remotely.
+		Key    string `json:"key"`
+		SHA256 string `json:"sha256"`
+		Size   int64  `json:"size"`
+		// ContentType is the MIME type of the file, guessed from its
+		// extension.
+		ContentType  string    `json:"contentType,omitempty"`
+		LastModified time.Time `json:"lastModified"`
+		UploadedAt   time.Time `json:"uploadedAt"`
+		RunID        string    `json:"runId,omitempty"`
+		// Parent is the path of the file this one is only meaningful
+		// alongside, e.g. the savestate a thumbnail previews.
+		Parent string `json:"parent,omitempty"`
+		// Title is the canonical name of the game a ROM was verified as,
+		// and Dump the outcome of verifying it against the DATs (see
+		// dat.Status). Both are empty when no DATs are configured.
+		Title string `json:"title,omitempty"`
+		Dump  string `json:"dump,omitempty"`
+		// DeviceID and DeviceName identify the machine that uploaded it.
+		DeviceID   string `json:"deviceId,omitempty"`
+		DeviceName string `json:"deviceName,omitempty"`
+	}
+
+	// Store records what has been uploaded. Every upload is kept as a
+	// version, so a file's history can be listed and any earlier upload
+	// restored.
+	Store interface {
+		// StoreFileMetadata records a new upload of the file.
+		StoreFileMetadata(ctx context.Context, md FileMetadata) error
+		// GetFileMetadata returns the latest upload of the file at path, or
+		// nil if it was never uploaded.
+		GetFileMetadata(ctx context.Context, path string) (*FileMetadata, error)
+		// ListVersions returns every upload of the file at path, newest first.
+		ListVersions(ctx context.Context, path string) ([]FileMetadata, error)
+		// ListFiles returns the latest upload of every file, ordered by path.
+		ListFiles(ctx context.Context) ([]FileMetadata, error)
+		Close() error
+	}
+)
@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	defaultSMTPPort = 587
+	// emailTimeout bounds sending an email, from connecting to quitting.
+	emailTimeout = 30 * time.Second
+)
+
+type (
+	// EmailConfig describes an SMTP server used to email a summary of every
+	// failed sync, or one with conflicts, to the To addresses. Username and
+	// Password are optional; when set, PLAIN authentication is used, which
+	// net/smtp only allows over TLS or to localhost.
+	EmailConfig struct {
+		Host     string
+		Port     int
+		Username string
+		Password secret.Secret
+		From     string
+		To       []string
+		Template string
+	}
+
+	email struct {
+		cfg  EmailConfig
+		tmpl *template.Template
+	}
+)
+
+var _ Notifier = &email{}
+
+func NewEmail(cfg EmailConfig) (Notifier, error) {
+	if cfg.Host == "" {
+		return nil, eris.New("smtp host is required")
+	}
+	if cfg.From == "" {
+		return nil, eris.New("email sender is required")
+	}
+	if len(cfg.To) == 0 {
+		return nil, eris.New("at least one email recipient is required")
+	}
+	if cfg.Port <= 0 {
+		cfg.Port = defaultSMTPPort
+	}
+	tmpl, err := parseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &email{
+		cfg:  cfg,
+		tmpl: tmpl,
+	}, nil
+}
+
+func (e *email) Notify(ctx context.Context, run history.Run) error {
+	if run.Status != history.StatusFailed && len(run.Conflicts) == 0 {
+		return nil
+	}
+	body, err := render(e.tmpl, run)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		password, err := e.cfg.Password.Resolve(ctx)
+		if err != nil {
+			return eris.Wrap(err, "failed to resolve smtp password")
+		}
+		auth = smtp.PlainAuth("", e.cfg.Username, password, e.cfg.Host)
+	}
+	err = e.send(ctx, auth, e.message(run, body))
+	if err != nil {
+		return eris.Wrap(err, "failed to send email")
+	}
+	return nil
+}
+
+// send is smtp.SendMail, but gives up once ctx is done or emailTimeout has
+// passed, so an unresponsive server can't hold up the sync reporting to it.
+func (e *email) send(ctx context.Context, auth smtp.Auth, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	// The deadline can't see ctx being cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: e.cfg.Host})
+		if err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return eris.New("smtp server doesn't support AUTH")
+		}
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(e.cfg.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (e *email) message(run history.Run, body string) []byte {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown host"
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	subject := fmt.Sprintf("Sync %s on %s", run.Status, host)
+	if len(run.Conflicts) > 0 {
+		subject += " with conflicts"
+	}
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
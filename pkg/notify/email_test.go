@@ -0,0 +1,172 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+)
+
+var _ = Describe("Email", func() {
+	var (
+		ctx      = context.Background()
+		mu       sync.Mutex
+		messages []string
+		rcpts    []string
+		// silent makes the server accept connections but never answer.
+		silent   bool
+		listener net.Listener
+		cfg      notify.EmailConfig
+		run      history.Run
+	)
+
+	// serve speaks just enough SMTP to take one message per connection.
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		mu.Lock()
+		quiet := silent
+		mu.Unlock()
+		if quiet {
+			_, _ = bufio.NewReader(conn).ReadString('\n')
+			return
+		}
+		r := bufio.NewReader(conn)
+		reply := func(line string) {
+			_, _ = conn.Write([]byte(line + "\r\n"))
+		}
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				mu.Lock()
+				rcpts = append(rcpts, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+				mu.Unlock()
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				mu.Lock()
+				messages = append(messages, msg.String())
+				mu.Unlock()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		messages = nil
+		rcpts = nil
+		silent = false
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go serve(conn)
+			}
+		}()
+		host, port, err := net.SplitHostPort(listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		p, err := strconv.Atoi(port)
+		Expect(err).NotTo(HaveOccurred())
+		cfg = notify.EmailConfig{
+			Host: host,
+			Port: p,
+			From: "syncer@example.com",
+			To:   []string{"me@example.com", "you@example.com"},
+		}
+		start := time.Now()
+		run = history.Run{
+			ID:         "run-1",
+			StartedAt:  start,
+			FinishedAt: start.Add(2 * time.Second),
+			Status:     history.StatusFailed,
+			Errors:     []string{"failed to sync Game.srm"},
+		}
+	})
+
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), messages...)
+	}
+
+	It("emails a summary of failed syncs", func() {
+		n, err := notify.NewEmail(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(sent()).To(HaveLen(1))
+		Expect(sent()[0]).To(ContainSubstring("Subject: Sync failed on "))
+		Expect(sent()[0]).To(ContainSubstring("- failed to sync Game.srm"))
+		Expect(rcpts).To(Equal([]string{"me@example.com", "you@example.com"}))
+	})
+
+	It("emails syncs with conflicts", func() {
+		run.Status = history.StatusSucceeded
+		run.Errors = nil
+		run.Conflicts = []string{"snes/Game.srm"}
+		n, err := notify.NewEmail(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(sent()).To(HaveLen(1))
+		Expect(sent()[0]).To(MatchRegexp(`Subject: Sync succeeded on .* with conflicts`))
+		Expect(sent()[0]).To(ContainSubstring("- snes/Game.srm: changed on another device"))
+	})
+
+	It("does not email successful syncs", func() {
+		run.Status = history.StatusSucceeded
+		n, err := notify.NewEmail(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(sent()).To(BeEmpty())
+	})
+
+	It("gives up on a server that doesn't answer once the context is done", func() {
+		mu.Lock()
+		silent = true
+		mu.Unlock()
+		n, err := notify.NewEmail(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		Expect(n.Notify(ctx, run)).NotTo(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+})
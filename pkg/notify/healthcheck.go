@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// HealthcheckConfig points at a dead man's switch, such as a
+	// healthchecks.io check, that is pinged at the start and end of every
+	// sync so an alert fires when syncs stop happening.
+	//
+	// URL receives the success ping; "/start", "/fail", and "/log" are
+	// appended to it for the start, failure, and cancellation pings, following
+	// the healthchecks.io API.
+	HealthcheckConfig struct {
+		URL string
+	}
+
+	healthcheck struct {
+		url    string
+		client *http.Client
+	}
+)
+
+var (
+	_ Notifier = &healthcheck{}
+	_ Starter  = &healthcheck{}
+)
+
+// MarshalYAML hides the URL past its host, since anyone holding the ping
+// URL can report to the check.
+func (c HealthcheckConfig) MarshalYAML() (any, error) {
+	type plain HealthcheckConfig
+	p := plain(c)
+	p.URL = redactURL(p.URL)
+	return p, nil
+}
+
+func NewHealthcheck(cfg HealthcheckConfig) (Notifier, error) {
+	_, err := url.ParseRequestURI(cfg.URL)
+	if err != nil {
+		return nil, eris.Wrap(err, "invalid healthcheck url")
+	}
+	return &healthcheck{
+		url:    strings.TrimSuffix(cfg.URL, "/"),
+		client: &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (h *healthcheck) Start(ctx context.Context, runID string) error {
+	return h.ping(ctx, "/start", runID, "")
+}
+
+func (h *healthcheck) Notify(ctx context.Context, run history.Run) error {
+	switch run.Status {
+	case history.StatusFailed:
+		return h.ping(ctx, "/fail", run.ID, strings.Join(run.Errors, "\n"))
+	case history.StatusCancelled:
+		// Neither a success nor a failure; just note it on the check.
+		return h.ping(ctx, "/log", run.ID, "sync cancelled")
+	default:
+		return h.ping(ctx, "", run.ID, "")
+	}
+}
+
+// ping sends the run ID so the check can pair start and end pings, and any
+// body, which healthchecks.io shows alongside the ping.
+func (h *healthcheck) ping(ctx context.Context, suffix, runID, body string) error {
+	u := h.url + suffix + "?rid=" + url.QueryEscape(runID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body))
+	if err != nil {
+		return eris.Wrap(err, "failed to create healthcheck request")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return eris.Wrap(err, "failed to ping healthcheck")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return eris.Errorf("healthcheck returned %s", resp.Status)
+	}
+	return nil
+}
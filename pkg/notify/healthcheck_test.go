@@ -0,0 +1,59 @@
+package notify_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+)
+
+var _ = Describe("Healthcheck", func() {
+	var (
+		ctx    = context.Background()
+		pings  []string
+		bodies []string
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		pings = nil
+		bodies = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			pings = append(pings, r.URL.RequestURI())
+			bodies = append(bodies, string(b))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("pings start and success", func() {
+		n, err := notify.NewHealthcheck(notify.HealthcheckConfig{URL: server.URL + "/ping/abc"})
+		Expect(err).NotTo(HaveOccurred())
+		notify.StartAll(ctx, []notify.Notifier{n}, "run-1")
+		Expect(n.Notify(ctx, history.Run{ID: "run-1", Status: history.StatusSucceeded})).To(Succeed())
+		Expect(pings).To(Equal([]string{"/ping/abc/start?rid=run-1", "/ping/abc?rid=run-1"}))
+	})
+
+	It("pings failure with the errors", func() {
+		n, err := notify.NewHealthcheck(notify.HealthcheckConfig{URL: server.URL + "/ping/abc/"})
+		Expect(err).NotTo(HaveOccurred())
+		run := history.Run{ID: "run-1", Status: history.StatusFailed, Errors: []string{"bucket unreachable"}}
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(pings).To(Equal([]string{"/ping/abc/fail?rid=run-1"}))
+		Expect(bodies).To(Equal([]string{"bucket unreachable"}))
+	})
+
+	It("rejects an invalid url", func() {
+		_, err := notify.NewHealthcheck(notify.HealthcheckConfig{URL: "not a url"})
+		Expect(err).To(HaveOccurred())
+	})
+})
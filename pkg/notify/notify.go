@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"text/template"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// DefaultTemplate is the message sent when a notifier has no template of its
+// own. Templates are rendered with the history.Run being reported.
+const DefaultTemplate = `Sync {{.Status}}: uploaded {{.FilesUploaded}} files, skipped {{.FilesSkipped}}{{if .FilesFailed}}, failed {{.FilesFailed}}{{end}} in {{.Duration}}{{range .Errors}}
+- {{.}}{{end}}{{range .Failures}}
+- {{.Path}}: {{.Reason}}{{end}}{{range .Conflicts}}
+- {{.}}: changed on another device{{end}}`
+
+type (
+	// Notifier reports the outcome of a sync run.
+	Notifier interface {
+		Notify(ctx context.Context, run history.Run) error
+	}
+
+	// Starter is implemented by notifiers that also want to know when a sync
+	// begins.
+	Starter interface {
+		Start(ctx context.Context, runID string) error
+	}
+)
+
+// StartAll tells every notifier implementing Starter that a run has begun.
+// Failures are logged rather than returned.
+func StartAll(ctx context.Context, notifiers []Notifier, runID string) {
+	for _, n := range notifiers {
+		starter, ok := n.(Starter)
+		if !ok {
+			continue
+		}
+		err := starter.Start(ctx, runID)
+		if err != nil {
+			log.FromCtx(ctx).Warn("Failed to send start notification", zap.Error(err))
+		}
+	}
+}
+
+// NotifyAll sends the run to every notifier. Failures are logged rather than
+// returned so one broken notifier never hides the others.
+func NotifyAll(ctx context.Context, notifiers []Notifier, run history.Run) {
+	for _, n := range notifiers {
+		err := n.Notify(ctx, run)
+		if err != nil {
+			log.FromCtx(ctx).Warn("Failed to send notification", zap.Error(err))
+		}
+	}
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, eris.Wrap(err, "invalid message template")
+	}
+	return tmpl, nil
+}
+
+func render(tmpl *template.Template, run history.Run) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, run)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to render message")
+	}
+	return buf.String(), nil
+}
+
+// redactURL hides everything after a URL's host, which for webhooks and
+// healthchecks is the credential, so configs holding them can be shown.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "[redacted]"
+	}
+	return u.Scheme + "://" + u.Host + "/[redacted]"
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const (
+	WebhookGeneric = "generic"
+	WebhookDiscord = "discord"
+	WebhookSlack   = "slack"
+
+	defaultWebhookAttempts = 3
+	defaultWebhookBackoff  = time.Second
+	webhookTimeout         = 10 * time.Second
+)
+
+type (
+	// WebhookConfig describes a URL that is POSTed to after each sync.
+	//
+	// Format selects the payload: "discord" and "slack" send the rendered
+	// Template as the message text, while "generic" (the default) sends the
+	// run's status, counts, errors, and duration alongside the message.
+	// Delivery is attempted up to MaxAttempts times, doubling Backoff after
+	// each failure. When OnlyOnFailure is set, successful runs are not sent.
+	WebhookConfig struct {
+		URL           string
+		Format        string
+		Template      string
+		OnlyOnFailure bool
+		MaxAttempts   int
+		Backoff       time.Duration
+	}
+
+	webhook struct {
+		cfg    WebhookConfig
+		tmpl   *template.Template
+		client *http.Client
+	}
+
+	// webhookPayload is the body of a "generic" webhook.
+	webhookPayload struct {
+		ID              string   `json:"id"`
+		Status          string   `json:"status"`
+		Message         string   `json:"message"`
+		StartedAt       string   `json:"startedAt"`
+		DurationSeconds float64  `json:"durationSeconds"`
+		FilesUploaded   int      `json:"filesUploaded"`
+		FilesSkipped    int      `json:"filesSkipped"`
+		FilesFailed     int      `json:"filesFailed"`
+		BytesUploaded   int64    `json:"bytesUploaded"`
+		Connectivity    string   `json:"connectivity,omitempty"`
+		Errors          []string `json:"errors"`
+	}
+)
+
+var _ Notifier = &webhook{}
+
+// MarshalYAML hides the URL past its host, since a Slack or Discord
+// webhook URL is itself the credential.
+func (c WebhookConfig) MarshalYAML() (any, error) {
+	type plain WebhookConfig
+	p := plain(c)
+	p.URL = redactURL(p.URL)
+	return p, nil
+}
+
+func NewWebhook(cfg WebhookConfig) (Notifier, error) {
+	if cfg.URL == "" {
+		return nil, eris.New("webhook url is required")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = WebhookGeneric
+	case WebhookGeneric, WebhookDiscord, WebhookSlack:
+	default:
+		return nil, eris.Errorf("unsupported webhook format %q", cfg.Format)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultWebhookAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultWebhookBackoff
+	}
+	tmpl, err := parseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook{
+		cfg:    cfg,
+		tmpl:   tmpl,
+		client: &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+func (w *webhook) Notify(ctx context.Context, run history.Run) error {
+	if w.cfg.OnlyOnFailure && run.Status != history.StatusFailed {
+		return nil
+	}
+	body, err := w.payload(run)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.cfg.Backoff
+	var lastErr error
+	for attempt := 1; attempt <= w.cfg.MaxAttempts; attempt++ {
+		lastErr = w.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+		if attempt == w.cfg.MaxAttempts {
+			break
+		}
+		log.FromCtx(ctx).Warn("Webhook delivery failed; retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(lastErr),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return eris.Wrapf(lastErr, "failed to deliver webhook after %d attempts", w.cfg.MaxAttempts)
+}
+
+func (w *webhook) payload(run history.Run) ([]byte, error) {
+	message, err := render(w.tmpl, run)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	switch w.cfg.Format {
+	case WebhookDiscord:
+		v = map[string]string{"content": message}
+	case WebhookSlack:
+		v = map[string]string{"text": message}
+	default:
+		errs := run.Errors
+		if errs == nil {
+			errs = []string{}
+		}
+		v = webhookPayload{
+			ID:              run.ID,
+			Status:          run.Status,
+			Message:         message,
+			StartedAt:       run.StartedAt.Format(time.RFC3339),
+			DurationSeconds: run.Duration().Seconds(),
+			FilesUploaded:   run.FilesUploaded,
+			FilesSkipped:    run.FilesSkipped,
+			FilesFailed:     run.FilesFailed,
+			BytesUploaded:   run.BytesUploaded,
+			Connectivity:    run.Connectivity,
+			Errors:          errs,
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to marshal webhook payload")
+	}
+	return b, nil
+}
+
+func (w *webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return eris.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return eris.Wrap(err, "failed to send webhook")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return eris.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
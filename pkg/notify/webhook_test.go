@@ -0,0 +1,113 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+)
+
+var _ = Describe("Webhook", func() {
+	var (
+		ctx      = context.Background()
+		mu       sync.Mutex
+		bodies   []map[string]any
+		statuses []int
+		server   *httptest.Server
+		run      history.Run
+	)
+
+	BeforeEach(func() {
+		bodies = nil
+		statuses = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			b, _ := io.ReadAll(r.Body)
+			body := map[string]any{}
+			_ = json.Unmarshal(b, &body)
+			bodies = append(bodies, body)
+			status := http.StatusNoContent
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+			w.WriteHeader(status)
+		}))
+		start := time.Now()
+		run = history.Run{
+			ID:            "run-1",
+			StartedAt:     start,
+			FinishedAt:    start.Add(2 * time.Second),
+			Status:        history.StatusFailed,
+			FilesUploaded: 3,
+			Errors:        []string{"failed to sync Game.srm"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts the run summary", func() {
+		n, err := notify.NewWebhook(notify.WebhookConfig{URL: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+
+		Expect(bodies).To(HaveLen(1))
+		Expect(bodies[0]).To(HaveKeyWithValue("status", history.StatusFailed))
+		Expect(bodies[0]).To(HaveKeyWithValue("filesUploaded", BeNumerically("==", 3)))
+		Expect(bodies[0]).To(HaveKeyWithValue("durationSeconds", BeNumerically("==", 2)))
+		Expect(bodies[0]).To(HaveKeyWithValue("errors", ConsistOf("failed to sync Game.srm")))
+	})
+
+	It("renders the template for chat formats", func() {
+		n, err := notify.NewWebhook(notify.WebhookConfig{
+			URL:      server.URL,
+			Format:   notify.WebhookDiscord,
+			Template: "{{.Status}} with {{len .Errors}} error",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+
+		Expect(bodies).To(HaveLen(1))
+		Expect(bodies[0]).To(Equal(map[string]any{"content": "failed with 1 error"}))
+	})
+
+	It("retries failed deliveries", func() {
+		statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+		n, err := notify.NewWebhook(notify.WebhookConfig{URL: server.URL, Backoff: time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(bodies).To(HaveLen(3))
+	})
+
+	It("gives up after the maximum number of attempts", func() {
+		statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError}
+		n, err := notify.NewWebhook(notify.WebhookConfig{URL: server.URL, MaxAttempts: 2, Backoff: time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).NotTo(Succeed())
+		Expect(bodies).To(HaveLen(2))
+	})
+
+	It("skips successful runs when only failures are wanted", func() {
+		run.Status = history.StatusSucceeded
+		n, err := notify.NewWebhook(notify.WebhookConfig{URL: server.URL, OnlyOnFailure: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(ctx, run)).To(Succeed())
+		Expect(bodies).To(BeEmpty())
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := notify.NewWebhook(notify.WebhookConfig{URL: server.URL, Format: "teams"})
+		Expect(err).To(HaveOccurred())
+	})
+})
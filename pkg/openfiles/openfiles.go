@@ -0,0 +1,61 @@
+package openfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// DefaultProcRoot is where Linux exposes the open files of each process.
+const DefaultProcRoot = "/proc"
+
+// accessModeMask selects the access mode from the flags of an open file:
+// zero for read-only, otherwise write-only or read-write.
+const accessModeMask = 0o3
+
+// Writing returns the absolute paths of the files any process has open for
+// writing, read from procfs rooted at root. Processes whose descriptors
+// can't be read, such as other users' without privilege, and systems
+// without procfs, contribute nothing.
+func Writing(root string) (map[string]bool, error) {
+	writing := make(map[string]bool)
+	fds, err := filepath.Glob(filepath.Join(root, "[0-9]*", "fd", "*"))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to list open files")
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink(fd)
+		if err != nil || !filepath.IsAbs(target) {
+			// Closed since listing, or a socket, pipe, or the like.
+			continue
+		}
+		pid := filepath.Dir(filepath.Dir(fd))
+		flags, err := readFlags(filepath.Join(pid, "fdinfo", filepath.Base(fd)))
+		if err != nil {
+			continue
+		}
+		if flags&accessModeMask != 0 {
+			writing[target] = true
+		}
+	}
+	return writing, nil
+}
+
+// readFlags reads the octal open flags from an fdinfo file.
+func readFlags(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		value, ok := strings.CutPrefix(line, "flags:")
+		if !ok {
+			continue
+		}
+		return strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+	}
+	return 0, eris.Errorf("no flags in %s", path)
+}
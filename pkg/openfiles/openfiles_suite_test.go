@@ -0,0 +1,13 @@
+package openfiles_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOpenfiles(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Openfiles Suite")
+}
@@ -0,0 +1,48 @@
+package openfiles_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/openfiles"
+)
+
+var _ = Describe("Writing", func() {
+	var root string
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+	})
+
+	open := func(pid, fd, target, flags string) {
+		dir := filepath.Join(root, pid)
+		Expect(os.MkdirAll(filepath.Join(dir, "fd"), 0o755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "fdinfo"), 0o755)).To(Succeed())
+		Expect(os.Symlink(target, filepath.Join(dir, "fd", fd))).To(Succeed())
+		info := "pos:\t0\nflags:\t" + flags + "\nmnt_id:\t25\n"
+		Expect(os.WriteFile(filepath.Join(dir, "fdinfo", fd), []byte(info), 0o644)).To(Succeed())
+	}
+
+	It("lists files open for writing", func() {
+		open("100", "3", "/roms/snes/Game.srm", "0100001")
+		open("100", "4", "/roms/snes/Game.sfc", "0100000")
+		open("200", "5", "/roms/gba/Game.sav", "02")
+		open("200", "6", "socket:[1234]", "02")
+
+		writing, err := openfiles.Writing(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writing).To(Equal(map[string]bool{
+			"/roms/snes/Game.srm": true,
+			"/roms/gba/Game.sav":  true,
+		}))
+	})
+
+	It("finds nothing without procfs", func() {
+		writing, err := openfiles.Writing(filepath.Join(root, "missing"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writing).To(BeEmpty())
+	})
+})
@@ -0,0 +1,86 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// DefaultSysfsRoot is where Linux exposes power supply and thermal information.
+const DefaultSysfsRoot = "/sys"
+
+type (
+	// Status is a snapshot of the device's battery and thermal state. Devices
+	// without a battery (e.g. a living-room Pi) report HasBattery false, and
+	// devices without a thermal zone report HasTemperature false.
+	Status struct {
+		HasBattery         bool
+		BatteryPercent     int
+		Charging           bool
+		HasTemperature     bool
+		TemperatureCelsius float64
+	}
+)
+
+// ReadStatus reads the battery and thermal state from sysfs rooted at root.
+// The first battery and the hottest thermal zone found are reported.
+func ReadStatus(root string) (Status, error) {
+	status := Status{}
+
+	supplies, err := filepath.Glob(filepath.Join(root, "class", "power_supply", "*"))
+	if err != nil {
+		return status, eris.Wrap(err, "failed to list power supplies")
+	}
+	for _, supply := range supplies {
+		supplyType, err := readString(filepath.Join(supply, "type"))
+		if err != nil || supplyType != "Battery" {
+			continue
+		}
+		capacity, err := readInt(filepath.Join(supply, "capacity"))
+		if err != nil {
+			continue
+		}
+		status.HasBattery = true
+		status.BatteryPercent = capacity
+		state, _ := readString(filepath.Join(supply, "status"))
+		status.Charging = state == "Charging" || state == "Full"
+		break
+	}
+
+	zones, err := filepath.Glob(filepath.Join(root, "class", "thermal", "thermal_zone*"))
+	if err != nil {
+		return status, eris.Wrap(err, "failed to list thermal zones")
+	}
+	for _, zone := range zones {
+		milliCelsius, err := readInt(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		celsius := float64(milliCelsius) / 1000
+		if !status.HasTemperature || celsius > status.TemperatureCelsius {
+			status.HasTemperature = true
+			status.TemperatureCelsius = celsius
+		}
+	}
+
+	return status, nil
+}
+
+func readString(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func readInt(path string) (int, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,55 @@
+package power_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/power"
+)
+
+var _ = Describe("Power", func() {
+	var (
+		root = filepath.Join(os.TempDir(), uuid.New().String())
+	)
+
+	writeFile := func(path, contents string) {
+		path = filepath.Join(root, path)
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		err = os.WriteFile(path, []byte(contents), 0644)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	AfterEach(func() {
+		err := os.RemoveAll(root)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reads the battery and hottest thermal zone", func() {
+		writeFile("class/power_supply/AC/type", "Mains\n")
+		writeFile("class/power_supply/BAT0/type", "Battery\n")
+		writeFile("class/power_supply/BAT0/capacity", "42\n")
+		writeFile("class/power_supply/BAT0/status", "Discharging\n")
+		writeFile("class/thermal/thermal_zone0/temp", "48000\n")
+		writeFile("class/thermal/thermal_zone1/temp", "71500\n")
+
+		status, err := power.ReadStatus(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.HasBattery).To(BeTrue())
+		Expect(status.BatteryPercent).To(Equal(42))
+		Expect(status.Charging).To(BeFalse())
+		Expect(status.HasTemperature).To(BeTrue())
+		Expect(status.TemperatureCelsius).To(BeNumerically("~", 71.5))
+	})
+
+	It("reports nothing on devices without a battery or thermal zone", func() {
+		status, err := power.ReadStatus(root)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.HasBattery).To(BeFalse())
+		Expect(status.HasTemperature).To(BeFalse())
+	})
+})
@@ -0,0 +1,121 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	barWidth       = 20
+	renderInterval = 200 * time.Millisecond
+)
+
+// bar renders the overall and per-file progress as a single, continuously
+// redrawn terminal line. It is updated from every goroutine of a concurrent
+// upload, so drawing is serialized by mu.
+type bar struct {
+	tracker
+	mu         sync.Mutex
+	out        io.Writer
+	lastRender time.Time
+	rendered   bool
+}
+
+var _ Reporter = &bar{}
+
+func newBar(out io.Writer) *bar {
+	return &bar{out: out}
+}
+
+func (b *bar) AddTotal(files int, bytes int64) {
+	b.addTotal(files, bytes)
+	b.render(false)
+}
+
+func (b *bar) StartFile(name string, size int64) {
+	b.startFile(name, size)
+	b.render(true)
+}
+
+func (b *bar) Update(done, total int64) {
+	b.update(done, total)
+	b.render(false)
+}
+
+func (b *bar) FinishFile() {
+	b.finishFile()
+	b.render(true)
+}
+
+func (b *bar) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.draw()
+	if b.rendered {
+		fmt.Fprintln(b.out)
+	}
+}
+
+// render redraws the line, at most every renderInterval unless forced. An
+// unforced redraw is dropped while another goroutine is drawing, rather
+// than wait for it.
+func (b *bar) render(force bool) {
+	if force {
+		b.mu.Lock()
+	} else if !b.mu.TryLock() {
+		return
+	}
+	defer b.mu.Unlock()
+	if !force && time.Since(b.lastRender) < renderInterval {
+		return
+	}
+	b.draw()
+}
+
+// draw writes the line; b.mu must be held.
+func (b *bar) draw() {
+	b.lastRender = time.Now()
+	b.rendered = true
+
+	s := b.snapshot()
+	overall := 0.0
+	if s.BytesTotal > 0 {
+		overall = float64(s.BytesDone) / float64(s.BytesTotal)
+	}
+	line := fmt.Sprintf("%s %3.0f%% %d/%d files %s/%s",
+		drawBar(overall), overall*100, s.FilesDone, s.FilesTotal,
+		FormatBytes(s.BytesDone), FormatBytes(s.BytesTotal),
+	)
+	if s.ETA > 0 {
+		line += fmt.Sprintf(" ETA %s", s.ETA.Round(time.Second))
+	}
+	if s.CurrentFile != "" {
+		line += fmt.Sprintf(" | %s %s %3.0f%%", s.CurrentFile, drawBar(s.CurrentFraction), s.CurrentFraction*100)
+	}
+	fmt.Fprintf(b.out, "\r\033[K%s", line)
+}
+
+func drawBar(fraction float64) string {
+	filled := int(fraction * barWidth)
+	if filled > barWidth {
+		filled = barWidth
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", barWidth-filled) + "]"
+}
+
+// FormatBytes formats a byte count using binary units, e.g. "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
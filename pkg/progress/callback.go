@@ -0,0 +1,38 @@
+package progress
+
+// callback reports every change in progress to a function, for callers that
+// render progress themselves (e.g. a TUI).
+type callback struct {
+	tracker
+	fn func(Snapshot)
+}
+
+var _ Reporter = &callback{}
+
+// NewCallback returns a Reporter that calls fn with a snapshot of the
+// progress after every change.
+func NewCallback(fn func(Snapshot)) Reporter {
+	return &callback{fn: fn}
+}
+
+func (c *callback) AddTotal(files int, bytes int64) {
+	c.addTotal(files, bytes)
+	c.fn(c.snapshot())
+}
+
+func (c *callback) StartFile(name string, size int64) {
+	c.startFile(name, size)
+	c.fn(c.snapshot())
+}
+
+func (c *callback) Update(done, total int64) {
+	c.update(done, total)
+	c.fn(c.snapshot())
+}
+
+func (c *callback) FinishFile() {
+	c.finishFile()
+	c.fn(c.snapshot())
+}
+
+func (c *callback) Close() {}
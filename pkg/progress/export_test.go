@@ -0,0 +1,8 @@
+package progress
+
+import "io"
+
+// NewBar returns the Reporter New uses on a terminal, drawing to out.
+func NewBar(out io.Writer) Reporter {
+	return newBar(out)
+}
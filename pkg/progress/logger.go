@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"context"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"go.uber.org/zap"
+)
+
+// logger reports progress as structured log lines, one per completed file,
+// for non-interactive runs.
+type logger struct {
+	tracker
+	log *zap.Logger
+}
+
+var _ Reporter = &logger{}
+
+func newLogger(ctx context.Context) *logger {
+	return &logger{log: log.FromCtx(ctx)}
+}
+
+func (l *logger) AddTotal(files int, bytes int64) {
+	l.addTotal(files, bytes)
+}
+
+func (l *logger) StartFile(name string, size int64) {
+	l.startFile(name, size)
+}
+
+func (l *logger) Update(done, total int64) {
+	l.update(done, total)
+}
+
+func (l *logger) FinishFile() {
+	name := l.snapshot().CurrentFile
+	l.finishFile()
+	s := l.snapshot()
+	l.log.Info("Progress",
+		zap.String("file", name),
+		zap.Int("filesDone", s.FilesDone),
+		zap.Int("filesTotal", s.FilesTotal),
+		zap.Int64("bytesDone", s.BytesDone),
+		zap.Int64("bytesTotal", s.BytesTotal),
+		zap.Duration("eta", s.ETA.Round(time.Second)),
+	)
+}
+
+func (l *logger) Close() {}
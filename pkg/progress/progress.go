@@ -0,0 +1,154 @@
+package progress
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+type progressKey struct{}
+
+type (
+	// Reporter tracks the progress of a batch of file transfers.
+	//
+	// AddTotal grows the amount of work expected. Each transfer is bracketed
+	// by StartFile and FinishFile, and Update reports how far the current
+	// transfer has progressed, in whatever units the transfer is measured in
+	// (e.g. compressed bytes); the reporter scales it to the file's size.
+	Reporter interface {
+		AddTotal(files int, bytes int64)
+		StartFile(name string, size int64)
+		Update(done, total int64)
+		FinishFile()
+		Close()
+	}
+
+	// Snapshot is a point-in-time view of a Reporter's progress.
+	Snapshot struct {
+		FilesDone   int
+		FilesTotal  int
+		BytesDone   int64
+		BytesTotal  int64
+		CurrentFile string
+		// CurrentFraction is how much of the current file has been
+		// transferred, from 0 to 1.
+		CurrentFraction float64
+		// ETA is the estimated time remaining, or zero if unknown.
+		ETA time.Duration
+	}
+
+	// tracker holds the state shared by every Reporter implementation.
+	tracker struct {
+		mu              sync.Mutex
+		started         time.Time
+		filesDone       int
+		filesTotal      int
+		bytesDone       int64
+		bytesTotal      int64
+		currentFile     string
+		currentSize     int64
+		currentFraction float64
+	}
+
+	noop struct{}
+)
+
+// New returns a Reporter that renders progress bars to out when it is a
+// terminal, and logs progress from ctx's logger otherwise.
+func New(ctx context.Context, out *os.File) Reporter {
+	if isTerminal(out) {
+		return newBar(out)
+	}
+	return newLogger(ctx)
+}
+
+// ToCtx returns a context carrying the reporter.
+func ToCtx(ctx context.Context, reporter Reporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, reporter)
+}
+
+// FromCtx returns the reporter carried by ctx, or one that discards all
+// progress if there is none.
+func FromCtx(ctx context.Context) Reporter {
+	if ctx != nil {
+		if reporter, ok := ctx.Value(progressKey{}).(Reporter); ok {
+			return reporter
+		}
+	}
+	return noop{}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (t *tracker) addTotal(files int, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filesTotal += files
+	t.bytesTotal += bytes
+}
+
+func (t *tracker) startFile(name string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.started.IsZero() {
+		t.started = time.Now()
+	}
+	t.currentFile = name
+	t.currentSize = size
+	t.currentFraction = 0
+}
+
+func (t *tracker) update(done, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if total <= 0 {
+		return
+	}
+	fraction := float64(done) / float64(total)
+	if fraction > 1 {
+		fraction = 1
+	}
+	t.currentFraction = fraction
+}
+
+func (t *tracker) finishFile() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.filesDone++
+	t.bytesDone += t.currentSize
+	t.currentFile = ""
+	t.currentSize = 0
+	t.currentFraction = 0
+}
+
+func (t *tracker) snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := Snapshot{
+		FilesDone:       t.filesDone,
+		FilesTotal:      t.filesTotal,
+		BytesDone:       t.bytesDone + int64(t.currentFraction*float64(t.currentSize)),
+		BytesTotal:      t.bytesTotal,
+		CurrentFile:     t.currentFile,
+		CurrentFraction: t.currentFraction,
+	}
+	elapsed := time.Since(t.started)
+	if !t.started.IsZero() && s.BytesDone > 0 && s.BytesTotal > s.BytesDone {
+		rate := float64(s.BytesDone) / elapsed.Seconds()
+		s.ETA = time.Duration(float64(s.BytesTotal-s.BytesDone) / rate * float64(time.Second))
+	}
+	return s
+}
+
+func (noop) AddTotal(files int, bytes int64)   {}
+func (noop) StartFile(name string, size int64) {}
+func (noop) Update(done, total int64)          {}
+func (noop) FinishFile()                       {}
+func (noop) Close()                            {}
@@ -0,0 +1,92 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+)
+
+type recordingReporter struct {
+	updates []int64
+}
+
+func (r *recordingReporter) AddTotal(files int, bytes int64)   {}
+func (r *recordingReporter) StartFile(name string, size int64) {}
+func (r *recordingReporter) Update(done, total int64) {
+	r.updates = append(r.updates, done)
+}
+func (r *recordingReporter) FinishFile() {}
+func (r *recordingReporter) Close()      {}
+
+var _ = Describe("Progress", func() {
+	It("formats byte counts", func() {
+		Expect(progress.FormatBytes(512)).To(Equal("512 B"))
+		Expect(progress.FormatBytes(1536)).To(Equal("1.5 KiB"))
+		Expect(progress.FormatBytes(3 * 1024 * 1024)).To(Equal("3.0 MiB"))
+	})
+
+	It("discards progress when no reporter is configured", func() {
+		reporter := progress.FromCtx(context.Background())
+		Expect(reporter).NotTo(BeNil())
+		reporter.StartFile("aaaa.sav", 10)
+		reporter.FinishFile()
+	})
+
+	It("draws a bar updated from several goroutines", func() {
+		out := &bytes.Buffer{}
+		bar := progress.NewBar(out)
+		bar.AddTotal(1, 8*100)
+		bar.StartFile("game.iso", 8*100)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Long enough for the bar to be redrawn along the way.
+				for done := int64(1); done <= 100; done++ {
+					bar.Update(done, 100)
+					time.Sleep(5 * time.Millisecond)
+				}
+			}()
+		}
+		wg.Wait()
+		bar.FinishFile()
+		bar.Close()
+		Expect(out.String()).To(HaveSuffix("1/1 files 800 B/800 B\n"))
+	})
+
+	It("reports bytes read through a Reader", func() {
+		path := filepath.Join(os.TempDir(), uuid.New().String())
+		Expect(os.WriteFile(path, []byte("0123456789"), 0644)).To(Succeed())
+		DeferCleanup(os.Remove, path)
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(f.Close)
+
+		reporter := &recordingReporter{}
+		ctx := progress.ToCtx(context.Background(), reporter)
+		r := progress.NewReader(ctx, f, 10)
+		buf := make([]byte, 4)
+		_, err = r.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reporter.updates).To(HaveExactElements(int64(4), int64(10)))
+
+		_, err = r.Seek(0, io.SeekStart)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.Read(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reporter.updates[len(reporter.updates)-1]).To(Equal(int64(4)))
+	})
+})
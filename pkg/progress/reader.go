@@ -0,0 +1,60 @@
+package progress
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Reader reports the bytes read from a file to the Reporter in ctx. It
+// implements io.ReaderAt and io.Seeker so uploaders can still read the file
+// without buffering it.
+type Reader struct {
+	f        *os.File
+	total    int64
+	read     atomic.Int64
+	reporter Reporter
+}
+
+var (
+	_ io.ReadSeeker = &Reader{}
+	_ io.ReaderAt   = &Reader{}
+)
+
+// NewReader wraps f, whose size is total bytes.
+func NewReader(ctx context.Context, f *os.File, total int64) *Reader {
+	return &Reader{
+		f:        f,
+		total:    total,
+		reporter: FromCtx(ctx),
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.report(n)
+	return n, err
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.f.ReadAt(p, off)
+	r.report(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.f.Seek(offset, whence)
+	if err == nil && whence == io.SeekStart && offset == 0 {
+		// The reader is being re-read from the start, e.g. on a retry.
+		r.read.Store(0)
+	}
+	return pos, err
+}
+
+func (r *Reader) report(n int) {
+	if n <= 0 {
+		return
+	}
+	r.reporter.Update(r.read.Add(int64(n)), r.total)
+}
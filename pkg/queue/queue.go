@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// Entry is a local file waiting to be uploaded, and when it was first
+	// queued.
+	Entry struct {
+		Path     string    `json:"path"`
+		QueuedAt time.Time `json:"queuedAt"`
+	}
+
+	// Queue journals the uploads a sync intends to make, by absolute path,
+	// until each is stored. Whatever is left after a sync, e.g. because
+	// storage was unreachable, is still to be uploaded.
+	Queue struct {
+		path    string
+		entries map[string]Entry
+		dirty   bool
+	}
+)
+
+// Load reads the queue at path. A missing or unreadable queue is treated as
+// empty: the files are found again by the next sync that can reach storage.
+func Load(path string) (*Queue, error) {
+	q := &Queue{path: path, entries: make(map[string]Entry)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read queue %s", path)
+	}
+	var entries []Entry
+	if json.Unmarshal(b, &entries) != nil {
+		q.dirty = true
+		return q, nil
+	}
+	for _, e := range entries {
+		q.entries[e.Path] = e
+	}
+	return q, nil
+}
+
+// Replace queues exactly the files at paths, dropping the rest, e.g. files
+// since uploaded or deleted. Files already queued keep when they were
+// queued.
+func (q *Queue) Replace(now time.Time, paths []string) {
+	entries := make(map[string]Entry, len(paths))
+	for _, p := range paths {
+		e, ok := q.entries[p]
+		if !ok {
+			e = Entry{Path: p, QueuedAt: now}
+		}
+		entries[p] = e
+	}
+	q.entries = entries
+	q.dirty = true
+}
+
+// Remove takes the file at path off the queue, once it is uploaded.
+func (q *Queue) Remove(path string) {
+	if _, ok := q.entries[path]; !ok {
+		return
+	}
+	delete(q.entries, path)
+	q.dirty = true
+}
+
+// Len is the number of files queued.
+func (q *Queue) Len() int {
+	return len(q.entries)
+}
+
+// Entries returns the queued files, ordered by path.
+func (q *Queue) Entries() []Entry {
+	entries := make([]Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Save writes the queue back to its file, if it changed, replacing it
+// atomically. An empty queue removes the file.
+func (q *Queue) Save() error {
+	if !q.dirty {
+		return nil
+	}
+	if len(q.entries) == 0 {
+		err := os.Remove(q.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return eris.Wrapf(err, "failed to remove queue %s", q.path)
+		}
+		q.dirty = false
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(q.path), os.ModePerm)
+	if err != nil {
+		return eris.Wrap(err, "failed to create queue directory")
+	}
+	b, err := json.Marshal(q.Entries())
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal queue")
+	}
+	tmp := q.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write queue %s", tmp)
+	}
+	err = os.Rename(tmp, q.path)
+	if err != nil {
+		return eris.Wrapf(err, "failed to replace queue %s", q.path)
+	}
+	q.dirty = false
+	return nil
+}
@@ -0,0 +1,60 @@
+package queue_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		path  string
+		start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "state", "queue.json")
+	})
+
+	It("starts empty when there is no queue file", func() {
+		q, err := queue.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(q.Len()).To(BeZero())
+	})
+
+	It("keeps queued files across loads until they are removed", func() {
+		q, err := queue.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		q.Replace(start, []string{"/roms/snes/Game.srm", "/roms/gba/Game.sav"})
+		Expect(q.Save()).To(Succeed())
+
+		q, err = queue.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(q.Entries()).To(Equal([]queue.Entry{
+			{Path: "/roms/gba/Game.sav", QueuedAt: start},
+			{Path: "/roms/snes/Game.srm", QueuedAt: start},
+		}))
+
+		q.Remove("/roms/gba/Game.sav")
+		q.Remove("/roms/snes/Game.srm")
+		Expect(q.Save()).To(Succeed())
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("keeps when a file was first queued", func() {
+		q, err := queue.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		q.Replace(start, []string{"/roms/snes/Game.srm"})
+		q.Replace(start.Add(time.Hour), []string{"/roms/snes/Game.srm", "/roms/gba/Game.sav"})
+		Expect(q.Entries()).To(Equal([]queue.Entry{
+			{Path: "/roms/gba/Game.sav", QueuedAt: start.Add(time.Hour)},
+			{Path: "/roms/snes/Game.srm", QueuedAt: start},
+		}))
+	})
+})
@@ -0,0 +1,131 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/rotisserie/eris"
+)
+
+const redacted = "[redacted]"
+
+type (
+	// Secret is a credential that can be kept out of the config file. It is
+	// resolved from the first of these that is set:
+	//
+	//   - Value, the secret itself
+	//   - File, a file holding the secret, e.g. a Docker or systemd secret
+	//   - Env, an environment variable holding the secret
+	//   - Command, a shell command printing the secret, e.g. "pass show s3"
+	//
+	// In config a plain string is shorthand for Value. Secrets never print
+	// their Value; it is redacted when formatted or marshaled.
+	Secret struct {
+		Value   string
+		File    string
+		Env     string
+		Command string
+	}
+)
+
+// IsZero reports whether no source is configured.
+func (s Secret) IsZero() bool {
+	return s == Secret{}
+}
+
+// Resolve returns the secret, reading it from its configured source. Trailing
+// newlines, as left by most editors and commands, are trimmed from file and
+// command output.
+func (s Secret) Resolve(ctx context.Context) (string, error) {
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+	case s.File != "":
+		b, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", eris.Wrapf(err, "failed to read secret file %s", s.File)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", eris.Errorf("secret environment variable %s is not set", s.Env)
+		}
+		return v, nil
+	case s.Command != "":
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sh", "-c", s.Command)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			return "", eris.Wrapf(err, "secret command failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimRight(stdout.String(), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
+
+// Redacted returns a copy of the secret with its Value hidden. The other
+// sources only say where the secret lives, so they are kept.
+func (s Secret) Redacted() Secret {
+	if s.Value != "" {
+		s.Value = redacted
+	}
+	return s
+}
+
+func (s Secret) String() string {
+	switch {
+	case s.Value != "":
+		return redacted
+	case s.File != "":
+		return "file:" + s.File
+	case s.Env != "":
+		return "env:" + s.Env
+	case s.Command != "":
+		return "command:" + s.Command
+	default:
+		return ""
+	}
+}
+
+// MarshalYAML never writes the secret's Value.
+func (s Secret) MarshalYAML() (any, error) {
+	if s.IsZero() {
+		return "", nil
+	}
+	return s.redactedMap(), nil
+}
+
+// MarshalText never writes the secret's Value.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Secret) redactedMap() map[string]string {
+	r := s.Redacted()
+	m := make(map[string]string)
+	for k, v := range map[string]string{"value": r.Value, "file": r.File, "env": r.Env, "command": r.Command} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// DecodeHook lets a plain string in config stand in for a Secret's Value.
+func DecodeHook() mapstructure.DecodeHookFunc {
+	return func(from, to reflect.Type, data any) (any, error) {
+		if to != reflect.TypeOf(Secret{}) || from.Kind() != reflect.String {
+			return data, nil
+		}
+		return Secret{Value: data.(string)}, nil
+	}
+}
@@ -0,0 +1,89 @@
+package secret_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
+)
+
+var _ = Describe("Secret", func() {
+	var (
+		ctx = context.Background()
+		dir = filepath.Join(os.TempDir(), uuid.New().String())
+	)
+
+	BeforeEach(func() {
+		err := os.MkdirAll(dir, os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("resolves a plain value", func() {
+		Expect(secret.Secret{Value: "hunter2"}.Resolve(ctx)).To(Equal("hunter2"))
+	})
+
+	It("resolves a file, trimming the trailing newline", func() {
+		path := filepath.Join(dir, "password")
+		err := os.WriteFile(path, []byte("hunter2\n"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Secret{File: path}.Resolve(ctx)).To(Equal("hunter2"))
+	})
+
+	It("resolves an environment variable", func() {
+		GinkgoT().Setenv("SECRET_TEST_PASSWORD", "hunter2")
+		Expect(secret.Secret{Env: "SECRET_TEST_PASSWORD"}.Resolve(ctx)).To(Equal("hunter2"))
+	})
+
+	It("fails when the environment variable is unset", func() {
+		_, err := secret.Secret{Env: "SECRET_TEST_UNSET_" + uuid.New().String()[:8]}.Resolve(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("resolves a command's output", func() {
+		Expect(secret.Secret{Command: "echo hunter2"}.Resolve(ctx)).To(Equal("hunter2"))
+	})
+
+	It("fails when the command fails", func() {
+		_, err := secret.Secret{Command: "exit 1"}.Resolve(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("never prints its value", func() {
+		s := secret.Secret{Value: "hunter2"}
+		Expect(fmt.Sprint(s)).NotTo(ContainSubstring("hunter2"))
+		b, err := yaml.Marshal(map[string]secret.Secret{"password": s})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).NotTo(ContainSubstring("hunter2"))
+	})
+
+	It("keeps where the secret lives when redacted", func() {
+		b, err := yaml.Marshal(map[string]secret.Secret{"password": {File: "/run/secrets/sftp"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring("/run/secrets/sftp"))
+	})
+
+	It("decodes a plain string from config", func() {
+		var out struct{ Password secret.Secret }
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook: secret.DecodeHook(),
+			Result:     &out,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		err = decoder.Decode(map[string]any{"password": "hunter2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.Password).To(Equal(secret.Secret{Value: "hunter2"}))
+	})
+})
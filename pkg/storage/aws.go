@@ -2,13 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"os"
 
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/aws/smithy-go"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 )
 
-func newAwsConfig(ctx context.Context) (aws.Config, error) {
+func newAwsConfig(ctx context.Context, opts ...func(*config.LoadOptions) error) (aws.Config, error) {
 	endpoint := os.Getenv("AWS_ENDPOINT")
 	customResolver := aws.EndpointResolverWithOptions(
 		aws.EndpointResolverWithOptionsFunc(
@@ -25,5 +29,27 @@ func newAwsConfig(ctx context.Context) (aws.Config, error) {
 			},
 		),
 	)
-	return config.LoadDefaultConfig(ctx, config.WithEndpointResolverWithOptions(customResolver))
+	opts = append(opts, config.WithEndpointResolverWithOptions(customResolver))
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// authErrorCodes are the AWS error codes meaning the credentials were
+// rejected or lack permission. HEAD requests carry no error body, so a 403
+// only surfaces as "Forbidden".
+var authErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"ExpiredToken":          true,
+	"Forbidden":             true,
+	"InvalidAccessKeyId":    true,
+	"InvalidToken":          true,
+	"SignatureDoesNotMatch": true,
+}
+
+// categorize marks AWS errors caused by bad credentials as auth errors.
+func categorize(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && authErrorCodes[apiErr.ErrorCode()] {
+		return rperrors.WithCategory(err, rperrors.AuthCategory)
+	}
+	return err
 }
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rotisserie/eris"
+)
+
+// Compression is the algorithm used to compress files before upload. It is
+// recorded as the object's Content-Encoding so the stored object describes
+// how to decompress it.
+type Compression string
+
+const (
+	NoCompression   Compression = ""
+	GzipCompression Compression = "gzip"
+	ZstdCompression Compression = "zstd"
+	// ZipCompression stores the file as a zip archive holding just it, the
+	// format emulators load ROMs from. It is only used for loose ROMs, with
+	// S3Config.ZipRoms.
+	ZipCompression Compression = "zip"
+)
+
+func (c Compression) validate() error {
+	switch c {
+	case NoCompression, GzipCompression, ZstdCompression:
+		return nil
+	case ZipCompression:
+		return eris.New("zip compression is only for loose ROMs; set zipRoms instead")
+	}
+	return eris.Errorf("unsupported compression %q", c)
+}
+
+// compressToTemp writes a compressed copy of src, the content of the file
+// called name, to a temporary file and returns it rewound to the beginning.
+// The caller is responsible for closing and removing the file.
+func compressToTemp(src io.Reader, name string, c Compression) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "syncer-*."+string(c))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create temp file")
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	var w io.WriteCloser
+	switch c {
+	case GzipCompression:
+		w = gzip.NewWriter(tmp)
+	case ZstdCompression:
+		w, err = zstd.NewWriter(tmp)
+		if err != nil {
+			cleanup()
+			return nil, eris.Wrap(err, "failed to create zstd writer")
+		}
+	case ZipCompression:
+		zw := zip.NewWriter(tmp)
+		entry, err := zw.Create(name)
+		if err != nil {
+			cleanup()
+			return nil, eris.Wrap(err, "failed to create zip entry")
+		}
+		w = zipEntryWriter{Writer: entry, zw: zw}
+	default:
+		cleanup()
+		return nil, eris.Errorf("unsupported compression %q", c)
+	}
+
+	_, err = io.Copy(w, src)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		cleanup()
+		return nil, eris.Wrap(err, "failed to compress file")
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		cleanup()
+		return nil, eris.Wrap(err, "failed to rewind compressed file")
+	}
+	return tmp, nil
+}
+
+// decompress wraps r to undo compression c.
+func decompress(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case NoCompression:
+		return io.NopCloser(r), nil
+	case GzipCompression:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to create gzip reader")
+		}
+		return zr, nil
+	case ZstdCompression:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to create zstd reader")
+		}
+		return zr.IOReadCloser(), nil
+	case ZipCompression:
+		return unzip(r)
+	}
+	return nil, eris.Errorf("unsupported compression %q", c)
+}
+
+// zipEntryWriter writes the one entry of a zip archive, finishing the
+// archive when closed.
+type zipEntryWriter struct {
+	io.Writer
+	zw *zip.Writer
+}
+
+func (w zipEntryWriter) Close() error {
+	return w.zw.Close()
+}
+
+// unzip reads the one entry of the zip archive read from r. A zip archive
+// can only be read from its end, so it is first copied to a temporary
+// file, removed once the entry is closed.
+func unzip(r io.Reader) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp("", "syncer-*.zip")
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create temp file")
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, eris.Wrap(err, "failed to read zip archive")
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		cleanup()
+		return nil, eris.Wrap(err, "failed to open zip archive")
+	}
+	if len(zr.File) != 1 {
+		cleanup()
+		return nil, eris.Errorf("zip archive holds %d files, want 1", len(zr.File))
+	}
+	entry, err := zr.File[0].Open()
+	if err != nil {
+		cleanup()
+		return nil, eris.Wrapf(err, "failed to open %s in zip archive", zr.File[0].Name)
+	}
+	return unzipReader{ReadCloser: entry, cleanup: cleanup}, nil
+}
+
+// unzipReader removes the temporary copy of the archive along with the
+// entry it reads.
+type unzipReader struct {
+	io.ReadCloser
+	cleanup func()
+}
+
+func (r unzipReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.cleanup()
+	return err
+}
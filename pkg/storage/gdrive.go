@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"path"
 
 	"github.com/TrevorEdris/retropie-utils/pkg/errors"
 	"github.com/TrevorEdris/retropie-utils/pkg/fs"
@@ -34,3 +35,7 @@ func (g *gdrive) Store(ctx context.Context, remoteDir string, file *fs.File) err
 func (g *gdrive) StoreAll(ctx context.Context, remoteDir string, file []*fs.File) error {
 	return errors.NotImplementedError
 }
+
+func (g *gdrive) Key(remoteDir string, file *fs.File) string {
+	return path.Join(remoteDir, file.Dir, file.Name)
+}
@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// DefaultKeyTemplate is the key template of the time layout: every
+	// upload under the sync's time-based remote directory, as dir/name.
+	DefaultKeyTemplate = "{time}/{dir}/{name}"
+
+	// blobKeyTemplate names content-addressed blobs, fanned out by the
+	// first byte of their hash to keep listings manageable.
+	blobKeyTemplate = blobDir + "/{shard}/{sha256}"
+
+	// maxKeyLength is the longest key, in bytes, S3 accepts.
+	maxKeyLength = 1024
+)
+
+// KeyEncoding is how the directories and names of files are written into
+// keys.
+type KeyEncoding string
+
+const (
+	// RawKeys uses directories and names as they are. It is the default.
+	RawKeys KeyEncoding = "raw"
+	// EscapedKeys percent-encodes every byte of directories and names
+	// other than letters, digits, and -_.()!'* (e.g. "Game [!].srm" as
+	// "Game%20%5B!%5D.srm"), so keys are safe for any tool or URL and
+	// decode back to exactly the original path.
+	EscapedKeys KeyEncoding = "escaped"
+)
+
+type (
+	// KeyFields are the values a key template is filled in with.
+	KeyFields struct {
+		// Time is the remote directory of the sync, e.g. "2024/03/01/12".
+		Time string
+		// Dir and Name locate the file relative to the synced root, e.g.
+		// "snes" and "Chrono Trigger.srm".
+		Dir  string
+		Name string
+		// SHA256 is the hex-encoded hash of the file's content.
+		SHA256 string
+		// Device is the ID of the device uploading the file.
+		Device string
+	}
+
+	// KeyBuilder builds object keys from a template of "/"-separated
+	// segments, under an optional prefix shared by everything the syncer
+	// stores. Templates may use the placeholders:
+	//
+	//	{time}    the sync's remote directory, numeric segments such as
+	//	          "2024/03/01/12"
+	//	{dir}     the file's directory
+	//	{system}  the first segment of the file's directory
+	//	{name}    the file's name
+	//	{sha256}  the hash of the file's content
+	//	{shard}   the first two characters of {sha256}
+	//	{device}  the uploading device's ID
+	//
+	// Segments left empty, such as {time} outside a sync, are dropped.
+	KeyBuilder struct {
+		prefix   string
+		template string
+		pattern  *regexp.Regexp
+		fields   []string
+		escaped  bool
+	}
+)
+
+// ParseKeyEncoding parses the name of a KeyEncoding ("raw" or "escaped").
+func ParseKeyEncoding(name string) (KeyEncoding, error) {
+	e := KeyEncoding(strings.ToLower(name))
+	return e, rperrors.WithCategory(e.validate(), rperrors.ConfigCategory)
+}
+
+func (e KeyEncoding) validate() error {
+	switch e {
+	case "", RawKeys, EscapedKeys:
+		return nil
+	}
+	return eris.Errorf("unsupported key encoding %q", e)
+}
+
+var placeholder = regexp.MustCompile(`\{[a-z0-9]+\}`)
+
+// placeholders maps each placeholder to the pattern it matches when parsing
+// a key.
+var placeholders = map[string]string{
+	"{time}":   `\d{4}(?:/\d+)*`,
+	"{dir}":    `.+?`,
+	"{system}": `[^/]+`,
+	"{name}":   `[^/]+`,
+	"{sha256}": `[0-9a-f]{64}`,
+	"{shard}":  `[0-9a-f]{2}`,
+	"{device}": `[^/]+`,
+}
+
+// NewKeyBuilder returns a builder of keys from the template under prefix. The
+// template must name each file uniquely, by its {name} or its {sha256}.
+func NewKeyBuilder(prefix, template string) (KeyBuilder, error) {
+	template = strings.Trim(template, "/")
+	if template == "" {
+		template = DefaultKeyTemplate
+	}
+	b := KeyBuilder{prefix: strings.Trim(prefix, "/"), template: template}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range placeholder.FindAllStringIndex(template, -1) {
+		name := template[loc[0]:loc[1]]
+		expr, ok := placeholders[name]
+		if !ok {
+			return KeyBuilder{}, eris.Errorf("unknown placeholder %s in key template %q", name, template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		// Empty segments are dropped when building, so the segment and its
+		// separator are optional when parsing.
+		fmt.Fprintf(&pattern, "(%s)?", expr)
+		b.fields = append(b.fields, name)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+	if !strings.Contains(template, "{name}") && !strings.Contains(template, "{sha256}") {
+		return KeyBuilder{}, eris.Errorf("key template %q must include {name} or {sha256}", template)
+	}
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return KeyBuilder{}, eris.Wrapf(err, "invalid key template %q", template)
+	}
+	b.pattern = re
+	return b, nil
+}
+
+// Encoded returns the builder writing directories and names with the
+// encoding.
+func (b KeyBuilder) Encoded(e KeyEncoding) KeyBuilder {
+	b.escaped = e == EscapedKeys
+	return b
+}
+
+// Encoding is how the builder writes directories and names.
+func (b KeyBuilder) Encoding() KeyEncoding {
+	if b.escaped {
+		return EscapedKeys
+	}
+	return RawKeys
+}
+
+// Template is the builder's key template.
+func (b KeyBuilder) Template() string {
+	return b.template
+}
+
+// Build returns the key of a file with the given fields.
+func (b KeyBuilder) Build(f KeyFields) string {
+	shard := ""
+	if len(f.SHA256) >= 2 {
+		shard = f.SHA256[:2]
+	}
+	dir := b.EscapePath(f.Dir)
+	system, _, _ := strings.Cut(dir, "/")
+	key := strings.NewReplacer(
+		"{time}", f.Time,
+		"{dir}", dir,
+		"{system}", system,
+		"{name}", b.EscapePath(f.Name),
+		"{sha256}", f.SHA256,
+		"{shard}", shard,
+		"{device}", f.Device,
+	).Replace(b.template)
+	return b.Under(key)
+}
+
+// BuildFile returns the key of the file uploaded in the sync stored under
+// remoteDir. Its content is only hashed if the template needs it. Keys
+// longer than S3 allows are an error.
+func (b KeyBuilder) BuildFile(remoteDir string, file *fs.File, device string) (string, error) {
+	f := KeyFields{
+		Time:   remoteDir,
+		Dir:    file.Dir,
+		Name:   file.Name,
+		Device: device,
+	}
+	if strings.Contains(b.template, "{sha256}") || strings.Contains(b.template, "{shard}") {
+		sum, err := file.Checksum()
+		if err != nil {
+			return "", err
+		}
+		f.SHA256 = sum
+	}
+	key := b.Build(f)
+	if len(key) > maxKeyLength {
+		return "", eris.Errorf("the key of %s is %d bytes, longer than the %d allowed", file.Absolute, len(key), maxKeyLength)
+	}
+	return key, nil
+}
+
+// EscapePath encodes each "/"-separated segment of p with the builder's
+// encoding.
+func (b KeyBuilder) EscapePath(p string) string {
+	if !b.escaped {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = escapeSegment(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// UnescapePath reverses EscapePath. It reports false if p isn't validly
+// encoded.
+func (b KeyBuilder) UnescapePath(p string) (string, bool) {
+	if !b.escaped {
+		return p, true
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", false
+		}
+		segments[i] = unescaped
+	}
+	return strings.Join(segments, "/"), true
+}
+
+// escapeSegment percent-encodes every byte of s but the characters S3
+// documents as safe in keys.
+func escapeSegment(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if keySafe(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func keySafe(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-_.()!'*", c) >= 0
+}
+
+// Under returns the key of rel under the prefix, dropping empty segments.
+func (b KeyBuilder) Under(rel string) string {
+	segments := make([]string, 0)
+	for _, s := range strings.Split(b.prefix+"/"+rel, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Relative returns key without the prefix.
+func (b KeyBuilder) Relative(key string) string {
+	if b.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, b.prefix+"/")
+}
+
+// Root is the directory holding everything under the prefix: "prefix/", or
+// empty without a prefix.
+func (b KeyBuilder) Root() string {
+	if b.prefix == "" {
+		return ""
+	}
+	return b.prefix + "/"
+}
+
+// Parse recovers the fields of a key built by this builder, decoding its
+// directory and name. It reports false if the key doesn't follow the
+// template.
+func (b KeyBuilder) Parse(key string) (KeyFields, bool) {
+	if b.prefix != "" {
+		var ok bool
+		key, ok = strings.CutPrefix(key, b.prefix+"/")
+		if !ok {
+			return KeyFields{}, false
+		}
+	}
+	m := b.pattern.FindStringSubmatch(key)
+	if m == nil {
+		// A dropped leading segment also drops its separator.
+		m = b.pattern.FindStringSubmatch("/" + key)
+		if m == nil {
+			return KeyFields{}, false
+		}
+	}
+	var f KeyFields
+	for i, name := range b.fields {
+		v := m[i+1]
+		switch name {
+		case "{dir}", "{system}", "{name}":
+			var ok bool
+			v, ok = b.UnescapePath(v)
+			if !ok {
+				return KeyFields{}, false
+			}
+		}
+		switch name {
+		case "{time}":
+			f.Time = v
+		case "{dir}":
+			f.Dir = v
+		case "{system}":
+			if f.Dir == "" {
+				f.Dir = v
+			}
+		case "{name}":
+			f.Name = v
+		case "{sha256}":
+			f.SHA256 = v
+		case "{device}":
+			f.Device = v
+		}
+	}
+	return f, true
+}
@@ -0,0 +1,101 @@
+package storage_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+var _ = Describe("KeyBuilder", func() {
+	sum := "ab" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789ab"
+
+	It("builds the time layout by default", func() {
+		keys, err := storage.NewKeyBuilder("/retropie/", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys.Template()).To(Equal(storage.DefaultKeyTemplate))
+		fields := storage.KeyFields{Time: "2024/03/01/12", Dir: "snes", Name: "Game.srm"}
+		Expect(keys.Build(fields)).To(Equal("retropie/2024/03/01/12/snes/Game.srm"))
+	})
+
+	It("drops empty segments", func() {
+		keys, err := storage.NewKeyBuilder("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys.Build(storage.KeyFields{Dir: "snes", Name: "Game.srm"})).To(Equal("snes/Game.srm"))
+	})
+
+	It("fills in every placeholder", func() {
+		keys, err := storage.NewKeyBuilder("", "{device}/{system}/{shard}/{sha256}-{name}")
+		Expect(err).NotTo(HaveOccurred())
+		fields := storage.KeyFields{Dir: "snes/hacks", Name: "Game.srm", SHA256: sum, Device: "pi"}
+		Expect(keys.Build(fields)).To(Equal("pi/snes/ab/" + sum + "-Game.srm"))
+	})
+
+	It("parses the keys it builds", func() {
+		keys, err := storage.NewKeyBuilder("retropie", "")
+		Expect(err).NotTo(HaveOccurred())
+		fields := storage.KeyFields{Time: "2024/03/01/12", Dir: "snes/hacks", Name: "Game.srm"}
+		parsed, ok := keys.Parse(keys.Build(fields))
+		Expect(ok).To(BeTrue())
+		Expect(parsed).To(Equal(fields))
+
+		fields.Time = ""
+		parsed, ok = keys.Parse(keys.Build(fields))
+		Expect(ok).To(BeTrue())
+		Expect(parsed).To(Equal(fields))
+
+		_, ok = keys.Parse("other/2024/03/01/12/snes/Game.srm")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("escapes directories and names so they decode back exactly", func() {
+		keys, err := storage.NewKeyBuilder("retropie", "{time}/{system}/{dir}/{name}")
+		Expect(err).NotTo(HaveOccurred())
+		keys = keys.Encoded(storage.EscapedKeys)
+		Expect(keys.Encoding()).To(Equal(storage.EscapedKeys))
+		fields := storage.KeyFields{Time: "2024/03/01/12", Dir: "snes/Hacks & Mods", Name: "Pokémon #1 [!] 100%.srm"}
+		key := keys.Build(fields)
+		Expect(key).To(Equal("retropie/2024/03/01/12/snes/snes/Hacks%20%26%20Mods/Pok%C3%A9mon%20%231%20%5B!%5D%20100%25.srm"))
+		parsed, ok := keys.Parse(key)
+		Expect(ok).To(BeTrue())
+		Expect(parsed).To(Equal(fields))
+
+		_, ok = keys.Parse("retropie/2024/03/01/12/snes/snes/Game%ZZ.srm")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("leaves names as they are by default", func() {
+		keys, err := storage.NewKeyBuilder("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys.Encoding()).To(Equal(storage.RawKeys))
+		Expect(keys.Build(storage.KeyFields{Dir: "snes", Name: "Game [!].srm"})).To(Equal("snes/Game [!].srm"))
+	})
+
+	It("rejects keys longer than S3 allows", func() {
+		keys, err := storage.NewKeyBuilder("", "")
+		Expect(err).NotTo(HaveOccurred())
+		file := fs.NewFile("/roms/snes/"+strings.Repeat("a", 1100)+".srm", time.Now())
+		_, err = keys.BuildFile("", file, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses key encodings", func() {
+		e, err := storage.ParseKeyEncoding("Escaped")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e).To(Equal(storage.EscapedKeys))
+		_, err = storage.ParseKeyEncoding("base64")
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+	})
+
+	It("rejects templates that don't name files uniquely", func() {
+		_, err := storage.NewKeyBuilder("", "{time}/{dir}")
+		Expect(err).To(HaveOccurred())
+		_, err = storage.NewKeyBuilder("", "{time}/{user}/{name}")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rotisserie/eris"
+)
+
+// latestDir is the remote directory, under any prefix, holding a pointer to
+// the latest upload of each file, at the file's path.
+const latestDir = "latest"
+
+// pointTo records key as the latest upload of the file, so it can be found
+// by the file's path alone. The latest layout's keys are already stable, so
+// it needs no pointers.
+func (s *s3) pointTo(ctx context.Context, file *fs.File, key, sum string) error {
+	if !s.cfg.LatestPointers || s.cfg.Layout == LatestLayout {
+		return nil
+	}
+	p := Pointer{
+		Key:          key,
+		SHA256:       sum,
+		LastModified: file.LastModified,
+		UploadedAt:   clock.Now(ctx),
+		DeviceID:     s.cfg.DeviceID,
+	}
+	pointer := s.pointerKey(file.Dir + "/" + file.Name)
+	err := s.writePointer(ctx, pointer, p)
+	if err != nil {
+		return eris.Wrapf(err, "failed to point %s at %s", pointer, key)
+	}
+	return nil
+}
+
+// Latest finds the latest upload of the file at filePath with a single
+// request for its pointer. With the latest layout, the path gives the key
+// without any request, but not the checksum.
+func (s *s3) Latest(ctx context.Context, filePath string) (Pointer, error) {
+	filePath = strings.Trim(filePath, "/")
+	if s.cfg.Layout == LatestLayout {
+		if root := s.keys.Root(); root != "" && strings.HasPrefix(filePath, root) {
+			return Pointer{}, eris.Wrapf(rperrors.NotFoundError, "%s is a key, not a path", filePath)
+		}
+		dir, name := path.Split(filePath)
+		return Pointer{Key: s.Key("", &fs.File{Dir: strings.TrimSuffix(dir, "/"), Name: name})}, nil
+	}
+	if !s.cfg.LatestPointers {
+		return Pointer{}, eris.Wrap(rperrors.NotFoundError, "latest pointers are disabled")
+	}
+	return s.readPointer(ctx, s.pointerKey(filePath))
+}
+
+// readPointer reads the latest pointer stored at key.
+func (s *s3) readPointer(ctx context.Context, key string) (Pointer, error) {
+	r, err := s.open(ctx, key)
+	if err != nil {
+		return Pointer{}, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return Pointer{}, eris.Wrapf(err, "failed to read latest pointer %s", key)
+	}
+	var ptr Pointer
+	err = json.Unmarshal(b, &ptr)
+	if err != nil {
+		return Pointer{}, eris.Wrapf(err, "failed to parse latest pointer %s", key)
+	}
+	return ptr, nil
+}
+
+// writePointer stores ptr at key.
+func (s *s3) writePointer(ctx context.Context, key string, ptr Pointer) error {
+	b, err := json.Marshal(ptr)
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal latest pointer")
+	}
+	_, err = s.client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket:      aws.String(s.cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return eris.Wrapf(categorize(err), "failed to write latest pointer %s", key)
+	}
+	return nil
+}
+
+func (s *s3) pointerKey(filePath string) string {
+	return s.keys.Under(latestDir + "/" + s.keys.EscapePath(filePath))
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// Layout describes how stored files are named remotely.
+type Layout string
+
+const (
+	// TimeLayout stores every upload under the time-based remote directory
+	// of the sync, one per hour (2024/03/01/12), as dir/name. It is the
+	// default.
+	TimeLayout Layout = "time"
+	// DailyLayout is TimeLayout with a remote directory per day
+	// (2024/03/01), so the last sync of each day is kept.
+	DailyLayout Layout = "daily"
+	// UploadLayout is TimeLayout with a remote directory per sync
+	// (2024/03/01/120503), so no upload ever replaces another.
+	UploadLayout Layout = "upload"
+	// LatestLayout stores each file at dir/name, replacing its previous
+	// upload, so the bucket mirrors the library. Only the latest upload of
+	// a file can be restored, unless the bucket keeps object versions.
+	LatestLayout Layout = "latest"
+	// ContentLayout stores each file once, under its content hash
+	// (blobs/sha256/ab/abcd...), so uploading an unchanged file again costs
+	// nothing. The metadata store maps each path to its blob, and the blob's
+	// name is the checksum to verify it against when it is restored. Only
+	// roms, saves and states are deduplicated; other files, such as the sync
+	// manifest, keep the time-based layout so they can be found by name.
+	ContentLayout Layout = "content"
+)
+
+// blobDir is the remote directory, under any prefix, holding content-addressed
+// blobs.
+const blobDir = "blobs/sha256"
+
+func (l Layout) validate() error {
+	switch l {
+	case "", TimeLayout, DailyLayout, UploadLayout, LatestLayout, ContentLayout:
+		return nil
+	default:
+		return eris.Errorf("unsupported layout %q", l)
+	}
+}
+
+// RemoteDir returns the remote directory, filling in {time} of the key
+// template, of a sync started at t. It is empty for LatestLayout.
+func (l Layout) RemoteDir(t time.Time) string {
+	switch l {
+	case LatestLayout:
+		return ""
+	case DailyLayout:
+		return t.Format("2006/01/02")
+	case UploadLayout:
+		return t.Format("2006/01/02/150405")
+	default:
+		return t.Format("2006/01/02/15")
+	}
+}
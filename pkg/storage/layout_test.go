@@ -0,0 +1,33 @@
+package storage_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+var _ = Describe("Layout", func() {
+	t := time.Date(2024, 3, 1, 12, 5, 3, 0, time.UTC)
+
+	It("names the remote directory of a sync", func() {
+		Expect(storage.Layout("").RemoteDir(t)).To(Equal("2024/03/01/12"))
+		Expect(storage.TimeLayout.RemoteDir(t)).To(Equal("2024/03/01/12"))
+		Expect(storage.DailyLayout.RemoteDir(t)).To(Equal("2024/03/01"))
+		Expect(storage.UploadLayout.RemoteDir(t)).To(Equal("2024/03/01/120503"))
+		Expect(storage.LatestLayout.RemoteDir(t)).To(BeEmpty())
+	})
+
+	It("keys every layout so the key template can parse it", func() {
+		keys, err := storage.NewKeyBuilder("", "")
+		Expect(err).NotTo(HaveOccurred())
+		for _, layout := range []storage.Layout{storage.TimeLayout, storage.DailyLayout, storage.UploadLayout, storage.LatestLayout} {
+			fields := storage.KeyFields{Time: layout.RemoteDir(t), Dir: "snes", Name: "Game.srm"}
+			parsed, ok := keys.Parse(keys.Build(fields))
+			Expect(ok).To(BeTrue(), string(layout))
+			Expect(parsed).To(Equal(fields), string(layout))
+		}
+	})
+})
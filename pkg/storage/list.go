@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rotisserie/eris"
+)
+
+var _ Lister = &s3{}
+
+// List lists every object under the prefix, blobs included, except latest
+// pointers and trashed objects.
+func (s *s3) List(ctx context.Context) ([]Object, error) {
+	root := s.keys.Root()
+	objects := make([]Object, 0)
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(root),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, eris.Wrap(categorize(err), "failed to list uploads")
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			rel := strings.TrimPrefix(key, root)
+			if strings.HasPrefix(rel, latestDir+"/") || strings.HasPrefix(rel, trashDir+"/") {
+				continue
+			}
+			objects = append(objects, Object{
+				Key:          key,
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+				Blob:         strings.HasPrefix(rel, blobDir+"/"),
+			})
+		}
+	}
+	return objects, nil
+}
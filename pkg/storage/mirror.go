@@ -0,0 +1,433 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type (
+	// Mirror is a named storage backend: either the primary one, or one
+	// that keeps a copy of everything stored in it. The name is used for
+	// logging and the retry journal.
+	Mirror struct {
+		Name    string
+		Storage Storage
+	}
+
+	// Flusher is implemented by storages that finish storing files in the
+	// background. Flush waits until everything stored so far is wherever
+	// it is going, or has been set aside to be retried.
+	Flusher interface {
+		Flush(ctx context.Context) error
+	}
+
+	// MirrorJob is a file waiting to be stored in a mirror.
+	MirrorJob struct {
+		Mirror    string      `json:"mirror"`
+		RemoteDir string      `json:"remoteDir"`
+		Path      string      `json:"path"`
+		Dir       string      `json:"dir"`
+		Parent    string      `json:"parent,omitempty"`
+		FileType  fs.FileType `json:"fileType"`
+		QueuedAt  time.Time   `json:"queuedAt"`
+	}
+
+	mirrored struct {
+		primary Mirror
+		mirrors map[string]*mirrorWorker
+		// order lists the mirrors in the order they are read from when the
+		// primary is unavailable.
+		order []*mirrorWorker
+		// journal is where jobs that failed are kept until they are
+		// retried, if anywhere.
+		journal string
+
+		mu     sync.Mutex
+		failed []MirrorJob
+		wg     sync.WaitGroup
+	}
+
+	mirrorWorker struct {
+		Mirror
+		mu          sync.Mutex
+		queue       []mirrorTask
+		running     bool
+		initialized bool
+	}
+
+	mirrorTask struct {
+		ctx  context.Context
+		job  MirrorJob
+		file *fs.File
+	}
+)
+
+var (
+	_ Storage      = &mirrored{}
+	_ Flusher      = &mirrored{}
+	_ Prefetcher   = &mirrored{}
+	_ Retriever    = &mirrored{}
+	_ Preflighter  = &mirrored{}
+	_ LatestFinder = &mirrored{}
+)
+
+// NewMirroredStorage wraps primary so every file stored in it is then
+// stored in each of the mirrors too, in the background, one file at a time
+// per mirror. Everything else only uses the primary, except that downloads
+// fall back to the mirrors, in order, while the primary can't be reached.
+// Files a mirror fails to store are kept in the journal at journal and
+// retried when the storage is next initialized; with no journal they are
+// only logged.
+func NewMirroredStorage(primary Mirror, mirrors []Mirror, journal string) Storage {
+	m := &mirrored{
+		primary: primary,
+		mirrors: make(map[string]*mirrorWorker, len(mirrors)),
+		journal: journal,
+	}
+	for _, mirror := range mirrors {
+		w := &mirrorWorker{Mirror: mirror}
+		m.mirrors[mirror.Name] = w
+		m.order = append(m.order, w)
+	}
+	return m
+}
+
+// Init initializes the primary storage, then queues the files the mirrors
+// failed to store before. The mirrors are initialized when first used.
+func (m *mirrored) Init(ctx context.Context) error {
+	err := m.primary.Storage.Init(ctx)
+	if err != nil {
+		return err
+	}
+	if m.journal == "" {
+		return nil
+	}
+	jobs, err := LoadMirrorJournal(m.journal)
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to read mirror journal", zap.Error(err))
+		return nil
+	}
+	for _, job := range jobs {
+		f, err := job.file()
+		if err != nil {
+			log.FromCtx(ctx).Warn("Dropping file queued for mirror", zap.String("mirror", job.Mirror), zap.String("file", job.Path), zap.Error(err))
+			continue
+		}
+		m.enqueue(ctx, job, f)
+	}
+	return nil
+}
+
+// Store stores the file in the primary storage, then queues it for each
+// mirror.
+func (m *mirrored) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	err := m.primary.Storage.Store(ctx, remoteDir, file)
+	if err != nil {
+		return err
+	}
+	for name := range m.mirrors {
+		m.enqueue(ctx, MirrorJob{
+			Mirror:    name,
+			RemoteDir: remoteDir,
+			Path:      file.Absolute,
+			Dir:       file.Dir,
+			Parent:    file.Parent,
+			FileType:  file.FileType,
+			QueuedAt:  clock.Now(ctx),
+		}, file)
+	}
+	return nil
+}
+
+func (m *mirrored) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	for _, f := range files {
+		err := m.Store(ctx, remoteDir, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mirrored) Key(remoteDir string, file *fs.File) string {
+	return m.primary.Storage.Key(remoteDir, file)
+}
+
+// Prefetch prefetches the primary storage, if it supports it.
+func (m *mirrored) Prefetch(ctx context.Context) error {
+	prefetcher, ok := m.primary.Storage.(Prefetcher)
+	if !ok {
+		return nil
+	}
+	return prefetcher.Prefetch(ctx)
+}
+
+// Retrieve downloads from the primary storage, or from the first mirror
+// that has key if the primary can't be reached. A mirror only has the keys
+// it shares with the primary, e.g. when neither adds a prefix. Nothing
+// falls back once part of the download has been written to w.
+func (m *mirrored) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	cw := &countingWriter{w: w}
+	var err error
+	return m.failover(ctx, "retrieve", func(s Storage) error {
+		if cw.n > 0 {
+			// The download must be started over, so keep its error.
+			return err
+		}
+		retriever, ok := s.(Retriever)
+		if !ok {
+			return eris.Wrap(rperrors.NotImplementedError, "storage does not support downloads")
+		}
+		err = retriever.Retrieve(ctx, key, cw)
+		return err
+	})
+}
+
+// Latest finds the latest upload of the file at path in the primary
+// storage, or in the first mirror that keeps latest pointers if the
+// primary can't be reached. It returns errors.NotFoundError if the storage
+// that answers keeps no pointers.
+func (m *mirrored) Latest(ctx context.Context, path string) (Pointer, error) {
+	var ptr Pointer
+	err := m.failover(ctx, "latest", func(s Storage) error {
+		finder, ok := s.(LatestFinder)
+		if !ok {
+			return eris.Wrap(rperrors.NotFoundError, "storage keeps no latest pointers")
+		}
+		var err error
+		ptr, err = finder.Latest(ctx, path)
+		return err
+	})
+	return ptr, err
+}
+
+// failover runs fn against the primary storage, then against each mirror in
+// turn for as long as the storage it ran against couldn't be reached. It
+// logs which storage served the operation, and returns the primary's error
+// if none did.
+func (m *mirrored) failover(ctx context.Context, op string, fn func(Storage) error) error {
+	err := fn(m.primary.Storage)
+	if !unavailable(err) {
+		log.FromCtx(ctx).Debug("Storage operation served", zap.String("op", op), zap.String("backend", m.primary.Name), zap.Error(err))
+		return err
+	}
+	for _, mirror := range m.order {
+		log.FromCtx(ctx).Warn("Storage unavailable; falling back to mirror",
+			zap.String("op", op),
+			zap.String("backend", mirror.Name),
+			zap.Error(err),
+		)
+		mirrorErr := fn(mirror.Storage)
+		if mirrorErr == nil {
+			log.FromCtx(ctx).Info("Storage operation served by mirror", zap.String("op", op), zap.String("backend", mirror.Name))
+			return nil
+		}
+		if !unavailable(mirrorErr) {
+			log.FromCtx(ctx).Warn("Mirror failed", zap.String("op", op), zap.String("backend", mirror.Name), zap.Error(mirrorErr))
+			if eris.Is(mirrorErr, rperrors.NotImplementedError) || eris.Is(mirrorErr, rperrors.NotFoundError) {
+				continue
+			}
+			return mirrorErr
+		}
+	}
+	return err
+}
+
+// Preflight checks the primary storage, if it supports it. A mirror that
+// can't be reached only delays its own copies.
+func (m *mirrored) Preflight(ctx context.Context) error {
+	preflighter, ok := m.primary.Storage.(Preflighter)
+	if !ok {
+		return nil
+	}
+	return preflighter.Preflight(ctx)
+}
+
+// Flush waits for the mirrors to store every file queued so far, then
+// journals those that failed so the next Init retries them.
+func (m *mirrored) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.mu.Lock()
+	failed := m.failed
+	m.failed = nil
+	m.mu.Unlock()
+	if m.journal == "" {
+		if len(failed) > 0 {
+			log.FromCtx(ctx).Warn("Files not mirrored", zap.Int("files", len(failed)))
+		}
+		return nil
+	}
+	if len(failed) > 0 {
+		log.FromCtx(ctx).Warn("Files left to mirror on the next sync", zap.Int("files", len(failed)))
+	}
+	return SaveMirrorJournal(m.journal, failed)
+}
+
+// enqueue queues the job with its mirror, starting the mirror's worker if
+// it isn't running.
+func (m *mirrored) enqueue(ctx context.Context, job MirrorJob, file *fs.File) {
+	w, ok := m.mirrors[job.Mirror]
+	if !ok {
+		// The mirror has since been removed from the config.
+		return
+	}
+	m.wg.Add(1)
+	w.mu.Lock()
+	w.queue = append(w.queue, mirrorTask{ctx: ctx, job: job, file: file})
+	start := !w.running
+	w.running = true
+	w.mu.Unlock()
+	if start {
+		go m.work(w)
+	}
+}
+
+// work stores the files queued for a mirror until there are none left.
+func (m *mirrored) work(w *mirrorWorker) {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		task := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		err := w.store(task)
+		if err != nil {
+			log.FromCtx(task.ctx).Warn("Failed to mirror file",
+				zap.String("mirror", w.Name),
+				zap.String("file", task.job.Path),
+				zap.Error(err),
+			)
+			// A mirror that can't store files at all never will.
+			if !eris.Is(err, rperrors.NotImplementedError) {
+				m.mu.Lock()
+				m.failed = append(m.failed, task.job)
+				m.mu.Unlock()
+			}
+		}
+		m.wg.Done()
+	}
+}
+
+// store initializes the mirror the first time it is used, then stores the
+// task's file in it.
+func (w *mirrorWorker) store(task mirrorTask) error {
+	if task.ctx.Err() != nil {
+		return task.ctx.Err()
+	}
+	if !w.initialized {
+		err := w.Storage.Init(task.ctx)
+		if err != nil {
+			return err
+		}
+		w.initialized = true
+	}
+	return w.Storage.Store(task.ctx, task.job.RemoteDir, task.file)
+}
+
+// unavailable reports whether err means the storage couldn't be reached,
+// including because its circuit breaker is open.
+func unavailable(err error) bool {
+	return err != nil && rperrors.CategoryOf(err) == rperrors.NetworkCategory
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// file rebuilds the file the job stores from what is on disk now.
+func (job MirrorJob) file() (*fs.File, error) {
+	info, err := os.Stat(job.Path)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to stat %s", job.Path)
+	}
+	f := fs.NewFile(job.Path, info.ModTime())
+	f.Dir = job.Dir
+	f.Parent = job.Parent
+	f.FileType = job.FileType
+	f.Size = info.Size()
+	return f, nil
+}
+
+// LoadMirrorJournal reads the files waiting to be stored in mirrors from
+// the journal at path. A missing journal has none.
+func LoadMirrorJournal(path string) ([]MirrorJob, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to read mirror journal %s", path)
+	}
+	var jobs []MirrorJob
+	err = json.Unmarshal(b, &jobs)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to parse mirror journal %s", path)
+	}
+	return jobs, nil
+}
+
+// SaveMirrorJournal replaces the journal at path with jobs, atomically. No
+// jobs removes it.
+func SaveMirrorJournal(path string, jobs []MirrorJob) error {
+	if len(jobs) == 0 {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return eris.Wrapf(err, "failed to remove mirror journal %s", path)
+		}
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return eris.Wrap(err, "failed to create mirror journal directory")
+	}
+	b, err := json.Marshal(jobs)
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal mirror journal")
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write mirror journal %s", tmp)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return eris.Wrapf(err, "failed to replace mirror journal %s", path)
+	}
+	return nil
+}
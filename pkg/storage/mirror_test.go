@@ -0,0 +1,105 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+)
+
+var _ = Describe("Mirror", func() {
+	var (
+		dir     string
+		journal string
+		file    *fs.File
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		journal = filepath.Join(dir, "state", "mirror-queue.json")
+		p := filepath.Join(dir, "Game.srm")
+		Expect(os.WriteFile(p, []byte("save"), 0644)).To(Succeed())
+		file = fs.NewFile(p, time.Now())
+		file.Dir = "snes"
+	})
+
+	It("stores files in the primary and every mirror", func() {
+		primary := &flakyStorage{}
+		mirror := &flakyStorage{}
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: primary}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, journal)
+		Expect(client.Init(context.TODO())).To(Succeed())
+		Expect(client.Store(context.TODO(), "", file)).To(Succeed())
+		Expect(client.(storage.Flusher).Flush(context.TODO())).To(Succeed())
+		Expect(primary.calls).To(Equal(1))
+		Expect(mirror.calls).To(Equal(1))
+		Expect(journal).NotTo(BeAnExistingFile())
+	})
+
+	It("fails when the primary does, without mirroring", func() {
+		mirror := &flakyStorage{}
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: &flakyStorage{failures: 1}}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, journal)
+		Expect(client.Store(context.TODO(), "", file)).NotTo(Succeed())
+		Expect(client.(storage.Flusher).Flush(context.TODO())).To(Succeed())
+		Expect(mirror.calls).To(Equal(0))
+	})
+
+	It("journals files a mirror fails to store and retries them on Init", func() {
+		mirror := &flakyStorage{failures: 1}
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: &flakyStorage{}}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, journal)
+		Expect(client.Store(context.TODO(), "", file)).To(Succeed())
+		Expect(client.(storage.Flusher).Flush(context.TODO())).To(Succeed())
+
+		jobs, err := storage.LoadMirrorJournal(journal)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].Mirror).To(Equal("rclone"))
+		Expect(jobs[0].Path).To(Equal(file.Absolute))
+		Expect(jobs[0].Dir).To(Equal("snes"))
+
+		client = storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: &flakyStorage{}}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, journal)
+		Expect(client.Init(context.TODO())).To(Succeed())
+		Expect(client.(storage.Flusher).Flush(context.TODO())).To(Succeed())
+		Expect(mirror.calls).To(Equal(2))
+		Expect(journal).NotTo(BeAnExistingFile())
+	})
+
+	It("drops journaled files that no longer exist", func() {
+		mirror := &flakyStorage{}
+		Expect(storage.SaveMirrorJournal(journal, []storage.MirrorJob{
+			{Mirror: "rclone", Path: filepath.Join(dir, "Gone.srm")},
+		})).To(Succeed())
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: &flakyStorage{}}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, journal)
+		Expect(client.Init(context.TODO())).To(Succeed())
+		Expect(client.(storage.Flusher).Flush(context.TODO())).To(Succeed())
+		Expect(mirror.calls).To(Equal(0))
+		Expect(journal).NotTo(BeAnExistingFile())
+	})
+	It("downloads from a mirror while the primary is unreachable", func() {
+		primary := storagetest.NewFake()
+		primary.Err = errors.CircuitOpenError
+		mirror := storagetest.NewFake()
+		Expect(mirror.Store(context.TODO(), "", file)).To(Succeed())
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: primary}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, "")
+		buf := &bytes.Buffer{}
+		Expect(client.(storage.Retriever).Retrieve(context.TODO(), "snes/Game.srm", buf)).To(Succeed())
+		Expect(buf.String()).To(Equal("save"))
+	})
+
+	It("does not fall back when the primary fails otherwise", func() {
+		mirror := storagetest.NewFake()
+		Expect(mirror.Store(context.TODO(), "", file)).To(Succeed())
+		client := storage.NewMirroredStorage(storage.Mirror{Name: "s3", Storage: storagetest.NewFake()}, []storage.Mirror{{Name: "rclone", Storage: mirror}}, "")
+		buf := &bytes.Buffer{}
+		Expect(client.(storage.Retriever).Retrieve(context.TODO(), "snes/Game.srm", buf)).To(MatchError(errors.NotFoundError))
+		Expect(buf.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const (
+	// minPartSize is the smallest part size S3 accepts for every part but the last.
+	minPartSize int64 = 5 * 1024 * 1024
+
+	defaultMultipartThreshold int64 = 100 * 1024 * 1024
+	defaultPartSize           int64 = 16 * 1024 * 1024
+	defaultMaxPartRetries           = 3
+)
+
+type (
+	// MultipartConfig controls how large files are uploaded. Files at or above
+	// Threshold bytes are uploaded in PartSize chunks, and the progress of each
+	// upload is journaled to JournalDir so an interrupted upload can resume from
+	// the last completed part on the next Store.
+	MultipartConfig struct {
+		Threshold      int64
+		PartSize       int64
+		MaxPartRetries int
+		JournalDir     string
+	}
+
+	// uploadJournal is the on-disk record of an in-progress multipart upload.
+	uploadJournal struct {
+		Bucket       string          `json:"bucket"`
+		Key          string          `json:"key"`
+		UploadID     string          `json:"uploadId"`
+		Size         int64           `json:"size"`
+		LastModified time.Time       `json:"lastModified"`
+		PartSize     int64           `json:"partSize"`
+		Parts        []completedPart `json:"parts"`
+	}
+
+	completedPart struct {
+		Number int32  `json:"number"`
+		ETag   string `json:"etag"`
+	}
+)
+
+func (c MultipartConfig) withDefaults() MultipartConfig {
+	if c.Threshold <= 0 {
+		c.Threshold = defaultMultipartThreshold
+	}
+	if c.PartSize <= 0 {
+		c.PartSize = defaultPartSize
+	}
+	if c.PartSize < minPartSize {
+		c.PartSize = minPartSize
+	}
+	if c.MaxPartRetries <= 0 {
+		c.MaxPartRetries = defaultMaxPartRetries
+	}
+	if c.JournalDir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			cacheDir = os.TempDir()
+		}
+		c.JournalDir = filepath.Join(cacheDir, "retropie-utils", "uploads")
+	}
+	return c
+}
+
+// multipartUpload uploads the file in parts, resuming a previously interrupted
+// upload of the same file to the same key when a matching journal exists.
+func (s *s3) multipartUpload(ctx context.Context, f *os.File, key string, file *fs.File, size int64, metadata map[string]string) error {
+	mp := s.cfg.Multipart
+	journalPath := s.journalPath(file)
+
+	journal, err := s.resumeJournal(ctx, journalPath, key, file, size)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		out, err := s.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+			Bucket:          aws.String(s.cfg.Bucket),
+			Key:             aws.String(key),
+			ContentType:     aws.String(file.ContentType()),
+			ContentEncoding: s.contentEncoding(file),
+			Metadata:        metadata,
+			Tagging:         s.tagging(file),
+		})
+		if err != nil {
+			return eris.Wrap(categorize(err), "failed to create multipart upload")
+		}
+		journal = &uploadJournal{
+			Bucket:       s.cfg.Bucket,
+			Key:          key,
+			UploadID:     aws.ToString(out.UploadId),
+			Size:         size,
+			LastModified: file.LastModified,
+			PartSize:     mp.PartSize,
+		}
+		err = journal.save(journalPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.FromCtx(ctx).Info("Resuming multipart upload",
+			zap.String("key", key),
+			zap.Int("completedParts", len(journal.Parts)),
+		)
+	}
+
+	done := make(map[int32]bool, len(journal.Parts))
+	for _, p := range journal.Parts {
+		done[p.Number] = true
+	}
+
+	reporter := progress.FromCtx(ctx)
+	var uploaded int64
+	numParts := int32((size + journal.PartSize - 1) / journal.PartSize)
+	for n := int32(1); n <= numParts; n++ {
+		if done[n] {
+			uploaded += partLength(size, journal.PartSize, n)
+			continue
+		}
+		offset := int64(n-1) * journal.PartSize
+		length := partLength(size, journal.PartSize, n)
+		etag, err := s.uploadPart(ctx, journal, n, io.NewSectionReader(f, offset, length), length)
+		if err != nil {
+			return err
+		}
+		uploaded += length
+		reporter.Update(uploaded, size)
+		journal.Parts = append(journal.Parts, completedPart{Number: n, ETag: etag})
+		err = journal.save(journalPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(journal.Parts, func(i, j int) bool {
+		return journal.Parts[i].Number < journal.Parts[j].Number
+	})
+	parts := make([]types.CompletedPart, 0, len(journal.Parts))
+	for _, p := range journal.Parts {
+		parts = append(parts, types.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int32(p.Number),
+		})
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(journal.Bucket),
+		Key:             aws.String(journal.Key),
+		UploadId:        aws.String(journal.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return eris.Wrap(categorize(err), "failed to complete multipart upload")
+	}
+
+	err = os.Remove(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.FromCtx(ctx).Warn("Failed to remove upload journal", zap.String("journal", journalPath), zap.Error(err))
+	}
+	return nil
+}
+
+// partLength returns the length of the numbered part of a file of the given size.
+func partLength(size, partSize int64, number int32) int64 {
+	offset := int64(number-1) * partSize
+	if offset+partSize > size {
+		return size - offset
+	}
+	return partSize
+}
+
+// uploadPart uploads a single part, retrying up to MaxPartRetries times.
+func (s *s3) uploadPart(ctx context.Context, journal *uploadJournal, number int32, body *io.SectionReader, length int64) (string, error) {
+	var lastErr error
+	for attempt := 1; attempt <= s.cfg.Multipart.MaxPartRetries; attempt++ {
+		_, err := body.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", eris.Wrap(err, "failed to rewind part")
+		}
+		out, err := s.client.UploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:        aws.String(journal.Bucket),
+			Key:           aws.String(journal.Key),
+			UploadId:      aws.String(journal.UploadID),
+			PartNumber:    aws.Int32(number),
+			ContentLength: aws.Int64(length),
+			Body:          body,
+		})
+		if err == nil {
+			return aws.ToString(out.ETag), nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		log.FromCtx(ctx).Warn("Failed to upload part",
+			zap.String("key", journal.Key),
+			zap.Int32("part", number),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+	}
+	return "", eris.Wrapf(categorize(lastErr), "failed to upload part %d", number)
+}
+
+// resumeJournal returns the journal for a resumable upload of the file, or nil
+// if the upload must start from scratch. Journals describing a different
+// version of the file or another key, such as the previous hour's directory,
+// are discarded and their uploads aborted, as are those of uploads S3 no
+// longer knows about.
+func (s *s3) resumeJournal(ctx context.Context, journalPath, key string, file *fs.File, size int64) (*uploadJournal, error) {
+	journal, err := loadJournal(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	if journal == nil {
+		return nil, nil
+	}
+
+	if journal.Bucket != s.cfg.Bucket || journal.Key != key || journal.Size != size || !journal.LastModified.Equal(file.LastModified) {
+		log.FromCtx(ctx).Info("Discarding stale upload journal", zap.String("journal", journalPath))
+		s.abortUpload(ctx, journal)
+		return nil, os.Remove(journalPath)
+	}
+
+	// S3 is the source of truth for which parts actually made it.
+	parts := make([]completedPart, 0, len(journal.Parts))
+	paginator := awss3.NewListPartsPaginator(s.client, &awss3.ListPartsInput{
+		Bucket:   aws.String(journal.Bucket),
+		Key:      aws.String(journal.Key),
+		UploadId: aws.String(journal.UploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			// ListParts doesn't model NoSuchUpload, so it only shows as
+			// the error code.
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload" {
+				log.FromCtx(ctx).Info("Multipart upload no longer exists; restarting", zap.String("key", key))
+				return nil, os.Remove(journalPath)
+			}
+			return nil, eris.Wrap(err, "failed to list uploaded parts")
+		}
+		for _, p := range page.Parts {
+			parts = append(parts, completedPart{
+				Number: aws.ToInt32(p.PartNumber),
+				ETag:   aws.ToString(p.ETag),
+			})
+		}
+	}
+	journal.Parts = parts
+	return journal, nil
+}
+
+func (s *s3) abortUpload(ctx context.Context, journal *uploadJournal) {
+	_, err := s.client.AbortMultipartUpload(ctx, &awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(journal.Bucket),
+		Key:      aws.String(journal.Key),
+		UploadId: aws.String(journal.UploadID),
+	})
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to abort multipart upload", zap.String("key", journal.Key), zap.Error(err))
+	}
+}
+
+// journalPath is unique per bucket and local file, but not per key, so an
+// upload to a key that has since changed is found and aborted rather than
+// left behind.
+func (s *s3) journalPath(file *fs.File) string {
+	sum := sha256.Sum256([]byte(s.cfg.Bucket + "\x00" + file.Absolute))
+	return filepath.Join(s.cfg.Multipart.JournalDir, hex.EncodeToString(sum[:])+".json")
+}
+
+func loadJournal(path string) (*uploadJournal, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read upload journal")
+	}
+	journal := &uploadJournal{}
+	err = json.Unmarshal(b, journal)
+	if err != nil {
+		// A corrupt journal only costs us the resume; start over.
+		return nil, os.Remove(path)
+	}
+	return journal, nil
+}
+
+func (j *uploadJournal) save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return eris.Wrap(err, "failed to create upload journal directory")
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		return eris.Wrap(err, "failed to marshal upload journal")
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return eris.Wrap(err, "failed to write upload journal")
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,206 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+// partSize is the smallest part S3 accepts, so the file below is uploaded in
+// three parts.
+const partSize = 5 * 1024 * 1024
+
+var _ = Describe("Multipart uploads", func() {
+	var (
+		mu sync.Mutex
+		// uploads holds the parts of each upload in progress, by ID.
+		uploads map[string]map[int][]byte
+		// keys holds the key of each upload in progress, by ID.
+		keys map[string]string
+		// objects holds the completed uploads, by key.
+		objects  map[string][]byte
+		requests []string
+		aborted  []string
+		// failPart, if set, is a part number that fails to upload.
+		failPart int
+		nextID   int
+
+		journals string
+		content  []byte
+		file     *fs.File
+		client   storage.Storage
+	)
+
+	BeforeEach(func() {
+		uploads = make(map[string]map[int][]byte)
+		keys = make(map[string]string)
+		objects = make(map[string][]byte)
+		requests = nil
+		aborted = nil
+		failPart = 0
+		nextID = 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			key := r.URL.Path
+			query := r.URL.Query()
+			id := query.Get("uploadId")
+			switch {
+			case r.Method == http.MethodPost && query.Has("uploads"):
+				nextID++
+				id = fmt.Sprintf("upload-%d", nextID)
+				uploads[id] = make(map[int][]byte)
+				keys[id] = key
+				requests = append(requests, "create "+key)
+				fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+			case r.Method == http.MethodPut && id != "":
+				n, err := strconv.Atoi(query.Get("partNumber"))
+				Expect(err).NotTo(HaveOccurred())
+				requests = append(requests, fmt.Sprintf("part %d", n))
+				body, err := io.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+				if n == failPart {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte("<Error><Code>InvalidRequest</Code></Error>"))
+					return
+				}
+				uploads[id][n] = body
+				w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+			case r.Method == http.MethodGet && id != "":
+				parts, ok := uploads[id]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte("<Error><Code>NoSuchUpload</Code></Error>"))
+					return
+				}
+				body := "<ListPartsResult><IsTruncated>false</IsTruncated>"
+				for n := range parts {
+					body += fmt.Sprintf(`<Part><PartNumber>%d</PartNumber><ETag>"etag-%d"</ETag></Part>`, n, n)
+				}
+				_, _ = w.Write([]byte(body + "</ListPartsResult>"))
+			case r.Method == http.MethodPost && id != "":
+				parts := uploads[id]
+				numbers := make([]int, 0, len(parts))
+				for n := range parts {
+					numbers = append(numbers, n)
+				}
+				sort.Ints(numbers)
+				var object []byte
+				for _, n := range numbers {
+					object = append(object, parts[n]...)
+				}
+				objects[key] = object
+				delete(uploads, id)
+				requests = append(requests, "complete "+key)
+				_, _ = w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+			case r.Method == http.MethodDelete && id != "":
+				Expect(keys[id]).To(Equal(key))
+				delete(uploads, id)
+				aborted = append(aborted, id)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				Fail("unexpected request " + r.Method + " " + r.URL.String())
+			}
+		}))
+		DeferCleanup(server.Close)
+		GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+		GinkgoT().Setenv("AWS_REGION", "us-east-1")
+		GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+		GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+		dir := GinkgoT().TempDir()
+		journals = filepath.Join(dir, "journals")
+		content = bytes.Repeat([]byte("0123456789abcdef"), (2*partSize+partSize/2)/16)
+		path := filepath.Join(dir, "psx", "Game.bin")
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+		file = fs.NewFile(path, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+		file.Dir = "psx"
+
+		var err error
+		client, err = storage.NewS3Storage(context.TODO(), storage.S3Config{
+			Enabled: true,
+			Bucket:  "retropie-sync",
+			Multipart: storage.MultipartConfig{
+				Threshold:      1,
+				PartSize:       partSize,
+				MaxPartRetries: 1,
+				JournalDir:     journals,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// interrupt fails an upload of the file to remoteDir at its second part.
+	interrupt := func(remoteDir string) {
+		failPart = 2
+		Expect(client.Store(context.TODO(), remoteDir, file)).NotTo(Succeed())
+		Expect(os.ReadDir(journals)).To(HaveLen(1))
+		mu.Lock()
+		failPart = 0
+		requests = nil
+		mu.Unlock()
+	}
+
+	It("resumes an interrupted upload after its last completed part", func() {
+		interrupt("2024/03/01/12")
+		Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+		Expect(requests).To(Equal([]string{"part 2", "part 3", "complete /retropie-sync/2024/03/01/12/psx/Game.bin"}))
+		Expect(objects["/retropie-sync/2024/03/01/12/psx/Game.bin"]).To(Equal(content))
+		Expect(aborted).To(BeEmpty())
+		Expect(os.ReadDir(journals)).To(BeEmpty())
+	})
+
+	It("aborts an interrupted upload to a key that has since changed", func() {
+		interrupt("2024/03/01/12")
+		Expect(client.Store(context.TODO(), "2024/03/01/13", file)).To(Succeed())
+		Expect(aborted).To(Equal([]string{"upload-1"}))
+		Expect(requests).To(Equal([]string{
+			"create /retropie-sync/2024/03/01/13/psx/Game.bin",
+			"part 1", "part 2", "part 3",
+			"complete /retropie-sync/2024/03/01/13/psx/Game.bin",
+		}))
+		Expect(objects["/retropie-sync/2024/03/01/13/psx/Game.bin"]).To(Equal(content))
+		Expect(os.ReadDir(journals)).To(BeEmpty())
+	})
+
+	It("aborts an interrupted upload of a file that has since changed", func() {
+		interrupt("2024/03/01/12")
+		file.LastModified = file.LastModified.Add(time.Minute)
+		Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+		Expect(aborted).To(Equal([]string{"upload-1"}))
+		Expect(requests).To(HaveLen(5))
+		Expect(os.ReadDir(journals)).To(BeEmpty())
+	})
+
+	It("restarts an upload S3 no longer knows about", func() {
+		interrupt("2024/03/01/12")
+		mu.Lock()
+		delete(uploads, "upload-1")
+		mu.Unlock()
+		Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+		Expect(requests).To(Equal([]string{
+			"create /retropie-sync/2024/03/01/12/psx/Game.bin",
+			"part 1", "part 2", "part 3",
+			"complete /retropie-sync/2024/03/01/12/psx/Game.bin",
+		}))
+		Expect(objects["/retropie-sync/2024/03/01/12/psx/Game.bin"]).To(Equal(content))
+		Expect(os.ReadDir(journals)).To(BeEmpty())
+	})
+})
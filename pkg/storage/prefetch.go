@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// blobIndex is the set of blob keys known to be stored.
+type blobIndex struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (idx *blobIndex) has(key string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.keys[key]
+}
+
+func (idx *blobIndex) add(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.keys[key] = true
+}
+
+// Prefetch lists the stored blobs, so storing a file in the content layout
+// no longer checks whether its blob exists. It does nothing for the time
+// layout, which never checks.
+func (s *s3) Prefetch(ctx context.Context) error {
+	if s.cfg.Layout != ContentLayout || !s.cfg.Enabled {
+		return nil
+	}
+	prefix := s.keys.Under(blobDir) + "/"
+	idx := &blobIndex{keys: make(map[string]bool)}
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return eris.Wrap(categorize(err), "failed to list stored blobs")
+		}
+		for _, obj := range page.Contents {
+			idx.keys[aws.ToString(obj.Key)] = true
+		}
+	}
+	log.FromCtx(ctx).Debug("Prefetched stored blobs", zap.Int("blobs", len(idx.keys)))
+	s.blobs = idx
+	return nil
+}
+
+// stored notes that the file was stored at key.
+func (s *s3) stored(file *fs.File, key string) {
+	if s.blobs != nil && s.deduplicates(file) {
+		s.blobs.add(key)
+	}
+}
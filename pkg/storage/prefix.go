@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+var _ PrefixMover = &s3{}
+
+// MovePrefix moves every object under from, uploads, blobs, trash, and
+// latest pointers alike, to the same key under to, keeping its metadata.
+// Latest pointers are rewritten to point at the moved uploads. Objects are
+// listed before any is moved, so a failed move can be run again to finish.
+func (s *s3) MovePrefix(ctx context.Context, from, to string, dryRun bool) ([]Move, error) {
+	from = strings.Trim(from, "/") + "/"
+	to = strings.Trim(to, "/") + "/"
+	keys := make([]string, 0)
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(from),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, eris.Wrapf(categorize(err), "failed to list %s", from)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+
+	moves := make([]Move, 0, len(keys))
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return moves, ctx.Err()
+		}
+		rel := strings.TrimPrefix(key, from)
+		m := Move{From: key, To: to + rel}
+		if !dryRun {
+			var err error
+			if strings.HasPrefix(rel, latestDir+"/") {
+				err = s.movePointer(ctx, m, from, to)
+			} else {
+				err = s.moveObject(ctx, m)
+			}
+			if err != nil {
+				return moves, err
+			}
+			log.FromCtx(ctx).Debug("Moved object", zap.String("from", m.From), zap.String("to", m.To))
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+// moveObject moves an object, keeping its metadata, content type, and
+// encoding.
+func (s *s3) moveObject(ctx context.Context, m Move) error {
+	head, err := s.head(ctx, m.From)
+	if err != nil {
+		return err
+	}
+	err = s.move(ctx, m.From, m.To, head, head.Metadata)
+	if err != nil {
+		return eris.Wrapf(err, "failed to move %s to %s", m.From, m.To)
+	}
+	return nil
+}
+
+// movePointer moves a latest pointer, pointing it at the upload's key under
+// the new prefix.
+func (s *s3) movePointer(ctx context.Context, m Move, from, to string) error {
+	ptr, err := s.readPointer(ctx, m.From)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(ptr.Key, from) {
+		ptr.Key = to + strings.TrimPrefix(ptr.Key, from)
+	}
+	err = s.writePointer(ctx, m.To, ptr)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(m.From),
+	})
+	if err != nil {
+		return eris.Wrapf(categorize(err), "failed to delete %s", m.From)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// Connectivity is what a pre-flight check found of the storage.
+type Connectivity string
+
+const (
+	// Online means storage can be reached and accepts the credentials.
+	Online Connectivity = "online"
+	// Offline means the endpoint's name couldn't be resolved or it couldn't
+	// be connected to.
+	Offline Connectivity = "offline"
+	// CaptivePortal means something other than the storage answered for
+	// it, as a hotel or airport network does until its login page is
+	// accepted.
+	CaptivePortal Connectivity = "captive-portal"
+	// Unauthorized means the storage rejected the credentials.
+	Unauthorized Connectivity = "unauthorized"
+)
+
+// preflightTimeout bounds the request made to the endpoint.
+const preflightTimeout = 10 * time.Second
+
+var _ Preflighter = &s3{}
+
+// PreflightError is why a pre-flight check failed.
+type PreflightError struct {
+	Connectivity Connectivity
+	Err          error
+}
+
+func (e *PreflightError) Error() string {
+	switch e.Connectivity {
+	case Offline:
+		return fmt.Sprintf("offline, will retry: %s", e.Err)
+	case CaptivePortal:
+		return fmt.Sprintf("behind a captive portal, will retry once past it: %s", e.Err)
+	default:
+		return fmt.Sprintf("%s: %s", e.Connectivity, e.Err)
+	}
+}
+
+func (e *PreflightError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectivityOf returns what the pre-flight check that returned err found
+// of the storage.
+func ConnectivityOf(err error) Connectivity {
+	if err == nil {
+		return Online
+	}
+	var pe *PreflightError
+	if errors.As(err, &pe) {
+		return pe.Connectivity
+	}
+	return ""
+}
+
+// Preflight resolves the endpoint's name, makes an unsigned request to it to
+// see that S3 answers, rather than a captive portal, then checks the bucket
+// accepts the credentials. Other failures to access the bucket, e.g.
+// because it doesn't exist yet, are left to Init.
+func (s *s3) Preflight(ctx context.Context) error {
+	endpoint := s.endpoint()
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return rperrors.WithCategory(eris.Wrapf(err, "invalid endpoint %s", endpoint), rperrors.ConfigCategory)
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) == nil {
+		_, err = net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return preflightFailed(Offline, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return rperrors.WithCategory(eris.Wrapf(err, "invalid endpoint %s", endpoint), rperrors.ConfigCategory)
+	}
+	client := &http.Client{
+		Timeout: preflightTimeout,
+		// A captive portal redirects to its login page.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// A portal intercepting HTTPS can't present the endpoint's
+		// certificate.
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) {
+			return preflightFailed(CaptivePortal, err)
+		}
+		return preflightFailed(Offline, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return preflightFailed(CaptivePortal, eris.Errorf("%s redirected to %s", endpoint, resp.Header.Get("Location")))
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return preflightFailed(CaptivePortal, eris.Errorf("%s answered with a web page", endpoint))
+	}
+
+	_, err = s.Ping(ctx)
+	if rperrors.CategoryOf(err) == rperrors.AuthCategory {
+		return rperrors.WithCategory(&PreflightError{Connectivity: Unauthorized, Err: err}, rperrors.AuthCategory)
+	}
+	return nil
+}
+
+func preflightFailed(c Connectivity, err error) error {
+	return rperrors.WithCategory(&PreflightError{Connectivity: c, Err: err}, rperrors.NetworkCategory)
+}
+
+// endpoint is the URL requests are sent to: AWS_ENDPOINT if set, else the
+// region's S3 endpoint.
+func (s *s3) endpoint() string {
+	if endpoint := os.Getenv("AWS_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return fmt.Sprintf("https://s3.%s.amazonaws.com", s.client.Options().Region)
+}
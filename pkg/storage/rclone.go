@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const defaultRcloneBinary = "rclone"
+
+// rclone's documented exit codes.
+const (
+	rcloneUsageError        = 1
+	rcloneDirNotFound       = 3
+	rcloneFileNotFound      = 4
+	rcloneTemporaryError    = 5
+	rcloneFatalServiceError = 7
+)
+
+type (
+	rclone struct {
+		cfg RcloneConfig
+	}
+
+	// RcloneConfig configures the rclone backend, which stores files by
+	// running the rclone binary against a remote set up with 'rclone
+	// config', so any provider rclone supports (OneDrive, pCloud, Mega, a
+	// NAS over SMB, ...) can be synced to. Files are stored under Path on
+	// Remote, e.g. Remote "onedrive" and Path "retropie". Binary defaults to
+	// "rclone" on the PATH; ConfigFile, if set, replaces rclone's own config
+	// file, and Flags are passed to every rclone command. Timeouts, where
+	// set, replace the storage-wide timeouts.
+	RcloneConfig struct {
+		Enabled    bool
+		Remote     string
+		Path       string
+		Binary     string
+		ConfigFile string
+		Flags      []string
+		Timeouts   TimeoutConfig
+	}
+
+	// rcloneEntry is an entry of 'rclone lsjson'.
+	rcloneEntry struct {
+		Path    string    `json:"Path"`
+		Size    int64     `json:"Size"`
+		ModTime time.Time `json:"ModTime"`
+	}
+)
+
+var (
+	_ Storage   = &rclone{}
+	_ Pinger    = &rclone{}
+	_ Retriever = &rclone{}
+	_ Lister    = &rclone{}
+)
+
+func NewRcloneStorage(cfg RcloneConfig) (Storage, error) {
+	if cfg.Remote == "" {
+		return nil, rperrors.WithCategory(eris.New("rclone remote is required"), rperrors.ConfigCategory)
+	}
+	if cfg.Binary == "" {
+		cfg.Binary = defaultRcloneBinary
+	}
+	return &rclone{cfg}, nil
+}
+
+// Init creates the folder files are stored in, if the remote has folders.
+func (r *rclone) Init(ctx context.Context) error {
+	return r.run(ctx, nil, "mkdir", r.target(""))
+}
+
+func (r *rclone) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	key := r.Key(remoteDir, file)
+	log.FromCtx(ctx).Sugar().Infof("Uploading %s to %s", file.Absolute, r.target(key))
+	return r.run(ctx, nil, "copyto", file.Absolute, r.target(key))
+}
+
+func (r *rclone) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	for _, f := range files {
+		err := r.Store(ctx, remoteDir, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rclone) Key(remoteDir string, file *fs.File) string {
+	return path.Join(remoteDir, file.Dir, file.Name)
+}
+
+// Ping lists the top of the storage folder. rclone doesn't report the
+// server's clock, so it returns the zero time.
+func (r *rclone) Ping(ctx context.Context) (time.Time, error) {
+	return time.Time{}, r.run(ctx, io.Discard, "lsf", "--max-depth", "1", r.target(""))
+}
+
+// Retrieve writes the file stored at key to w. rclone checks what it
+// downloads against the provider's own hashes; there is no checksum of
+// ours to compare with.
+func (r *rclone) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	return r.run(ctx, w, "cat", r.target(key))
+}
+
+// List returns every file under the storage folder.
+func (r *rclone) List(ctx context.Context) ([]Object, error) {
+	out := &bytes.Buffer{}
+	err := r.run(ctx, out, "lsjson", "--recursive", "--files-only", r.target(""))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]rcloneEntry, 0)
+	err = json.Unmarshal(out.Bytes(), &entries)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to parse rclone listing")
+	}
+	objects := make([]Object, 0, len(entries))
+	for _, e := range entries {
+		objects = append(objects, Object{Key: e.Path, Size: e.Size, LastModified: e.ModTime})
+	}
+	return objects, nil
+}
+
+// target returns the rclone path of key, e.g. "onedrive:retropie/snes/Game.srm".
+func (r *rclone) target(key string) string {
+	return r.cfg.Remote + ":" + strings.TrimPrefix(path.Join(r.cfg.Path, key), "/")
+}
+
+// run runs rclone with args, writing its output to stdout if given.
+// Failures are categorized by rclone's exit code, and carry what it wrote
+// to stderr.
+func (r *rclone) run(ctx context.Context, stdout io.Writer, args ...string) error {
+	flags := make([]string, 0, len(r.cfg.Flags)+2)
+	if r.cfg.ConfigFile != "" {
+		flags = append(flags, "--config", r.cfg.ConfigFile)
+	}
+	flags = append(flags, r.cfg.Flags...)
+	cmd := exec.CommandContext(ctx, r.cfg.Binary, append(flags, args...)...)
+	cmd.Stdout = stdout
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	log.FromCtx(ctx).Debug("Running rclone", zap.Strings("args", cmd.Args[1:]))
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return rperrors.WithCategory(eris.Wrapf(err, "rclone binary %q not found", r.cfg.Binary), rperrors.ConfigCategory)
+	}
+	msg := strings.TrimSpace(stderr.String())
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return eris.Wrapf(err, "failed to run rclone %s", args[0])
+	}
+	switch exitErr.ExitCode() {
+	case rcloneDirNotFound, rcloneFileNotFound:
+		return eris.Wrapf(rperrors.NotFoundError, "rclone %s: %s", args[0], msg)
+	case rcloneUsageError:
+		return rperrors.WithCategory(eris.Errorf("rclone %s: %s", args[0], msg), rperrors.ConfigCategory)
+	case rcloneTemporaryError:
+		return rperrors.WithCategory(eris.Errorf("rclone %s: %s", args[0], msg), rperrors.NetworkCategory)
+	case rcloneFatalServiceError:
+		return rperrors.WithCategory(eris.Errorf("rclone %s: %s", args[0], msg), rperrors.AuthCategory)
+	}
+	return eris.Errorf("rclone %s failed with exit code %d: %s", args[0], exitErr.ExitCode(), msg)
+}
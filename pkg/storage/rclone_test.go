@@ -0,0 +1,125 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+)
+
+// fakeRclone records its arguments in args.txt beside it, prints "content"
+// for cat, and fails as rclone does for paths containing "missing".
+const fakeRclone = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args.txt"
+case "$*" in
+*missing*) echo "object not found" >&2; exit 4 ;;
+*" cat "*) printf content ;;
+*" lsjson "*) echo '[{"Path":"snes/Game.srm","Size":4,"ModTime":"2024-03-01T12:00:00Z"}]' ;;
+esac
+`
+
+// localRclone acts as rclone does on the "local" remote, storing files in
+// remote/ beside it.
+const localRclone = `#!/bin/sh
+root="$(dirname "$0")/remote"
+eval target=\${$#}
+target="$root/${target#*:}"
+case "$1" in
+mkdir) mkdir -p "$target" ;;
+copyto) mkdir -p "$(dirname "$target")" && cp "$2" "$target" ;;
+cat) [ -f "$target" ] || { echo "object not found" >&2; exit 3; }; cat "$target" ;;
+lsf) ls "$target" ;;
+lsjson)
+	cd "$target" || exit 3
+	printf '['
+	sep=''
+	find . -type f | while read -r f; do
+		printf '%s{"Path":"%s","Size":%s,"ModTime":"%s"}' "$sep" "${f#./}" "$(stat -c %s "$f")" "$(date -u -r "$f" +%Y-%m-%dT%H:%M:%SZ)"
+		sep=','
+	done
+	printf ']'
+	;;
+esac
+`
+
+var _ = storagetest.Conformance("rclone", func() storage.Storage {
+	dir := GinkgoT().TempDir()
+	binary := filepath.Join(dir, "rclone")
+	Expect(os.WriteFile(binary, []byte(localRclone), 0755)).To(Succeed())
+	client, err := storage.NewRcloneStorage(storage.RcloneConfig{Remote: "local", Path: "retropie", Binary: binary})
+	Expect(err).NotTo(HaveOccurred())
+	return client
+})
+
+var _ = Describe("Rclone", func() {
+	var (
+		dir    string
+		client storage.Storage
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		binary := filepath.Join(dir, "rclone")
+		Expect(os.WriteFile(binary, []byte(fakeRclone), 0755)).To(Succeed())
+		var err error
+		client, err = storage.NewRcloneStorage(storage.RcloneConfig{
+			Remote: "onedrive",
+			Path:   "retropie",
+			Binary: binary,
+			Flags:  []string{"--fast-list"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	args := func() string {
+		b, err := os.ReadFile(filepath.Join(dir, "args.txt"))
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	It("requires a remote", func() {
+		_, err := storage.NewRcloneStorage(storage.RcloneConfig{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("copies files under the remote path", func() {
+		f := fs.NewFile("/roms/snes/Game.srm", time.Now())
+		Expect(client.Store(context.TODO(), "2024", f)).To(Succeed())
+		Expect(args()).To(Equal("--fast-list copyto /roms/snes/Game.srm onedrive:retropie/2024/snes/Game.srm\n"))
+	})
+
+	It("retrieves files", func() {
+		out := &bytes.Buffer{}
+		Expect(client.(storage.Retriever).Retrieve(context.TODO(), "snes/Game.srm", out)).To(Succeed())
+		Expect(out.String()).To(Equal("content"))
+	})
+
+	It("reports missing files as not found", func() {
+		err := client.(storage.Retriever).Retrieve(context.TODO(), "snes/missing.srm", &bytes.Buffer{})
+		Expect(err).To(MatchError(errors.NotFoundError))
+	})
+
+	It("lists stored files", func() {
+		objects, err := client.(storage.Lister).List(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		Expect(objects[0].Key).To(Equal("snes/Game.srm"))
+		Expect(objects[0].Size).To(Equal(int64(4)))
+	})
+
+	It("fails with a config error when rclone isn't installed", func() {
+		missing, err := storage.NewRcloneStorage(storage.RcloneConfig{Remote: "onedrive", Binary: filepath.Join(dir, "nope")})
+		Expect(err).NotTo(HaveOccurred())
+		err = missing.Init(context.TODO())
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+	})
+})
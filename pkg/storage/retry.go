@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxAttempts      = 3
+	defaultInitialBackoff   = 500 * time.Millisecond
+	defaultMaxBackoff       = 30 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+)
+
+type (
+	// RetryConfig controls how failed storage operations are retried and when
+	// the backend is considered persistently unreachable.
+	//
+	// Each operation is attempted up to MaxAttempts times, sleeping between
+	// attempts with exponential backoff starting at InitialBackoff and capped
+	// at MaxBackoff. Jitter (0-1) randomly shortens each sleep by up to that
+	// fraction. After BreakerThreshold consecutive operations fail, the breaker
+	// opens and every call fails fast for BreakerCooldown.
+	RetryConfig struct {
+		MaxAttempts      int
+		InitialBackoff   time.Duration
+		MaxBackoff       time.Duration
+		Jitter           float64
+		BreakerThreshold int
+		BreakerCooldown  time.Duration
+	}
+
+	retrying struct {
+		storage Storage
+		cfg     RetryConfig
+		breaker *breaker
+	}
+
+	breaker struct {
+		mu        sync.Mutex
+		threshold int
+		cooldown  time.Duration
+		failures  int
+		openUntil time.Time
+	}
+)
+
+var (
+	_ Storage    = &retrying{}
+	_ Prefetcher = &retrying{}
+)
+
+// NewRetryingStorage wraps the given storage so that every operation is
+// retried according to cfg and guarded by a circuit breaker.
+func NewRetryingStorage(storage Storage, cfg RetryConfig) Storage {
+	cfg = cfg.withDefaults()
+	return &retrying{
+		storage: storage,
+		cfg:     cfg,
+		breaker: &breaker{
+			threshold: cfg.BreakerThreshold,
+			cooldown:  cfg.BreakerCooldown,
+		},
+	}
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.Jitter < 0 {
+		c.Jitter = 0
+	}
+	if c.Jitter > 1 {
+		c.Jitter = 1
+	}
+	if c.BreakerThreshold <= 0 {
+		c.BreakerThreshold = defaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = defaultBreakerCooldown
+	}
+	return c
+}
+
+func (r *retrying) Init(ctx context.Context) error {
+	return r.do(ctx, "init", func() error {
+		return r.storage.Init(ctx)
+	})
+}
+
+func (r *retrying) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	return r.do(ctx, "store", func() error {
+		return r.storage.Store(ctx, remoteDir, file)
+	})
+}
+
+func (r *retrying) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	for _, f := range files {
+		err := r.Store(ctx, remoteDir, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prefetch prefetches through the wrapped storage, if it supports it.
+func (r *retrying) Prefetch(ctx context.Context) error {
+	prefetcher, ok := r.storage.(Prefetcher)
+	if !ok {
+		return nil
+	}
+	return r.do(ctx, "prefetch", func() error {
+		return prefetcher.Prefetch(ctx)
+	})
+}
+
+// Retrieve downloads through the wrapped storage, if it supports it. It is
+// not retried, since part of the object may already have been written to w.
+func (r *retrying) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	retriever, ok := r.storage.(Retriever)
+	if !ok {
+		return eris.Wrap(errors.NotImplementedError, "storage does not support downloads")
+	}
+	return retriever.Retrieve(ctx, key, w)
+}
+
+// Preflight checks the wrapped storage, if it supports it. It is not
+// retried, since it is meant to tell quickly that storage can't be reached.
+func (r *retrying) Preflight(ctx context.Context) error {
+	preflighter, ok := r.storage.(Preflighter)
+	if !ok {
+		return nil
+	}
+	return preflighter.Preflight(ctx)
+}
+
+func (r *retrying) Key(remoteDir string, file *fs.File) string {
+	return r.storage.Key(remoteDir, file)
+}
+
+func (r *retrying) do(ctx context.Context, op string, fn func() error) error {
+	if !r.breaker.allow(clock.Now(ctx)) {
+		return errors.CircuitOpenError
+	}
+
+	var err error
+	for attempt := 1; attempt <= r.cfg.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			r.breaker.success()
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if attempt == r.cfg.MaxAttempts {
+			break
+		}
+
+		wait := r.backoff(attempt)
+		log.FromCtx(ctx).Warn("Storage operation failed; retrying",
+			zap.String("operation", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	if r.breaker.failure(clock.Now(ctx)) {
+		log.FromCtx(ctx).Error("Storage backend appears unreachable; opening circuit breaker",
+			zap.String("operation", op),
+			zap.Duration("cooldown", r.cfg.BreakerCooldown),
+			zap.Error(err),
+		)
+	}
+	return eris.Wrapf(err, "%s failed after %d attempts", op, r.cfg.MaxAttempts)
+}
+
+func (r *retrying) backoff(attempt int) time.Duration {
+	wait := r.cfg.InitialBackoff << (attempt - 1)
+	if wait <= 0 || wait > r.cfg.MaxBackoff {
+		wait = r.cfg.MaxBackoff
+	}
+	if r.cfg.Jitter > 0 {
+		wait -= time.Duration(rand.Float64() * r.cfg.Jitter * float64(wait))
+	}
+	return wait
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// failure records an operation that failed at now and reports whether it
+// tripped the breaker.
+func (b *breaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.failures = 0
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// retryable reports whether retrying could help. Missing features, bad
+// credentials, bad config, and unreadable local files fail the same way
+// every time, and say nothing about whether the backend is reachable.
+func retryable(err error) bool {
+	if eris.Is(err, errors.NotImplementedError) {
+		return false
+	}
+	switch errors.CategoryOf(err) {
+	case errors.AuthCategory, errors.ConfigCategory, errors.LocalCategory:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+type flakyStorage struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyStorage) Init(ctx context.Context) error {
+	return nil
+}
+
+func (f *flakyStorage) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return eris.New("transient failure")
+	}
+	return nil
+}
+
+func (f *flakyStorage) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	return nil
+}
+
+func (f *flakyStorage) Key(remoteDir string, file *fs.File) string {
+	return remoteDir + "/" + file.Name
+}
+
+// countingStorage counts the Stores of the storage it wraps.
+type countingStorage struct {
+	storage.Storage
+	calls int
+}
+
+func (c *countingStorage) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	c.calls++
+	return c.Storage.Store(ctx, remoteDir, file)
+}
+
+var _ = Describe("Retry", func() {
+	cfg := storage.RetryConfig{
+		MaxAttempts:      3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	}
+
+	It("retries transient failures", func() {
+		flaky := &flakyStorage{failures: 2}
+		client := storage.NewRetryingStorage(flaky, cfg)
+		err := client.Store(context.TODO(), "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(flaky.calls).To(Equal(3))
+	})
+
+	It("opens the circuit breaker on persistent failures", func() {
+		flaky := &flakyStorage{failures: 100}
+		client := storage.NewRetryingStorage(flaky, cfg)
+		Expect(client.Store(context.TODO(), "", nil)).To(HaveOccurred())
+		Expect(client.Store(context.TODO(), "", nil)).To(HaveOccurred())
+		Expect(flaky.calls).To(Equal(6))
+		err := client.Store(context.TODO(), "", nil)
+		Expect(err).To(MatchError(errors.CircuitOpenError))
+		Expect(flaky.calls).To(Equal(6))
+	})
+
+	It("closes the circuit breaker after the cooldown", func() {
+		fake := clock.NewFake(time.Date(2023, 12, 17, 13, 0, 0, 0, time.UTC))
+		ctx := clock.ToCtx(context.TODO(), fake)
+		flaky := &flakyStorage{failures: 6}
+		client := storage.NewRetryingStorage(flaky, cfg)
+		Expect(client.Store(ctx, "", nil)).To(HaveOccurred())
+		Expect(client.Store(ctx, "", nil)).To(HaveOccurred())
+		Expect(client.Store(ctx, "", nil)).To(MatchError(errors.CircuitOpenError))
+		fake.Advance(time.Hour)
+		Expect(client.Store(ctx, "", nil)).To(Succeed())
+	})
+
+	It("does not retry unimplemented operations", func() {
+		sftp, err := storage.NewSFTPStorage(storage.SFTPConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		client := storage.NewRetryingStorage(sftp, cfg)
+		err = client.Store(context.TODO(), "", nil)
+		Expect(err).To(MatchError(errors.NotImplementedError))
+	})
+
+	It("neither retries nor opens the circuit breaker for unreadable local files", func() {
+		GinkgoT().Setenv("AWS_REGION", "us-east-1")
+		s3, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Enabled: true, Bucket: "retropie-sync"})
+		Expect(err).NotTo(HaveOccurred())
+		counting := &countingStorage{Storage: s3}
+		client := storage.NewRetryingStorage(counting, cfg)
+		missing := fs.NewFile(filepath.Join(GinkgoT().TempDir(), "Missing.srm"), time.Now())
+		for i := 0; i < 3; i++ {
+			err = client.Store(context.TODO(), "", missing)
+			Expect(errors.CategoryOf(err)).To(Equal(errors.LocalCategory))
+		}
+		Expect(counting.calls).To(Equal(3))
+	})
+
+	It("reports downloads the wrapped storage can't make", func() {
+		client := storage.NewRetryingStorage(&flakyStorage{}, cfg)
+		retriever, ok := client.(storage.Retriever)
+		Expect(ok).To(BeTrue())
+		err := retriever.Retrieve(context.TODO(), "key", io.Discard)
+		Expect(err).To(MatchError(errors.NotImplementedError))
+	})
+})
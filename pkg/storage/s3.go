@@ -2,21 +2,31 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
 	"github.com/TrevorEdris/retropie-utils/pkg/fs"
 	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
 	"github.com/rotisserie/eris"
 	"go.uber.org/zap"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 type (
@@ -26,22 +36,102 @@ type (
 		uploader           *manager.Uploader
 		cfg                S3Config
 		resourcesValidated bool
+		// keys names stored files, and blobKeys the blobs of files stored
+		// by content.
+		keys     KeyBuilder
+		blobKeys KeyBuilder
+		// blobs, once prefetched, holds the keys of the stored blobs so
+		// the content layout needn't check for each one.
+		blobs *blobIndex
 	}
 
+	// S3Config configures the S3 backend. AccessKeyID and SecretAccessKey
+	// are optional; when unset, credentials come from the default AWS chain
+	// (environment, shared config, instance role). Layout defaults to
+	// TimeLayout. Files not stored by content are named by KeyTemplate (see
+	// KeyBuilder), or DefaultKeyTemplate if it is unset.
+	//
+	// Stored objects are tagged with Tags (e.g. "username"), their system,
+	// their file type, and DeviceID if set. When CreateMissingResources is
+	// set, Init replaces the bucket's lifecycle rules with Lifecycle, if any.
+	// With LatestPointers set, every upload also updates a pointer at
+	// [prefix/]latest/dir/name to find it by. KeyEncoding chooses how
+	// directories and names are written into keys, RawKeys by default.
+	// With ZipRoms set, ROMs not already in a compressed format are stored
+	// zipped, whatever Compression says; retrieving them unzips them.
+	// Timeouts, where set, replace the storage-wide timeouts.
 	S3Config struct {
 		Bucket                 string
+		Prefix                 string
+		Layout                 Layout
+		Compression            Compression
 		Enabled                bool
 		CreateMissingResources bool
+		Multipart              MultipartConfig
+		AccessKeyID            secret.Secret
+		SecretAccessKey        secret.Secret
+		Tags                   map[string]string
+		DeviceID               string
+		Lifecycle              []LifecycleRule
+		KeyTemplate            string
+		KeyEncoding            KeyEncoding
+		LatestPointers         bool
+		ZipRoms                bool
+		Timeouts               TimeoutConfig
 	}
 )
 
-var _ Storage = &s3{}
+// checksumMetadataKey is the user metadata recording the SHA-256 of an
+// object's original, uncompressed content.
+const checksumMetadataKey = "sha256"
+
+var (
+	_ Storage      = &s3{}
+	_ Pinger       = &s3{}
+	_ Verifier     = &s3{}
+	_ Retriever    = &s3{}
+	_ Prefetcher   = &s3{}
+	_ Copier       = &s3{}
+	_ LatestFinder = &s3{}
+)
 
 func NewS3Storage(ctx context.Context, cfg S3Config) (Storage, error) {
-	awscfg, err := newAwsConfig(ctx)
+	err := cfg.Compression.validate()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	err = cfg.Layout.validate()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	err = cfg.KeyEncoding.validate()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	keys, err := NewKeyBuilder(cfg.Prefix, cfg.KeyTemplate)
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	keys = keys.Encoded(cfg.KeyEncoding)
+	blobs, err := NewKeyBuilder(cfg.Prefix, blobKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range cfg.Lifecycle {
+		err = rule.validate()
+		if err != nil {
+			return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+		}
+	}
+	opts, err := cfg.credentialOptions(ctx)
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	awscfg, err := newAwsConfig(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
+	cfg.Multipart = cfg.Multipart.withDefaults()
 	client := awss3.NewFromConfig(awscfg, func(o *awss3.Options) {
 		o.UsePathStyle = true
 	})
@@ -50,9 +140,31 @@ func NewS3Storage(ctx context.Context, cfg S3Config) (Storage, error) {
 		client:   client,
 		uploader: manager.NewUploader(client),
 		cfg:      cfg,
+		keys:     keys,
+		blobKeys: blobs,
 	}, nil
 }
 
+// credentialOptions resolves static credentials when both keys are configured.
+func (cfg S3Config) credentialOptions(ctx context.Context) ([]func(*config.LoadOptions) error, error) {
+	if cfg.AccessKeyID.IsZero() && cfg.SecretAccessKey.IsZero() {
+		return nil, nil
+	}
+	if cfg.AccessKeyID.IsZero() || cfg.SecretAccessKey.IsZero() {
+		return nil, eris.New("both accessKeyID and secretAccessKey must be set")
+	}
+	id, err := cfg.AccessKeyID.Resolve(ctx)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to resolve access key id")
+	}
+	key, err := cfg.SecretAccessKey.Resolve(ctx)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to resolve secret access key")
+	}
+	provider := credentials.NewStaticCredentialsProvider(id, key, "")
+	return []func(*config.LoadOptions) error{config.WithCredentialsProvider(provider)}, nil
+}
+
 func (s *s3) Init(ctx context.Context) error {
 	// Validate required S3 resources exist
 	exist, err := s.checkIfResourcesExist(ctx)
@@ -68,6 +180,12 @@ func (s *s3) Init(ctx context.Context) error {
 		}
 		s.resourcesValidated = true
 	}
+	if s.cfg.CreateMissingResources && len(s.cfg.Lifecycle) > 0 {
+		err = s.applyLifecycle(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -85,7 +203,27 @@ func (s *s3) checkIfResourcesExist(ctx context.Context) (bool, error) {
 	if errors.As(err, &notFoundErr) {
 		return false, nil
 	}
-	return false, err
+	return false, categorize(err)
+}
+
+// Ping checks the bucket exists and is accessible, returning the time S3
+// reported in its response.
+func (s *s3) Ping(ctx context.Context) (time.Time, error) {
+	out, err := s.client.HeadBucket(ctx, &awss3.HeadBucketInput{
+		Bucket: aws.String(s.cfg.Bucket),
+	})
+	if err != nil {
+		return time.Time{}, eris.Wrapf(categorize(err), "failed to access bucket %s", s.cfg.Bucket)
+	}
+	resp, ok := awsmiddleware.GetRawResponse(out.ResultMetadata).(*smithyhttp.Response)
+	if !ok {
+		return time.Time{}, nil
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return serverTime, nil
 }
 
 func (s *s3) createMissingResources(ctx context.Context) error {
@@ -96,7 +234,7 @@ func (s *s3) createMissingResources(ctx context.Context) error {
 		})
 	if err != nil {
 		log.FromCtx(ctx).Error("Failed to create bucket", zap.String("bucket", s.cfg.Bucket), zap.Error(err))
-		return err
+		return categorize(err)
 	}
 	log.FromCtx(ctx).Info("Successfully created bucket", zap.String("bucket", s.cfg.Bucket))
 	return nil
@@ -109,30 +247,72 @@ func (s *s3) Store(ctx context.Context, remoteDir string, file *fs.File) error {
 
 	f, err := os.Open(file.Absolute)
 	if err != nil {
-		return eris.Wrap(err, "failed to open file")
+		return rperrors.WithCategory(eris.Wrap(err, "failed to open file"), rperrors.LocalCategory)
 	}
 	defer f.Close()
 
-	remoteDir, _ = strings.CutSuffix(remoteDir, "/")
-	key := fmt.Sprintf("%s/%s", file.Dir, file.Name)
-	if remoteDir != "" {
-		key = fmt.Sprintf("%s/%s", remoteDir, key)
+	// Hash up front so a read error is reported rather than an empty key.
+	sum, err := file.Checksum()
+	if err != nil {
+		return rperrors.WithCategory(err, rperrors.LocalCategory)
+	}
+	metadata := map[string]string{checksumMetadataKey: sum}
+	key, err := s.key(remoteDir, file)
+	if err != nil {
+		return err
+	}
+	if s.deduplicates(file) && !replacing(ctx) {
+		exists, err := s.objectExists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.FromCtx(ctx).Debug("Content already stored", zap.String("file", file.Absolute), zap.String("key", key))
+			return s.pointTo(ctx, file, key, sum)
+		}
 	}
 	log.FromCtx(ctx).Sugar().Infof("Uploading %s to %s/%s", file.Absolute, s.cfg.Bucket, key)
 
+	if c := s.compression(file); c != NoCompression {
+		compressed, err := compressToTemp(f, file.Name, c)
+		if err != nil {
+			return rperrors.WithCategory(err, rperrors.LocalCategory)
+		}
+		defer os.Remove(compressed.Name())
+		defer compressed.Close()
+		f = compressed
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return rperrors.WithCategory(eris.Wrap(err, "failed to stat file"), rperrors.LocalCategory)
+	}
+	if info.Size() >= s.cfg.Multipart.Threshold {
+		err = s.multipartUpload(ctx, f, key, file, info.Size(), metadata)
+		if err != nil {
+			return err
+		}
+		s.stored(file, key)
+		return s.pointTo(ctx, file, key, sum)
+	}
+
 	_, err = s.uploader.Upload(
 		ctx,
 		&awss3.PutObjectInput{
-			Bucket: aws.String(s.cfg.Bucket),
-			Key:    aws.String(key),
-			Body:   f,
+			Bucket:          aws.String(s.cfg.Bucket),
+			Key:             aws.String(key),
+			Body:            progress.NewReader(ctx, f, info.Size()),
+			ContentType:     aws.String(file.ContentType()),
+			ContentEncoding: s.contentEncoding(file),
+			Metadata:        metadata,
+			Tagging:         s.tagging(file),
 		},
 	)
 	if err != nil {
-		return eris.Wrap(err, "failed to upload")
+		return eris.Wrap(categorize(err), "failed to upload")
 	}
-
-	return nil
+	s.stored(file, key)
+	return s.pointTo(ctx, file, key, sum)
 }
 
 func (s *s3) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
@@ -144,3 +324,171 @@ func (s *s3) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) e
 	}
 	return nil
 }
+
+// Key builds the object key for the file from the key template, by default
+// [prefix/][remoteDir/]dir/name, or as [prefix/]blobs/sha256/ab/abcd... for
+// files stored by content. The configured prefix (e.g. "retropie/") lets the
+// bucket be shared with other applications without key collisions. Key is
+// empty if the file's content could not be hashed, or the key would be too
+// long.
+func (s *s3) Key(remoteDir string, file *fs.File) string {
+	key, err := s.key(remoteDir, file)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+func (s *s3) key(remoteDir string, file *fs.File) (string, error) {
+	keys := s.keys
+	if s.deduplicates(file) {
+		keys = s.blobKeys
+	}
+	return keys.BuildFile(strings.TrimSuffix(remoteDir, "/"), file, s.cfg.DeviceID)
+}
+
+// RemoteChecksum returns the SHA-256 of the original content stored at key.
+// Objects uploaded before checksums were recorded are always downloaded.
+func (s *s3) RemoteChecksum(ctx context.Context, key string, download bool) (string, error) {
+	if !download {
+		out, err := s.head(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if sum := out.Metadata[checksumMetadataKey]; sum != "" {
+			return sum, nil
+		}
+	}
+
+	r, err := s.open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to read %s", key)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Copy copies the object at from to to on the server, keeping its metadata
+// and tags. Objects too large for a single copy are copied in parts.
+func (s *s3) Copy(ctx context.Context, from, to string) error {
+	head, err := s.head(ctx, from)
+	if err != nil {
+		return err
+	}
+	if aws.ToInt64(head.ContentLength) > maxCopySize {
+		err = s.copyParts(ctx, from, to, head, head.Metadata)
+	} else {
+		_, err = s.client.CopyObject(ctx, &awss3.CopyObjectInput{
+			Bucket:     aws.String(s.cfg.Bucket),
+			Key:        aws.String(to),
+			CopySource: aws.String(copySource(s.cfg.Bucket, from)),
+		})
+	}
+	if err != nil {
+		return eris.Wrapf(categorize(err), "failed to copy %s to %s", from, to)
+	}
+	return nil
+}
+
+// Retrieve downloads the object at key, decompressing it if it was stored
+// compressed, and checks it against the checksum recorded at upload. A
+// download that doesn't match, e.g. because it was cut short, fails with
+// errors.ChecksumError after it has been written to w.
+func (s *s3) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	r, err := s.open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return eris.Wrapf(err, "failed to read %s", key)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); r.sum != "" && got != r.sum {
+		return eris.Wrapf(rperrors.ChecksumError, "%s downloaded as %s, but was uploaded as %s", key, got, r.sum)
+	}
+	return nil
+}
+
+// open returns a reader of the original content of the object at key.
+func (s *s3) open(ctx context.Context, key string) (objectReader, error) {
+	out, err := s.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return objectReader{}, eris.Wrapf(rperrors.NotFoundError, "no object at %s", key)
+		}
+		return objectReader{}, eris.Wrapf(categorize(err), "failed to download %s", key)
+	}
+	r, err := decompress(out.Body, Compression(aws.ToString(out.ContentEncoding)))
+	if err != nil {
+		out.Body.Close()
+		return objectReader{}, err
+	}
+	return objectReader{ReadCloser: r, body: out.Body, sum: out.Metadata[checksumMetadataKey]}, nil
+}
+
+// objectReader closes the response body along with the decompressor
+// reading from it. sum is the checksum recorded at upload, if any.
+type objectReader struct {
+	io.ReadCloser
+	body io.Closer
+	sum  string
+}
+
+func (r objectReader) Close() error {
+	err := r.ReadCloser.Close()
+	bodyErr := r.body.Close()
+	if err != nil {
+		return err
+	}
+	return bodyErr
+}
+
+// deduplicates reports whether the file is stored by its content.
+func (s *s3) deduplicates(file *fs.File) bool {
+	return s.cfg.Layout == ContentLayout && file.FileType != fs.Other
+}
+
+func (s *s3) objectExists(ctx context.Context, key string) (bool, error) {
+	if s.blobs != nil {
+		return s.blobs.has(key), nil
+	}
+	_, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+	var notFoundErr *types.NotFound
+	if errors.As(err, &notFoundErr) {
+		return false, nil
+	}
+	return false, eris.Wrapf(categorize(err), "failed to check for %s", key)
+}
+
+// compression returns how the file is compressed before upload.
+func (s *s3) compression(file *fs.File) Compression {
+	if s.cfg.ZipRoms && file.FileType == fs.Rom && !fs.IsCompressed(file.Name) {
+		return ZipCompression
+	}
+	return s.cfg.Compression
+}
+
+func (s *s3) contentEncoding(file *fs.File) *string {
+	c := s.compression(file)
+	if c == NoCompression {
+		return nil
+	}
+	return aws.String(string(c))
+}
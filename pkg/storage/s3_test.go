@@ -1,11 +1,30 @@
 package storage_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
 	"github.com/TrevorEdris/retropie-utils/pkg/storage"
 )
 
@@ -22,4 +41,645 @@ var _ = Describe("S3", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
+
+	It("rejects unsupported compression", func() {
+		_, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+			Compression: "lz4",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("pings the bucket and reports the server time", func() {
+		serverTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		}))
+		defer server.Close()
+		GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+		GinkgoT().Setenv("AWS_REGION", "us-east-1")
+		GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+		GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+		client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Bucket: "retropie-sync"})
+		Expect(err).NotTo(HaveOccurred())
+		got, err := client.(storage.Pinger).Ping(context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(BeTemporally("==", serverTime))
+	})
+
+	When("checking connectivity before a sync", func() {
+		var handler http.HandlerFunc
+
+		preflight := func() error {
+			server := httptest.NewServer(handler)
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Bucket: "retropie-sync"})
+			Expect(err).NotTo(HaveOccurred())
+			return client.(storage.Preflighter).Preflight(context.TODO())
+		}
+
+		It("passes when S3 answers and accepts the credentials", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {}
+			Expect(preflight()).To(Succeed())
+		})
+
+		It("recognizes a captive portal redirecting to its login page", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://portal.example/login", http.StatusFound)
+			}
+			err := preflight()
+			Expect(storage.ConnectivityOf(err)).To(Equal(storage.CaptivePortal))
+			Expect(errors.CategoryOf(err)).To(Equal(errors.NetworkCategory))
+		})
+
+		It("recognizes a captive portal answering with a web page", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, _ = w.Write([]byte("<html>Log in to continue</html>"))
+			}
+			Expect(storage.ConnectivityOf(preflight())).To(Equal(storage.CaptivePortal))
+		})
+
+		It("reports rejected credentials", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}
+			err := preflight()
+			Expect(storage.ConnectivityOf(err)).To(Equal(storage.Unauthorized))
+			Expect(errors.CategoryOf(err)).To(Equal(errors.AuthCategory))
+		})
+
+		It("reports an endpoint that can't be connected to as offline", func() {
+			server := httptest.NewServer(http.NotFoundHandler())
+			server.Close()
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Bucket: "retropie-sync"})
+			Expect(err).NotTo(HaveOccurred())
+			err = client.(storage.Preflighter).Preflight(context.TODO())
+			Expect(storage.ConnectivityOf(err)).To(Equal(storage.Offline))
+			Expect(err.Error()).To(HavePrefix("offline, will retry"))
+		})
+	})
+
+	When("using the content layout", func() {
+		var (
+			mu       sync.Mutex
+			requests []string
+			exists   bool
+			listed   []string
+			file     *fs.File
+			client   storage.Storage
+		)
+
+		BeforeEach(func() {
+			requests = nil
+			exists = false
+			listed = nil
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+				if r.Method == http.MethodHead && !exists {
+					w.WriteHeader(http.StatusNotFound)
+				}
+				if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+					Expect(r.URL.Query().Get("prefix")).To(Equal("retropie/blobs/sha256/"))
+					body := "<ListBucketResult>"
+					for _, key := range listed {
+						body += "<Contents><Key>" + key + "</Key></Contents>"
+					}
+					_, _ = w.Write([]byte(body + "</ListBucketResult>"))
+				}
+			}))
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+			path := filepath.Join(GinkgoT().TempDir(), "snes", "Chrono Trigger.srm")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte("save"), 0644)).To(Succeed())
+			file = fs.NewFile(path, time.Now())
+
+			var err error
+			client, err = storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled: true,
+				Bucket:  "retropie-sync",
+				Prefix:  "retropie",
+				Layout:  storage.ContentLayout,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("keys files by their content", func() {
+			sum, err := file.Checksum()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Key("2024/03/01/12", file)).To(Equal("retropie/blobs/sha256/" + sum[:2] + "/" + sum))
+		})
+
+		It("uploads content it has not stored", func() {
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(requests).To(ContainElement("PUT /retropie-sync/" + client.Key("", file)))
+		})
+
+		It("skips content it has already stored", func() {
+			exists = true
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(requests).To(Equal([]string{"HEAD /retropie-sync/" + client.Key("", file)}))
+		})
+
+		It("checks prefetched blobs without a request per file", func() {
+			listed = []string{client.Key("", file)}
+			Expect(client.(storage.Prefetcher).Prefetch(context.TODO())).To(Succeed())
+			requests = nil
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(requests).To(BeEmpty())
+		})
+
+		It("uploads blobs missing from the prefetched listing once", func() {
+			Expect(client.(storage.Prefetcher).Prefetch(context.TODO())).To(Succeed())
+			requests = nil
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(client.Store(context.TODO(), "2024/03/01/13", file)).To(Succeed())
+			Expect(requests).To(Equal([]string{"PUT /retropie-sync/" + client.Key("", file)}))
+		})
+	})
+
+	It("rejects an unsupported layout", func() {
+		_, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+			Layout: "random",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keys files with the key template", func() {
+		client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+			Prefix:      "retropie",
+			KeyTemplate: "{device}/{dir}/{name}",
+			DeviceID:    "pi",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		file := fs.NewFile("/roms/snes/Game.srm", time.Now())
+		file.Dir = "snes"
+		Expect(client.Key("2024/03/01/12", file)).To(Equal("retropie/pi/snes/Game.srm"))
+
+		_, err = storage.NewS3Storage(context.TODO(), storage.S3Config{
+			KeyTemplate: "{time}/{dir}",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	When("verifying stored objects", func() {
+		var (
+			handler  http.HandlerFunc
+			verifier storage.Verifier
+		)
+
+		BeforeEach(func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler(w, r)
+			}))
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Bucket: "retropie-sync"})
+			Expect(err).NotTo(HaveOccurred())
+			verifier = client.(storage.Verifier)
+		})
+
+		It("uses the checksum recorded at upload", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodHead))
+				w.Header().Set("x-amz-meta-sha256", "abc123")
+			}
+			sum, err := verifier.RemoteChecksum(context.TODO(), "snes/game.srm", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sum).To(Equal("abc123"))
+		})
+
+		It("reports missing objects", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			_, err := verifier.RemoteChecksum(context.TODO(), "snes/game.srm", false)
+			Expect(err).To(MatchError(errors.NotFoundError))
+		})
+
+		It("hashes the decompressed content when downloading", func() {
+			compressed := &bytes.Buffer{}
+			zw := gzip.NewWriter(compressed)
+			_, err := zw.Write([]byte("save"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodGet))
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(compressed.Bytes())
+			}
+
+			sum, err := verifier.RemoteChecksum(context.TODO(), "snes/game.srm", true)
+			Expect(err).NotTo(HaveOccurred())
+			want := sha256.Sum256([]byte("save"))
+			Expect(sum).To(Equal(hex.EncodeToString(want[:])))
+		})
+
+		It("retrieves the decompressed content", func() {
+			compressed := &bytes.Buffer{}
+			zw := gzip.NewWriter(compressed)
+			_, err := zw.Write([]byte("save"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodGet))
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(compressed.Bytes())
+			}
+
+			content := &bytes.Buffer{}
+			err = verifier.(storage.Retriever).Retrieve(context.TODO(), "snes/game.srm", content)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content.String()).To(Equal("save"))
+		})
+
+		It("unzips zipped ROMs", func() {
+			zipped := &bytes.Buffer{}
+			zw := zip.NewWriter(zipped)
+			entry, err := zw.Create("game.sfc")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = entry.Write([]byte("rom"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "zip")
+				_, _ = w.Write(zipped.Bytes())
+			}
+
+			content := &bytes.Buffer{}
+			err = verifier.(storage.Retriever).Retrieve(context.TODO(), "snes/game.sfc", content)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content.String()).To(Equal("rom"))
+		})
+
+		It("rejects downloads that don't match the checksum recorded at upload", func() {
+			want := sha256.Sum256([]byte("save"))
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("x-amz-meta-sha256", hex.EncodeToString(want[:]))
+				_, _ = w.Write([]byte("sa"))
+			}
+
+			err := verifier.(storage.Retriever).Retrieve(context.TODO(), "snes/game.srm", io.Discard)
+			Expect(err).To(MatchError(errors.ChecksumError))
+		})
+	})
+
+	When("copying and trashing objects", func() {
+		var (
+			requests []string
+			ranges   []string
+			size     int64
+			trasher  storage.Trasher
+			copier   storage.Copier
+		)
+
+		BeforeEach(func() {
+			requests = nil
+			ranges = nil
+			size = 4
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				switch {
+				case r.Method == http.MethodHead:
+					w.Header().Set("Content-Type", "application/x-psx-save")
+					w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+					w.Header().Set("x-amz-meta-sha256", "abc123")
+					w.Header().Set("x-amz-meta-trashed-at", "2024-03-01T12:00:00Z")
+					w.Header().Set("x-amz-meta-expires-at", "2024-03-31T12:00:00Z")
+				case r.Method == http.MethodGet && query.Has("tagging"):
+					requests = append(requests, "GET tags "+r.URL.Path)
+					_, _ = w.Write([]byte("<Tagging><TagSet><Tag><Key>system</Key><Value>psx</Value></Tag></TagSet></Tagging>"))
+					return
+				case r.Method == http.MethodPost && query.Has("uploads"):
+					Expect(r.Header.Get("Content-Type")).To(Equal("application/x-psx-save"))
+					Expect(r.Header.Get("x-amz-tagging")).To(Equal("system=psx"))
+					Expect(r.Header.Get("x-amz-meta-sha256")).To(Equal("abc123"))
+					requests = append(requests, "create "+r.URL.Path)
+					_, _ = w.Write([]byte("<InitiateMultipartUploadResult><UploadId>copy-1</UploadId></InitiateMultipartUploadResult>"))
+					return
+				case r.Method == http.MethodPut && query.Get("uploadId") != "":
+					ranges = append(ranges, r.Header.Get("x-amz-copy-source-range"))
+					_, _ = w.Write([]byte(`<CopyPartResult><ETag>"p"</ETag></CopyPartResult>`))
+					return
+				case r.Method == http.MethodPost && query.Get("uploadId") != "":
+					requests = append(requests, "complete "+r.URL.Path)
+					_, _ = w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+					return
+				case r.Method == http.MethodPut:
+					Expect(r.Header.Get("x-amz-meta-sha256")).To(Equal("abc123"))
+					Expect(r.Header.Get("Content-Type")).To(Equal("application/x-psx-save"))
+					_, _ = w.Write([]byte(`<CopyObjectResult><ETag>"x"</ETag></CopyObjectResult>`))
+				}
+				requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("x-amz-copy-source"))
+			}))
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{Bucket: "retropie-sync", Prefix: "retropie"})
+			Expect(err).NotTo(HaveOccurred())
+			trasher = client.(storage.Trasher)
+			copier = client.(storage.Copier)
+		})
+
+		It("moves the object under trash/", func() {
+			err := trasher.Trash(context.TODO(), "retropie/snes/game 1.srm", 30*24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]string{
+				"HEAD /retropie-sync/retropie/snes/game 1.srm ",
+				"PUT /retropie-sync/retropie/trash/snes/game 1.srm retropie-sync/retropie/snes/game%201.srm",
+				"DELETE /retropie-sync/retropie/snes/game 1.srm ",
+			}))
+		})
+
+		It("copies objects too large for a single copy in parts", func() {
+			size = 5*1024*1024*1024 + 1
+			err := trasher.Trash(context.TODO(), "retropie/psx/Game.bin", 30*24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]string{
+				"HEAD /retropie-sync/retropie/psx/Game.bin ",
+				"GET tags /retropie-sync/retropie/psx/Game.bin",
+				"create /retropie-sync/retropie/trash/psx/Game.bin",
+				"complete /retropie-sync/retropie/trash/psx/Game.bin",
+				"DELETE /retropie-sync/retropie/psx/Game.bin ",
+			}))
+			Expect(ranges).To(HaveLen(11))
+			Expect(ranges[0]).To(Equal("bytes=0-536870911"))
+			Expect(ranges[10]).To(Equal("bytes=5368709120-5368709120"))
+		})
+
+		It("copies objects too large for a single copy in parts, keeping their tags", func() {
+			size = 5*1024*1024*1024 + 1
+			err := copier.Copy(context.TODO(), "retropie/psx/Game.bin", "retropie/v2/psx/Game.bin")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]string{
+				"HEAD /retropie-sync/retropie/psx/Game.bin ",
+				"GET tags /retropie-sync/retropie/psx/Game.bin",
+				"create /retropie-sync/retropie/v2/psx/Game.bin",
+				"complete /retropie-sync/retropie/v2/psx/Game.bin",
+			}))
+			Expect(ranges).To(HaveLen(11))
+			Expect(ranges[10]).To(Equal("bytes=5368709120-5368709120"))
+		})
+
+		It("restores the object to its original key", func() {
+			err := trasher.RestoreTrash(context.TODO(), "retropie/snes/game.srm")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(Equal([]string{
+				"HEAD /retropie-sync/retropie/trash/snes/game.srm ",
+				"PUT /retropie-sync/retropie/snes/game.srm retropie-sync/retropie/trash/snes/game.srm",
+				"DELETE /retropie-sync/retropie/trash/snes/game.srm ",
+			}))
+		})
+	})
+
+	When("keeping latest pointers", func() {
+		var (
+			mu      sync.Mutex
+			objects map[string][]byte
+			file    *fs.File
+			sum     string
+		)
+
+		BeforeEach(func() {
+			objects = make(map[string][]byte)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch r.Method {
+				case http.MethodPut:
+					if src := r.Header.Get("x-amz-copy-source"); src != "" {
+						src, err := url.PathUnescape(src)
+						Expect(err).NotTo(HaveOccurred())
+						objects[r.URL.Path] = objects["/"+src]
+						_, _ = w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+						return
+					}
+					body, err := io.ReadAll(r.Body)
+					Expect(err).NotTo(HaveOccurred())
+					objects[r.URL.Path] = body
+				case http.MethodHead:
+					if _, ok := objects[r.URL.Path]; !ok {
+						w.WriteHeader(http.StatusNotFound)
+					}
+				case http.MethodDelete:
+					delete(objects, r.URL.Path)
+				case http.MethodGet:
+					if r.URL.Query().Get("list-type") == "2" {
+						prefix := "/retropie-sync/" + r.URL.Query().Get("prefix")
+						keys := make([]string, 0)
+						for key := range objects {
+							if strings.HasPrefix(key, prefix) {
+								keys = append(keys, strings.TrimPrefix(key, "/retropie-sync/"))
+							}
+						}
+						sort.Strings(keys)
+						body := "<ListBucketResult>"
+						for _, key := range keys {
+							body += fmt.Sprintf("<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(objects["/retropie-sync/"+key]))
+						}
+						_, _ = w.Write([]byte(body + "</ListBucketResult>"))
+						return
+					}
+					body, ok := objects[r.URL.Path]
+					if !ok {
+						w.WriteHeader(http.StatusNotFound)
+						_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+						return
+					}
+					_, _ = w.Write(body)
+				}
+			}))
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+			path := filepath.Join(GinkgoT().TempDir(), "snes", "Game.srm")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte("save"), 0644)).To(Succeed())
+			file = fs.NewFile(path, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+			var err error
+			sum, err = file.Checksum()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("points at the latest upload of each file", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled:        true,
+				Bucket:         "retropie-sync",
+				Prefix:         "retropie",
+				LatestPointers: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(client.Store(context.TODO(), "2024/03/02/12", file)).To(Succeed())
+			Expect(objects).To(HaveKey("/retropie-sync/retropie/latest/snes/Game.srm"))
+
+			latest, err := client.(storage.LatestFinder).Latest(context.TODO(), "snes/Game.srm")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest.Key).To(Equal("retropie/2024/03/02/12/snes/Game.srm"))
+			Expect(latest.SHA256).To(Equal(sum))
+			Expect(latest.LastModified).To(BeTemporally("==", file.LastModified))
+
+			_, err = client.(storage.LatestFinder).Latest(context.TODO(), "snes/Other.srm")
+			Expect(err).To(MatchError(errors.NotFoundError))
+		})
+
+		It("moves everything under a prefix, repointing latest pointers", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled:        true,
+				Bucket:         "retropie-sync",
+				Prefix:         "retropie",
+				LatestPointers: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+
+			mover := client.(storage.PrefixMover)
+			moves, err := mover.MovePrefix(context.TODO(), "retropie", "alice", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(moves).To(HaveLen(2))
+			Expect(objects).To(HaveKey("/retropie-sync/retropie/2024/03/01/12/snes/Game.srm"))
+
+			moves, err = mover.MovePrefix(context.TODO(), "retropie", "alice", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(moves).To(ContainElement(storage.Move{
+				From: "retropie/2024/03/01/12/snes/Game.srm",
+				To:   "alice/2024/03/01/12/snes/Game.srm",
+			}))
+			Expect(objects).To(HaveLen(2))
+			Expect(objects).To(HaveKey("/retropie-sync/alice/2024/03/01/12/snes/Game.srm"))
+			Expect(string(objects["/retropie-sync/alice/latest/snes/Game.srm"])).To(ContainSubstring(`"key":"alice/2024/03/01/12/snes/Game.srm"`))
+		})
+
+		It("lists uploads without latest pointers or the trash", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled:        true,
+				Bucket:         "retropie-sync",
+				Prefix:         "retropie",
+				LatestPointers: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(client.Store(context.TODO(), "2024/03/02/12", file)).To(Succeed())
+			Expect(client.(storage.Trasher).Trash(context.TODO(), "retropie/2024/03/01/12/snes/Game.srm", time.Hour)).To(Succeed())
+
+			listed, err := client.(storage.Lister).List(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listed).To(HaveLen(1))
+			Expect(listed[0].Key).To(Equal("retropie/2024/03/02/12/snes/Game.srm"))
+			Expect(listed[0].Size).To(Equal(int64(len("save"))))
+		})
+
+		It("finds files by path in the latest layout without pointers", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled:        true,
+				Bucket:         "retropie-sync",
+				Prefix:         "retropie",
+				Layout:         storage.LatestLayout,
+				LatestPointers: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Store(context.TODO(), "", file)).To(Succeed())
+			Expect(objects).To(HaveLen(1))
+
+			latest, err := client.(storage.LatestFinder).Latest(context.TODO(), "snes/Game.srm")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest.Key).To(Equal("retropie/snes/Game.srm"))
+		})
+	})
+
+	When("tagging objects", func() {
+		var (
+			mu       sync.Mutex
+			tagging  string
+			requests []string
+			file     *fs.File
+		)
+
+		BeforeEach(func() {
+			tagging = ""
+			requests = nil
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				requests = append(requests, r.Method+" "+r.URL.RequestURI())
+				if r.Method == http.MethodPut && r.URL.Query().Has("lifecycle") {
+					body, err := io.ReadAll(r.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(body)).To(ContainSubstring("<Key>fileType</Key><Value>rom</Value>"))
+					Expect(string(body)).To(ContainSubstring("<StorageClass>GLACIER</StorageClass>"))
+				}
+				if r.Method == http.MethodPut {
+					tagging = r.Header.Get("x-amz-tagging")
+				}
+			}))
+			DeferCleanup(server.Close)
+			GinkgoT().Setenv("AWS_ENDPOINT", server.URL)
+			GinkgoT().Setenv("AWS_REGION", "us-east-1")
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "test")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+			path := filepath.Join(GinkgoT().TempDir(), "snes", "Chrono Trigger.srm")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte("save"), 0644)).To(Succeed())
+			file = fs.NewFile(path, time.Now())
+		})
+
+		It("tags uploads with their system, file type, and device", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Enabled:  true,
+				Bucket:   "retropie-sync",
+				Tags:     map[string]string{"username": "trevor"},
+				DeviceID: "device-1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Store(context.TODO(), "2024/03/01/12", file)).To(Succeed())
+			Expect(tagging).To(Equal("deviceID=device-1&fileType=save&system=snes&username=trevor"))
+		})
+
+		It("applies lifecycle rules on init", func() {
+			client, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Bucket:                 "retropie-sync",
+				CreateMissingResources: true,
+				Lifecycle: []storage.LifecycleRule{{
+					ID:             "archive-roms",
+					Tags:           map[string]string{"filetype": "rom"},
+					TransitionDays: 30,
+					StorageClass:   "glacier",
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Init(context.TODO())).To(Succeed())
+			Expect(requests).To(ContainElement("PUT /retropie-sync?lifecycle="))
+		})
+
+		It("rejects lifecycle rules with an unknown storage class", func() {
+			_, err := storage.NewS3Storage(context.TODO(), storage.S3Config{
+				Lifecycle: []storage.LifecycleRule{{ID: "x", TransitionDays: 30, StorageClass: "COLD"}},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
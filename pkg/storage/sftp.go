@@ -2,9 +2,11 @@ package storage
 
 import (
 	"context"
+	"path"
 
 	"github.com/TrevorEdris/retropie-utils/pkg/errors"
 	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
 )
 
 type (
@@ -15,7 +17,7 @@ type (
 	SFTPConfig struct {
 		Enabled   bool
 		Username  string
-		Password  string
+		Password  secret.Secret
 		Port      int
 		RemoteDir string
 	}
@@ -38,3 +40,7 @@ func (s *sftp) Store(ctx context.Context, remoteDir string, file *fs.File) error
 func (s *sftp) StoreAll(ctx context.Context, remoteDir string, file []*fs.File) error {
 	return errors.NotImplementedError
 }
+
+func (s *sftp) Key(remoteDir string, file *fs.File) string {
+	return path.Join(remoteDir, file.Dir, file.Name)
+}
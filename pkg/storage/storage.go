@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/TrevorEdris/retropie-utils/pkg/fs"
 )
@@ -11,5 +13,141 @@ type (
 		Init(ctx context.Context) error
 		Store(ctx context.Context, remoteDir string, file *fs.File) error
 		StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error
+		// Key returns where Store puts the file, so the location can be
+		// recorded and the file found again later.
+		Key(remoteDir string, file *fs.File) string
 	}
+
+	// Pinger is implemented by storages that can check they are reachable
+	// without modifying anything. Ping returns the server's clock, or the zero
+	// time if the server doesn't report one.
+	Pinger interface {
+		Ping(ctx context.Context) (time.Time, error)
+	}
+
+	// Preflighter is implemented by storages that can check, before a
+	// sync, that they can be reached and will accept the credentials.
+	// Preflight returns a *PreflightError saying why not.
+	Preflighter interface {
+		Preflight(ctx context.Context) error
+	}
+
+	// Verifier is implemented by storages that can report what they hold.
+	// RemoteChecksum returns the hex-encoded SHA-256 of the original content
+	// stored at key, using the checksum recorded at upload when there is one
+	// unless download is set. It returns errors.NotFoundError if nothing is
+	// stored at key.
+	Verifier interface {
+		RemoteChecksum(ctx context.Context, key string, download bool) (string, error)
+	}
+
+	// Prefetcher is implemented by storages that look up what they already
+	// hold while storing a file. Prefetch loads that into memory in bulk,
+	// so a sync of many files makes one listing instead of a round trip per
+	// file. It applies until the storage is discarded.
+	Prefetcher interface {
+		Prefetch(ctx context.Context) error
+	}
+
+	// Retriever is implemented by storages that can download what they hold.
+	// Retrieve writes the original, uncompressed content stored at key to w.
+	// It returns errors.NotFoundError if nothing is stored at key, and
+	// errors.ChecksumError, once w has been written, if the content doesn't
+	// match the checksum recorded when it was stored.
+	Retriever interface {
+		Retrieve(ctx context.Context, key string, w io.Writer) error
+	}
+
+	// LatestFinder is implemented by storages that can find the latest
+	// upload of a file from its path alone, e.g. "snes/Game.srm", without
+	// the metadata store. It returns errors.NotFoundError if they can't.
+	LatestFinder interface {
+		Latest(ctx context.Context, path string) (Pointer, error)
+	}
+
+	// Pointer locates the latest upload of a file. SHA256 and LastModified
+	// are those of the uploaded file, when known.
+	Pointer struct {
+		Key          string    `json:"key"`
+		SHA256       string    `json:"sha256,omitempty"`
+		LastModified time.Time `json:"lastModified"`
+		UploadedAt   time.Time `json:"uploadedAt"`
+		DeviceID     string    `json:"deviceId,omitempty"`
+	}
+
+	// Copier is implemented by storages that can copy what they hold
+	// without downloading it. Copy stores the object at from again at to,
+	// with its metadata, leaving the original in place.
+	Copier interface {
+		Copy(ctx context.Context, from, to string) error
+	}
+
+	// PrefixMover is implemented by storages that can move everything under
+	// one key prefix to another, e.g. to rename a person's prefix in a
+	// shared bucket. MovePrefix returns the moves made, or with dryRun set,
+	// the moves it would make.
+	PrefixMover interface {
+		MovePrefix(ctx context.Context, from, to string, dryRun bool) ([]Move, error)
+	}
+
+	// Move is an object moved from one key to another.
+	Move struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	// Lister is implemented by storages that can list what they hold. List
+	// returns every upload stored, leaving out the storage's own
+	// bookkeeping, such as latest pointers and the trash.
+	Lister interface {
+		List(ctx context.Context) ([]Object, error)
+	}
+
+	// Object is an upload as stored. Size is the stored size, which is the
+	// compressed size of compressed uploads. Blob is set for content
+	// stored by its hash, whose key names no file.
+	Object struct {
+		Key          string    `json:"key"`
+		Size         int64     `json:"size"`
+		LastModified time.Time `json:"lastModified"`
+		Blob         bool      `json:"blob,omitempty"`
+	}
+
+	// Trasher is implemented by storages that delete softly. Trash moves
+	// the object at key to the trash, where it can be restored until it
+	// expires after ttl; the trash is only emptied with DeleteTrash. Trashed
+	// objects are identified by the key they were stored at.
+	Trasher interface {
+		Trash(ctx context.Context, key string, ttl time.Duration) error
+		ListTrash(ctx context.Context) ([]TrashEntry, error)
+		RestoreTrash(ctx context.Context, key string) error
+		DeleteTrash(ctx context.Context, key string) error
+	}
+
+	// TrashEntry describes a trashed object by the key it was stored at.
+	TrashEntry struct {
+		Key       string    `json:"key"`
+		Size      int64     `json:"size"`
+		TrashedAt time.Time `json:"trashedAt"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	replaceKey struct{}
 )
+
+// WithReplace returns a context under which Store uploads the file even if
+// identical content appears to be stored already, e.g. to repair an object
+// found to be corrupt.
+func WithReplace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replaceKey{}, true)
+}
+
+func replacing(ctx context.Context) bool {
+	replace, _ := ctx.Value(replaceKey{}).(bool)
+	return replace
+}
+
+// Expired reports whether the entry may be deleted for good.
+func (e TrashEntry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
@@ -0,0 +1,307 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+)
+
+type (
+	// Fake is a Storage for tests of code that uses one, which keeps what
+	// it stores in memory, or with NewDirFake, in a local directory. Keys
+	// are [remoteDir/]dir/name, as with rclone. Setting Err fails every
+	// operation with it, e.g. errors.CircuitOpenError to act unreachable.
+	Fake struct {
+		// Err, if set, is returned by every operation.
+		Err error
+
+		mu      sync.Mutex
+		root    string
+		objects map[string]fakeObject
+		trash   map[string]fakeTrash
+		stores  int
+	}
+
+	fakeObject struct {
+		content      []byte
+		lastModified time.Time
+	}
+
+	fakeTrash struct {
+		fakeObject
+		trashedAt time.Time
+		expiresAt time.Time
+	}
+)
+
+var (
+	_ storage.Storage   = &Fake{}
+	_ storage.Retriever = &Fake{}
+	_ storage.Lister    = &Fake{}
+	_ storage.Trasher   = &Fake{}
+	_ storage.Pinger    = &Fake{}
+)
+
+// NewFake returns an empty Fake that keeps what it stores in memory.
+func NewFake() *Fake {
+	return &Fake{
+		objects: make(map[string]fakeObject),
+		trash:   make(map[string]fakeTrash),
+	}
+}
+
+// NewDirFake returns a Fake that stores files under root, so tests can look
+// at what was stored. It starts with whatever root already holds.
+func NewDirFake(root string) *Fake {
+	f := NewFake()
+	f.root = root
+	return f
+}
+
+func (f *Fake) Init(ctx context.Context) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.root == "" {
+		return nil
+	}
+	return os.MkdirAll(f.root, os.ModePerm)
+}
+
+func (f *Fake) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	content, err := os.ReadFile(file.Absolute)
+	if err != nil {
+		return eris.Wrapf(err, "failed to read %s", file.Absolute)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stores++
+	return f.put(f.Key(remoteDir, file), fakeObject{content: content, lastModified: clock.Now(ctx)})
+}
+
+func (f *Fake) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	for _, file := range files {
+		err := f.Store(ctx, remoteDir, file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fake) Key(remoteDir string, file *fs.File) string {
+	return path.Join(remoteDir, file.Dir, file.Name)
+}
+
+// Ping returns the time by the clock in ctx.
+func (f *Fake) Ping(ctx context.Context) (time.Time, error) {
+	if f.Err != nil {
+		return time.Time{}, f.Err
+	}
+	return clock.Now(ctx), nil
+}
+
+func (f *Fake) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	obj, err := f.get(key)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(obj.content))
+	return err
+}
+
+// List returns every stored object, sorted by key.
+func (f *Fake) List(ctx context.Context) ([]storage.Object, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys, err := f.keys()
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]storage.Object, 0, len(keys))
+	for _, key := range keys {
+		obj, err := f.get(key)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, storage.Object{Key: key, Size: int64(len(obj.content)), LastModified: obj.lastModified})
+	}
+	return objects, nil
+}
+
+func (f *Fake) Trash(ctx context.Context, key string, ttl time.Duration) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, err := f.get(key)
+	if err != nil {
+		return err
+	}
+	err = f.delete(key)
+	if err != nil {
+		return err
+	}
+	now := clock.Now(ctx)
+	f.trash[key] = fakeTrash{fakeObject: obj, trashedAt: now, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (f *Fake) ListTrash(ctx context.Context) ([]storage.TrashEntry, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries := make([]storage.TrashEntry, 0, len(f.trash))
+	for key, t := range f.trash {
+		entries = append(entries, storage.TrashEntry{Key: key, Size: int64(len(t.content)), TrashedAt: t.trashedAt, ExpiresAt: t.expiresAt})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+func (f *Fake) RestoreTrash(ctx context.Context, key string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.trash[key]
+	if !ok {
+		return eris.Wrapf(errors.NotFoundError, "%s is not in the trash", key)
+	}
+	delete(f.trash, key)
+	return f.put(key, t.fakeObject)
+}
+
+func (f *Fake) DeleteTrash(ctx context.Context, key string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.trash[key]; !ok {
+		return eris.Wrapf(errors.NotFoundError, "%s is not in the trash", key)
+	}
+	delete(f.trash, key)
+	return nil
+}
+
+// Stores returns how many files have been stored.
+func (f *Fake) Stores() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stores
+}
+
+// Content returns what is stored at key, or errors.NotFoundError.
+func (f *Fake) Content(key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, err := f.get(key)
+	return obj.content, err
+}
+
+func (f *Fake) put(key string, obj fakeObject) error {
+	if f.root == "" {
+		f.objects[key] = obj
+		return nil
+	}
+	p := filepath.Join(f.root, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return eris.Wrapf(err, "failed to create directory for %s", key)
+	}
+	err = os.WriteFile(p, obj.content, 0644)
+	if err != nil {
+		return eris.Wrapf(err, "failed to write %s", key)
+	}
+	return nil
+}
+
+func (f *Fake) get(key string) (fakeObject, error) {
+	if f.root == "" {
+		obj, ok := f.objects[key]
+		if !ok {
+			return fakeObject{}, eris.Wrapf(errors.NotFoundError, "%s not found", key)
+		}
+		return obj, nil
+	}
+	p := filepath.Join(f.root, filepath.FromSlash(key))
+	info, err := os.Stat(p)
+	if err != nil || info.IsDir() {
+		return fakeObject{}, eris.Wrapf(errors.NotFoundError, "%s not found", key)
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return fakeObject{}, eris.Wrapf(err, "failed to read %s", key)
+	}
+	return fakeObject{content: content, lastModified: info.ModTime()}, nil
+}
+
+func (f *Fake) delete(key string) error {
+	if f.root == "" {
+		delete(f.objects, key)
+		return nil
+	}
+	err := os.Remove(filepath.Join(f.root, filepath.FromSlash(key)))
+	if err != nil {
+		return eris.Wrapf(err, "failed to delete %s", key)
+	}
+	return nil
+}
+
+// keys returns every stored key, sorted.
+func (f *Fake) keys() ([]string, error) {
+	keys := make([]string, 0, len(f.objects))
+	if f.root == "" {
+		for key := range f.objects {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys, nil
+	}
+	err := filepath.WalkDir(f.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, eris.Wrapf(err, "failed to list %s", f.root)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
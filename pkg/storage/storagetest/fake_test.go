@@ -0,0 +1,16 @@
+package storagetest_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+)
+
+var _ = storagetest.Conformance("in-memory fake", func() storage.Storage {
+	return storagetest.NewFake()
+})
+
+var _ = storagetest.Conformance("directory fake", func() storage.Storage {
+	return storagetest.NewDirFake(GinkgoT().TempDir())
+})
@@ -0,0 +1,166 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+// remoteDir is the remote directory the specs store files under.
+const remoteDir = "conformance"
+
+// Conformance registers specs that check the storage newStorage creates
+// behaves as the syncer expects of any backend: what is stored can be
+// downloaded again byte for byte, including empty files and names outside
+// ASCII, later uploads replace earlier ones, and missing keys are reported
+// as errors.NotFoundError. Specs for the optional interfaces (Retriever,
+// Lister, Trasher) are skipped if the storage doesn't implement them.
+// newStorage is called for every spec, and must return an empty storage.
+// Call it at the top level of a test package, as with Describe:
+//
+//	var _ = storagetest.Conformance("rclone", func() storage.Storage { ... })
+func Conformance(name string, newStorage func() storage.Storage) bool {
+	return Describe(name+" conformance", func() {
+		var (
+			ctx    context.Context
+			client storage.Storage
+			dir    string
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			dir = GinkgoT().TempDir()
+			client = newStorage()
+			Expect(client.Init(ctx)).To(Succeed())
+		})
+
+		// file writes content to a local file at system/name for storing.
+		file := func(system, name, content string) *fs.File {
+			p := filepath.Join(dir, system, name)
+			Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+			info, err := os.Stat(p)
+			Expect(err).NotTo(HaveOccurred())
+			f := fs.NewFile(p, info.ModTime())
+			f.Dir = system
+			f.Size = info.Size()
+			return f
+		}
+
+		retriever := func() storage.Retriever {
+			r, ok := client.(storage.Retriever)
+			if !ok {
+				Skip(name + " does not support downloads")
+			}
+			return r
+		}
+
+		retrieve := func(key string) string {
+			out := &bytes.Buffer{}
+			Expect(retriever().Retrieve(ctx, key, out)).To(Succeed())
+			return out.String()
+		}
+
+		It("initializes more than once", func() {
+			Expect(client.Init(ctx)).To(Succeed())
+		})
+
+		It("builds the same key for the same file", func() {
+			f := file("snes", "Game.srm", "save")
+			key := client.Key(remoteDir, f)
+			Expect(key).NotTo(BeEmpty())
+			Expect(client.Key(remoteDir, f)).To(Equal(key))
+			Expect(client.Key(remoteDir, file("gba", "Game.srm", "save"))).NotTo(Equal(key))
+		})
+
+		It("retrieves what it stores", func() {
+			f := file("snes", "Game.srm", "save data")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			Expect(retrieve(client.Key(remoteDir, f))).To(Equal("save data"))
+		})
+
+		It("stores empty files", func() {
+			f := file("snes", "Empty.srm", "")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			Expect(retrieve(client.Key(remoteDir, f))).To(BeEmpty())
+		})
+
+		It("stores names outside ASCII", func() {
+			f := file("psx", "Pokémon – Édition ドラゴンクエスト.srm", "unicode")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			Expect(retrieve(client.Key(remoteDir, f))).To(Equal("unicode"))
+		})
+
+		It("replaces what is stored at a key", func() {
+			f := file("snes", "Game.srm", "first")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			f = file("snes", "Game.srm", "second")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			Expect(retrieve(client.Key(remoteDir, f))).To(Equal("second"))
+		})
+
+		It("stores several files", func() {
+			files := []*fs.File{file("snes", "A.srm", "a"), file("snes", "B.srm", "b")}
+			Expect(client.StoreAll(ctx, remoteDir, files)).To(Succeed())
+			Expect(retrieve(client.Key(remoteDir, files[0]))).To(Equal("a"))
+			Expect(retrieve(client.Key(remoteDir, files[1]))).To(Equal("b"))
+		})
+
+		It("reports missing keys as not found", func() {
+			key := client.Key(remoteDir, file("snes", "Missing.srm", ""))
+			err := retriever().Retrieve(ctx, key, &bytes.Buffer{})
+			Expect(err).To(MatchError(errors.NotFoundError))
+		})
+
+		It("lists what it stores", func() {
+			lister, ok := client.(storage.Lister)
+			if !ok {
+				Skip(name + " does not support listing")
+			}
+			start := time.Now().Add(-time.Minute)
+			f := file("snes", "Game.srm", "save")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			objects, err := lister.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(objects[0].Key).To(Equal(client.Key(remoteDir, f)))
+			Expect(objects[0].Size).To(BeNumerically(">", 0))
+			// Backends either keep the file's own time or the upload time.
+			Expect(objects[0].LastModified).To(BeTemporally(">=", start.Truncate(time.Second)))
+		})
+
+		It("trashes and restores what it stores", func() {
+			trasher, ok := client.(storage.Trasher)
+			if !ok {
+				Skip(name + " does not support the trash")
+			}
+			f := file("snes", "Game.srm", "save")
+			Expect(client.Store(ctx, remoteDir, f)).To(Succeed())
+			key := client.Key(remoteDir, f)
+
+			Expect(trasher.Trash(ctx, key, time.Hour)).To(Succeed())
+			Expect(retriever().Retrieve(ctx, key, &bytes.Buffer{})).To(MatchError(errors.NotFoundError))
+			entries, err := trasher.ListTrash(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(ContainElement(HaveField("Key", key)))
+
+			Expect(trasher.RestoreTrash(ctx, key)).To(Succeed())
+			Expect(retrieve(key)).To(Equal("save"))
+
+			Expect(trasher.Trash(ctx, key, time.Hour)).To(Succeed())
+			Expect(trasher.DeleteTrash(ctx, key)).To(Succeed())
+			entries, err = trasher.ListTrash(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).NotTo(ContainElement(HaveField("Key", key)))
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// Tags set on every object stored from a file, alongside the configured
+// static tags (e.g. "username").
+const (
+	// SystemTag is the system the file belongs to, the top-level directory
+	// it is stored under (e.g. "snes", or "configs").
+	SystemTag = "system"
+	// FileTypeTag is the file's type, e.g. "rom" or "save".
+	FileTypeTag = "fileType"
+	// DeviceIDTag is the ID of the device that uploaded the file. It is
+	// only set when the DeviceID is configured.
+	DeviceIDTag = "deviceID"
+)
+
+// LifecycleRule is an S3 lifecycle rule applied to the objects under the
+// configured prefix that have all of Tags, e.g. {fileType: rom}. Objects are
+// moved to StorageClass (e.g. "GLACIER") TransitionDays after upload, and
+// deleted ExpirationDays after upload; zero days disables either action.
+type LifecycleRule struct {
+	ID             string
+	Tags           map[string]string
+	TransitionDays int32
+	StorageClass   string
+	ExpirationDays int32
+}
+
+func (r LifecycleRule) validate() error {
+	if r.ID == "" {
+		return eris.New("lifecycle rule is missing an id")
+	}
+	if r.TransitionDays <= 0 && r.ExpirationDays <= 0 {
+		return eris.Errorf("lifecycle rule %s has neither transitionDays nor expirationDays", r.ID)
+	}
+	if r.TransitionDays > 0 {
+		for _, class := range types.TransitionStorageClass("").Values() {
+			if strings.EqualFold(string(class), r.StorageClass) {
+				return nil
+			}
+		}
+		return eris.Errorf("lifecycle rule %s has unsupported storage class %q", r.ID, r.StorageClass)
+	}
+	return nil
+}
+
+// tagging returns the URL-encoded tags of the object stored from file.
+func (s *s3) tagging(file *fs.File) *string {
+	tags := url.Values{}
+	for k, v := range s.cfg.Tags {
+		tags.Set(k, v)
+	}
+	system, _, _ := strings.Cut(file.Dir, "/")
+	if system != "" && system != "." {
+		tags.Set(SystemTag, system)
+	}
+	tags.Set(FileTypeTag, file.FileType.String())
+	if s.cfg.DeviceID != "" {
+		tags.Set(DeviceIDTag, s.cfg.DeviceID)
+	}
+	return aws.String(tags.Encode())
+}
+
+// applyLifecycle replaces the bucket's lifecycle rules with the configured
+// ones.
+func (s *s3) applyLifecycle(ctx context.Context) error {
+	rules := make([]types.LifecycleRule, 0, len(s.cfg.Lifecycle))
+	for _, rule := range s.cfg.Lifecycle {
+		rules = append(rules, s.lifecycleRule(rule))
+	}
+	_, err := s.client.PutBucketLifecycleConfiguration(ctx, &awss3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s.cfg.Bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return eris.Wrap(categorize(err), "failed to apply lifecycle rules")
+	}
+	log.FromCtx(ctx).Info("Applied lifecycle rules", zap.String("bucket", s.cfg.Bucket), zap.Int("rules", len(rules)))
+	return nil
+}
+
+func (s *s3) lifecycleRule(rule LifecycleRule) types.LifecycleRule {
+	out := types.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: s.lifecycleFilter(rule.Tags),
+	}
+	if rule.TransitionDays > 0 {
+		out.Transitions = []types.Transition{{
+			Days:         aws.Int32(rule.TransitionDays),
+			StorageClass: types.TransitionStorageClass(strings.ToUpper(rule.StorageClass)),
+		}}
+	}
+	if rule.ExpirationDays > 0 {
+		out.Expiration = &types.LifecycleExpiration{Days: aws.Int32(rule.ExpirationDays)}
+	}
+	return out
+}
+
+// lifecycleFilter matches the objects under the prefix with all of the
+// given tags. S3 only accepts an And of two or more predicates.
+func (s *s3) lifecycleFilter(tags map[string]string) types.LifecycleRuleFilter {
+	prefix := s.keys.Root()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	predicates := make([]types.Tag, 0, len(keys))
+	for _, k := range keys {
+		predicates = append(predicates, types.Tag{Key: aws.String(canonicalTagKey(k)), Value: aws.String(tags[k])})
+	}
+	switch {
+	case len(predicates) == 0:
+		return &types.LifecycleRuleFilterMemberPrefix{Value: prefix}
+	case len(predicates) == 1 && prefix == "":
+		return &types.LifecycleRuleFilterMemberTag{Value: predicates[0]}
+	default:
+		and := types.LifecycleRuleAndOperator{Tags: predicates}
+		if prefix != "" {
+			and.Prefix = aws.String(prefix)
+		}
+		return &types.LifecycleRuleFilterMemberAnd{Value: and}
+	}
+}
+
+// canonicalTagKey restores the case of the built-in tags, which config
+// loading lowercases in map keys.
+func canonicalTagKey(key string) string {
+	for _, tag := range []string{SystemTag, FileTypeTag, DeviceIDTag} {
+		if strings.EqualFold(key, tag) {
+			return tag
+		}
+	}
+	return key
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	defaultTransferTimeout = time.Hour
+	defaultMetadataTimeout = 2 * time.Minute
+)
+
+type (
+	// TimeoutConfig bounds how long a storage operation may take before it
+	// is abandoned, so a hung connection can't stall a sync forever. Store
+	// bounds each upload attempt and Retrieve each download, both by
+	// default an hour, long enough for a disc image over a slow link.
+	// Metadata bounds everything else, such as initializing and prefetching,
+	// by default two minutes. A negative timeout disables it.
+	TimeoutConfig struct {
+		Store    time.Duration
+		Retrieve time.Duration
+		Metadata time.Duration
+	}
+
+	timingOut struct {
+		storage Storage
+		cfg     TimeoutConfig
+	}
+)
+
+var (
+	_ Storage     = &timingOut{}
+	_ Prefetcher  = &timingOut{}
+	_ Retriever   = &timingOut{}
+	_ Preflighter = &timingOut{}
+)
+
+// Override returns the timeouts with those set in o replacing them, e.g.
+// to apply a backend's own timeouts over the storage-wide ones.
+func (t TimeoutConfig) Override(o TimeoutConfig) TimeoutConfig {
+	if o.Store != 0 {
+		t.Store = o.Store
+	}
+	if o.Retrieve != 0 {
+		t.Retrieve = o.Retrieve
+	}
+	if o.Metadata != 0 {
+		t.Metadata = o.Metadata
+	}
+	return t
+}
+
+// NewTimeoutStorage wraps storage so its operations fail once they take
+// longer than cfg allows. A timed out operation fails with a network error,
+// so it is retried like any other when wrapped by NewRetryingStorage.
+func NewTimeoutStorage(storage Storage, cfg TimeoutConfig) Storage {
+	if cfg.Store == 0 {
+		cfg.Store = defaultTransferTimeout
+	}
+	if cfg.Retrieve == 0 {
+		cfg.Retrieve = defaultTransferTimeout
+	}
+	if cfg.Metadata == 0 {
+		cfg.Metadata = defaultMetadataTimeout
+	}
+	return &timingOut{storage: storage, cfg: cfg}
+}
+
+func (t *timingOut) Init(ctx context.Context) error {
+	return t.do(ctx, "init", t.cfg.Metadata, func(ctx context.Context) error {
+		return t.storage.Init(ctx)
+	})
+}
+
+func (t *timingOut) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	return t.do(ctx, "store", t.cfg.Store, func(ctx context.Context) error {
+		return t.storage.Store(ctx, remoteDir, file)
+	})
+}
+
+// StoreAll stores the files one at a time, each within the store timeout.
+func (t *timingOut) StoreAll(ctx context.Context, remoteDir string, files []*fs.File) error {
+	for _, f := range files {
+		err := t.Store(ctx, remoteDir, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *timingOut) Key(remoteDir string, file *fs.File) string {
+	return t.storage.Key(remoteDir, file)
+}
+
+// Prefetch prefetches through the wrapped storage, if it supports it.
+func (t *timingOut) Prefetch(ctx context.Context) error {
+	prefetcher, ok := t.storage.(Prefetcher)
+	if !ok {
+		return nil
+	}
+	return t.do(ctx, "prefetch", t.cfg.Metadata, prefetcher.Prefetch)
+}
+
+// Retrieve downloads through the wrapped storage, if it supports it.
+func (t *timingOut) Retrieve(ctx context.Context, key string, w io.Writer) error {
+	retriever, ok := t.storage.(Retriever)
+	if !ok {
+		return eris.Wrap(errors.NotImplementedError, "storage does not support downloads")
+	}
+	return t.do(ctx, "retrieve", t.cfg.Retrieve, func(ctx context.Context) error {
+		return retriever.Retrieve(ctx, key, w)
+	})
+}
+
+// Preflight checks the wrapped storage, if it supports it.
+func (t *timingOut) Preflight(ctx context.Context) error {
+	preflighter, ok := t.storage.(Preflighter)
+	if !ok {
+		return nil
+	}
+	return t.do(ctx, "preflight", t.cfg.Metadata, preflighter.Preflight)
+}
+
+// do runs fn under a context that expires after timeout, unless timeout is
+// negative.
+func (t *timingOut) do(ctx context.Context, op string, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout < 0 {
+		return fn(ctx)
+	}
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(opCtx)
+	if err != nil && ctx.Err() == nil && opCtx.Err() == context.DeadlineExceeded {
+		return errors.WithCategory(eris.Wrapf(err, "%s timed out after %s", op, timeout), errors.NetworkCategory)
+	}
+	return err
+}
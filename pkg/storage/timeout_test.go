@@ -0,0 +1,45 @@
+package storage_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+// hungStorage stores nothing until its context is done.
+type hungStorage struct {
+	flakyStorage
+}
+
+func (h *hungStorage) Store(ctx context.Context, remoteDir string, file *fs.File) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var _ = Describe("Timeout", func() {
+	It("fails operations that take too long as unreachable", func() {
+		client := storage.NewTimeoutStorage(&hungStorage{}, storage.TimeoutConfig{Store: time.Millisecond})
+		err := client.Store(context.TODO(), "", nil)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(errors.CategoryOf(err)).To(Equal(errors.NetworkCategory))
+	})
+
+	It("reports cancellation as such", func() {
+		client := storage.NewTimeoutStorage(&hungStorage{}, storage.TimeoutConfig{Store: time.Hour})
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		err := client.Store(ctx, "", nil)
+		Expect(errors.CategoryOf(err)).To(Equal(errors.CancelledCategory))
+	})
+
+	It("lets backends override the storage-wide timeouts", func() {
+		cfg := storage.TimeoutConfig{Store: time.Hour, Metadata: time.Minute}.Override(storage.TimeoutConfig{Store: 2 * time.Hour})
+		Expect(cfg).To(Equal(storage.TimeoutConfig{Store: 2 * time.Hour, Metadata: time.Minute}))
+	})
+})
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const (
+	// trashDir is the remote directory, under any prefix, holding trashed
+	// objects at their original key.
+	trashDir = "trash"
+
+	// trashedAtMetadataKey and expiresAtMetadataKey record, on a trashed
+	// object, when it was trashed and when it may be deleted for good.
+	trashedAtMetadataKey = "trashed-at"
+	expiresAtMetadataKey = "expires-at"
+
+	// maxCopySize is the largest object CopyObject copies; larger ones are
+	// copied in parts of copyPartSize.
+	maxCopySize  int64 = 5 * 1024 * 1024 * 1024
+	copyPartSize int64 = 512 * 1024 * 1024
+)
+
+var _ Trasher = &s3{}
+
+// Trash moves the object at key under trash/, recording when it expires.
+func (s *s3) Trash(ctx context.Context, key string, ttl time.Duration) error {
+	head, err := s.head(ctx, key)
+	if err != nil {
+		return err
+	}
+	now := clock.Now(ctx).UTC()
+	metadata := make(map[string]string, len(head.Metadata)+2)
+	for k, v := range head.Metadata {
+		metadata[k] = v
+	}
+	metadata[trashedAtMetadataKey] = now.Format(time.RFC3339)
+	if ttl > 0 {
+		metadata[expiresAtMetadataKey] = now.Add(ttl).Format(time.RFC3339)
+	}
+	err = s.move(ctx, key, s.trashKey(key), head, metadata)
+	if err != nil {
+		return eris.Wrapf(err, "failed to trash %s", key)
+	}
+	log.FromCtx(ctx).Info("Trashed object", zap.String("key", key), zap.Duration("ttl", ttl))
+	return nil
+}
+
+// ListTrash lists the trashed objects, reading the expiry recorded on each.
+func (s *s3) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	entries := make([]TrashEntry, 0)
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(s.trashKey("")),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, eris.Wrap(categorize(err), "failed to list trash")
+		}
+		for _, obj := range page.Contents {
+			trashKey := aws.ToString(obj.Key)
+			head, err := s.head(ctx, trashKey)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, TrashEntry{
+				Key:       s.untrashKey(trashKey),
+				Size:      aws.ToInt64(obj.Size),
+				TrashedAt: parseMetadataTime(head.Metadata[trashedAtMetadataKey]),
+				ExpiresAt: parseMetadataTime(head.Metadata[expiresAtMetadataKey]),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// RestoreTrash moves the trashed object back to key.
+func (s *s3) RestoreTrash(ctx context.Context, key string) error {
+	trashKey := s.trashKey(key)
+	head, err := s.head(ctx, trashKey)
+	if err != nil {
+		return err
+	}
+	metadata := make(map[string]string, len(head.Metadata))
+	for k, v := range head.Metadata {
+		if k != trashedAtMetadataKey && k != expiresAtMetadataKey {
+			metadata[k] = v
+		}
+	}
+	err = s.move(ctx, trashKey, key, head, metadata)
+	if err != nil {
+		return eris.Wrapf(err, "failed to restore %s", key)
+	}
+	return nil
+}
+
+// DeleteTrash deletes the trashed object for good.
+func (s *s3) DeleteTrash(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(s.trashKey(key)),
+	})
+	if err != nil {
+		return eris.Wrapf(categorize(err), "failed to delete %s from the trash", key)
+	}
+	return nil
+}
+
+// trashKey returns where the object at key is kept while trashed:
+// [prefix/]trash/ followed by key without the prefix.
+func (s *s3) trashKey(key string) string {
+	return s.keys.Root() + trashDir + "/" + s.keys.Relative(key)
+}
+
+// untrashKey is the inverse of trashKey.
+func (s *s3) untrashKey(trashKey string) string {
+	return s.keys.Root() + strings.TrimPrefix(s.keys.Relative(trashKey), trashDir+"/")
+}
+
+func (s *s3) head(ctx context.Context, key string) (*awss3.HeadObjectOutput, error) {
+	out, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFoundErr *types.NotFound
+		if errors.As(err, &notFoundErr) {
+			return nil, eris.Wrapf(rperrors.NotFoundError, "no object at %s", key)
+		}
+		return nil, eris.Wrapf(categorize(err), "failed to check %s", key)
+	}
+	return out, nil
+}
+
+// move copies the object at from, described by head, to to, replacing its
+// metadata but keeping its content type, encoding, and tags, then deletes
+// the original.
+func (s *s3) move(ctx context.Context, from, to string, head *awss3.HeadObjectOutput, metadata map[string]string) error {
+	var err error
+	if aws.ToInt64(head.ContentLength) > maxCopySize {
+		err = s.copyParts(ctx, from, to, head, metadata)
+	} else {
+		_, err = s.client.CopyObject(ctx, &awss3.CopyObjectInput{
+			Bucket:            aws.String(s.cfg.Bucket),
+			Key:               aws.String(to),
+			CopySource:        aws.String(copySource(s.cfg.Bucket, from)),
+			ContentType:       head.ContentType,
+			ContentEncoding:   head.ContentEncoding,
+			Metadata:          metadata,
+			MetadataDirective: types.MetadataDirectiveReplace,
+		})
+	}
+	if err != nil {
+		return categorize(err)
+	}
+	_, err = s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(from),
+	})
+	if err != nil {
+		return categorize(err)
+	}
+	return nil
+}
+
+// copyParts copies an object too large for CopyObject with a multipart
+// upload of copyPartSize ranges of it. Unlike CopyObject, that doesn't copy
+// the object's tags, so they are read and set on the upload.
+func (s *s3) copyParts(ctx context.Context, from, to string, head *awss3.HeadObjectOutput, metadata map[string]string) error {
+	tagging, err := s.client.GetObjectTagging(ctx, &awss3.GetObjectTaggingInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(from),
+	})
+	if err != nil {
+		return eris.Wrap(err, "failed to read tags")
+	}
+	tags := url.Values{}
+	for _, tag := range tagging.TagSet {
+		tags.Set(aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+	out, err := s.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+		Bucket:          aws.String(s.cfg.Bucket),
+		Key:             aws.String(to),
+		ContentType:     head.ContentType,
+		ContentEncoding: head.ContentEncoding,
+		Metadata:        metadata,
+		Tagging:         aws.String(tags.Encode()),
+	})
+	if err != nil {
+		return eris.Wrap(err, "failed to create multipart copy")
+	}
+	upload := &uploadJournal{Bucket: s.cfg.Bucket, Key: to, UploadID: aws.ToString(out.UploadId)}
+	size := aws.ToInt64(head.ContentLength)
+	parts := make([]types.CompletedPart, 0, (size+copyPartSize-1)/copyPartSize)
+	for n := int32(1); int64(n-1)*copyPartSize < size; n++ {
+		offset := int64(n-1) * copyPartSize
+		part, err := s.client.UploadPartCopy(ctx, &awss3.UploadPartCopyInput{
+			Bucket:          aws.String(s.cfg.Bucket),
+			Key:             aws.String(to),
+			UploadId:        aws.String(upload.UploadID),
+			PartNumber:      aws.Int32(n),
+			CopySource:      aws.String(copySource(s.cfg.Bucket, from)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+partLength(size, copyPartSize, n)-1)),
+		})
+		if err != nil {
+			s.abortUpload(ctx, upload)
+			return eris.Wrapf(err, "failed to copy part %d", n)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int32(n),
+		})
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.cfg.Bucket),
+		Key:             aws.String(to),
+		UploadId:        aws.String(upload.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s.abortUpload(ctx, upload)
+		return eris.Wrap(err, "failed to complete multipart copy")
+	}
+	return nil
+}
+
+// copySource formats the source of a CopyObject, URL-encoding each segment
+// of the key.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+func parseMetadataTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -11,6 +11,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// configResult is the JSON output of the config command.
+type configResult struct {
+	ConfigFile string `json:"configFile"`
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+}
+
 // configCmd represents the config command
 var configCmd = &cobra.Command{
 	Use:   "config",
@@ -25,9 +32,20 @@ to quickly create a Cobra application.`,
 		// TODO: Add support for flags
 		configFile := getConfigFilename()
 		err := syncer.ValidateConfig(configFile)
+		if jsonOutput() {
+			result := configResult{ConfigFile: configFile, Valid: err == nil}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			printJSON(result)
+			if err != nil {
+				os.Exit(exitConfig)
+			}
+			return
+		}
 		if err != nil {
 			fmt.Printf("Validation of config file %s failed: %s\n", configFile, err)
-			os.Exit(1)
+			os.Exit(exitConfig)
 		} else {
 			fmt.Println("Validation passed")
 		}
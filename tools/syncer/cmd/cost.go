@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/cost"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	costTiers         []string
+	costSyncsPerMonth float64
+)
+
+// costCmd represents the cost command
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate the monthly cost of remote storage",
+	Long: `Estimate the monthly cost of remote storage.
+
+The files a sync would pick up are totalled, and the sync history
+gives how often syncs run and how much each uploads on average. Every
+upload is kept, so the stored total grows by that much each month.
+The estimate covers storage and upload requests at list prices for
+each tier:
+
+  s3-standard      S3 Standard
+  s3-standard-ia   S3 Standard-Infrequent Access
+  s3-glacier-ir    S3 Glacier Instant Retrieval
+  s3-glacier       S3 Glacier Flexible Retrieval
+  s3-deep-archive  S3 Glacier Deep Archive
+  b2               Backblaze B2
+
+Retrieval, egress, and minimum storage durations and object sizes
+are not included. Use --tier to compare only some tiers, and
+--syncs-per-month to try a different cadence with the same average
+upload per sync.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+		tiers := cost.Tiers()
+		if len(costTiers) > 0 {
+			tiers = make([]cost.Tier, 0, len(costTiers))
+			for _, name := range costTiers {
+				tier, ok := cost.LookupTier(name)
+				if !ok {
+					fail("Invalid --tier", errors.WithCategory(eris.Errorf("unknown tier %q", name), errors.ConfigCategory))
+				}
+				tiers = append(tiers, tier)
+			}
+		}
+
+		report, err := syncer.EstimateCost(context.Background(), cfg, tiers, costSyncsPerMonth)
+		if err != nil {
+			fail("Unable to estimate cost", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+		fmt.Printf("Library: %d files, %s\n", report.Files, progress.FormatBytes(report.Usage.StoredBytes))
+		if report.FromHistory {
+			fmt.Printf("Uploads: %s in %d files a month (%.0f syncs)\n",
+				progress.FormatBytes(report.Usage.MonthlyUploadBytes),
+				report.Usage.MonthlyUploads,
+				report.SyncsPerMonth,
+			)
+		} else {
+			fmt.Println("Uploads: no sync history; only the library is costed")
+		}
+		fmt.Printf("%-16s %10s %10s %10s %10s\n", "TIER", "STORED GB", "STORAGE", "REQUESTS", "TOTAL")
+		for _, e := range report.Estimates {
+			fmt.Printf("%-16s %10.2f %10s %10s %10s\n", e.Tier, e.StoredGB, dollars(e.Storage), dollars(e.Requests), dollars(e.Total))
+		}
+	},
+}
+
+func dollars(amount float64) string {
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+func init() {
+	rootCmd.AddCommand(costCmd)
+	costCmd.Flags().StringSliceVar(&costTiers, "tier", nil, "only estimate these tiers, e.g. s3-standard,b2")
+	costCmd.Flags().Float64Var(&costSyncsPerMonth, "syncs-per-month", 0, "syncs a month, instead of the rate in the sync history")
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/daemon"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep syncing in the background",
+	Long: `Keep syncing in the background.
+
+Runs until stopped, syncing on the cron schedule in daemon.schedule
+(e.g. "@every 1h" or "0 3 * * *") and, with daemon.watch set,
+shortly after saves, states, or ROMs change. Only one sync runs at a
+time. Changes to the config file are applied without restarting.
+While uploads are queued because the backend was unreachable, it is
+checked every daemon.reconnectInterval (1m by default), and a sync
+started as soon as it can be reached.
+
+To diagnose memory growth or CPU use of a long-running daemon, set
+daemon.debugAddress (e.g. 127.0.0.1:6060) to serve the Go profiler at
+/debug/pprof/, then e.g. 'go tool pprof http://127.0.0.1:6060/debug/pprof/heap'.
+It is off by default and has no authentication, so bind it to localhost.
+
+SIGINT or SIGTERM stops the daemon, cancelling any sync in progress.
+Use 'syncer install-service --daemon' to run it under systemd.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		ctx = log.ToCtx(ctx, log.FromCtx(ctx))
+		defer func() {
+			_ = log.FromCtx(ctx).Sync()
+		}()
+
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+		if cfg.Daemon.Schedule == "" && !cfg.Daemon.Watch && !cfg.Daemon.SyncOnStart {
+			log.FromCtx(ctx).Warn("Neither daemon.schedule nor daemon.watch is set; nothing will be synced")
+		}
+
+		var reloads <-chan syncer.Config
+		if viper.ConfigFileUsed() != "" {
+			reloads = syncer.WatchConfig(ctx, viper.GetViper(), cfg)
+		}
+		log.FromCtx(ctx).Info("Daemon started", cfg.SummaryFields()...)
+		err = daemon.Run(ctx, cfg, reloads)
+		if err != nil {
+			fail("Daemon failed", err)
+		}
+		log.FromCtx(ctx).Info("Daemon stopped")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
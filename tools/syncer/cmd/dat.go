@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// datCmd represents the dat command
+var datCmd = &cobra.Command{
+	Use:   "dat",
+	Short: "Work with No-Intro and Redump DAT files",
+	Long: `Work with No-Intro and Redump DAT files.
+
+When dat.folder is set in the config, every .dat file in it is loaded
+and synced ROMs are verified against them, recording each ROM's
+canonical title and whether it is a good dump in the metadata store.`,
+}
+
+// datVerifyCmd represents the dat verify command
+var datVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify ROMs against the DATs",
+	Long: `Verify ROMs against the DATs.
+
+Every ROM in the RomsFolder is hashed and looked up in the DATs. Known
+good dumps are verified, whatever their file name. ROMs the DATs list
+as bad dumps, and ROMs named like a known dump but with different
+contents, are flagged, and the command exits non-zero if there are
+any. ROMs the DATs don't know are reported as unknown.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		results, err := syncer.VerifyDats(context.Background(), cfg)
+		if err != nil {
+			fail("Unable to verify ROMs", err)
+		}
+		counts := make(map[dat.Status]int)
+		for _, r := range results {
+			counts[r.Status]++
+		}
+		if jsonOutput() {
+			printJSON(results)
+		} else {
+			for _, r := range results {
+				if r.Status == dat.Verified || r.Status == dat.Unknown {
+					continue
+				}
+				fmt.Printf("%-9s %s (%s)\n", strings.ToUpper(string(r.Status)), r.Path, r.Match.Game)
+			}
+			fmt.Printf("%d verified, %d bad dumps, %d mismatched, %d unknown\n",
+				counts[dat.Verified], counts[dat.BadDump], counts[dat.Mismatch], counts[dat.Unknown])
+		}
+		if counts[dat.BadDump]+counts[dat.Mismatch] > 0 {
+			os.Exit(exitFailure)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(datCmd)
+	datCmd.AddCommand(datVerifyCmd)
+}
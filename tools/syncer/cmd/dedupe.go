@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	dedupeDelete   bool
+	dedupeHardlink bool
+	dedupeContents bool
+)
+
+// dedupeCmd represents the dedupe command
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Find byte-identical ROMs",
+	Long: `Find byte-identical ROMs.
+
+Reports ROMs in the RomsFolder whose contents are identical, whatever
+their name or folder. For each set, the first copy by path is kept.
+
+--hardlink replaces every other copy with a hard link to the kept one,
+so every name keeps working but the data is only stored once.
+--delete removes the other copies instead; saves named after a deleted
+copy are left behind, and .bin tracks a cue sheet refers to are never
+deleted.
+
+--archive-contents compares zip archives by the files inside them, so a
+zipped ROM is reported as a duplicate of a loose copy or of another zip
+of it. Such copies can be deleted but are never hard linked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		action := syncer.DedupeReport
+		switch {
+		case dedupeDelete:
+			action = syncer.DedupeDelete
+		case dedupeHardlink:
+			action = syncer.DedupeHardlink
+		}
+		results, err := syncer.Dedupe(context.Background(), cfg, action, dedupeContents)
+		if err != nil {
+			fail("Unable to dedupe", err)
+		}
+		if jsonOutput() {
+			printJSON(results)
+			return
+		}
+		if len(results) == 0 {
+			fmt.Println("No duplicate ROMs found")
+			return
+		}
+		var wasted int64
+		for _, r := range results {
+			fmt.Printf("%s each, keeping %s\n", progress.FormatBytes(r.Size), r.Kept)
+			for _, p := range r.Paths[1:] {
+				fmt.Printf("  %s%s\n", p, dedupeOutcome(r, p, action))
+			}
+			wasted += r.Size * int64(len(r.Paths)-1)
+		}
+		fmt.Printf("%d sets of duplicates, %s in extra copies\n", len(results), progress.FormatBytes(wasted))
+	},
+}
+
+// dedupeOutcome describes what was done with the copy at p.
+func dedupeOutcome(r syncer.DedupeResult, p string, action syncer.DedupeAction) string {
+	for _, changed := range r.Changed {
+		if changed == p {
+			if action == syncer.DedupeDelete {
+				return " (deleted)"
+			}
+			return " (hard linked)"
+		}
+	}
+	for _, skipped := range r.Skipped {
+		if skipped == p {
+			return " (skipped)"
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+	dedupeCmd.Flags().BoolVar(&dedupeDelete, "delete", false, "delete every copy but one")
+	dedupeCmd.Flags().BoolVar(&dedupeHardlink, "hardlink", false, "replace every copy but one with a hard link to it")
+	dedupeCmd.Flags().BoolVar(&dedupeContents, "archive-contents", false, "compare zip archives by the files inside them")
+	dedupeCmd.MarkFlagsMutuallyExclusive("delete", "hardlink")
+}
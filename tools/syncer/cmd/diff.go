@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var diffChanged bool
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare local files with their latest uploads",
+	Long: `Compare local files with their latest uploads.
+
+Every file a sync would pick up is compared, by checksum, with its
+latest upload recorded in the metadata store, and reported as:
+
+  identical     matches its latest upload
+  local-newer   changed since its latest upload; the next sync uploads it
+  remote-newer  the latest upload, e.g. from another device, is newer
+  local-only    never uploaded; the next sync uploads it
+  remote-only   uploaded, but not on this device
+
+Nothing is uploaded and the storage backend is not contacted, so this
+is a quick review of what a sync would do. Use --changed to leave out
+identical files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		report, err := syncer.Diff(ctx, cfg)
+		if err != nil {
+			fail("Unable to diff", err)
+		}
+		if diffChanged {
+			entries := report.Entries[:0]
+			for _, entry := range report.Entries {
+				if entry.Status != syncer.DiffIdentical {
+					entries = append(entries, entry)
+				}
+			}
+			report.Entries = entries
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+		fmt.Printf("%-12s %-20s %-20s %10s %-16s %s\n", "STATUS", "LOCAL", "REMOTE", "SIZE", "DEVICE", "PATH")
+		for _, entry := range report.Entries {
+			size := entry.LocalSize
+			if entry.Status == syncer.DiffRemoteOnly {
+				size = entry.RemoteSize
+			}
+			fmt.Printf("%-12s %-20s %-20s %10s %-16s %s\n",
+				entry.Status,
+				formatTime(entry.Local),
+				formatTime(entry.Remote),
+				progress.FormatBytes(size),
+				entry.Device,
+				entry.Path,
+			)
+		}
+		fmt.Printf("%d identical, %d local-newer, %d remote-newer, %d local-only, %d remote-only\n",
+			report.Count(syncer.DiffIdentical),
+			report.Count(syncer.DiffLocalNewer),
+			report.Count(syncer.DiffRemoteNewer),
+			report.Count(syncer.DiffLocalOnly),
+			report.Count(syncer.DiffRemoteOnly),
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVar(&diffChanged, "changed", false, "leave out identical files")
+}
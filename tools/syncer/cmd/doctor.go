@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose problems with the syncer's environment",
+	Long: `Diagnose problems with the syncer's environment.
+
+Checks that the config is valid, that the RomsFolder and state
+directory are readable, writable, and have free space, that the
+storage backend is reachable, and that the system clock agrees with
+it. Nothing is uploaded or modified. Exits non-zero if any check
+fails.
+
+For S3, reachable means the endpoint's name resolves, S3 itself
+answers rather than a captive portal's login page, and the bucket
+accepts the credentials. Every sync makes the same check before
+using the backend, records what it found with the run in 'syncer
+history', and stops with a short reason rather than retrying.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		checks := syncer.Doctor(context.Background(), cfg)
+		if jsonOutput() {
+			printJSON(checks)
+		} else {
+			for _, c := range checks {
+				fmt.Printf("%-5s %-22s %s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+				if c.Hint != "" {
+					fmt.Printf("      %-22s -> %s\n", "", c.Hint)
+				}
+			}
+		}
+		if !syncer.Healthy(checks) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+)
+
+// Exit codes, documented in the root command's help so wrapper scripts and
+// systemd units can react to the kind of failure.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitConfig      = 3
+	exitAuth        = 4
+	exitNetwork     = 5
+	exitConflict    = 6
+	exitInterrupted = 130
+)
+
+const exitCodesHelp = `Exit codes:
+  0    success
+  1    failure not covered below
+  2    invalid command line usage
+  3    invalid or incomplete config
+  4    storage rejected the credentials
+  5    storage unreachable
+  6    unresolved conflict, a sync over its limits, or too little disk space
+  130  interrupted`
+
+// exitCode maps err to the exit code for its category.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	switch errors.CategoryOf(err) {
+	case errors.ConfigCategory:
+		return exitConfig
+	case errors.AuthCategory:
+		return exitAuth
+	case errors.NetworkCategory:
+		return exitNetwork
+	case errors.ConflictCategory:
+		return exitConflict
+	case errors.CancelledCategory:
+		return exitInterrupted
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyLimit int
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past sync runs",
+	Long: `Show past sync runs.
+
+Every sync is recorded in history.jsonl in the syncer's state
+directory ($HOME/.syncer by default), including when it ran, how
+many files were uploaded or skipped, and any errors.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		runs, err := history.NewJournal(cfg.HistoryFile()).List(historyLimit)
+		if err != nil {
+			fail("Unable to read history", err)
+		}
+		if jsonOutput() {
+			printJSON(runs)
+			return
+		}
+		if len(runs) == 0 {
+			fmt.Println("No sync runs recorded")
+			return
+		}
+		fmt.Printf("%-20s %-16s %-10s %10s %9s %8s %10s  %s\n", "STARTED", "DEVICE", "STATUS", "DURATION", "UPLOADED", "SKIPPED", "BYTES", "ERRORS")
+		for _, run := range runs {
+			fmt.Printf("%-20s %-16s %-10s %10s %9d %8d %10s  %s\n",
+				run.StartedAt.Local().Format(time.DateTime),
+				run.DeviceName,
+				run.Status,
+				run.Duration().Round(time.Second),
+				run.FilesUploaded,
+				run.FilesSkipped,
+				progress.FormatBytes(run.BytesUploaded),
+				strings.Join(run.Errors, "; "),
+			)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "number of most recent runs to show (0 for all)")
+}
@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
 	"github.com/spf13/cobra"
 )
 
+var initProfile string
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -27,23 +30,32 @@ the actual configuration file.
 **Note:** The example configuration file will result in the syncer
 [loading the default config for AWS](https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/#loading-aws-shared-configuration).
 
-cp $HOME/.syncer/config.example.yaml $HOME/.syncer/config.yaml`,
+cp $HOME/.syncer/config.example.yaml $HOME/.syncer/config.yaml
+
+With --profile, the example uses the folder layout of another
+distribution (batocera, recalbox, or lakka) instead of RetroPie's. Here
+it names a layout, not one of the config's named profiles.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			fmt.Printf("Unable to determine user home directory: %s", err)
-			os.Exit(1)
+			fail("Unable to determine user home directory", err)
 		}
 		syncerDir := filepath.Join(home, ".syncer")
-		err = syncer.CreateExample(syncerDir)
+		filename, err := syncer.CreateExample(syncerDir, initProfile)
 		if err != nil {
-			fmt.Printf("Unable to create example configuration: %s", err)
+			fail("Unable to create example configuration", err)
+		}
+		if jsonOutput() {
+			printJSON(map[string]string{"created": filename})
+			return
 		}
+		fmt.Printf("Created %s\n", filename)
 	},
 }
 
 func init() {
 	configCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initProfile, "profile", "", "layout profile of the distribution: "+strings.Join(syncer.Profiles(), ", "))
 
 	// Here you will define your flags and configuration settings.
 
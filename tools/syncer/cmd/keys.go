@@ -0,0 +1,165 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	keysMigrateFrom         string
+	keysMigrateFromEncoding string
+	keysMigrateDryRun       bool
+	keysMoveDryRun          bool
+)
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage how remote files are named",
+	Long: `Manage how remote files are named.
+
+storage.s3.keyTemplate names every file not stored by content, from
+"/"-separated segments with these placeholders:
+
+  {time}    the sync's time-based directory, e.g. 2024/03/01/12
+  {dir}     the file's directory, e.g. snes
+  {system}  the first segment of the file's directory
+  {name}    the file's name
+  {sha256}  the hash of the file's content
+  {shard}   the first two characters of {sha256}
+  {device}  the uploading device's ID
+
+The default is ` + storage.DefaultKeyTemplate + `, and every key is under storage.s3.prefix.
+Changing the template only names new uploads; 'syncer keys migrate'
+moves what was uploaded before.
+
+ROM names often hold characters such as &, #, é and brackets that some
+tools and URLs mishandle. With storage.s3.keyEncoding set to escaped,
+every byte of a directory or name other than letters, digits and
+-_.()!'* is percent-encoded, "Game [!].srm" as "Game%20%5B!%5D.srm",
+and decoded back exactly when keys are read. The default, raw, uses
+names as they are. 'syncer keys migrate --from-encoding raw' moves
+uploads made before switching.
+
+storage.s3.layout chooses what {time} is:
+
+  time     a directory per hour, 2024/03/01/12 (the default)
+  daily    a directory per day, 2024/03/01
+  upload   a directory per sync, 2024/03/01/120503
+  latest   empty, so each upload replaces the last
+  content  roms, saves and states are stored once under
+           blobs/sha256/ by their hash; other files per hour`,
+}
+
+// keysMigrateCmd represents the keys migrate command
+var keysMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Copy uploads to the keys of the current key template",
+	Long: `Copy uploads to the keys of the current key template.
+
+The latest upload of every file in the metadata store, stored under the
+--from template and --from-encoding, is copied to the key
+storage.s3.keyTemplate and storage.s3.keyEncoding give it, and the new
+key recorded. Objects at the old keys, and earlier uploads,
+are left in place. Uploads whose key doesn't follow --from, such as
+content-addressed blobs, are listed and left alone.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		fromEncoding, err := storage.ParseKeyEncoding(keysMigrateFromEncoding)
+		if err != nil {
+			fail("Invalid --from-encoding", err)
+		}
+		report, err := syncer.MigrateKeys(ctx, cfg, keysMigrateFrom, fromEncoding, keysMigrateDryRun)
+		if err != nil {
+			fail("Unable to migrate keys", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+		verb := "Copied"
+		if keysMigrateDryRun {
+			verb = "Would copy"
+		}
+		for _, m := range report.Migrated {
+			fmt.Printf("%s %s to %s\n", verb, m.From, m.To)
+		}
+		for _, p := range report.Unmatched {
+			fmt.Printf("Skipped %s: its key doesn't follow %s\n", p, keysMigrateFrom)
+		}
+		fmt.Printf("%s %d uploads, skipped %d\n", verb, len(report.Migrated), len(report.Unmatched))
+	},
+}
+
+// keysMovePrefixCmd represents the keys move-prefix command
+var keysMovePrefixCmd = &cobra.Command{
+	Use:   "move-prefix <old> <new>",
+	Short: "Move every upload from one prefix to another",
+	Long: `Move every upload from one prefix to another.
+
+Everything stored under the old storage.s3.prefix, latest pointers
+included, is moved to the new one, and every upload in the metadata
+store is pointed at its new key. This is how a person's uploads are
+renamed when several share a bucket, each under their own prefix, e.g.
+one profile each. Moving is a copy then a delete per object, so an
+interrupted move can be run again to finish it.
+
+Set storage.s3.prefix to the new prefix afterwards, on every device
+uploading under it.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		report, err := syncer.MovePrefix(ctx, cfg, args[0], args[1], keysMoveDryRun)
+		if err != nil {
+			fail("Unable to move prefix", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+		verb, recorded := "Moved", "updated"
+		if keysMoveDryRun {
+			verb, recorded = "Would move", "would update"
+		}
+		for _, m := range report.Moved {
+			fmt.Printf("%s %s to %s\n", verb, m.From, m.To)
+		}
+		fmt.Printf("%s %d objects, %s %d metadata records\n", verb, len(report.Moved), recorded, report.Records)
+		if !keysMoveDryRun && strings.Trim(cfg.Storage.S3.Prefix, "/") == strings.Trim(args[0], "/") {
+			fmt.Printf("storage.s3.prefix is still %s; set it to %s\n", args[0], args[1])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysMigrateCmd)
+	keysMigrateCmd.Flags().StringVar(&keysMigrateFrom, "from", storage.DefaultKeyTemplate, "the key template existing uploads were stored under")
+	keysMigrateCmd.Flags().StringVar(&keysMigrateFromEncoding, "from-encoding", string(storage.RawKeys), "the key encoding existing uploads were stored with")
+	keysMigrateCmd.Flags().BoolVar(&keysMigrateDryRun, "dry-run", false, "list the copies without making them")
+	keysCmd.AddCommand(keysMovePrefixCmd)
+	keysMovePrefixCmd.Flags().BoolVar(&keysMoveDryRun, "dry-run", false, "list the moves without making them")
+}
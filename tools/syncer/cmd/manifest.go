@@ -0,0 +1,79 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/manifest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// manifestCmd represents the manifest command
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Work with sync integrity manifests",
+	Long: `Work with sync integrity manifests.
+
+When manifest.enabled is set in the config, every sync uploads a
+manifest.json listing each synced file with its size and checksum,
+signed with manifest.signingKey if one is configured.`,
+}
+
+// manifestVerifyCmd represents the manifest verify command
+var manifestVerifyCmd = &cobra.Command{
+	Use:   "verify [manifest.json]",
+	Short: "Verify the RomsFolder against a manifest",
+	Long: `Verify the RomsFolder against a manifest.
+
+Every file listed in the manifest must exist in the RomsFolder with
+the recorded size and checksum. Missing and mismatched files are
+reported, and the command exits non-zero if there are any. Without a
+manifest file, the latest sync's manifest is downloaded from storage,
+and only the files the config syncs are checked.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		ctx := context.Background()
+		var report *manifest.Report
+		if len(args) == 0 {
+			report, err = syncer.VerifyLatestManifest(ctx, cfg)
+		} else {
+			report, err = syncer.VerifyManifest(ctx, cfg, args[0])
+		}
+		if err != nil {
+			fail("Unable to verify manifest", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+			if !report.OK() {
+				os.Exit(1)
+			}
+			return
+		}
+		for _, path := range report.Missing {
+			fmt.Printf("MISSING    %s\n", path)
+		}
+		for _, path := range report.Mismatched {
+			fmt.Printf("MISMATCHED %s\n", path)
+		}
+		fmt.Printf("%d verified, %d missing, %d mismatched\n", report.Verified, len(report.Missing), len(report.Mismatched))
+		if !report.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+	manifestCmd.AddCommand(manifestVerifyCmd)
+}
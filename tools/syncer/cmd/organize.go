@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	organizeDryRun bool
+	organizeUndo   bool
+)
+
+// organizeCmd represents the organize command
+var organizeCmd = &cobra.Command{
+	Use:   "organize",
+	Short: "Rename verified ROMs to their canonical names",
+	Long: `Rename verified ROMs to their canonical names.
+
+Every ROM in the RomsFolder that the DATs in dat.folder verify as a
+good dump is renamed to its name in the DAT and moved into the folder
+of its system (e.g. snes), along with the saves and states named after
+it. ROMs that aren't verified, or whose new name is taken, are left
+where they are. Add dat.systems entries for systems the built-in
+mapping doesn't know.
+
+Use --dry-run to see the plan first. Every run is journaled in the
+state directory, and --undo moves the files of the latest run back.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		if organizeUndo {
+			reverted, err := syncer.UndoOrganize(ctx, cfg)
+			if err != nil {
+				fail("Unable to undo", err)
+			}
+			if jsonOutput() {
+				printJSON(reverted)
+				return
+			}
+			printMoves(reverted)
+			fmt.Printf("Moved %d files back\n", len(reverted))
+			return
+		}
+
+		plan, err := syncer.PlanOrganize(ctx, cfg)
+		if err != nil {
+			fail("Unable to plan", err)
+		}
+		if !organizeDryRun {
+			_, err = syncer.ApplyOrganize(ctx, cfg, plan)
+			if err != nil {
+				fail("Unable to organize", err)
+			}
+		}
+		if jsonOutput() {
+			printJSON(plan)
+			return
+		}
+		printMoves(plan.Moves)
+		for _, s := range plan.Skipped {
+			fmt.Printf("skipped %s: %s\n", s.Path, s.Reason)
+		}
+		if organizeDryRun {
+			fmt.Printf("Would move %d files\n", len(plan.Moves))
+		} else {
+			fmt.Printf("Moved %d files; undo with 'syncer organize --undo'\n", len(plan.Moves))
+		}
+	},
+}
+
+func printMoves(moves []syncer.Move) {
+	for _, m := range moves {
+		fmt.Printf("%s -> %s\n", m.From, m.To)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(organizeCmd)
+	organizeCmd.Flags().BoolVar(&organizeDryRun, "dry-run", false, "print the plan without moving anything")
+	organizeCmd.Flags().BoolVar(&organizeUndo, "undo", false, "move the files of the latest run back")
+	organizeCmd.MarkFlagsMutuallyExclusive("dry-run", "undo")
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat string
+
+// errorResult is written in place of a command's result when it fails in
+// JSON output mode.
+type errorResult struct {
+	Error    string `json:"error"`
+	Category string `json:"category"`
+}
+
+func validateOutputFormat() error {
+	switch outputFormat {
+	case outputText, outputJSON:
+		return nil
+	default:
+		return eris.Errorf("unsupported output format %q; expected %q or %q", outputFormat, outputText, outputJSON)
+	}
+}
+
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to encode output: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// fail reports err in the selected output format and exits with the code
+// for its category. In text mode msg prefixes the error, e.g. "Unable to
+// load config".
+func fail(msg string, err error) {
+	if jsonOutput() {
+		printJSON(errorResult{Error: fmt.Sprintf("%s: %s", msg, err), Category: errors.CategoryOf(err).String()})
+	} else {
+		fmt.Printf("%s: %s\n", msg, err)
+	}
+	os.Exit(exitCode(err))
+}
+
+// formatTime formats t in local time for tables, or "-" if it is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
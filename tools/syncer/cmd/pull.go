@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var pullOpts syncer.PullOptions
+
+// pullCmd represents the pull command
+var pullCmd = &cobra.Command{
+	Use:   "pull <remote-identifier>",
+	Short: "Download a specific file now",
+	Long: `Download a specific file now.
+
+The identifier is a file's path as recorded in the metadata store, e.g.
+"gba/Pokemon Emerald.sav", whose latest upload is downloaded to where
+that file belongs on this device; or else a raw storage key, which needs
+--to. A path with no metadata record, e.g. on a new device, is found
+through the pointer kept under latest/ in the bucket when
+storage.s3.latestPointers is set, or from the path alone when
+storage.s3.layout is latest. The download is checked against the
+checksum recorded at upload before it replaces anything.
+
+On a machine that lays files out differently from the one that uploaded
+them, restore.paths in the config maps remote directories to local ones,
+e.g. "snes: /userdata/roms/snes" or "bios: /userdata/bios".
+
+A local file that already matches is left alone. One that differs is
+only overwritten with --force, exiting with status 6 otherwise, and is
+backed up first so 'syncer undo' can put it back. A file that may not fit
+in the free disk space isn't downloaded either, unless --ignore-space is
+given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		transfer, err := syncer.Pull(ctx, cfg, args[0], pullOpts)
+		if err != nil {
+			fail("Unable to pull", err)
+		}
+		if jsonOutput() {
+			printJSON(transfer)
+			return
+		}
+		if transfer.Skipped {
+			fmt.Printf("%s is up to date\n", transfer.Local)
+			return
+		}
+		fmt.Printf("%s -> %s\n", transfer.Key, transfer.Local)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+	pullCmd.Flags().StringVar(&pullOpts.Output, "to", "", "where to write the file, instead of where it belongs locally")
+	pullCmd.Flags().BoolVar(&pullOpts.Force, "force", false, "overwrite a local file that differs")
+	pullCmd.Flags().BoolVar(&pullOpts.SkipSpaceCheck, "ignore-space", false, "download even if the file may not fit in the free disk space")
+}
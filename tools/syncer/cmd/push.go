@@ -0,0 +1,61 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push <path-or-glob>...",
+	Short: "Upload specific files now",
+	Long: `Upload specific files now.
+
+Each argument is a file, directory, or glob, relative to the working
+directory or else to the RomsFolder, e.g.
+
+  syncer push "gba/Pokemon Emerald.sav"
+  syncer push 'snes/*.srm'
+
+Matching files are uploaded whatever the sync flags and filters say,
+stored and recorded in the metadata store just as a sync would, so
+'syncer pull' on another device can fetch them. They must be in the
+RomsFolder or the configs, BIOS, or screenshots folder. A device whose
+direction is download refuses to push.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		transfers, err := syncer.Push(ctx, cfg, args)
+		if err != nil {
+			fail("Unable to push", err)
+		}
+		if jsonOutput() {
+			printJSON(transfers)
+			return
+		}
+		for _, t := range transfers {
+			fmt.Printf("%s -> %s\n", t.Local, t.Key)
+		}
+		fmt.Printf("Pushed %d files\n", len(transfers))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var repairDryRun bool
+
+// repairMetadataCmd represents the repair-metadata command
+var repairMetadataCmd = &cobra.Command{
+	Use:   "repair-metadata",
+	Short: "Bring the metadata store back in line with storage",
+	Long: `Bring the metadata store back in line with storage.
+
+Metadata is recorded after each upload, and failing to record it
+doesn't fail the sync, so the metadata store can miss uploads. This
+lists everything stored and records each upload it is missing, taking
+the file's path from storage.s3.keyTemplate, and the upload time from
+when the object was stored.
+
+Records of uploads that are no longer stored, e.g. deleted by hand or
+by a lifecycle rule, are listed as orphaned and kept. Objects whose
+file can't be told from their key, such as blobs of the content
+layout, are listed as unrecognized.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		report, err := syncer.RepairMetadata(ctx, cfg, repairDryRun)
+		if err != nil {
+			fail("Unable to repair metadata", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+		verb := "Recorded"
+		if repairDryRun {
+			verb = "Would record"
+		}
+		for _, md := range report.Rebuilt {
+			fmt.Printf("%s %s, uploaded %s to %s\n", verb, md.Path, formatTime(md.UploadedAt), md.Key)
+		}
+		for _, md := range report.Orphaned {
+			fmt.Printf("Orphaned %s, uploaded %s: %s is gone\n", md.Path, formatTime(md.UploadedAt), md.Key)
+		}
+		for _, key := range report.Unrecognized {
+			fmt.Printf("Unrecognized %s: its key doesn't name a file\n", key)
+		}
+		fmt.Printf("%s %d uploads, %d orphaned, %d unrecognized\n", verb, len(report.Rebuilt), len(report.Orphaned), len(report.Unrecognized))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairMetadataCmd)
+	repairMetadataCmd.Flags().BoolVar(&repairDryRun, "dry-run", false, "list what would be recorded without recording it")
+}
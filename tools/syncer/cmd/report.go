@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var reportHTML string
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize the ROM library",
+	Long: `Summarize the ROM library.
+
+Scans the RomsFolder and reports, for each system, how many ROMs,
+saves, states, and screenshots it holds and how much space they take.
+Systems that need a BIOS missing from the BIOS folder are flagged
+along with how many of their ROMs can't be played, and byte-identical
+ROMs are listed as duplicates. Nothing is uploaded.
+
+The report is printed as a table, or as JSON with --output json;
+--html also writes it as a standalone HTML page.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		report, err := syncer.LibraryReport(context.Background(), cfg)
+		if err != nil {
+			fail("Unable to build report", err)
+		}
+		if reportHTML != "" {
+			f, err := os.Create(reportHTML)
+			if err != nil {
+				fail("Unable to create HTML report", err)
+			}
+			err = report.WriteHTML(f)
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				fail("Unable to write HTML report", err)
+			}
+		}
+		if jsonOutput() {
+			printJSON(report)
+			return
+		}
+
+		fmt.Printf("%-16s %7s %7s %7s %11s %10s  %s\n", "SYSTEM", "ROMS", "SAVES", "STATES", "SCREENSHOTS", "SIZE", "BIOS")
+		for _, s := range report.Systems {
+			bios := "ok"
+			if len(s.MissingBios) > 0 {
+				bios = fmt.Sprintf("%d unplayable; needs one of %s", s.Unplayable, strings.Join(s.MissingBios, ", "))
+			}
+			fmt.Printf("%-16s %7d %7d %7d %11d %10s  %s\n", s.System, s.Roms, s.Saves, s.States, s.Screenshots, progress.FormatBytes(s.Bytes), bios)
+		}
+		fmt.Printf("\n%d files, %s\n", report.TotalFiles, progress.FormatBytes(report.TotalBytes))
+		if len(report.Duplicates) > 0 {
+			fmt.Printf("\n%d sets of duplicate ROMs:\n", len(report.Duplicates))
+			for _, d := range report.Duplicates {
+				fmt.Printf("  %s each: %s\n", progress.FormatBytes(d.Size), strings.Join(d.Paths, ", "))
+			}
+		}
+		if reportHTML != "" {
+			fmt.Printf("\nHTML report written to %s\n", reportHTML)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVar(&reportHTML, "html", "", "also write the report as HTML to this file")
+}
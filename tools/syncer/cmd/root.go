@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -17,16 +20,44 @@ var cfgFile string
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "syncer",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
+	Short: "Back up RetroPie ROMs, saves, and states",
+	Long: `Back up RetroPie ROMs, saves, and states to remote storage.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+One config can hold several named profiles, e.g. one per person sharing a
+device, under "profiles". --profile (or activeProfile in the config, or
+SYNCER_ACTIVEPROFILE) lays the named profile's settings over the rest of
+the config:
+
+  storage:
+    s3:
+      enabled: true
+      bucket: family-saves
+  profiles:
+    alice:
+      storage:
+        s3:
+          prefix: alice
+      saves:
+        folder: /home/alice/saves
+    bob:
+      storage:
+        s3:
+          prefix: bob
+
+Each profile keeps its own history, lock, cache, and metadata under
+profiles/<name> in the state directory unless it sets stateDir.
+
+` + exitCodesHelp,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := validateOutputFormat()
+		if err != nil {
+			return err
+		}
+		return errors.WithCategory(initLogger(), errors.ConfigCategory)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -34,7 +65,13 @@ to quickly create a Cobra application.`,
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		// Errors that reach here are from parsing the command line, unless
+		// they say otherwise.
+		code := exitCode(err)
+		if code == exitFailure {
+			code = exitUsage
+		}
+		os.Exit(code)
 	}
 }
 
@@ -47,7 +84,17 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.syncer/config.yaml)")
 	_ = viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
+	rootCmd.PersistentFlags().String("profile", "", "named profile from the config's profiles section to use")
+	_ = viper.BindPFlag("activeProfile", rootCmd.PersistentFlags().Lookup("profile"))
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "output format: text or json")
+	rootCmd.PersistentFlags().String("log-level", "info", "log level: debug, info, warn, or error")
+	rootCmd.PersistentFlags().String("log-format", log.FormatConsole, "log format: console or json")
+	rootCmd.PersistentFlags().String("log-file", "", "also write logs to this file, rotating it as it grows")
+	_ = viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
+	_ = viper.BindPFlag("log.format", rootCmd.PersistentFlags().Lookup("log-format"))
+	_ = viper.BindPFlag("log.file.path", rootCmd.PersistentFlags().Lookup("log-file"))
 	viper.SetEnvPrefix("SYNCER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// Cobra also supports local flags, which will only run
@@ -58,11 +105,11 @@ func init() {
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" {
-		fmt.Fprintln(os.Stdout, "Using config file "+cfgFile)
+		fmt.Fprintln(os.Stderr, "Using config file "+cfgFile)
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
-		fmt.Fprintln(os.Stdout, "No config file arg provided; searching in $HOME/.syncer")
+		fmt.Fprintln(os.Stderr, "No config file arg provided; searching in $HOME/.syncer")
 		// Find home directory.
 		home, err := os.UserHomeDir()
 		cobra.CheckErr(err)
@@ -87,6 +134,31 @@ func initConfig() {
 	}
 }
 
+// initLogger replaces the default logger with one built from the log section
+// of the config, which flags and SYNCER_LOG_* environment variables override.
+func initLogger() error {
+	cfg := log.Config{}
+	err := viper.UnmarshalKey("log", &cfg)
+	if err != nil {
+		return err
+	}
+	// Nested keys only pick up flags and environment variables when read
+	// individually.
+	cfg.Level = viper.GetString("log.level")
+	cfg.Format = viper.GetString("log.format")
+	cfg.File.Path = viper.GetString("log.file.path")
+	if jsonOutput() {
+		// Keep stdout for the command's result alone.
+		cfg.Output = log.OutputStderr
+	}
+	logger, err := log.New(cfg)
+	if err != nil {
+		return err
+	}
+	log.SetDefault(logger)
+	return nil
+}
+
 func getConfigFilename() string {
 	home, err := os.UserHomeDir()
 	cobra.CheckErr(err)
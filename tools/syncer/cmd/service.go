@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/service"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	serviceInterval time.Duration
+	serviceUser     bool
+	serviceDryRun   bool
+	serviceName     string
+	serviceDaemon   bool
+)
+
+// installServiceCmd represents the install-service command
+var installServiceCmd = &cobra.Command{
+	Use:   "install-service",
+	Short: "Install a systemd timer or service that keeps syncing",
+	Long: `Install a systemd timer or service that keeps syncing.
+
+Writes a oneshot service running 'syncer sync' with the current
+binary and config file, and a timer starting it every --timer
+interval (and 5 minutes after boot), then enables the timer.
+
+With --daemon, writes a service running 'syncer daemon' instead,
+restarted if it fails, and enables it; the daemon's schedule then
+comes from the config.
+
+System units are written to /etc/systemd/system and need root; they
+run as the user invoking sudo. With --user the units are installed
+for the current user instead. Use --dry-run to print the units
+without installing anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := serviceOptions()
+		if err != nil {
+			fail("Unable to prepare service", err)
+		}
+		if serviceDryRun {
+			units, err := service.Units(opts)
+			if err != nil {
+				fail("Unable to render units", err)
+			}
+			for _, u := range units {
+				fmt.Printf("# %s\n%s\n", u.Name, u.Content)
+			}
+			return
+		}
+		paths, err := service.Install(opts)
+		for _, p := range paths {
+			fmt.Printf("Wrote %s\n", p)
+		}
+		if err != nil {
+			fail("Unable to install service", err)
+		}
+		unit := opts.Name + ".timer"
+		if serviceDaemon {
+			unit = opts.Name + ".service"
+		}
+		fmt.Printf("Enabled %s; check it with: systemctl %sstatus %s\n", unit, userFlag(opts.User), unit)
+	},
+}
+
+func serviceOptions() (service.Options, error) {
+	if !serviceDaemon && serviceInterval < time.Minute {
+		return service.Options{}, eris.New("--timer must be at least 1m")
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return service.Options{}, eris.Wrap(err, "failed to find the syncer binary")
+	}
+	binary, err = filepath.EvalSymlinks(binary)
+	if err != nil {
+		return service.Options{}, eris.Wrap(err, "failed to resolve the syncer binary")
+	}
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		configFile = getConfigFilename()
+	}
+	configFile, err = filepath.Abs(configFile)
+	if err != nil {
+		return service.Options{}, eris.Wrap(err, "failed to resolve the config file")
+	}
+
+	opts := service.Options{
+		Name:     serviceName,
+		Binary:   binary,
+		Args:     []string{"sync", "--config", configFile},
+		Interval: serviceInterval,
+		User:     serviceUser,
+	}
+	if serviceDaemon {
+		opts.Args[0] = "daemon"
+		opts.Interval = 0
+	}
+	if !serviceUser {
+		opts.RunAs = os.Getenv("SUDO_USER")
+		if opts.RunAs == "" {
+			u, err := user.Current()
+			if err != nil {
+				return service.Options{}, eris.Wrap(err, "failed to find the current user")
+			}
+			opts.RunAs = u.Username
+		}
+	}
+	return opts, nil
+}
+
+func userFlag(user bool) string {
+	if user {
+		return "--user "
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(installServiceCmd)
+	installServiceCmd.Flags().DurationVar(&serviceInterval, "timer", time.Hour, "how often to sync, e.g. 15m")
+	installServiceCmd.Flags().BoolVar(&serviceUser, "user", false, "install user units instead of system units")
+	installServiceCmd.Flags().BoolVar(&serviceDryRun, "dry-run", false, "print the units instead of installing them")
+	installServiceCmd.Flags().StringVar(&serviceName, "name", "syncer", "name of the generated units")
+	installServiceCmd.Flags().BoolVar(&serviceDaemon, "daemon", false, "run 'syncer daemon' as a long-running service instead of a timer")
+}
@@ -6,14 +6,30 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
 	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
 	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/rotisserie/eris"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	showConfig      bool
+	syncSystems     []string
+	syncTypes       []string
+	syncYes         bool
+	syncIgnoreSpace bool
+)
+
 // syncCmd represents the sync command
 var syncCmd = &cobra.Command{
 	Use:   "sync",
@@ -22,36 +38,185 @@ var syncCmd = &cobra.Command{
 
 The syncer will look at the configured RomsFolder
 for any files matching a known file suffix, provided
-the corresponding sync for that file type is enabled.`,
+the corresponding sync for that file type is enabled.
+
+SIGINT or SIGTERM stops the sync cleanly: the file being uploaded
+is abandoned (large uploads resume on the next sync), the run is
+recorded as cancelled, and the command exits with status 130.
+A second SIGINT exits immediately.
+
+Only one sync runs at a time: while another is running, whether by
+hand, from 'syncer daemon', or from the dashboard, the command exits
+with status 6.
+
+--system and --type narrow a single sync without editing the config:
+'syncer sync --system gba --type saves' uploads only GBA saves. --system
+restricts the RomsFolder to the named system folders; --type enables only
+the named types (roms, saves, states, configs, bios, screenshots).
+
+With cache.enabled set, files whose size and modification time are the
+same as when they were last uploaded are skipped without being read or
+checked against the backend. Delete cache.json in the state directory to
+upload everything again.
+
+To avoid uploading a save an emulator is halfway through writing, set
+stability.window (e.g. 30s) to skip files modified that recently, and
+stability.skipOpen to skip files a process has open for writing. Skipped
+files are counted as skipped and picked up by the next sync.
+
+sync.minInterval limits how often each file type is uploaded, e.g.
+'state: 10m' uploads a savestate at most every ten minutes however often
+it changes, while saves without an interval upload on every sync.
+
+A file that fails to upload doesn't stop the others: the sync carries on
+and lists the failures at the end. It only fails, exiting non-zero, if
+more than sync.maxFailures files failed (none by default), or if the
+backend is unreachable or rejects the credentials.
+
+Every sync journals the files it is about to upload in queue.json in the
+state directory, taking each off once it is stored. When the backend
+can't be reached, e.g. on a handheld away from Wi-Fi, the files are left
+queued and the next sync uploads them; 'syncer daemon' checks the
+backend every daemon.reconnectInterval (1m by default) and syncs as soon
+as it is back.
+
+limits.maxFiles, limits.maxBytes, and limits.maxDeletions stop a sync
+that would upload more files or bytes than expected, or that finds more
+previously uploaded files missing than expected, as after swapping in a
+wiped SD card. Nothing is uploaded and the command exits with status 6;
+--yes runs it anyway.
+
+direction sets which way files move. "upload", the default, only uploads.
+"download" only fetches what other devices uploaded since this device's
+copies changed, for a device that only ever receives saves. "both"
+downloads, then uploads. Downloads need a metadata store shared between
+devices. They back up the files they replace for 'syncer undo', and they
+leave alone any local file changed after the upload, reporting it as a
+conflict. Downloads that may not fit in the free disk space fail before
+anything is downloaded, exiting with status 6; --ignore-space downloads
+anyway.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
 		ctx = log.ToCtx(ctx, log.FromCtx(ctx))
+		defer func() {
+			_ = log.FromCtx(ctx).Sync()
+		}()
+		go func() {
+			<-ctx.Done()
+			// Restore the default handlers so a second signal kills us.
+			stop()
+			log.FromCtx(ctx).Warn("Interrupted; stopping sync (interrupt again to exit immediately)")
+		}()
 
-		cfg := syncer.Config{}
-		err := viper.Unmarshal(&cfg)
+		cfg, err := syncer.LoadConfig(viper.GetViper())
 		if err != nil {
-			panic(err)
+			fail("Unable to load config", err)
+		}
+		if len(syncSystems) > 0 {
+			cfg.Systems = syncSystems
+		}
+		if syncYes {
+			cfg.Limits.Confirmed = true
+		}
+		if syncIgnoreSpace {
+			cfg.Restore.SkipSpaceCheck = true
+		}
+		if len(syncTypes) > 0 {
+			err = cfg.OnlySync(syncTypes)
+			if err != nil {
+				fail("Invalid --type", err)
+			}
 		}
 
-		b, err := yaml.Marshal(cfg)
-		if err != nil {
-			panic(err)
+		if showConfig {
+			// Secrets and notification URLs are redacted when marshaled.
+			b, err := yaml.Marshal(cfg)
+			if err != nil {
+				fail("Unable to marshal config", err)
+			}
+			fmt.Fprintf(os.Stderr, "Running sync with config:\n%s", string(b))
 		}
-		fmt.Printf("Running sync with config:\n%s", string(b))
+		log.FromCtx(ctx).Info("Running sync", cfg.SummaryFields()...)
 
 		s, err := syncer.NewSyncer(ctx, cfg)
 		if err != nil {
-			panic(err)
+			fail("Unable to create syncer", err)
+		}
+		reporter := progress.New(ctx, os.Stderr)
+		ctx = progress.ToCtx(ctx, reporter)
+		run, err := s.Sync(ctx)
+		reporter.Close()
+		_ = log.FromCtx(ctx).Sync()
+		if eris.Is(err, errors.LockedError) {
+			fail("Unable to start sync", err)
+		}
+		if eris.Is(err, errors.LimitError) {
+			fail("Nothing was uploaded; rerun with --yes if this is expected", err)
+		}
+		if jsonOutput() {
+			printJSON(run)
+		} else {
+			if run.FilesDownloaded > 0 {
+				fmt.Printf("Downloaded %d files (%s)\n", run.FilesDownloaded, progress.FormatBytes(run.BytesDownloaded))
+			}
+			fmt.Printf("Uploaded %d files (%s), skipped %d, failed %d in %s\n",
+				run.FilesUploaded,
+				progress.FormatBytes(run.BytesUploaded),
+				run.FilesSkipped,
+				run.FilesFailed,
+				run.Duration().Round(time.Second),
+			)
+			if run.FilesUnchanged > 0 {
+				fmt.Printf("%d files unchanged since they were last uploaded\n", run.FilesUnchanged)
+			}
+			printSkips(run.Skips)
+			for _, f := range run.Failures {
+				fmt.Printf("Failed: %s: %s\n", f.Path, f.Reason)
+			}
+			for _, path := range run.Conflicts {
+				fmt.Printf("Conflict: %s was last uploaded from another device\n", path)
+			}
+		}
+		if run.Status == history.StatusCancelled {
+			if !jsonOutput() {
+				fmt.Println("Sync cancelled")
+			}
+			os.Exit(exitInterrupted)
 		}
-		err = s.Sync(ctx)
 		if err != nil {
-			panic(err)
+			if !jsonOutput() {
+				fmt.Printf("Sync failed: %s\n", err)
+			}
+			os.Exit(exitCode(err))
 		}
 	},
 }
 
+// printSkips prints how many files were skipped for each reason.
+func printSkips(skips []history.FileOutcome) {
+	counts := make(map[string]int)
+	reasons := make([]string, 0)
+	for _, skip := range skips {
+		if counts[skip.Reason] == 0 {
+			reasons = append(reasons, skip.Reason)
+		}
+		counts[skip.Reason]++
+	}
+	for _, reason := range reasons {
+		fmt.Printf("Skipped %d: %s\n", counts[reason], reason)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&showConfig, "show-config", false, "print the full config, with secrets redacted, before syncing")
+	syncCmd.Flags().StringSliceVar(&syncSystems, "system", nil, "only sync these systems, e.g. gba,snes (overrides the systems config)")
+	syncCmd.Flags().StringSliceVar(&syncTypes, "type", nil, "only sync these file types: roms, saves, states, configs, bios, screenshots")
+	syncCmd.Flags().BoolVar(&syncYes, "yes", false, "sync even if it exceeds the configured limits")
+	syncCmd.Flags().BoolVar(&syncIgnoreSpace, "ignore-space", false, "download even if the files may not fit in the free disk space")
+	syncCmd.Flags().BoolVar(&syncIgnoreSpace, "force", false, "download even if the files may not fit in the free disk space")
+	_ = syncCmd.Flags().MarkDeprecated("force", "use --ignore-space instead")
 
 	// Here you will define your flags and configuration settings.
 
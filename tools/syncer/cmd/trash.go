@@ -0,0 +1,137 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var trashEmptyAll bool
+
+// trashCmd represents the trash command
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage deleted remote files",
+	Long: `Manage deleted remote files.
+
+Remote objects are never deleted outright: they are moved under
+trash/ in the bucket and kept for trash.ttl (30 days by default), so
+a mistaken delete can be undone with 'syncer trash restore'. Expired
+objects are only deleted for good by 'syncer trash empty'.`,
+}
+
+// trashListCmd represents the trash list command
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deleted remote files",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		entries, err := syncer.ListTrash(ctx, cfg)
+		if err != nil {
+			fail("Unable to list trash", err)
+		}
+		if jsonOutput() {
+			printJSON(entries)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("The trash is empty")
+			return
+		}
+		fmt.Printf("%-20s %-20s %10s  %s\n", "TRASHED", "EXPIRES", "SIZE", "KEY")
+		for _, entry := range entries {
+			fmt.Printf("%-20s %-20s %10s  %s\n",
+				formatTime(entry.TrashedAt),
+				formatTime(entry.ExpiresAt),
+				progress.FormatBytes(entry.Size),
+				entry.Key,
+			)
+		}
+	},
+}
+
+// trashRestoreCmd represents the trash restore command
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <key>...",
+	Short: "Restore deleted remote files",
+	Long: `Restore deleted remote files.
+
+Each key, as shown by 'syncer trash list', is moved back out of the
+trash to where it was stored.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		for _, key := range args {
+			err = syncer.RestoreTrash(ctx, cfg, key)
+			if err != nil {
+				fail("Unable to restore", err)
+			}
+			if !jsonOutput() {
+				fmt.Printf("Restored %s\n", key)
+			}
+		}
+		if jsonOutput() {
+			printJSON(args)
+		}
+	},
+}
+
+// trashEmptyCmd represents the trash empty command
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Delete expired remote files for good",
+	Long: `Delete expired remote files for good.
+
+Trashed objects past their expiry are deleted; with --all, every
+trashed object is. Deleted objects cannot be restored.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		deleted, err := syncer.EmptyTrash(ctx, cfg, trashEmptyAll)
+		if err != nil {
+			fail("Unable to empty trash", err)
+		}
+		if jsonOutput() {
+			printJSON(deleted)
+			return
+		}
+		for _, entry := range deleted {
+			fmt.Printf("Deleted %s\n", entry.Key)
+		}
+		fmt.Printf("Deleted %d objects\n", len(deleted))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashEmptyCmd)
+	trashEmptyCmd.Flags().BoolVar(&trashEmptyAll, "all", false, "delete every trashed object, expired or not")
+}
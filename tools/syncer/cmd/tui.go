@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/tui"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Interactive dashboard for syncing",
+	Long: `Interactive dashboard for syncing.
+
+Shows per-system ROM, save, and state counts for the RomsFolder and
+the result of the last sync, and lets you start a sync and watch its
+progress from the keyboard. Handy when SSH'd into a Pi.
+
+Changes to the config file are picked up without restarting.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fmt.Printf("Unable to load config: %s\n", err)
+			os.Exit(exitConfig)
+		}
+		ctx := context.Background()
+		var reloads <-chan syncer.Config
+		if viper.ConfigFileUsed() != "" {
+			// Log lines would tear the dashboard apart.
+			reloads = syncer.WatchConfig(log.ToCtx(ctx, zap.NewNop()), viper.GetViper(), cfg)
+		}
+		err = tui.Run(ctx, cfg, reloads)
+		if err != nil {
+			fmt.Printf("Dashboard failed: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
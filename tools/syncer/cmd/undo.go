@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var undoList bool
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo [backup]",
+	Short: "Put back local files overwritten by a pull",
+	Long: `Put back local files overwritten by a pull.
+
+Before 'syncer pull' replaces a local file, it copies it to a backup
+snapshot under backup/ in the state directory, and notes the files it
+creates; backup.keep snapshots are kept (10 by default). Undo restores
+the files of the latest snapshot, or the one named, removes the files
+the pull created, and deletes the snapshot, so running it again goes
+back further. --list shows the snapshots.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		if undoList {
+			snapshots, err := cfg.Backups().List()
+			if err != nil {
+				fail("Unable to list backups", err)
+			}
+			if jsonOutput() {
+				printJSON(snapshots)
+				return
+			}
+			if len(snapshots) == 0 {
+				fmt.Println("There are no backups")
+				return
+			}
+			fmt.Printf("%-28s %-20s %s\n", "BACKUP", "TAKEN", "FILES")
+			for _, sn := range snapshots {
+				fmt.Printf("%-28s %-20s %d\n", sn.ID, formatTime(sn.CreatedAt), len(sn.Files)+len(sn.Created))
+			}
+			return
+		}
+
+		id := ""
+		if len(args) > 0 {
+			id = args[0]
+		}
+		snapshot, restored, err := syncer.Undo(cfg, id)
+		if err != nil {
+			fail("Unable to undo", err)
+		}
+		if jsonOutput() {
+			printJSON(restored)
+			return
+		}
+		for _, path := range restored {
+			fmt.Printf("Restored %s\n", path)
+		}
+		for _, path := range snapshot.Created {
+			fmt.Printf("Removed %s\n", path)
+		}
+		fmt.Printf("Restored %d files as they were at %s\n", len(restored), formatTime(snapshot.CreatedAt))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolVar(&undoList, "list", false, "list the backups instead of restoring one")
+}
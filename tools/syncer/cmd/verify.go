@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Trevor Edris trevor.edris@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var verifyOpts syncer.VerifyOptions
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify uploaded files are intact",
+	Long: `Verify uploaded files are intact.
+
+For every file a sync would pick up, the latest upload recorded in the
+metadata store is checked against the storage backend. By default the
+checksum recorded on the object at upload is compared; --download
+fetches and hashes every object instead, catching corruption of the
+stored bytes themselves.
+
+Each file is reported as ok, modified (changed locally since its last
+upload), unsynced (never uploaded), missing (the object is gone), or
+corrupt (the object doesn't match what was uploaded). With --reupload,
+missing and corrupt files are uploaded again from the local copy.
+Exits non-zero if any missing or corrupt file remains.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		cfg, err := syncer.LoadConfig(viper.GetViper())
+		if err != nil {
+			fail("Unable to load config", err)
+		}
+
+		report, err := syncer.Verify(ctx, cfg, verifyOpts)
+		if err != nil {
+			fail("Unable to verify", err)
+		}
+		if jsonOutput() {
+			printJSON(report)
+		} else {
+			for _, r := range report.Results {
+				if r.Status == syncer.VerifyOK {
+					continue
+				}
+				line := fmt.Sprintf("%-9s %s", strings.ToUpper(string(r.Status)), r.Path)
+				if r.Reuploaded {
+					line += " (re-uploaded)"
+				}
+				fmt.Println(line)
+			}
+			fmt.Printf("%d ok, %d modified, %d unsynced, %d missing, %d corrupt\n",
+				report.Count(syncer.VerifyOK),
+				report.Count(syncer.VerifyModified),
+				report.Count(syncer.VerifyUnsynced),
+				report.Count(syncer.VerifyMissing),
+				report.Count(syncer.VerifyCorrupt),
+			)
+		}
+		if !report.OK() {
+			os.Exit(exitFailure)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().BoolVar(&verifyOpts.Download, "download", false, "download and hash every object instead of trusting recorded checksums")
+	verifyCmd.Flags().BoolVar(&verifyOpts.Reupload, "reupload", false, "upload missing and corrupt files again")
+}
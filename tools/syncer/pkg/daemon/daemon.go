@@ -0,0 +1,306 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWatchDelay        = 2 * time.Minute
+	defaultReconnectInterval = time.Minute
+)
+
+type (
+	daemon struct {
+		mu  sync.Mutex
+		cfg syncer.Config
+
+		// requests holds at most one pending sync, so triggers arriving while
+		// a sync runs collapse into a single follow-up sync.
+		requests chan string
+
+		// What the daemon runs, the syncer's own functions outside tests.
+		newSyncer func(context.Context, syncer.Config) (syncer.Syncer, error)
+		reachable func(context.Context, syncer.Config) error
+		queue     func(syncer.Config) ([]queue.Entry, error)
+		// triggers starts whatever requests syncs for a config, returning a
+		// channel closed once it has stopped after ctx is cancelled.
+		triggers func(ctx context.Context, cfg syncer.Config) <-chan struct{}
+	}
+)
+
+// Run syncs on the configured schedule and, if enabled, whenever synced files
+// change, until ctx is cancelled. Configs received on reloads replace the
+// active one: the schedule and watcher are restarted with it, and the next
+// sync uses it; the debug endpoints, if enabled, keep the address they
+// started with. A sync in progress when ctx is cancelled is stopped, and Run
+// returns once it has been recorded.
+func Run(ctx context.Context, cfg syncer.Config, reloads <-chan syncer.Config) error {
+	return newDaemon(cfg).run(ctx, reloads)
+}
+
+func newDaemon(cfg syncer.Config) *daemon {
+	d := &daemon{
+		cfg:       cfg,
+		requests:  make(chan string, 1),
+		newSyncer: syncer.NewSyncer,
+		reachable: syncer.Reachable,
+		queue:     syncer.Queued,
+	}
+	d.triggers = d.startTriggers
+	return d
+}
+
+func (d *daemon) run(ctx context.Context, reloads <-chan syncer.Config) error {
+	cfg := d.config()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.work(ctx)
+	}()
+	// Started once, so a reload doesn't drop a profile being taken.
+	if cfg.Daemon.DebugAddress != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveDebug(ctx, cfg.Daemon.DebugAddress)
+		}()
+	}
+
+	if cfg.Daemon.SyncOnStart {
+		d.request("start")
+	}
+	for {
+		triggersCtx, stopTriggers := context.WithCancel(ctx)
+		triggersDone := d.triggers(triggersCtx, cfg)
+		select {
+		case <-ctx.Done():
+			stopTriggers()
+			<-triggersDone
+			wg.Wait()
+			return nil
+		case cfg = <-reloads:
+			stopTriggers()
+			<-triggersDone
+			d.mu.Lock()
+			d.cfg = cfg
+			d.mu.Unlock()
+			log.FromCtx(ctx).Info("Restarting schedule and watcher with the reloaded config")
+		}
+	}
+}
+
+// request asks for a sync, giving the reason in the logs.
+func (d *daemon) request(reason string) {
+	select {
+	case d.requests <- reason:
+	default:
+		// A sync is already pending.
+	}
+}
+
+func (d *daemon) config() syncer.Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cfg
+}
+
+// work runs requested syncs one at a time. While uploads are queued because
+// storage couldn't be reached, it checks storage every reconnect interval
+// and syncs once it can be reached.
+func (d *daemon) work(ctx context.Context) {
+	var reconnect <-chan time.Time
+	if d.queued(ctx) {
+		reconnect = time.After(0)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reason := <-d.requests:
+			reconnect = d.sync(ctx, reason)
+		case <-reconnect:
+			err := d.reachable(ctx, d.config())
+			if err != nil {
+				log.FromCtx(ctx).Debug("Storage still unreachable", zap.Error(err))
+				reconnect = time.After(d.reconnectInterval())
+				continue
+			}
+			log.FromCtx(ctx).Info("Storage reachable; uploading queued files")
+			reconnect = d.sync(ctx, "reconnect")
+		}
+	}
+}
+
+// queued reports whether uploads are queued from an earlier sync.
+func (d *daemon) queued(ctx context.Context) bool {
+	entries, err := d.queue(d.config())
+	if err != nil {
+		log.FromCtx(ctx).Warn("Unable to read the upload queue", zap.Error(err))
+		return false
+	}
+	return len(entries) > 0
+}
+
+func (d *daemon) reconnectInterval() time.Duration {
+	interval := d.config().Daemon.ReconnectInterval
+	if interval <= 0 {
+		return defaultReconnectInterval
+	}
+	return interval
+}
+
+// sync runs a sync. If storage couldn't be reached and uploads are left
+// queued, it returns a channel firing when storage should be checked again.
+func (d *daemon) sync(ctx context.Context, reason string) <-chan time.Time {
+	logger := log.FromCtx(ctx).With(zap.String("trigger", reason))
+	ctx = log.ToCtx(ctx, logger)
+	logger.Info("Starting sync")
+	s, err := d.newSyncer(ctx, d.config())
+	if err != nil {
+		logger.Error("Unable to create syncer", zap.Error(err))
+		return nil
+	}
+	run, err := s.Sync(ctx)
+	if err != nil {
+		logger.Error("Sync failed", zap.String("run_id", run.ID), zap.Error(err))
+		if errors.CategoryOf(err) == errors.NetworkCategory && d.queued(ctx) {
+			logger.Info("Waiting for storage to be reachable", zap.Duration("interval", d.reconnectInterval()))
+			return time.After(d.reconnectInterval())
+		}
+		return nil
+	}
+	logger.Info("Sync finished",
+		zap.String("run_id", run.ID),
+		zap.Int("uploaded", run.FilesUploaded),
+		zap.Int("downloaded", run.FilesDownloaded),
+		zap.Int("skipped", run.FilesSkipped),
+		zap.Int("unchanged", run.FilesUnchanged),
+		zap.Int("failed", run.FilesFailed),
+		zap.Duration("duration", run.Duration()),
+	)
+	return nil
+}
+
+// startTriggers starts the scheduler and watcher for cfg. The returned
+// channel is closed once both have stopped after ctx is cancelled.
+func (d *daemon) startTriggers(ctx context.Context, cfg syncer.Config) <-chan struct{} {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if cfg.Daemon.Schedule != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.schedule(ctx, cfg.Daemon.Schedule)
+		}()
+	}
+	if cfg.Daemon.Watch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.watch(ctx, cfg)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (d *daemon) schedule(ctx context.Context, spec string) {
+	c := cron.New()
+	_, err := c.AddFunc(spec, func() {
+		d.request("schedule")
+	})
+	if err != nil {
+		log.FromCtx(ctx).Error("Invalid schedule; scheduled syncs disabled", zap.String("schedule", spec), zap.Error(err))
+		return
+	}
+	log.FromCtx(ctx).Info("Scheduled syncs", zap.String("schedule", spec))
+	c.Start()
+	<-ctx.Done()
+	<-c.Stop().Done()
+}
+
+// watch requests a sync once files that would be synced have changed and the
+// RomsFolder has then been quiet for the watch delay.
+func (d *daemon) watch(ctx context.Context, cfg syncer.Config) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.FromCtx(ctx).Error("Unable to watch the RomsFolder", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+
+	err = addTree(watcher, cfg.RomsFolder)
+	if err != nil {
+		log.FromCtx(ctx).Error("Unable to watch the RomsFolder", zap.String("directory", cfg.RomsFolder), zap.Error(err))
+		return
+	}
+	delay := cfg.Daemon.WatchDelay
+	if delay <= 0 {
+		delay = defaultWatchDelay
+	}
+	log.FromCtx(ctx).Info("Watching for changes", zap.String("directory", cfg.RomsFolder), zap.Duration("delay", delay))
+
+	quiet := time.NewTimer(delay)
+	quiet.Stop()
+	defer quiet.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			log.FromCtx(ctx).Warn("File watcher error", zap.Error(err))
+		case event := <-watcher.Events:
+			if event.Has(fsnotify.Create) {
+				info, err := os.Stat(event.Name)
+				if err == nil && info.IsDir() {
+					_ = addTree(watcher, event.Name)
+					continue
+				}
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			rel, err := filepath.Rel(cfg.RomsFolder, event.Name)
+			if err != nil || !cfg.Syncs(rel) {
+				continue
+			}
+			log.FromCtx(ctx).Debug("Synced file changed", zap.String("file", rel))
+			quiet.Reset(delay)
+		case <-quiet.C:
+			d.request("watch")
+		}
+	}
+}
+
+// addTree watches dir and every directory below it, skipping hidden ones.
+func addTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,282 @@
+package daemon_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/daemon"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/rotisserie/eris"
+)
+
+// fakeSyncer records the syncs run and the config each used. Each sync
+// blocks until released, if release is set, and fails with the next of errs.
+type fakeSyncer struct {
+	mu      sync.Mutex
+	configs []syncer.Config
+	errs    []error
+	release chan struct{}
+	started chan struct{}
+}
+
+func (f *fakeSyncer) new(ctx context.Context, cfg syncer.Config) (syncer.Syncer, error) {
+	return &fakeRun{f: f, cfg: cfg}, nil
+}
+
+func (f *fakeSyncer) syncs() []syncer.Config {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]syncer.Config{}, f.configs...)
+}
+
+type fakeRun struct {
+	f   *fakeSyncer
+	cfg syncer.Config
+}
+
+func (r *fakeRun) Sync(ctx context.Context) (history.Run, error) {
+	f := r.f
+	f.mu.Lock()
+	f.configs = append(f.configs, r.cfg)
+	var err error
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	f.mu.Unlock()
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return history.Run{}, ctx.Err()
+		}
+	}
+	return history.Run{}, err
+}
+
+// fakeTriggers records the configs triggers were started with, and keeps the
+// latest request function so specs can fire triggers.
+type fakeTriggers struct {
+	mu      sync.Mutex
+	configs []syncer.Config
+	running int
+	request func(string)
+}
+
+func (t *fakeTriggers) start(ctx context.Context, cfg syncer.Config, request func(string)) <-chan struct{} {
+	t.mu.Lock()
+	t.configs = append(t.configs, cfg)
+	t.running++
+	t.request = request
+	t.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		t.running--
+		t.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (t *fakeTriggers) fire(reason string) {
+	t.mu.Lock()
+	request := t.request
+	t.mu.Unlock()
+	request(reason)
+}
+
+func (t *fakeTriggers) started() []syncer.Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]syncer.Config{}, t.configs...)
+}
+
+func (t *fakeTriggers) active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running
+}
+
+var _ = Describe("Run", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		cfg       syncer.Config
+		reloads   chan syncer.Config
+		syncs     *fakeSyncer
+		triggers  *fakeTriggers
+		queued    []queue.Entry
+		reachable []error
+		checks    int
+		lookups   int
+		mu        sync.Mutex
+		done      chan error
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		cfg = syncer.Config{}
+		cfg.Daemon.Schedule = "@every 1h"
+		cfg.Daemon.ReconnectInterval = 10 * time.Millisecond
+		reloads = make(chan syncer.Config)
+		syncs = &fakeSyncer{}
+		triggers = &fakeTriggers{}
+		queued = nil
+		reachable = nil
+		checks = 0
+		lookups = 0
+		done = make(chan error, 1)
+	})
+
+	run := func() {
+		fakes := daemon.Fakes{
+			NewSyncer: syncs.new,
+			Reachable: func(ctx context.Context, cfg syncer.Config) error {
+				mu.Lock()
+				defer mu.Unlock()
+				checks++
+				if len(reachable) == 0 {
+					return nil
+				}
+				err := reachable[0]
+				reachable = reachable[1:]
+				return err
+			},
+			Queued: func(cfg syncer.Config) ([]queue.Entry, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				lookups++
+				return queued, nil
+			},
+			Triggers: triggers.start,
+		}
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			done <- daemon.RunWithFakes(ctx, cfg, reloads, fakes)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-stopped
+		})
+		Eventually(triggers.started).Should(HaveLen(1))
+	}
+
+	// reachabilityChecks and queueLookups count the calls to the fakes.
+	reachabilityChecks := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return checks
+	}
+	queueLookups := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return lookups
+	}
+
+	setQueued := func(entries []queue.Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		queued = entries
+	}
+
+	offline := func() error {
+		return errors.WithCategory(eris.New("connection refused"), errors.NetworkCategory)
+	}
+
+	It("stops its triggers and returns once ctx is cancelled", func() {
+		run()
+		Expect(triggers.active()).To(Equal(1))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(triggers.active()).To(Equal(0))
+	})
+
+	It("stops a sync in progress when ctx is cancelled", func() {
+		syncs.release = make(chan struct{})
+		syncs.started = make(chan struct{}, 1)
+		cfg.Daemon.SyncOnStart = true
+		run()
+		Eventually(syncs.started).Should(Receive())
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("syncs on start if asked to", func() {
+		cfg.Daemon.SyncOnStart = true
+		run()
+		Eventually(syncs.syncs).Should(HaveLen(1))
+	})
+
+	It("collapses requests made during a sync into one more sync", func() {
+		syncs.release = make(chan struct{})
+		syncs.started = make(chan struct{}, 3)
+		run()
+		triggers.fire("schedule")
+		Eventually(syncs.started).Should(Receive())
+		for i := 0; i < 5; i++ {
+			triggers.fire("watch")
+		}
+		syncs.release <- struct{}{}
+		Eventually(syncs.started).Should(Receive())
+		syncs.release <- struct{}{}
+		Consistently(syncs.syncs, 100*time.Millisecond).Should(HaveLen(2))
+	})
+
+	It("restarts the triggers with a reloaded config, which the next sync uses", func() {
+		run()
+		reloaded := cfg
+		reloaded.Daemon.Schedule = "@every 5m"
+		reloads <- reloaded
+		Eventually(triggers.started).Should(HaveLen(2))
+		Expect(triggers.started()[1].Daemon.Schedule).To(Equal("@every 5m"))
+		Expect(triggers.active()).To(Equal(1))
+
+		triggers.fire("schedule")
+		Eventually(syncs.syncs).Should(HaveLen(1))
+		Expect(syncs.syncs()[0].Daemon.Schedule).To(Equal("@every 5m"))
+	})
+
+	It("syncs once storage is reachable while uploads are queued", func() {
+		queued = []queue.Entry{{Path: "/roms/snes/Game.srm"}}
+		reachable = []error{offline(), offline()}
+		run()
+		Eventually(syncs.syncs).Should(HaveLen(1))
+		Expect(reachabilityChecks()).To(Equal(3))
+	})
+
+	It("checks storage again after a sync fails to reach it, leaving uploads queued", func() {
+		syncs.errs = []error{offline()}
+		reachable = []error{offline()}
+		run()
+		Eventually(queueLookups).Should(Equal(1))
+		setQueued([]queue.Entry{{Path: "/roms/snes/Game.srm"}})
+		triggers.fire("schedule")
+		// The failed sync, then a check that still can't reach storage,
+		// then one that can, and the sync it starts.
+		Eventually(syncs.syncs).Should(HaveLen(2))
+		Expect(reachabilityChecks()).To(Equal(2))
+	})
+
+	It("doesn't check storage when a sync fails otherwise", func() {
+		syncs.errs = []error{eris.New("bad config")}
+		run()
+		Eventually(queueLookups).Should(Equal(1))
+		setQueued([]queue.Entry{{Path: "/roms/snes/Game.srm"}})
+		triggers.fire("schedule")
+		Eventually(syncs.syncs).Should(HaveLen(1))
+		Consistently(reachabilityChecks, 100*time.Millisecond).Should(Equal(0))
+	})
+})
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"go.uber.org/zap"
+)
+
+// debugShutdownTimeout bounds how long profiles being fetched when the daemon
+// stops are waited for.
+const debugShutdownTimeout = 5 * time.Second
+
+// serveDebug serves the Go profiler and runtime stats under /debug/pprof/ at
+// addr until ctx is cancelled, for diagnosing e.g. memory growth of a
+// long-running daemon. Failing to listen is logged, never fatal.
+func serveDebug(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), debugShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	log.FromCtx(ctx).Warn("Serving debug endpoints; don't expose them beyond this machine", zap.String("address", addr))
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.FromCtx(ctx).Error("Unable to serve debug endpoints", zap.String("address", addr), zap.Error(err))
+	}
+}
@@ -0,0 +1,29 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+// Fakes stand in for what the daemon runs.
+type Fakes struct {
+	NewSyncer func(context.Context, syncer.Config) (syncer.Syncer, error)
+	Reachable func(context.Context, syncer.Config) error
+	Queued    func(syncer.Config) ([]queue.Entry, error)
+	// Triggers is given a function requesting a sync.
+	Triggers func(ctx context.Context, cfg syncer.Config, request func(reason string)) <-chan struct{}
+}
+
+// RunWithFakes is Run with the syncer and triggers replaced by fakes.
+func RunWithFakes(ctx context.Context, cfg syncer.Config, reloads <-chan syncer.Config, fakes Fakes) error {
+	d := newDaemon(cfg)
+	d.newSyncer = fakes.NewSyncer
+	d.reachable = fakes.Reachable
+	d.queue = fakes.Queued
+	d.triggers = func(ctx context.Context, cfg syncer.Config) <-chan struct{} {
+		return fakes.Triggers(ctx, cfg, d.request)
+	}
+	return d.run(ctx, reloads)
+}
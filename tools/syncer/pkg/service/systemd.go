@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+const systemUnitDir = "/etc/systemd/system"
+
+type (
+	// Options describe the systemd units to generate. With Interval set, a
+	// oneshot service running Args is triggered by a timer every Interval;
+	// otherwise the service runs Args continuously and is restarted if it
+	// exits. User units run as the invoking user and live under
+	// ~/.config/systemd/user; system units run as RunAs.
+	Options struct {
+		Name     string
+		Binary   string
+		Args     []string
+		Interval time.Duration
+		User     bool
+		RunAs    string
+	}
+
+	// Unit is a generated unit file.
+	Unit struct {
+		Name    string
+		Content string
+	}
+)
+
+var serviceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=RetroPie syncer ({{.Command}})
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+{{- if .Oneshot}}
+Type=oneshot
+{{- else}}
+Type=simple
+Restart=on-failure
+RestartSec=30
+{{- end}}
+ExecStart={{.ExecStart}}
+{{- if .RunAs}}
+User={{.RunAs}}
+{{- end}}
+Nice=10
+IOSchedulingClass=idle
+{{- if not .Oneshot}}
+
+[Install]
+WantedBy={{.WantedBy}}
+{{- end}}
+`))
+
+var timerTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description=Run {{.Name}}.service every {{.Interval}}
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec={{.Seconds}}s
+RandomizedDelaySec=60
+
+[Install]
+WantedBy=timers.target
+`))
+
+// Units renders the service, and the timer if there is an Interval.
+func Units(opts Options) ([]Unit, error) {
+	if opts.Name == "" || opts.Binary == "" || len(opts.Args) == 0 {
+		return nil, eris.New("name, binary, and args are required")
+	}
+	wantedBy := "multi-user.target"
+	if opts.User {
+		wantedBy = "default.target"
+	}
+	runAs := opts.RunAs
+	if opts.User {
+		runAs = ""
+	}
+
+	var service bytes.Buffer
+	err := serviceTemplate.Execute(&service, map[string]any{
+		"Command":   opts.Args[0],
+		"Oneshot":   opts.Interval > 0,
+		"ExecStart": execStart(opts.Binary, opts.Args),
+		"RunAs":     runAs,
+		"WantedBy":  wantedBy,
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to render service")
+	}
+	units := []Unit{{Name: opts.Name + ".service", Content: service.String()}}
+
+	if opts.Interval > 0 {
+		var timer bytes.Buffer
+		err = timerTemplate.Execute(&timer, map[string]any{
+			"Name":     opts.Name,
+			"Interval": opts.Interval,
+			"Seconds":  int64(opts.Interval.Seconds()),
+		})
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to render timer")
+		}
+		units = append(units, Unit{Name: opts.Name + ".timer", Content: timer.String()})
+	}
+	return units, nil
+}
+
+// Install writes the units, reloads systemd, and enables the timer or, if
+// there is none, the service.
+func Install(opts Options) ([]string, error) {
+	units, err := Units(opts)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := UnitDir(opts.User)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to create %s", dir)
+	}
+	paths := make([]string, 0, len(units))
+	for _, u := range units {
+		path := filepath.Join(dir, u.Name)
+		err = os.WriteFile(path, []byte(u.Content), 0644)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to write %s (system units need root; try sudo or --user)", path)
+		}
+		paths = append(paths, path)
+	}
+
+	err = systemctl(opts.User, "daemon-reload")
+	if err != nil {
+		return paths, err
+	}
+	return paths, systemctl(opts.User, "enable", "--now", units[len(units)-1].Name)
+}
+
+// UnitDir is where system or user units are installed.
+func UnitDir(user bool) (string, error) {
+	if !user {
+		return systemUnitDir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", eris.Wrap(err, "failed to find user config directory")
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+func systemctl(user bool, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return eris.Wrapf(err, "systemctl %s: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// execStart quotes each word that systemd would otherwise split or expand.
+func execStart(binary string, args []string) string {
+	words := append([]string{binary}, args...)
+	for i, w := range words {
+		if strings.ContainsAny(w, " \t\"'\\$%") {
+			w = strings.ReplaceAll(w, `\`, `\\`)
+			w = strings.ReplaceAll(w, `"`, `\"`)
+			w = strings.ReplaceAll(w, "%", "%%")
+			w = strings.ReplaceAll(w, "$", "$$")
+			words[i] = `"` + w + `"`
+		}
+	}
+	return strings.Join(words, " ")
+}
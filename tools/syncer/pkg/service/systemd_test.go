@@ -0,0 +1,113 @@
+package service_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/service"
+)
+
+var _ = Describe("Units", func() {
+	DescribeTable("renders the units",
+		func(opts service.Options, want []service.Unit) {
+			units, err := service.Units(opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(units).To(Equal(want))
+		},
+		Entry("a timer for a system oneshot",
+			service.Options{Name: "retropie-sync", Binary: "/usr/local/bin/syncer", Args: []string{"sync"}, Interval: 15 * time.Minute, RunAs: "pi"},
+			[]service.Unit{
+				{Name: "retropie-sync.service", Content: `[Unit]
+Description=RetroPie syncer (sync)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/bin/syncer sync
+User=pi
+Nice=10
+IOSchedulingClass=idle
+`},
+				{Name: "retropie-sync.timer", Content: `[Unit]
+Description=Run retropie-sync.service every 15m0s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=900s
+RandomizedDelaySec=60
+
+[Install]
+WantedBy=timers.target
+`},
+			},
+		),
+		Entry("a system daemon",
+			service.Options{Name: "retropie-syncd", Binary: "/usr/local/bin/syncer", Args: []string{"daemon"}, RunAs: "pi"},
+			[]service.Unit{
+				{Name: "retropie-syncd.service", Content: `[Unit]
+Description=RetroPie syncer (daemon)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+Restart=on-failure
+RestartSec=30
+ExecStart=/usr/local/bin/syncer daemon
+User=pi
+Nice=10
+IOSchedulingClass=idle
+
+[Install]
+WantedBy=multi-user.target
+`},
+			},
+		),
+		Entry("a user daemon, ignoring RunAs",
+			service.Options{Name: "retropie-syncd", Binary: "/usr/local/bin/syncer", Args: []string{"daemon", "--config", "/home/pi/syncer.yaml"}, User: true, RunAs: "pi"},
+			[]service.Unit{
+				{Name: "retropie-syncd.service", Content: `[Unit]
+Description=RetroPie syncer (daemon)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+Restart=on-failure
+RestartSec=30
+ExecStart=/usr/local/bin/syncer daemon --config /home/pi/syncer.yaml
+Nice=10
+IOSchedulingClass=idle
+
+[Install]
+WantedBy=default.target
+`},
+			},
+		),
+	)
+
+	DescribeTable("quotes ExecStart words systemd would split or expand",
+		func(binary string, args []string, want string) {
+			units, err := service.Units(service.Options{Name: "retropie-sync", Binary: binary, Args: args})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(units[0].Content, "\n")).To(ContainElement("ExecStart=" + want))
+		},
+		Entry("spaces", "/usr/local/bin/syncer", []string{"sync", "--config", "/home/pi/My Saves/syncer.yaml"}, `/usr/local/bin/syncer sync --config "/home/pi/My Saves/syncer.yaml"`),
+		Entry("tabs", "/usr/local/bin/syncer", []string{"sync", "a\tb"}, "/usr/local/bin/syncer sync \"a\tb\""),
+		Entry("percent signs", "/usr/local/bin/syncer", []string{"sync", "--name", "100%"}, `/usr/local/bin/syncer sync --name "100%%"`),
+		Entry("dollar signs", "/usr/local/bin/syncer", []string{"sync", "--name", "$HOME"}, `/usr/local/bin/syncer sync --name "$$HOME"`),
+		Entry("double quotes", "/usr/local/bin/syncer", []string{"sync", "--name", `say "hi"`}, `/usr/local/bin/syncer sync --name "say \"hi\""`),
+		Entry("single quotes", "/usr/local/bin/syncer", []string{"sync", "--name", "Mario's"}, `/usr/local/bin/syncer sync --name "Mario's"`),
+		Entry("backslashes", "/usr/local/bin/syncer", []string{"sync", "--name", `a\b`}, `/usr/local/bin/syncer sync --name "a\\b"`),
+		Entry("the binary", "/opt/My Tools/syncer", []string{"sync"}, `"/opt/My Tools/syncer" sync`),
+	)
+
+	It("requires a name, binary, and args", func() {
+		_, err := service.Units(service.Options{Name: "retropie-sync", Binary: "/usr/local/bin/syncer"})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,105 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// applyBudget warns if uploading the planned batches would take this
+// month's uploads over the budget, and if so leaves out the sets of the
+// file types the budget pauses.
+func (s *syncer) applyBudget(ctx context.Context, run *history.Run, batches []batch) ([]batch, error) {
+	budget := s.cfg.Budget
+	if budget.MonthlyBytes <= 0 && budget.MonthlyFiles <= 0 {
+		return batches, nil
+	}
+	paused, err := budget.paused()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	runs, err := history.NewJournal(s.cfg.HistoryFile()).List(0)
+	if err != nil {
+		return nil, err
+	}
+	usedBytes, usedFiles := monthUsage(runs, run.StartedAt)
+	over := func(batches []batch) bool {
+		bytes, files := usedBytes, usedFiles
+		for _, b := range batches {
+			selected := b.files()
+			files += len(selected)
+			bytes += totalSize(selected)
+		}
+		return (budget.MonthlyBytes > 0 && bytes > budget.MonthlyBytes) || (budget.MonthlyFiles > 0 && files > budget.MonthlyFiles)
+	}
+	if !over(batches) {
+		return batches, nil
+	}
+
+	log.FromCtx(ctx).Warn("Sync takes this month's uploads over the budget",
+		zap.String("uploaded", progress.FormatBytes(usedBytes)),
+		zap.Int("files", usedFiles),
+		zap.String("monthlyBytes", progress.FormatBytes(budget.MonthlyBytes)),
+		zap.Int("monthlyFiles", budget.MonthlyFiles),
+		zap.Strings("pausing", budget.Pause),
+	)
+	if len(paused) == 0 {
+		return batches, nil
+	}
+	kept := make([]batch, 0, len(batches))
+	for _, b := range batches {
+		sets := make([]*fs.FileSet, 0, len(b.sets))
+		for _, set := range b.sets {
+			if paused[set.Primary.FileType] {
+				run.Skip("monthly upload budget reached", paths(set.Files())...)
+				continue
+			}
+			sets = append(sets, set)
+		}
+		b.sets = sets
+		if len(b.sets) > 0 || len(b.unchanged) > 0 {
+			kept = append(kept, b)
+		}
+	}
+	if over(kept) {
+		log.FromCtx(ctx).Warn("Sync goes over the upload budget even without the paused file types")
+	}
+	return kept, nil
+}
+
+// monthUsage sums what the runs started in the calendar month of now
+// uploaded.
+func monthUsage(runs []history.Run, now time.Time) (int64, int) {
+	year, month, _ := now.Date()
+	var bytes int64
+	files := 0
+	for _, r := range runs {
+		y, m, _ := r.StartedAt.In(now.Location()).Date()
+		if y != year || m != month {
+			continue
+		}
+		bytes += r.BytesUploaded
+		files += r.FilesUploaded
+	}
+	return bytes, files
+}
+
+// paused parses Pause.
+func (b Budget) paused() (map[fs.FileType]bool, error) {
+	paused := make(map[fs.FileType]bool, len(b.Pause))
+	for _, name := range b.Pause {
+		ft, err := fs.ParseFileType(name)
+		if err != nil {
+			return nil, eris.Wrap(err, "invalid file type in budget.pause")
+		}
+		paused[ft] = true
+	}
+	return paused, nil
+}
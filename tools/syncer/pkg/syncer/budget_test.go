@@ -0,0 +1,113 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Budget", func() {
+	It("sums the uploads of the runs started this calendar month", func() {
+		now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+		runs := []history.Run{
+			{StartedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), BytesUploaded: 100, FilesUploaded: 1},
+			{StartedAt: time.Date(2024, 3, 14, 23, 0, 0, 0, time.UTC), BytesUploaded: 50, FilesUploaded: 2},
+			{StartedAt: time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC), BytesUploaded: 1000, FilesUploaded: 10},
+			{StartedAt: time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC), BytesUploaded: 1000, FilesUploaded: 10},
+		}
+		bytes, files := syncer.MonthUsage(runs, now)
+		Expect(bytes).To(Equal(int64(150)))
+		Expect(files).To(Equal(3))
+	})
+
+	It("counts the month in the local time zone", func() {
+		est := time.FixedZone("EST", -5*60*60)
+		now := time.Date(2024, 3, 15, 12, 0, 0, 0, est)
+		// Still February in EST.
+		runs := []history.Run{{StartedAt: time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), FilesUploaded: 1}}
+		_, files := syncer.MonthUsage(runs, now)
+		Expect(files).To(Equal(0))
+	})
+
+	When("syncing", func() {
+		var (
+			ctx    context.Context
+			cfg    syncer.Config
+			remote *storagetest.Fake
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			dir := GinkgoT().TempDir()
+			remote = storagetest.NewFake()
+			cfg = syncer.Config{
+				RomsFolder: filepath.Join(dir, "roms"),
+				StateDir:   filepath.Join(dir, "state"),
+			}
+			cfg.Metadata.Backend = "none"
+			cfg.Sync.Saves = true
+			cfg.Sync.States = true
+			cfg.Budget.Pause = []string{"state"}
+			for _, name := range []string{"Game.srm", "Game.state"} {
+				p := filepath.Join(cfg.RomsFolder, "snes", name)
+				Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(p, []byte(name), 0644)).To(Succeed())
+			}
+			// Earlier this month.
+			Expect(history.NewJournal(cfg.HistoryFile()).Append(history.Run{
+				StartedAt:     time.Now(),
+				FilesUploaded: 10,
+			})).To(Succeed())
+		})
+
+		sync := func() history.Run {
+			s, err := syncer.NewSyncerWithStorage(cfg, remote)
+			Expect(err).NotTo(HaveOccurred())
+			run, err := s.Sync(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			return run
+		}
+
+		It("uploads everything within the budget", func() {
+			cfg.Budget.MonthlyFiles = 12
+			run := sync()
+			Expect(run.FilesUploaded).To(Equal(2))
+		})
+
+		It("leaves out the paused file types over the budget", func() {
+			cfg.Budget.MonthlyFiles = 11
+			run := sync()
+			Expect(run.FilesUploaded).To(Equal(1))
+			objects, err := remote.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(ConsistOf(HaveField("Key", HaveSuffix("/snes/Game.srm"))))
+			Expect(run.Skips).To(ConsistOf(history.FileOutcome{
+				Path:   filepath.Join(cfg.RomsFolder, "snes", "Game.state"),
+				Reason: "monthly upload budget reached",
+			}))
+		})
+
+		It("only warns over the budget with nothing to pause", func() {
+			cfg.Budget.MonthlyFiles = 11
+			cfg.Budget.Pause = nil
+			run := sync()
+			Expect(run.FilesUploaded).To(Equal(2))
+		})
+
+		It("rejects unknown file types to pause", func() {
+			cfg.Budget.Pause = []string{"savestate"}
+			err := cfg.Validate()
+			Expect(err).To(MatchError(ContainSubstring("budget.pause")))
+			Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+		})
+	})
+})
@@ -1,36 +1,377 @@
 package syncer
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/TrevorEdris/retropie-utils/pkg/backup"
+	"github.com/TrevorEdris/retropie-utils/pkg/cache"
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+	"github.com/TrevorEdris/retropie-utils/pkg/device"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
 	"github.com/TrevorEdris/retropie-utils/pkg/storage"
 	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+	"github.com/robfig/cron/v3"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
 
 type (
 	// TODO: Allow for arbitrary locations?
 	Config struct {
-		Storage    Storage `mapstructure:"storage"`
-		RomsFolder string  `mapstructure:"romsFolder"`
-		Sync       Sync    `mapstructure:"sync"`
+		// Profile selects the filesystem layout of a distribution
+		// ("retropie", "batocera", "recalbox", or "lakka"), filling in the
+		// folders left unset. See Profile.
+		Profile     string      `mapstructure:"profile"`
+		Storage     Storage     `mapstructure:"storage"`
+		RomsFolder  string      `mapstructure:"romsFolder"`
+		Saves       Saves       `mapstructure:"saves"`
+		Configs     Configs     `mapstructure:"configs"`
+		Bios        Bios        `mapstructure:"bios"`
+		Screenshots Screenshots `mapstructure:"screenshots"`
+		Sync        Sync        `mapstructure:"sync"`
+		Throttle    Throttle    `mapstructure:"throttle"`
+		Filters     Filters     `mapstructure:"filters"`
+		Manifest    Manifest    `mapstructure:"manifest"`
+		Notify      Notify      `mapstructure:"notify"`
+		Log         log.Config  `mapstructure:"log"`
+		Daemon      Daemon      `mapstructure:"daemon"`
+		Metadata    Metadata    `mapstructure:"metadata"`
+		Conflicts   Conflicts   `mapstructure:"conflicts"`
+		Dat         Dat         `mapstructure:"dat"`
+		Trash       Trash       `mapstructure:"trash"`
+		Restore     Restore     `mapstructure:"restore"`
+		Cache       Cache       `mapstructure:"cache"`
+		Backup      Backup      `mapstructure:"backup"`
+		Stability   Stability   `mapstructure:"stability"`
+		Limits      Limits      `mapstructure:"limits"`
+		Budget      Budget      `mapstructure:"budget"`
+		LargeFiles  LargeFiles  `mapstructure:"largeFiles"`
+		Mount       Mount       `mapstructure:"mount"`
+		// Direction is which way syncs move files: "upload" (the default)
+		// only pushes local changes, "download" only fetches what other
+		// devices uploaded, and "both" does both, downloading first.
+		// Downloads need the metadata store shared between devices.
+		Direction Direction `mapstructure:"direction" validate:"omitempty,oneof=upload download both"`
+		// Systems, if set, restricts syncing the RomsFolder to these system
+		// folders (e.g. "gba", "snes"), on top of Filters.
+		Systems []string `mapstructure:"systems"`
+		// StateDir holds the syncer's local state, such as its sync history.
+		// Defaults to $HOME/.syncer, or $HOME/.syncer/profiles/<name> for a
+		// named profile.
+		StateDir string `mapstructure:"stateDir"`
+		// ActiveProfile names the entry of the config's "profiles" section
+		// whose settings override the rest of the config, e.g. to back up
+		// each person's saves on a shared device to their own bucket or
+		// prefix. It is usually set with --profile.
+		ActiveProfile string `mapstructure:"activeProfile"`
+		// LockStaleAfter is how long a sync may hold the sync lock before
+		// another sync takes it over. Locks held by a process that has exited
+		// are always taken over; zero never expires a lock by age, which is
+		// what's wanted unless StateDir is shared between devices.
+		LockStaleAfter time.Duration `mapstructure:"lockStaleAfter"`
+		// DeviceName names this machine in the history and metadata of its
+		// uploads. Defaults to the hostname when the device's identity is
+		// first created in StateDir.
+		DeviceName string `mapstructure:"deviceName"`
+		// FileTypes maps extensions, without the leading "." (e.g. "cso"), to
+		// the file type ("rom", "save", "state", or "other") they are synced
+		// as. It extends the built-in mapping, or replaces it entirely when
+		// ReplaceDefaultFileTypes is set.
+		FileTypes               map[string]string `mapstructure:"fileTypes"`
+		ReplaceDefaultFileTypes bool              `mapstructure:"replaceDefaultFileTypes"`
+		// ScanWorkers is how many directories are read at once while
+		// scanning for files, 4 by default. 1 reads them one at a time.
+		ScanWorkers int `mapstructure:"scanWorkers" validate:"gte=0"`
 	}
 
 	Storage struct {
 		GoogleDrive storage.GDriveConfig `mapstructure:"googleDrive"`
 		S3          storage.S3Config     `mapstructure:"s3"`
 		SFTP        storage.SFTPConfig   `mapstructure:"sftp"`
+		Rclone      storage.RcloneConfig `mapstructure:"rclone"`
+		Retry       storage.RetryConfig  `mapstructure:"retry"`
+		// Timeouts bound each storage operation during a sync. The s3 and
+		// rclone backends may override them with their own.
+		Timeouts storage.TimeoutConfig `mapstructure:"timeouts"`
 	}
 
 	Sync struct {
-		Roms   bool `mapstructure:"roms"`
-		Saves  bool `mapstructure:"saves"`
-		States bool `mapstructure:"states"`
+		Roms    bool `mapstructure:"roms"`
+		Saves   bool `mapstructure:"saves"`
+		States  bool `mapstructure:"states"`
+		Configs bool `mapstructure:"configs"`
+		Bios    bool `mapstructure:"bios"`
+		// Screenshots syncs the .png screenshots RetroArch writes next to
+		// games, and those in Screenshots.Folder if one is set. Savestate
+		// thumbnails always follow their savestate instead.
+		Screenshots bool `mapstructure:"screenshots"`
+		// MinInterval limits how often files of a type are uploaded, by
+		// type name (e.g. "state": 10m), so savestates rewritten every few
+		// minutes during play aren't uploaded on every sync. Changed files
+		// uploaded more recently are left for a later sync. Upload times
+		// come from the metadata store or the sync cache, so one of them
+		// must be enabled.
+		MinInterval map[string]time.Duration `mapstructure:"minInterval"`
+		// MaxFailures is how many files may fail to sync before the sync
+		// as a whole fails. Either way, a failed file doesn't stop the
+		// others from syncing.
+		MaxFailures int `mapstructure:"maxFailures"`
 	}
+
+	// Saves locates saves kept outside the RomsFolder, in a folder per
+	// system laid out like the RomsFolder (e.g. saves/snes/Game.srm), so
+	// they are stored alongside those of devices that keep them next to the
+	// games. States are read from StatesFolder, or Folder if that is unset.
+	// By default both are read from the RomsFolder.
+	Saves struct {
+		Folder       string `mapstructure:"folder"`
+		StatesFolder string `mapstructure:"statesFolder"`
+	}
+
+	// Screenshots locates a screenshot folder outside the RomsFolder, for
+	// when RetroArch's screenshot_directory is set. Its files are stored
+	// under "screenshots/" by their path relative to Folder.
+	Screenshots struct {
+		Folder string `mapstructure:"folder"`
+	}
+
+	// Bios locates the BIOS files emulators need, by default in
+	// $HOME/RetroPie/BIOS. Extensions, without the leading "." (e.g. "bin"),
+	// replace the built-in set of BIOS extensions.
+	Bios struct {
+		Folder     string   `mapstructure:"folder"`
+		Extensions []string `mapstructure:"extensions"`
+	}
+
+	// Configs locates RetroArch's configuration: retroarch.cfg, core and
+	// game overrides, input remaps, core options, and shader presets. Folder
+	// defaults to /opt/retropie/configs. Files are stored under "configs/"
+	// by their path relative to Folder, so a controller setup made on one
+	// machine lands in the same place from any other. Paths renames folders
+	// relative to Folder on the way, e.g. {"all/retroarch": "retroarch"},
+	// for machines that keep the same files in different places.
+	Configs struct {
+		Folder string            `mapstructure:"folder"`
+		Paths  map[string]string `mapstructure:"paths"`
+	}
+
+	// Filters select which files are synced by their path relative to the
+	// RomsFolder, e.g. exclude ["**/media/**", "*.bak"]. Directories
+	// excluded whole, like media/ there, aren't scanned. See fs.Filter.
+	Filters struct {
+		Include []string `mapstructure:"include"`
+		Exclude []string `mapstructure:"exclude"`
+	}
+
+	// Manifest controls the integrity manifest uploaded with every sync. When
+	// SigningKey is set the manifest is signed with it; like any secret, it
+	// may be read from a file, environment variable, or command. With it
+	// enabled, a download-only sync, i.e. a restore, then checks the files
+	// it covers against the latest manifest and fails if any are missing
+	// or differ.
+	Manifest struct {
+		Enabled    bool          `mapstructure:"enabled"`
+		SigningKey secret.Secret `mapstructure:"signingKey"`
+	}
+
+	// Notify sends the outcome of every sync to the configured destinations.
+	Notify struct {
+		Webhooks    []notify.WebhookConfig   `mapstructure:"webhooks"`
+		Healthcheck notify.HealthcheckConfig `mapstructure:"healthcheck"`
+		Email       notify.EmailConfig       `mapstructure:"email"`
+	}
+
+	// Daemon configures 'syncer daemon'. Schedule is a cron expression, or a
+	// descriptor such as "@every 1h" or "@daily"; empty disables scheduled
+	// syncs. With Watch set, changes to files that would be synced trigger a
+	// sync once the RomsFolder has been quiet for WatchDelay (default 2m),
+	// so a save written every few seconds during play only syncs once.
+	// While uploads are queued because storage was unreachable, it is
+	// checked every ReconnectInterval (default 1m), and a sync started
+	// once it can be reached. With DebugAddress set, e.g.
+	// "127.0.0.1:6060", the Go profiler is served there under
+	// /debug/pprof/; it is off by default.
+	Daemon struct {
+		Schedule          string        `mapstructure:"schedule"`
+		Watch             bool          `mapstructure:"watch"`
+		WatchDelay        time.Duration `mapstructure:"watchDelay"`
+		SyncOnStart       bool          `mapstructure:"syncOnStart"`
+		ReconnectInterval time.Duration `mapstructure:"reconnectInterval"`
+		DebugAddress      string        `mapstructure:"debugAddress" validate:"omitempty,hostname_port"`
+	}
+
+	// Metadata records every upload so files can be looked up without
+	// listing the remote. Backend is "bolt" (the default), which keeps a
+	// database at Path (default <StateDir>/metadata.db), or "none".
+	//
+	// A sync only logs a failure to record an upload, since the file is
+	// stored. With Strict set, recording is retried, and if it still fails
+	// the file counts as failed and is uploaded again by the next sync, so
+	// restores driven by metadata miss nothing.
+	Metadata struct {
+		Backend string `mapstructure:"backend" validate:"omitempty,oneof=bolt none"`
+		Path    string `mapstructure:"path"`
+		Strict  bool   `mapstructure:"strict"`
+	}
+
+	// Conflicts decides what happens when a file's latest upload came from
+	// another device and the local copy differs from it. Policy is "skip"
+	// (the default), "fail", or "overwrite". Conflicts are only detected
+	// when devices share a metadata store.
+	Conflicts struct {
+		Policy string `mapstructure:"policy" validate:"omitempty,oneof=skip fail overwrite"`
+	}
+
+	// Trash keeps remote objects that are deleted under "trash/" for TTL
+	// (default 30 days) before 'syncer trash empty' deletes them for good.
+	Trash struct {
+		TTL time.Duration `mapstructure:"ttl"`
+	}
+
+	// Restore maps where files downloaded to this machine land, for when it
+	// lays files out differently from the device that uploaded them (e.g.
+	// Batocera's /userdata/roms). Paths maps a remote directory, such as a
+	// system ("snes") or "bios", to a local directory; the longest matching
+	// entry wins, and unmapped files land under the RomsFolder.
+	//
+	// Downloads that may not fit in the free disk space fail before
+	// anything is downloaded, unless SkipSpaceCheck is set.
+	Restore struct {
+		Paths map[string]string `mapstructure:"paths"`
+		// SkipSpaceCheck downloads whatever the free space. It is set by
+		// --ignore-space rather than the config file.
+		SkipSpaceCheck bool `mapstructure:"-"`
+	}
+
+	// Backup keeps a copy of each local file a pull overwrites, in a
+	// snapshot per pull under backup/ in StateDir, so 'syncer undo' can put
+	// it back. Keep is how many snapshots are kept, 10 by default.
+	Backup struct {
+		Keep int `mapstructure:"keep"`
+	}
+
+	// Stability holds back files an emulator may still be writing, so a
+	// half-written save is never uploaded. A file is only synced once it
+	// has gone unmodified for Window and, with SkipOpen, no process has it
+	// open for writing (read from /proc, so Linux only). A skipped file
+	// holds back the rest of its set and is picked up by the next sync.
+	Stability struct {
+		Window   time.Duration `mapstructure:"window"`
+		SkipOpen bool          `mapstructure:"skipOpen"`
+	}
+
+	// Limits stop a sync that would change far more than usual, such as one
+	// run against a wiped or freshly flashed SD card, until it is confirmed
+	// with 'syncer sync --yes'. MaxFiles and MaxBytes bound what one run
+	// uploads. Syncs never delete remote files, so MaxDeletions bounds the
+	// files this device uploaded before that are now missing locally, the
+	// surest sign the card isn't what it was. Zero disables a limit.
+	Limits struct {
+		MaxFiles     int   `mapstructure:"maxFiles"`
+		MaxBytes     int64 `mapstructure:"maxBytes"`
+		MaxDeletions int   `mapstructure:"maxDeletions"`
+		// Confirmed lets a sync exceed the limits. It is set by --yes
+		// rather than the config file.
+		Confirmed bool `mapstructure:"-"`
+	}
+
+	// Budget caps what is uploaded each calendar month, as counted from
+	// the sync history, to avoid surprise bandwidth and storage bills.
+	// MonthlyBytes and MonthlyFiles bound the bytes and files uploaded;
+	// zero disables a cap. A sync that would go over a cap warns, and
+	// leaves out the file types named in Pause (e.g. "state",
+	// "screenshot"), so the saves that matter keep being backed up.
+	Budget struct {
+		MonthlyBytes int64    `mapstructure:"monthlyBytes" validate:"gte=0"`
+		MonthlyFiles int      `mapstructure:"monthlyFiles" validate:"gte=0"`
+		Pause        []string `mapstructure:"pause"`
+	}
+
+	// LargeFiles decides how files of at least Threshold bytes (default
+	// 100MiB), mostly disc images such as CHDs and ISOs, are synced. A
+	// large file whose modification time changed but whose content still
+	// matches its latest upload in the metadata store isn't uploaded again,
+	// since hashing it is far cheaper than sending it. Files larger than
+	// MaxSize are skipped; zero syncs files of any size. How large files
+	// are uploaded is set by storage.s3.multipart.
+	LargeFiles struct {
+		Threshold int64 `mapstructure:"threshold" validate:"gte=0"`
+		MaxSize   int64 `mapstructure:"maxSize" validate:"gte=0"`
+	}
+
+	// Mount guards against syncing a RomsFolder on a drive that isn't
+	// mounted, which looks just like an empty library. A sync always fails
+	// if the RomsFolder doesn't exist; it also fails if MarkerFile, a path
+	// relative to the RomsFolder (e.g. ".mounted"), doesn't exist, or if the
+	// RomsFolder holds fewer than ExpectedMinFiles files. Both are checked
+	// before anything is downloaded.
+	Mount struct {
+		MarkerFile       string `mapstructure:"markerFile"`
+		ExpectedMinFiles int    `mapstructure:"expectedMinFiles" validate:"gte=0"`
+	}
+
+	// Cache remembers what each sync uploaded, so the next one skips files
+	// whose size and modification time haven't changed without hashing them
+	// or contacting the backend. Path defaults to cache.json in StateDir.
+	// With a time-based layout, skipped files are left out of the run's
+	// directory rather than uploaded to it again.
+	Cache struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Path    string `mapstructure:"path"`
+	}
+
+	// Dat points at a folder of No-Intro or Redump DAT files. When set,
+	// synced ROMs are verified against them and tagged with their canonical
+	// title in the metadata store. Systems maps DAT names (e.g. "Nintendo -
+	// Super Nintendo Entertainment System") to the RetroPie system folder
+	// 'syncer organize' moves their ROMs to, extending the built-in mapping.
+	Dat struct {
+		Folder  string            `mapstructure:"folder"`
+		Systems map[string]string `mapstructure:"systems"`
+	}
+
+	// Throttle defers everything but saves while the device is low on battery
+	// or running hot. A zero value disables the corresponding check.
+	Throttle struct {
+		MinBatteryPercent     int     `mapstructure:"minBatteryPercent"`
+		MaxTemperatureCelsius float64 `mapstructure:"maxTemperatureCelsius"`
+	}
+)
+
+// Direction is which way syncs move files.
+type Direction string
+
+const (
+	DirectionUpload   Direction = "upload"
+	DirectionDownload Direction = "download"
+	DirectionBoth     Direction = "both"
 )
 
+// uploads reports whether syncs upload local changes.
+func (d Direction) uploads() bool {
+	return d != DirectionDownload
+}
+
+// downloads reports whether syncs download other devices' uploads.
+func (d Direction) downloads() bool {
+	return d == DirectionDownload || d == DirectionBoth
+}
+
 var example = Config{
 	Storage: Storage{
 		GoogleDrive: storage.GDriveConfig{
@@ -51,34 +392,619 @@ var example = Config{
 	},
 }
 
+const (
+	defaultConfigsFolder = "/opt/retropie/configs"
+	// configsRemoteDir and biosRemoteDir are the remote directories,
+	// alongside the synced systems, that hold RetroArch configs and BIOS
+	// files.
+	configsRemoteDir = "configs"
+	biosRemoteDir    = "bios"
+	// screenshotsRemoteDir holds screenshots from Screenshots.Folder.
+	screenshotsRemoteDir = "screenshots"
+
+	defaultTrashTTL   = 30 * 24 * time.Hour
+	defaultBackupKeep = 10
+
+	defaultScanWorkers = 4
+
+	defaultLargeFileThreshold int64 = 100 * 1024 * 1024
+)
+
 var validate *validator.Validate
 
-func CreateExample(outputDir string) error {
+// LoadConfig unmarshals the config held by v, with the settings of its active
+// named profile, if any, laid over the rest. Secrets may be given either as
+// a plain string or as a secret.Secret describing where to read them from.
+func LoadConfig(v *viper.Viper) (Config, error) {
+	name := strings.ToLower(v.GetString("activeProfile"))
+	var profile map[string]any
+	if name != "" {
+		var err error
+		v, profile, err = withNamedProfile(v, name)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	cfg := Config{}
+	err := v.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		secret.DecodeHook(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)))
+	if err != nil {
+		return Config{}, errors.WithCategory(eris.Wrap(err, "failed to unmarshal config"), errors.ConfigCategory)
+	}
+	err = cfg.applyProfile()
+	if err != nil {
+		return Config{}, err
+	}
+	// Keep each profile's history, lock, cache, and metadata apart unless
+	// it says otherwise.
+	if _, ok := profile["statedir"]; name != "" && !ok {
+		cfg.StateDir = filepath.Join(cfg.GetStateDir(), "profiles", name)
+	}
+	return cfg, nil
+}
+
+// withNamedProfile returns a copy of v with the settings of the named
+// profile merged over the rest, and the profile's own settings.
+func withNamedProfile(v *viper.Viper, name string) (*viper.Viper, map[string]any, error) {
+	profiles := v.GetStringMap("profiles")
+	profile, ok := profiles[name].(map[string]any)
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, nil, errors.WithCategory(eris.Errorf("unknown profile %q; the config defines %s", name, strings.Join(names, ", ")), errors.ConfigCategory)
+	}
+	settings := v.AllSettings()
+	delete(settings, "profiles")
+	mergeSettings(settings, profile)
+	merged := viper.New()
+	err := merged.MergeConfigMap(settings)
+	if err != nil {
+		return nil, nil, errors.WithCategory(eris.Wrapf(err, "failed to apply profile %q", name), errors.ConfigCategory)
+	}
+	return merged, profile, nil
+}
+
+// mergeSettings lays src over dst, merging nested sections key by key.
+func mergeSettings(dst, src map[string]any) {
+	for k, v := range src {
+		sub, ok := v.(map[string]any)
+		if existing, isMap := dst[k].(map[string]any); ok && isMap {
+			mergeSettings(existing, sub)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// Backend names the primary storage backend, the first enabled one in the
+// order Backends lists them, or "none".
+func (c Config) Backend() string {
+	backends := c.Backends()
+	if len(backends) == 0 {
+		return "none"
+	}
+	return backends[0]
+}
+
+// Backends names every enabled storage backend. Files are uploaded to all of
+// them: the first is the primary, which everything else (downloads,
+// verification, ...) uses, and the rest are mirrors kept in sync with it.
+func (c Config) Backends() []string {
+	backends := make([]string, 0)
+	if c.Storage.S3.Enabled {
+		backends = append(backends, "s3")
+	}
+	if c.Storage.SFTP.Enabled {
+		backends = append(backends, "sftp")
+	}
+	if c.Storage.Rclone.Enabled {
+		backends = append(backends, "rclone")
+	}
+	if c.Storage.GoogleDrive.Enabled {
+		backends = append(backends, "googleDrive")
+	}
+	return backends
+}
+
+// SummaryFields describe the config without any credentials, for logging at
+// the start of a sync.
+func (c Config) SummaryFields() []zap.Field {
+	fields := []zap.Field{
+		zap.String("romsFolder", c.RomsFolder),
+		zap.String("backend", c.Backend()),
+		zap.Strings("mirrors", c.mirrors()),
+		zap.String("direction", string(c.direction())),
+	}
+	if c.Storage.S3.Enabled {
+		fields = append(fields,
+			zap.String("bucket", c.Storage.S3.Bucket),
+			zap.String("prefix", c.Storage.S3.Prefix),
+			zap.String("layout", string(c.Layout())),
+			zap.String("compression", string(c.Storage.S3.Compression)),
+			zap.Bool("zipRoms", c.Storage.S3.ZipRoms),
+		)
+	}
+	if c.Storage.Rclone.Enabled {
+		fields = append(fields,
+			zap.String("remote", c.Storage.Rclone.Remote),
+			zap.String("path", c.Storage.Rclone.Path),
+		)
+	}
+	return append(fields,
+		zap.Bool("roms", c.Sync.Roms),
+		zap.Bool("saves", c.Sync.Saves),
+		zap.Bool("states", c.Sync.States),
+		zap.Bool("configs", c.Sync.Configs),
+		zap.Bool("bios", c.Sync.Bios),
+		zap.Bool("screenshots", c.Sync.Screenshots),
+		zap.Strings("systems", c.Systems),
+		zap.Int("includePatterns", len(c.Filters.Include)),
+		zap.Int("excludePatterns", len(c.Filters.Exclude)),
+		zap.Bool("manifest", c.Manifest.Enabled),
+		zap.Bool("cache", c.Cache.Enabled),
+		zap.Duration("stabilityWindow", c.Stability.Window),
+		zap.Bool("skipOpen", c.Stability.SkipOpen),
+		zap.Int64("maxFileSize", c.LargeFiles.MaxSize),
+		zap.String("stateDir", c.GetStateDir()),
+	)
+}
+
+// GetStateDir returns the directory holding the syncer's local state.
+func (c Config) GetStateDir() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".syncer"
+	}
+	return filepath.Join(home, ".syncer")
+}
+
+// HistoryFile returns the path of the sync history journal.
+func (c Config) HistoryFile() string {
+	return filepath.Join(c.GetStateDir(), "history.jsonl")
+}
+
+// MetadataStore opens the configured metadata store, or returns nil if
+// metadata is disabled.
+func (c Config) MetadataStore() (metadata.Store, error) {
+	switch c.Metadata.Backend {
+	case "none":
+		return nil, nil
+	case "", "bolt":
+		p := c.Metadata.Path
+		if p == "" {
+			p = filepath.Join(c.GetStateDir(), "metadata.db")
+		}
+		return metadata.NewBoltStore(p)
+	default:
+		return nil, errors.WithCategory(eris.Errorf("unknown metadata backend %q", c.Metadata.Backend), errors.ConfigCategory)
+	}
+}
+
+// Layout is how the storage backend names what it stores. Only S3 has a
+// choice; the others use the time layout.
+func (c Config) Layout() storage.Layout {
+	if c.Storage.S3.Enabled && c.Storage.S3.Layout != "" {
+		return c.Storage.S3.Layout
+	}
+	return storage.TimeLayout
+}
+
+// RemoteDir is the remote directory the layout stores a sync started at t
+// under, such that the same file uploaded in two syncs is stored in two
+// separate locations unless the layout replaces it.
+//
+// Example, with the time layout:
+// December 17, 2023 at 1:18pm EST
+// 2023/12/17/13
+func (c Config) RemoteDir(t time.Time) string {
+	return c.Layout().RemoteDir(t)
+}
+
+// SyncCache loads the sync cache, or returns nil if it is disabled. The
+// cache is kept per storage target, so changing the bucket, prefix, layout,
+// or key template starts it afresh.
+func (c Config) SyncCache() (*cache.Cache, error) {
+	if !c.Cache.Enabled {
+		return nil, nil
+	}
+	p := c.Cache.Path
+	if p == "" {
+		p = filepath.Join(c.GetStateDir(), "cache.json")
+	}
+	return cache.Load(p, c.cacheTarget())
+}
+
+// Downloads loads the record of the version of each file this device last
+// downloaded from another device, which is kept whether or not the sync
+// cache is enabled, so editing a downloaded file isn't mistaken for a
+// conflict with the upload it came from.
+func (c Config) Downloads() (*cache.Cache, error) {
+	return cache.Load(c.DownloadsFile(), c.cacheTarget())
+}
+
+// cacheTarget names the storage target the sync cache and download record
+// belong to.
+func (c Config) cacheTarget() string {
+	target := c.Backend()
+	switch target {
+	case "s3":
+		s3 := c.Storage.S3
+		target = fmt.Sprintf("s3://%s/%s?layout=%s&keys=%s&compression=%s", s3.Bucket, strings.Trim(s3.Prefix, "/"), s3.Layout, s3.KeyTemplate, s3.Compression)
+	case "rclone":
+		target = fmt.Sprintf("rclone://%s:%s", c.Storage.Rclone.Remote, strings.Trim(c.Storage.Rclone.Path, "/"))
+	}
+	return target
+}
+
+// Device returns this machine's identity, creating it on first use.
+func (c Config) Device() (device.Identity, error) {
+	return device.Load(c.GetStateDir(), c.DeviceName)
+}
+
+func (c Conflicts) policy() string {
+	if c.Policy == "" {
+		return ConflictSkip
+	}
+	return c.Policy
+}
+
+// direction returns which way syncs move files.
+func (c Config) direction() Direction {
+	if c.Direction == "" {
+		return DirectionUpload
+	}
+	return c.Direction
+}
+
+// ttl returns how long trashed objects are kept.
+func (t Trash) ttl() time.Duration {
+	if t.TTL <= 0 {
+		return defaultTrashTTL
+	}
+	return t.TTL
+}
+
+// Backups returns the store of backups of overwritten local files.
+func (c Config) Backups() *backup.Store {
+	keep := c.Backup.Keep
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	return backup.NewStore(filepath.Join(c.GetStateDir(), "backup"), keep)
+}
+
+// DatIndex loads the configured DATs, or returns nil if there are none.
+func (c Config) DatIndex() (*dat.Index, error) {
+	if c.Dat.Folder == "" {
+		return nil, nil
+	}
+	idx, err := dat.LoadDir(c.Dat.Folder)
+	if err != nil {
+		return nil, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	return idx, nil
+}
+
+// LockFile returns the path of the lock held while a sync runs.
+func (c Config) LockFile() string {
+	return filepath.Join(c.GetStateDir(), "sync.lock")
+}
+
+// QueueFile is where uploads are journaled until they are stored.
+func (c Config) QueueFile() string {
+	return filepath.Join(c.GetStateDir(), "queue.json")
+}
+
+// DownloadsFile is where the version of each file downloaded from another
+// device is recorded.
+func (c Config) DownloadsFile() string {
+	return filepath.Join(c.GetStateDir(), "downloads.json")
+}
+
+// MirrorQueueFile is where files the mirrors failed to store are journaled
+// until the next sync retries them.
+func (c Config) MirrorQueueFile() string {
+	return filepath.Join(c.GetStateDir(), "mirror-queue.json")
+}
+
+// timeouts returns the storage timeouts of the named backend.
+func (c Config) timeouts(backend string) storage.TimeoutConfig {
+	switch backend {
+	case "s3":
+		return c.Storage.Timeouts.Override(c.Storage.S3.Timeouts)
+	case "rclone":
+		return c.Storage.Timeouts.Override(c.Storage.Rclone.Timeouts)
+	default:
+		return c.Storage.Timeouts
+	}
+}
+
+// mirrors names the enabled backends after the primary.
+func (c Config) mirrors() []string {
+	backends := c.Backends()
+	if len(backends) == 0 {
+		return nil
+	}
+	return backends[1:]
+}
+
+// Notifiers builds the configured notifiers.
+func (c Config) Notifiers() ([]notify.Notifier, error) {
+	notifiers := make([]notify.Notifier, 0, len(c.Notify.Webhooks))
+	for _, wc := range c.Notify.Webhooks {
+		n, err := notify.NewWebhook(wc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if c.Notify.Healthcheck.URL != "" {
+		n, err := notify.NewHealthcheck(c.Notify.Healthcheck)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if c.Notify.Email.Host != "" {
+		n, err := notify.NewEmail(c.Notify.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+// RomsDirectory scans the RomsFolder, applying the configured filters and
+// file types.
+func (c Config) RomsDirectory(ctx context.Context) (fs.Directory, error) {
+	return c.directory(ctx, c.RomsFolder)
+}
+
+// saveDirectories returns the directories saves and states are read from,
+// reusing romDir for those kept in the RomsFolder. Options apply to the
+// directories it opens.
+func (c Config) saveDirectories(ctx context.Context, romDir fs.Directory, opts ...fs.DirectoryOption) (saves, states fs.Directory, err error) {
+	saves = romDir
+	if c.Saves.Folder != "" {
+		saves, err = c.directory(ctx, c.Saves.Folder, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	states = saves
+	if c.Saves.StatesFolder != "" {
+		states, err = c.directory(ctx, c.Saves.StatesFolder, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return saves, states, nil
+}
+
+// directory scans folder, applying the configured filters and file types,
+// then opts.
+func (c Config) directory(ctx context.Context, folder string, opts ...fs.DirectoryOption) (fs.Directory, error) {
+	filter, err := c.filter()
+	if err != nil {
+		return nil, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	types, err := c.fileTypes()
+	if err != nil {
+		return nil, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	opts = append([]fs.DirectoryOption{fs.WithFilter(filter), fs.WithFileTypes(types), fs.WithScanWorkers(c.scanWorkers())}, opts...)
+	return fs.NewDirectory(ctx, folder, opts...)
+}
+
+func (l LargeFiles) threshold() int64 {
+	if l.Threshold <= 0 {
+		return defaultLargeFileThreshold
+	}
+	return l.Threshold
+}
+
+func (c Config) scanWorkers() int {
+	if c.ScanWorkers <= 0 {
+		return defaultScanWorkers
+	}
+	return c.ScanWorkers
+}
+
+// ConfigFiles returns the RetroArch configuration files to sync, with their
+// Dir mapped to where they are stored remotely. A missing folder has none.
+func (c Config) ConfigFiles(ctx context.Context) ([]*fs.File, error) {
+	folder := c.Configs.Folder
+	if folder == "" {
+		folder = defaultConfigsFolder
+	}
+	return folderFiles(ctx, folder, fs.ConfigFileTypes(), fs.Config, c.Configs.remoteDir)
+}
+
+// BiosFiles returns the BIOS files to sync, stored remotely under "bios/" by
+// their path relative to the BIOS folder. A missing folder has none.
+func (c Config) BiosFiles(ctx context.Context) ([]*fs.File, error) {
+	types := fs.BiosFileTypes()
+	if len(c.Bios.Extensions) > 0 {
+		types = fs.FileTypes{}
+		for _, ext := range c.Bios.Extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			types[ext] = fs.Bios
+		}
+	}
+	return folderFiles(ctx, c.Bios.folder(), types, fs.Bios, func(dir string) string {
+		return path.Join(biosRemoteDir, dir)
+	})
+}
+
+// ScreenshotFiles returns the screenshots in the configured screenshot
+// folder, stored remotely under "screenshots/".
+func (c Config) ScreenshotFiles(ctx context.Context) ([]*fs.File, error) {
+	if c.Screenshots.Folder == "" {
+		return nil, nil
+	}
+	return folderFiles(ctx, c.Screenshots.Folder, fs.DefaultFileTypes(), fs.Screenshot, func(dir string) string {
+		return path.Join(screenshotsRemoteDir, dir)
+	})
+}
+
+func (b Bios) folder() string {
+	if b.Folder != "" {
+		return b.Folder
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join("RetroPie", "BIOS")
+	}
+	return filepath.Join(home, "RetroPie", "BIOS")
+}
+
+// folderFiles returns the files of the given type in a folder outside the
+// RomsFolder, setting each file's Dir to remoteDir applied to its path
+// relative to the folder ("" for files directly under it).
+func folderFiles(ctx context.Context, folder string, types fs.FileTypes, fileType fs.FileType, remoteDir func(string) string) ([]*fs.File, error) {
+	_, err := os.Stat(folder)
+	if os.IsNotExist(err) {
+		log.FromCtx(ctx).Warn("Folder does not exist", zap.String("directory", folder))
+		return nil, nil
+	}
+	dir, err := fs.NewDirectory(ctx, folder, fs.WithFileTypes(types))
+	if err != nil {
+		return nil, err
+	}
+	files, err := dir.GetMatchingFiles(fileType)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		rel, err := filepath.Rel(folder, filepath.Dir(f.Absolute))
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to determine relative path of %s", f.Absolute)
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		f.Dir = remoteDir(rel)
+	}
+	return files, nil
+}
+
+// remoteDir maps a folder relative to the configs folder to where it is
+// stored, the longest matching entry of Paths winning.
+func (c Configs) remoteDir(dir string) string {
+	match, to := "", ""
+	for from, mapped := range c.Paths {
+		trimmed := strings.Trim(from, "/")
+		if (dir == trimmed || strings.HasPrefix(dir, trimmed+"/")) && len(trimmed) > len(match) {
+			match, to = trimmed, mapped
+		}
+	}
+	if match != "" {
+		dir = strings.Trim(to+strings.TrimPrefix(dir, match), "/")
+	}
+	return path.Join(configsRemoteDir, dir)
+}
+
+// localPath maps the remote path p to a local path, the longest matching
+// entry of Paths winning. Viper lowercases map keys, so entries match
+// regardless of case.
+func (r Restore) localPath(p string) (string, bool) {
+	match, to := "", ""
+	for from, mapped := range r.Paths {
+		trimmed := strings.Trim(from, "/")
+		if trimmed == "" || len(trimmed) <= len(match) {
+			continue
+		}
+		if strings.EqualFold(p, trimmed) || (len(p) > len(trimmed) && strings.EqualFold(p[:len(trimmed)+1], trimmed+"/")) {
+			match, to = trimmed, mapped
+		}
+	}
+	if match == "" {
+		return "", false
+	}
+	return filepath.Join(to, filepath.FromSlash(strings.TrimPrefix(p[len(match):], "/"))), true
+}
+
+func (c Config) fileTypes() (fs.FileTypes, error) {
+	types := fs.DefaultFileTypes()
+	if c.ReplaceDefaultFileTypes {
+		types = fs.FileTypes{}
+	}
+	for ext, name := range c.FileTypes {
+		ft, err := fs.ParseFileType(name)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid file type for extension %s", ext)
+		}
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		types[ext] = ft
+	}
+	return types, nil
+}
+
+// minIntervals parses Sync.MinInterval by file type.
+func (c Config) minIntervals() (map[fs.FileType]time.Duration, error) {
+	intervals := make(map[fs.FileType]time.Duration, len(c.Sync.MinInterval))
+	for name, interval := range c.Sync.MinInterval {
+		ft, err := fs.ParseFileType(name)
+		if err != nil {
+			return nil, eris.Wrap(err, "invalid file type in sync.minInterval")
+		}
+		if interval > 0 {
+			intervals[ft] = interval
+		}
+	}
+	return intervals, nil
+}
+
+// CreateExample writes an example configuration for the given layout
+// profile, if any, to outputDir, returning the path of the file it created.
+func CreateExample(outputDir, profile string) (string, error) {
+	if _, ok := profiles[profile]; profile != "" && !ok {
+		return "", errors.WithCategory(eris.Errorf("unknown profile %q; expected one of %s", profile, strings.Join(Profiles(), ", ")), errors.ConfigCategory)
+	}
 	err := os.MkdirAll(outputDir, os.ModePerm)
 	if err != nil {
-		return err
+		return "", err
 	}
 	filename := filepath.Join(outputDir, "config.example.yaml")
 	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer f.Close()
 	userHomeDir, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return "", err
+	}
+	example.Profile = profile
+	if profile == "" || profile == ProfileRetroPie {
+		example.RomsFolder = filepath.Join(userHomeDir, "RetroPie", "roms")
 	}
-	example.RomsFolder = filepath.Join(userHomeDir, "RetroPie", "roms")
 	yamlData, err := yaml.Marshal(&example)
 	if err != nil {
-		return err
+		return "", err
 	}
 	_, err = f.Write(yamlData)
 	if err != nil {
-		return err
+		return "", err
 	}
-	fmt.Printf("Created %s\n", filename)
-	return nil
+	return filename, nil
 }
 
 func ValidateConfig(configFile string) error {
@@ -94,9 +1020,104 @@ func ValidateConfig(configFile string) error {
 		return err
 	}
 
-	err = validate.Struct(config)
+	return config.Validate()
+}
+
+// Validate checks the config beyond what the struct tags describe: the filter
+// patterns must compile, the file types must be known, and the notifiers must
+// be buildable.
+func (c Config) Validate() error {
+	return errors.WithCategory(c.validate(), errors.ConfigCategory)
+}
+
+func (c Config) validate() error {
+	if validate == nil {
+		validate = validator.New()
+	}
+	err := validate.Struct(c)
 	if err != nil {
 		return err
 	}
+	_, err = c.filter()
+	if err != nil {
+		return err
+	}
+	_, err = c.fileTypes()
+	if err != nil {
+		return err
+	}
+	_, err = c.Budget.paused()
+	if err != nil {
+		return err
+	}
+	if c.Daemon.Schedule != "" {
+		_, err = cron.ParseStandard(c.Daemon.Schedule)
+		if err != nil {
+			return eris.Wrapf(err, "invalid daemon schedule %q", c.Daemon.Schedule)
+		}
+	}
+	_, err = c.Notifiers()
+	return err
+}
+
+// OnlySync limits the sync to the named file types ("roms", "saves",
+// "states", "configs", "bios", or "screenshots"), disabling the others.
+func (c *Config) OnlySync(types []string) error {
+	var only Sync
+	for _, t := range types {
+		switch strings.ToLower(strings.TrimSpace(t)) {
+		case "roms":
+			only.Roms = true
+		case "saves":
+			only.Saves = true
+		case "states":
+			only.States = true
+		case "configs":
+			only.Configs = true
+		case "bios":
+			only.Bios = true
+		case "screenshots":
+			only.Screenshots = true
+		default:
+			return errors.WithCategory(eris.Errorf("unknown sync type %q", t), errors.ConfigCategory)
+		}
+	}
+	c.Sync = only
 	return nil
 }
+
+func (c Config) filter() (*fs.Filter, error) {
+	filter, err := fs.NewFilter(c.Filters.Include, c.Filters.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Within(c.Systems...), nil
+}
+
+// Syncs reports whether the file at relPath, relative to the RomsFolder,
+// would be picked up by a sync with this config.
+func (c Config) Syncs(relPath string) bool {
+	filter, err := c.filter()
+	if err != nil {
+		return false
+	}
+	if !filter.Match(filepath.ToSlash(relPath)) {
+		return false
+	}
+	types, err := c.fileTypes()
+	if err != nil {
+		return false
+	}
+	switch types.TypeOf(filepath.Base(relPath)) {
+	case fs.Rom:
+		return c.Sync.Roms
+	case fs.Save:
+		return c.Sync.Saves
+	case fs.State:
+		return c.Sync.States
+	case fs.Screenshot:
+		return c.Sync.Screenshots
+	default:
+		return false
+	}
+}
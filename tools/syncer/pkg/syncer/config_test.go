@@ -0,0 +1,226 @@
+package syncer_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Config", func() {
+	Context("holding credentials", func() {
+		var (
+			cfg         syncer.Config
+			credentials []string
+		)
+
+		BeforeEach(func() {
+			credentials = []string{
+				"AKIAEXAMPLEKEYID",
+				"s3-secret-access-key",
+				"sftp-password",
+				"smtp-password",
+				"manifest-signing-key",
+				"T000/B000/slack-token",
+				"discord-webhook-token",
+				"healthcheck-uuid",
+			}
+			cfg = syncer.Config{RomsFolder: "/home/pi/RetroPie/roms"}
+			cfg.Storage.S3.Enabled = true
+			cfg.Storage.S3.Bucket = "retropie-sync"
+			cfg.Storage.S3.AccessKeyID = secret.Secret{Value: credentials[0]}
+			cfg.Storage.S3.SecretAccessKey = secret.Secret{Value: credentials[1]}
+			cfg.Storage.SFTP.Password = secret.Secret{Value: credentials[2]}
+			cfg.Notify.Email.Host = "smtp.example.com"
+			cfg.Notify.Email.Password = secret.Secret{Value: credentials[3]}
+			cfg.Manifest.SigningKey = secret.Secret{Value: credentials[4]}
+			cfg.Notify.Webhooks = []notify.WebhookConfig{
+				{URL: "https://hooks.slack.com/services/" + credentials[5], Format: "slack"},
+				{URL: "https://discord.com/api/webhooks/1234/" + credentials[6] + "?wait=true", Format: "discord"},
+			}
+			cfg.Notify.Healthcheck.URL = "https://hc-ping.com/" + credentials[7]
+		})
+
+		It("leaves them out when marshaled", func() {
+			b, err := yaml.Marshal(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			for _, c := range credentials {
+				Expect(string(b)).NotTo(ContainSubstring(c))
+			}
+			// What isn't secret is still shown.
+			Expect(string(b)).To(ContainSubstring("retropie-sync"))
+			Expect(string(b)).To(ContainSubstring("https://hooks.slack.com/[redacted]"))
+			Expect(string(b)).To(ContainSubstring("https://hc-ping.com/[redacted]"))
+		})
+
+		It("leaves them out of the summary", func() {
+			enc := zapcore.NewMapObjectEncoder()
+			for _, f := range cfg.SummaryFields() {
+				f.AddTo(enc)
+			}
+			summary := fmt.Sprint(enc.Fields)
+			for _, c := range credentials {
+				Expect(summary).NotTo(ContainSubstring(c))
+			}
+			Expect(enc.Fields).To(HaveKeyWithValue("bucket", "retropie-sync"))
+			Expect(enc.Fields).To(HaveKeyWithValue("romsFolder", "/home/pi/RetroPie/roms"))
+		})
+	})
+
+	Context("with named profiles", func() {
+		const base = `
+romsFolder: /home/pi/RetroPie/roms
+stateDir: /var/lib/syncer
+storage:
+  s3:
+    enabled: true
+    bucket: retropie-sync
+    prefix: retropie
+profiles:
+  travel:
+    storage:
+      s3:
+        bucket: travel-sync
+  handheld:
+    stateDir: /var/lib/handheld
+    romsFolder: /mnt/sd/roms
+`
+
+		load := func(active string) (syncer.Config, error) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			Expect(v.ReadConfig(strings.NewReader(base))).To(Succeed())
+			v.Set("activeProfile", active)
+			return syncer.LoadConfig(v)
+		}
+
+		It("merges the profile's nested settings key by key", func() {
+			cfg, err := load("travel")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Storage.S3.Enabled).To(BeTrue())
+			Expect(cfg.Storage.S3.Bucket).To(Equal("travel-sync"))
+			Expect(cfg.Storage.S3.Prefix).To(Equal("retropie"))
+			Expect(cfg.RomsFolder).To(Equal("/home/pi/RetroPie/roms"))
+		})
+
+		It("keeps the state of a profile apart unless it sets its own", func() {
+			cfg, err := load("travel")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.StateDir).To(Equal(filepath.Join("/var/lib/syncer", "profiles", "travel")))
+
+			cfg, err = load("handheld")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.StateDir).To(Equal("/var/lib/handheld"))
+			Expect(cfg.RomsFolder).To(Equal("/mnt/sd/roms"))
+		})
+
+		It("uses the settings as they are without an active profile", func() {
+			cfg, err := load("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.StateDir).To(Equal("/var/lib/syncer"))
+			Expect(cfg.Storage.S3.Bucket).To(Equal("retropie-sync"))
+		})
+
+		It("rejects an unknown profile, listing those defined", func() {
+			_, err := load("office")
+			Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+			Expect(err).To(MatchError(ContainSubstring(`unknown profile "office"; the config defines handheld, travel`)))
+		})
+	})
+
+	Context("with a layout profile", func() {
+		var (
+			home string
+			v    *viper.Viper
+		)
+
+		BeforeEach(func() {
+			home = GinkgoT().TempDir()
+			GinkgoT().Setenv("HOME", home)
+			v = viper.New()
+		})
+
+		// folders returns the folders the config syncs, by setting.
+		folders := func(cfg syncer.Config) map[string]string {
+			return map[string]string{
+				"romsFolder":         cfg.RomsFolder,
+				"saves.folder":       cfg.Saves.Folder,
+				"saves.statesFolder": cfg.Saves.StatesFolder,
+				"configs.folder":     cfg.Configs.Folder,
+				"bios.folder":        cfg.Bios.Folder,
+				"screenshots.folder": cfg.Screenshots.Folder,
+			}
+		}
+
+		DescribeTable("fills in every folder it knows", func(profile string, expected map[string]string) {
+			v.Set("profile", profile)
+			cfg, err := syncer.LoadConfig(v)
+			Expect(err).NotTo(HaveOccurred())
+			for k, p := range expected {
+				expected[k] = strings.Replace(p, "~", home, 1)
+			}
+			Expect(folders(cfg)).To(Equal(expected))
+		},
+			Entry("RetroPie, with saves and states beside the games", syncer.ProfileRetroPie, map[string]string{
+				"romsFolder":         "~/RetroPie/roms",
+				"saves.folder":       "",
+				"saves.statesFolder": "",
+				"configs.folder":     "/opt/retropie/configs",
+				"bios.folder":        "~/RetroPie/BIOS",
+				"screenshots.folder": "",
+			}),
+			Entry("Batocera", syncer.ProfileBatocera, map[string]string{
+				"romsFolder":         "/userdata/roms",
+				"saves.folder":       "/userdata/saves",
+				"saves.statesFolder": "",
+				"configs.folder":     "/userdata/system/configs",
+				"bios.folder":        "/userdata/bios",
+				"screenshots.folder": "/userdata/screenshots",
+			}),
+			Entry("Recalbox", syncer.ProfileRecalbox, map[string]string{
+				"romsFolder":         "/recalbox/share/roms",
+				"saves.folder":       "/recalbox/share/saves",
+				"saves.statesFolder": "",
+				"configs.folder":     "/recalbox/share/system/configs",
+				"bios.folder":        "/recalbox/share/bios",
+				"screenshots.folder": "/recalbox/share/screenshots",
+			}),
+			Entry("Lakka, with states apart from saves", syncer.ProfileLakka, map[string]string{
+				"romsFolder":         "/storage/roms",
+				"saves.folder":       "/storage/savefiles",
+				"saves.statesFolder": "/storage/savestates",
+				"configs.folder":     "/storage/.config/retroarch/config",
+				"bios.folder":        "/storage/system",
+				"screenshots.folder": "/storage/screenshots",
+			}),
+		)
+
+		It("keeps the folders the config sets", func() {
+			v.Set("profile", "Batocera")
+			v.Set("romsFolder", "/media/usb/roms")
+			v.Set("bios.folder", "/media/usb/bios")
+			cfg, err := syncer.LoadConfig(v)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.RomsFolder).To(Equal("/media/usb/roms"))
+			Expect(cfg.Bios.Folder).To(Equal("/media/usb/bios"))
+			Expect(cfg.Saves.Folder).To(Equal("/userdata/saves"))
+		})
+
+		It("rejects an unknown profile", func() {
+			v.Set("profile", "emudeck")
+			_, err := syncer.LoadConfig(v)
+			Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+			Expect(err).To(MatchError(ContainSubstring(`unknown profile "emudeck"; expected one of batocera, lakka, recalbox, retropie`)))
+		})
+	})
+})
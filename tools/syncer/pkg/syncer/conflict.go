@@ -0,0 +1,120 @@
+package syncer
+
+import (
+	"context"
+	"path"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/cache"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+const (
+	// ConflictSkip leaves conflicting files un-uploaded. It is the default.
+	ConflictSkip = "skip"
+	// ConflictFail stops the sync at the first conflict.
+	ConflictFail = "fail"
+	// ConflictOverwrite uploads conflicting files anyway, after warning.
+	ConflictOverwrite = "overwrite"
+)
+
+// conflict describes a file whose latest upload came from another device,
+// which this device never had, and differs from the local copy: uploading it
+// would bury that device's progress under this one's. A file this device
+// downloaded and then changed is no conflict; it carries on from that upload.
+type conflict struct {
+	path  string
+	other string
+}
+
+// resolveConflicts applies the configured conflict policy to the sets,
+// returning the sets that should be uploaded. A set is held back as a whole
+// if any of its files conflicts. Conflicts can only be seen when the devices
+// share a metadata store.
+func (s *syncer) resolveConflicts(ctx context.Context, run *history.Run, sets []*fs.FileSet) ([]*fs.FileSet, error) {
+	if s.metadata == nil {
+		return sets, nil
+	}
+	resolved := make([]*fs.FileSet, 0, len(sets))
+	for _, set := range sets {
+		conflicts, err := s.conflicts(ctx, set)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) == 0 {
+			resolved = append(resolved, set)
+			continue
+		}
+		for _, c := range conflicts {
+			run.Conflicts = append(run.Conflicts, c.path)
+			log.FromCtx(ctx).Warn("File was last uploaded from another device and has changed since",
+				zap.String("file", c.path),
+				zap.String("otherDevice", c.other),
+				zap.String("policy", s.cfg.Conflicts.policy()),
+			)
+		}
+		switch s.cfg.Conflicts.policy() {
+		case ConflictFail:
+			c := conflicts[0]
+			return nil, errors.WithCategory(
+				eris.Errorf("%s was last uploaded from %s and has changed since", c.path, c.other),
+				errors.ConflictCategory,
+			)
+		case ConflictOverwrite:
+			resolved = append(resolved, set)
+		default:
+			run.Skip("changed on another device", paths(set.Files())...)
+		}
+	}
+	return resolved, nil
+}
+
+// conflicts returns the files of the set that conflict with another device's
+// upload.
+func (s *syncer) conflicts(ctx context.Context, set *fs.FileSet) ([]conflict, error) {
+	conflicts := make([]conflict, 0)
+	for _, f := range set.Files() {
+		p := path.Join(f.Dir, f.Name)
+		latest, ok := s.latest[fs.PathID(p)]
+		if !ok || latest.DeviceID == "" || latest.DeviceID == s.device.ID {
+			continue
+		}
+		sum, err := f.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		if sum == latest.SHA256 || s.seen(f.Absolute, latest) {
+			// This device has, or had, the other device's version.
+			continue
+		}
+		other := latest.DeviceName
+		if other == "" {
+			other = latest.DeviceID
+		}
+		conflicts = append(conflicts, conflict{path: p, other: other})
+	}
+	return conflicts, nil
+}
+
+// seen reports whether this device has had the upload md of the file at
+// abs, because it downloaded it or last synced it with that content.
+func (s *syncer) seen(abs string, md metadata.FileMetadata) bool {
+	if md.SHA256 == "" {
+		return false
+	}
+	for _, c := range []*cache.Cache{s.downloads, s.cache} {
+		if c == nil {
+			continue
+		}
+		entry, ok := c.Get(abs)
+		if ok && entry.SHA256 == md.SHA256 && entry.UploadedAt.Equal(md.UploadedAt) {
+			return true
+		}
+	}
+	return false
+}
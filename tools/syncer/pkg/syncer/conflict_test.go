@@ -0,0 +1,164 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Conflicts", func() {
+	var (
+		ctx      context.Context
+		dir      string
+		remote   *storagetest.Fake
+		metadata string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir = GinkgoT().TempDir()
+		remote = storagetest.NewFake()
+		metadata = filepath.Join(dir, "metadata.db")
+	})
+
+	// device returns the config of a device whose saves are in its own
+	// folder, sharing the remote and metadata store with the others.
+	device := func(name string) syncer.Config {
+		cfg := syncer.Config{
+			RomsFolder: filepath.Join(dir, name, "roms"),
+			StateDir:   filepath.Join(dir, name, "state"),
+			DeviceName: name,
+			Direction:  "both",
+		}
+		cfg.Sync.Saves = true
+		cfg.Metadata.Path = metadata
+		Expect(os.MkdirAll(cfg.RomsFolder, os.ModePerm)).To(Succeed())
+		return cfg
+	}
+
+	// save writes a save on the device, modified at the given time.
+	save := func(cfg syncer.Config, content string, modified time.Time) string {
+		p := filepath.Join(cfg.RomsFolder, "snes", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		Expect(os.Chtimes(p, modified, modified)).To(Succeed())
+		return p
+	}
+
+	sync := func(cfg syncer.Config) (history.Run, error) {
+		s, err := syncer.NewSyncerWithStorage(cfg, remote)
+		Expect(err).NotTo(HaveOccurred())
+		return s.Sync(ctx)
+	}
+
+	// uploaded returns the content of the latest upload of the save.
+	uploaded := func() string {
+		objects, err := remote.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).NotTo(BeEmpty())
+		latest := objects[0]
+		for _, o := range objects {
+			if o.LastModified.After(latest.LastModified) {
+				latest = o
+			}
+		}
+		content, err := remote.Content(latest.Key)
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	start := time.Now().Add(-time.Hour)
+
+	Context("with a save this device never had", func() {
+		var a syncer.Config
+
+		BeforeEach(func() {
+			b := device("b")
+			save(b, "b's progress", start)
+			_, err := sync(b)
+			Expect(err).NotTo(HaveOccurred())
+
+			a = device("a")
+			a.Direction = "upload"
+			save(a, "a's progress", start.Add(time.Minute))
+		})
+
+		It("skips it by default", func() {
+			run, err := sync(a)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run.Conflicts).To(ConsistOf("snes/Game.srm"))
+			Expect(run.FilesUploaded).To(Equal(0))
+			Expect(uploaded()).To(Equal("b's progress"))
+		})
+
+		It("fails the sync with the fail policy", func() {
+			a.Conflicts.Policy = syncer.ConflictFail
+			run, err := sync(a)
+			Expect(errors.CategoryOf(err)).To(Equal(errors.ConflictCategory))
+			Expect(run.Conflicts).To(ConsistOf("snes/Game.srm"))
+			Expect(uploaded()).To(Equal("b's progress"))
+		})
+
+		It("uploads it with the overwrite policy", func() {
+			a.Conflicts.Policy = syncer.ConflictOverwrite
+			run, err := sync(a)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run.Conflicts).To(ConsistOf("snes/Game.srm"))
+			Expect(run.FilesUploaded).To(Equal(1))
+			Expect(uploaded()).To(Equal("a's progress"))
+		})
+	})
+
+	DescribeTable("uploads a save downloaded from another device and changed since", func(cached bool) {
+		b := device("b")
+		save(b, "b's progress", start)
+		_, err := sync(b)
+		Expect(err).NotTo(HaveOccurred())
+
+		a := device("a")
+		a.Cache.Enabled = cached
+		run, err := sync(a)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.FilesDownloaded).To(Equal(1))
+
+		save(a, "a's progress", time.Now())
+		run, err = sync(a)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.Conflicts).To(BeEmpty())
+		Expect(run.FilesUploaded).To(Equal(1))
+		Expect(uploaded()).To(Equal("a's progress"))
+	},
+		Entry("without the sync cache", false),
+		Entry("with the sync cache", true),
+	)
+
+	It("uploads a save another device downloaded and changed since", func() {
+		b := device("b")
+		save(b, "b's progress", start)
+		_, err := sync(b)
+		Expect(err).NotTo(HaveOccurred())
+		a := device("a")
+		_, err = sync(a)
+		Expect(err).NotTo(HaveOccurred())
+		save(a, "a's progress", start.Add(time.Minute))
+		_, err = sync(a)
+		Expect(err).NotTo(HaveOccurred())
+
+		run, err := sync(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.Conflicts).To(BeEmpty())
+		Expect(run.FilesDownloaded).To(Equal(1))
+		content, err := os.ReadFile(filepath.Join(b.RomsFolder, "snes", "Game.srm"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("a's progress"))
+	})
+})
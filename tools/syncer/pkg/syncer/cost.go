@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/cost"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+)
+
+// costWindow is how much sync history the upload rate is measured over.
+const costWindow = 30 * 24 * time.Hour
+
+// CostReport estimates a month of storing the library on each tier.
+// SyncsPerMonth is how often the library is synced, measured from the sync
+// history unless given; FromHistory is unset when there is no history to
+// measure how much each sync uploads, in which case only the library itself
+// is costed.
+type CostReport struct {
+	Files         int             `json:"files"`
+	Usage         cost.Usage      `json:"usage"`
+	SyncsPerMonth float64         `json:"syncsPerMonth"`
+	FromHistory   bool            `json:"fromHistory"`
+	Estimates     []cost.Estimate `json:"estimates"`
+}
+
+// EstimateCost estimates the monthly cost of the files a sync would pick up
+// on the given tiers, assuming each sync uploads what recent syncs did on
+// average. A syncsPerMonth of zero or less uses the rate in the history.
+func EstimateCost(ctx context.Context, cfg Config, tiers []cost.Tier, syncsPerMonth float64) (CostReport, error) {
+	files, err := cfg.syncedFiles(ctx)
+	if err != nil {
+		return CostReport{}, err
+	}
+	report := CostReport{
+		Files: len(files),
+		Usage: cost.Usage{StoredBytes: totalSize(files)},
+	}
+
+	runs, err := history.NewJournal(cfg.HistoryFile()).List(0)
+	if err != nil {
+		return CostReport{}, err
+	}
+	rate, bytesPerSync, uploadsPerSync := syncRate(runs, clock.Now(ctx))
+	if syncsPerMonth <= 0 {
+		syncsPerMonth = rate
+	}
+	report.SyncsPerMonth = syncsPerMonth
+	report.FromHistory = rate > 0
+	report.Usage.MonthlyUploadBytes = int64(bytesPerSync * syncsPerMonth)
+	report.Usage.MonthlyUploads = int(uploadsPerSync * syncsPerMonth)
+
+	report.Estimates = make([]cost.Estimate, 0, len(tiers))
+	for _, tier := range tiers {
+		report.Estimates = append(report.Estimates, tier.Estimate(report.Usage))
+	}
+	return report, nil
+}
+
+// syncRate measures, over the runs of the last costWindow, how many syncs
+// run a month and what each uploads on average. A history younger than the
+// window is extrapolated to a month.
+func syncRate(runs []history.Run, now time.Time) (perMonth, bytesPerSync, uploadsPerSync float64) {
+	if len(runs) == 0 {
+		return 0, 0, 0
+	}
+	since := now.Add(-costWindow)
+	// runs are newest first.
+	if oldest := runs[len(runs)-1].StartedAt; oldest.After(since) {
+		since = oldest
+	}
+	var n int
+	var bytes, uploads int64
+	for _, run := range runs {
+		if run.StartedAt.Before(since) {
+			break
+		}
+		n++
+		bytes += run.BytesUploaded
+		uploads += int64(run.FilesUploaded)
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	window := now.Sub(since)
+	if window < 24*time.Hour {
+		window = 24 * time.Hour
+	}
+	perMonth = float64(n) * float64(costWindow) / float64(window)
+	return perMonth, float64(bytes) / float64(n), float64(uploads) / float64(n)
+}
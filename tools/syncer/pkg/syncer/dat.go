@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"context"
+	"path"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+// DatResult is the outcome of verifying one ROM against the DATs.
+type DatResult struct {
+	Path string `json:"path"`
+	dat.Result
+}
+
+// VerifyDats verifies every ROM in the RomsFolder against the configured DATs.
+func VerifyDats(ctx context.Context, cfg Config) ([]DatResult, error) {
+	idx, err := cfg.DatIndex()
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return nil, errors.WithCategory(eris.New("no DAT folder configured; set dat.folder"), errors.ConfigCategory)
+	}
+	romDir, err := cfg.RomsDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roms, err := romDir.GetMatchingFiles(fs.Rom)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]DatResult, 0, len(roms))
+	for _, f := range roms {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		sum, err := dat.SHA1File(f.Absolute)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, DatResult{
+			Path:   path.Join(f.Dir, f.Name),
+			Result: idx.Verify(f.Name, sum),
+		})
+	}
+	return results, nil
+}
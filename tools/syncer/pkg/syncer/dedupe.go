@@ -0,0 +1,138 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/library"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type DedupeAction string
+
+const (
+	// DedupeReport only reports duplicates.
+	DedupeReport DedupeAction = ""
+	// DedupeDelete deletes every copy but one.
+	DedupeDelete DedupeAction = "delete"
+	// DedupeHardlink replaces every copy but one with a hard link to it.
+	DedupeHardlink DedupeAction = "hardlink"
+)
+
+// DedupeResult is a set of byte-identical ROMs and what was done about it.
+// Kept is the copy every other is resolved against. Skipped lists copies
+// left alone: tracks a cue sheet refers to are never deleted, copies
+// already hard linked to Kept need nothing done, and copies that only hold
+// the same contents, such as a zip of a loose ROM, are never hard linked.
+type DedupeResult struct {
+	library.Duplicate
+	Kept    string   `json:"kept"`
+	Changed []string `json:"changed,omitempty"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Dedupe finds byte-identical ROMs in the RomsFolder and resolves them with
+// the action, keeping the first copy by path. With contents set, zip
+// archives are compared by what they hold, so a zipped ROM is a duplicate
+// of a loose copy.
+func Dedupe(ctx context.Context, cfg Config, action DedupeAction, contents bool) ([]DedupeResult, error) {
+	romDir, err := cfg.RomsDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roms, err := romDir.GetMatchingFiles(fs.Rom)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*fs.File, len(roms))
+	for _, f := range roms {
+		byPath[path.Join(f.Dir, f.Name)] = f
+	}
+	find := library.FindDuplicates
+	if contents {
+		find = library.FindContentDuplicates
+	}
+	duplicates, err := find(roms)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DedupeResult, 0, len(duplicates))
+	for _, d := range duplicates {
+		result := DedupeResult{Duplicate: d, Kept: d.Paths[0]}
+		if action == DedupeReport {
+			results = append(results, result)
+			continue
+		}
+		keep := byPath[result.Kept]
+		for _, p := range d.Paths[1:] {
+			dup := byPath[p]
+			skip, err := skipDuplicate(action, keep, dup)
+			if err != nil {
+				return results, err
+			}
+			if skip {
+				result.Skipped = append(result.Skipped, p)
+				continue
+			}
+			switch action {
+			case DedupeDelete:
+				err = os.Remove(dup.Absolute)
+				if err != nil {
+					return results, eris.Wrapf(err, "failed to delete %s", dup.Absolute)
+				}
+			case DedupeHardlink:
+				err = library.Hardlink(keep.Absolute, dup.Absolute)
+				if err != nil {
+					return results, err
+				}
+			default:
+				return results, eris.Errorf("unknown dedupe action %q", action)
+			}
+			log.FromCtx(ctx).Info("Resolved duplicate",
+				zap.String("file", dup.Absolute),
+				zap.String("kept", keep.Absolute),
+				zap.String("action", string(action)),
+			)
+			result.Changed = append(result.Changed, p)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// skipDuplicate reports whether dup should be left alone.
+func skipDuplicate(action DedupeAction, keep, dup *fs.File) (bool, error) {
+	if action == DedupeDelete && dup.Parent != "" {
+		// A cue sheet or playlist refers to it by name.
+		return true, nil
+	}
+	keepInfo, err := os.Stat(keep.Absolute)
+	if err != nil {
+		return false, eris.Wrapf(err, "failed to stat %s", keep.Absolute)
+	}
+	dupInfo, err := os.Stat(dup.Absolute)
+	if err != nil {
+		return false, eris.Wrapf(err, "failed to stat %s", dup.Absolute)
+	}
+	if os.SameFile(keepInfo, dupInfo) {
+		return action == DedupeHardlink, nil
+	}
+	if action == DedupeHardlink {
+		// Only the contents may match, e.g. a zip and a loose copy.
+		keepSum, err := keep.Checksum()
+		if err != nil {
+			return false, err
+		}
+		dupSum, err := dup.Checksum()
+		if err != nil {
+			return false, err
+		}
+		return keepSum != dupSum, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/rotisserie/eris"
+)
+
+type (
+	DiffStatus string
+
+	// DiffEntry compares one file with its latest upload. Local and Remote
+	// are the modification times of the local file and of the file when it
+	// was uploaded, zero when there is none, and LocalSize and RemoteSize
+	// their sizes. Device names the device that made the upload.
+	DiffEntry struct {
+		Path       string     `json:"path"`
+		Status     DiffStatus `json:"status"`
+		Local      time.Time  `json:"local"`
+		Remote     time.Time  `json:"remote"`
+		LocalSize  int64      `json:"localSize,omitempty"`
+		RemoteSize int64      `json:"remoteSize,omitempty"`
+		Device     string     `json:"device,omitempty"`
+	}
+
+	DiffReport struct {
+		Entries []DiffEntry `json:"entries"`
+	}
+)
+
+const (
+	// DiffIdentical means the local file matches its latest upload.
+	DiffIdentical DiffStatus = "identical"
+	// DiffLocalNewer means the local file changed since its latest upload;
+	// the next sync will upload it.
+	DiffLocalNewer DiffStatus = "local-newer"
+	// DiffRemoteNewer means the latest upload, from this or another device
+	// sharing the metadata store, is newer than the local file.
+	DiffRemoteNewer DiffStatus = "remote-newer"
+	// DiffLocalOnly means the file has never been uploaded.
+	DiffLocalOnly DiffStatus = "local-only"
+	// DiffRemoteOnly means the file was uploaded but is not here.
+	DiffRemoteOnly DiffStatus = "remote-only"
+)
+
+// Count returns the number of files with the given status.
+func (r DiffReport) Count(status DiffStatus) int {
+	n := 0
+	for _, entry := range r.Entries {
+		if entry.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Diff compares every file a sync would pick up with its latest upload
+// recorded in the metadata store, by checksum, and lists the uploads of
+// files covered by the config that are missing locally. The storage backend
+// is not contacted.
+func Diff(ctx context.Context, cfg Config) (DiffReport, error) {
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return DiffReport{}, err
+	}
+	if store == nil {
+		return DiffReport{}, errors.WithCategory(eris.New("diff requires the metadata store; metadata.backend is none"), errors.ConfigCategory)
+	}
+	defer store.Close()
+
+	files, err := cfg.syncedFiles(ctx)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	latest, err := latestUploads(ctx, store)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	report := DiffReport{Entries: make([]DiffEntry, 0, len(files))}
+	local := make(map[string]bool, len(files))
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		entry := DiffEntry{Path: path.Join(f.Dir, f.Name), Local: f.LastModified, LocalSize: fileSize(f)}
+		local[fs.PathID(entry.Path)] = true
+		md, ok := latest[fs.PathID(entry.Path)]
+		if !ok {
+			entry.Status = DiffLocalOnly
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+		entry.Remote = md.LastModified
+		entry.RemoteSize = md.Size
+		entry.Device = md.DeviceName
+		// Files of a different size can't be identical, so they needn't
+		// be read. Older uploads may not have recorded a size.
+		sum := ""
+		if md.Size == 0 || md.Size == entry.LocalSize {
+			sum, err = f.Checksum()
+			if err != nil {
+				return report, err
+			}
+		}
+		switch {
+		case sum == md.SHA256:
+			entry.Status = DiffIdentical
+		case md.LastModified.After(f.LastModified):
+			entry.Status = DiffRemoteNewer
+		default:
+			entry.Status = DiffLocalNewer
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	for id, md := range latest {
+		if local[id] || !cfg.covers(md.Path) {
+			continue
+		}
+		report.Entries = append(report.Entries, DiffEntry{
+			Path:       md.Path,
+			Status:     DiffRemoteOnly,
+			Remote:     md.LastModified,
+			RemoteSize: md.Size,
+			Device:     md.DeviceName,
+		})
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		return report.Entries[i].Path < report.Entries[j].Path
+	})
+	return report, nil
+}
+
+// covers reports whether a sync with this config would pick up the file
+// recorded at p, were it here.
+func (c Config) covers(p string) bool {
+	top, _, _ := strings.Cut(p, "/")
+	switch top {
+	case configsRemoteDir:
+		return c.Sync.Configs
+	case biosRemoteDir:
+		return c.Sync.Bios
+	case screenshotsRemoteDir:
+		if c.Screenshots.Folder != "" {
+			return c.Sync.Screenshots
+		}
+	}
+	return c.Syncs(p)
+}
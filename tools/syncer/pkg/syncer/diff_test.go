@@ -0,0 +1,90 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Diff", func() {
+	var (
+		ctx context.Context
+		cfg syncer.Config
+	)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	write := func(rel, content string, modified time.Time) {
+		p := filepath.Join(cfg.RomsFolder, rel)
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		Expect(os.Chtimes(p, modified, modified)).To(Succeed())
+	}
+
+	statuses := func() map[string]syncer.DiffStatus {
+		report, err := syncer.Diff(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		found := make(map[string]syncer.DiffStatus, len(report.Entries))
+		for _, entry := range report.Entries {
+			found[entry.Path] = entry.Status
+		}
+		return found
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir := GinkgoT().TempDir()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+			DeviceName: "pi",
+		}
+		cfg.Sync.Saves = true
+		cfg.Sync.States = true
+		cfg.Metadata.Path = filepath.Join(dir, "metadata.db")
+
+		write("snes/Same.srm", "same", start)
+		write("snes/Ahead.srm", "ahead", start)
+		write("snes/Behind.srm", "behind", start)
+		write("snes/Gone.srm", "gone", start)
+		write("snes/Game.state", "state", start)
+		s, err := syncer.NewSyncerWithStorage(cfg, storagetest.NewFake())
+		Expect(err).NotTo(HaveOccurred())
+		run, err := s.Sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.FilesUploaded).To(Equal(5))
+
+		write("snes/Ahead.srm", "ahead, further", start.Add(time.Minute))
+		write("snes/Behind.srm", "behind, further", start.Add(-time.Minute))
+		Expect(os.Remove(filepath.Join(cfg.RomsFolder, "snes", "Gone.srm"))).To(Succeed())
+		Expect(os.Remove(filepath.Join(cfg.RomsFolder, "snes", "Game.state"))).To(Succeed())
+		write("snes/New.srm", "new", start)
+	})
+
+	It("compares each file with its latest upload", func() {
+		Expect(statuses()).To(Equal(map[string]syncer.DiffStatus{
+			"snes/Same.srm":   syncer.DiffIdentical,
+			"snes/Ahead.srm":  syncer.DiffLocalNewer,
+			"snes/Behind.srm": syncer.DiffRemoteNewer,
+			"snes/Gone.srm":   syncer.DiffRemoteOnly,
+			"snes/Game.state": syncer.DiffRemoteOnly,
+			"snes/New.srm":    syncer.DiffLocalOnly,
+		}))
+	})
+
+	It("leaves out uploads the config doesn't sync", func() {
+		cfg.Sync.States = false
+		Expect(statuses()).NotTo(HaveKey("snes/Game.state"))
+		Expect(statuses()).To(HaveKeyWithValue("snes/Gone.srm", syncer.DiffRemoteOnly))
+
+		cfg.Systems = []string{"gba"}
+		Expect(statuses()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,180 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+
+	// S3 rejects requests signed more than 15 minutes from its own clock.
+	maxClockSkew  = 15 * time.Minute
+	warnClockSkew = time.Minute
+
+	minFreeSpace uint64 = 1024 * 1024 * 1024
+)
+
+type (
+	// Check is the result of one diagnostic. Hint suggests how to fix a
+	// warning or failure.
+	Check struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Detail string `json:"detail"`
+		Hint   string `json:"hint,omitempty"`
+	}
+)
+
+// Doctor diagnoses the environment the syncer runs in: the config, the
+// RomsFolder and state directory, and the storage backend. It never modifies
+// the remote storage.
+func Doctor(ctx context.Context, cfg Config) []Check {
+	checks := []Check{checkConfig(cfg)}
+	checks = append(checks, checkDir("romsFolder", cfg.RomsFolder)...)
+	if cfg.Mount.MarkerFile != "" && cfg.RomsFolder != "" {
+		checks = append(checks, checkMarker(cfg))
+	}
+	checks = append(checks, checkDir("stateDir", cfg.GetStateDir())...)
+	checks = append(checks, checkStorage(ctx, cfg)...)
+	return checks
+}
+
+// Healthy reports whether none of the checks failed.
+func Healthy(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+func checkConfig(cfg Config) Check {
+	err := cfg.Validate()
+	if err != nil {
+		return Check{Name: "config", Status: CheckFail, Detail: err.Error(), Hint: "fix the config file, or run 'syncer config init' for an example"}
+	}
+	if cfg.RomsFolder == "" {
+		return Check{Name: "config", Status: CheckFail, Detail: "romsFolder is not set", Hint: "set romsFolder, e.g. $HOME/RetroPie/roms"}
+	}
+	return Check{Name: "config", Status: CheckPass, Detail: "valid"}
+}
+
+// checkMarker checks the RomsFolder's marker file exists.
+func checkMarker(cfg Config) Check {
+	err := cfg.checkMounted()
+	if err != nil {
+		return Check{Name: "mount", Status: CheckFail, Detail: err.Error(), Hint: fmt.Sprintf("mount the drive holding %s, or create %s on it", cfg.RomsFolder, cfg.Mount.MarkerFile)}
+	}
+	return Check{Name: "mount", Status: CheckPass, Detail: fmt.Sprintf("%s is mounted", cfg.RomsFolder)}
+}
+
+// checkDir checks the directory can be listed and written to, and that its
+// filesystem has room for restores and temporary files.
+func checkDir(name, dir string) []Check {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) && name == "stateDir" {
+		return []Check{{Name: name, Status: CheckPass, Detail: fmt.Sprintf("%s will be created on first use", dir)}}
+	}
+	if err != nil {
+		return []Check{{Name: name, Status: CheckFail, Detail: err.Error(), Hint: fmt.Sprintf("create %s or fix %s in the config", dir, name)}}
+	}
+	if !info.IsDir() {
+		return []Check{{Name: name, Status: CheckFail, Detail: fmt.Sprintf("%s is not a directory", dir)}}
+	}
+
+	checks := make([]Check, 0, 2)
+	_, err = os.ReadDir(dir)
+	if err != nil {
+		checks = append(checks, Check{Name: name, Status: CheckFail, Detail: err.Error(), Hint: fmt.Sprintf("grant the syncer's user read access to %s", dir)})
+	} else if err = probeWrite(dir); err != nil {
+		checks = append(checks, Check{Name: name, Status: CheckWarn, Detail: fmt.Sprintf("%s is not writable: %s", dir, err), Hint: fmt.Sprintf("grant the syncer's user write access to %s", dir)})
+	} else {
+		checks = append(checks, Check{Name: name, Status: CheckPass, Detail: fmt.Sprintf("%s is readable and writable", dir)})
+	}
+
+	free, err := fs.FreeSpace(dir)
+	switch {
+	case err != nil:
+		checks = append(checks, Check{Name: name + " disk space", Status: CheckSkip, Detail: err.Error()})
+	case free < minFreeSpace:
+		checks = append(checks, Check{Name: name + " disk space", Status: CheckWarn, Detail: fmt.Sprintf("only %s free", progress.FormatBytes(int64(free))), Hint: "free up space; compressed uploads and restores need room for temporary files"})
+	default:
+		checks = append(checks, Check{Name: name + " disk space", Status: CheckPass, Detail: fmt.Sprintf("%s free", progress.FormatBytes(int64(free)))})
+	}
+	return checks
+}
+
+func probeWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".syncer-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkStorage pings the storage backend and compares its clock to ours.
+func checkStorage(ctx context.Context, cfg Config) []Check {
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return []Check{{Name: "storage", Status: CheckFail, Detail: err.Error(), Hint: "enable and configure one storage backend"}}
+	}
+	if preflighter, ok := client.(storage.Preflighter); ok {
+		err = preflighter.Preflight(ctx)
+		if err != nil {
+			return []Check{{Name: "connectivity", Status: CheckFail, Detail: err.Error(), Hint: connectivityHint(storage.ConnectivityOf(err))}}
+		}
+	}
+	pinger, ok := client.(storage.Pinger)
+	if !ok {
+		return []Check{{Name: "storage", Status: CheckSkip, Detail: fmt.Sprintf("%s does not support connectivity checks", cfg.Backend())}}
+	}
+	serverTime, err := pinger.Ping(ctx)
+	if err != nil {
+		return []Check{{Name: "storage", Status: CheckFail, Detail: err.Error(), Hint: "check the credentials, bucket name, and network connection"}}
+	}
+	checks := []Check{{Name: "storage", Status: CheckPass, Detail: fmt.Sprintf("%s is reachable", cfg.Backend())}}
+
+	if serverTime.IsZero() {
+		return append(checks, Check{Name: "clock", Status: CheckSkip, Detail: "storage did not report its time"})
+	}
+	skew := clock.Now(ctx).Sub(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	clock := Check{Name: "clock", Status: CheckPass, Detail: fmt.Sprintf("%s from storage", skew)}
+	switch {
+	case skew >= maxClockSkew:
+		clock.Status = CheckFail
+		clock.Hint = "sync the system clock (e.g. enable systemd-timesyncd); requests will be rejected"
+	case skew >= warnClockSkew:
+		clock.Status = CheckWarn
+		clock.Hint = "sync the system clock (e.g. enable systemd-timesyncd)"
+	}
+	return append(checks, clock)
+}
+
+func connectivityHint(c storage.Connectivity) string {
+	switch c {
+	case storage.Offline:
+		return "check the network connection; syncs queue their uploads until storage is reachable"
+	case storage.CaptivePortal:
+		return "open a browser and accept the network's login page"
+	case storage.Unauthorized:
+		return "check the access key and secret, and that they may access the bucket"
+	default:
+		return "check the storage endpoint"
+	}
+}
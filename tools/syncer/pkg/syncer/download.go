@@ -0,0 +1,221 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/backup"
+	"github.com/TrevorEdris/retropie-utils/pkg/cache"
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// download fetches the files other devices uploaded since this device's
+// copies last changed, including ones this device doesn't have yet. A local
+// copy changed more recently than the upload is left alone and reported as a
+// conflict. Files uploaded as a group, such as a cue sheet and its tracks,
+// are downloaded as one. Replaced files are backed up so 'syncer undo' can
+// put them back.
+// When throttled, only saves are downloaded.
+func (s *syncer) download(ctx context.Context, run *history.Run, throttled bool) error {
+	if s.metadata == nil {
+		return errors.WithCategory(eris.New("downloading requires the metadata store; metadata.backend is none"), errors.ConfigCategory)
+	}
+	retriever, ok := s.storage.(storage.Retriever)
+	if !ok {
+		return eris.Wrapf(errors.NotImplementedError, "%s does not support downloads", s.cfg.Backend())
+	}
+	local, err := s.cfg.localIndex(ctx)
+	if err != nil {
+		return err
+	}
+	types, err := s.cfg.fileTypes()
+	if err != nil {
+		return errors.WithCategory(err, errors.ConfigCategory)
+	}
+
+	remote := make([]string, 0, len(s.latest))
+	for _, md := range s.latest {
+		if md.DeviceID == "" || md.DeviceID == s.device.ID || !s.cfg.covers(md.Path) {
+			continue
+		}
+		if throttled && types.TypeOf(path.Base(md.Path)) != fs.Save {
+			continue
+		}
+		remote = append(remote, md.Path)
+	}
+	sort.Strings(remote)
+
+	sizes := make(map[string]int64, len(remote))
+	for _, p := range remote {
+		dest, err := s.cfg.placeFile(p, local)
+		if err != nil {
+			return err
+		}
+		if dest != "" {
+			sizes[dest] = s.latest[fs.PathID(p)].Size
+		}
+	}
+	err = checkSpace(sizes, s.cfg.Restore.SkipSpaceCheck)
+	if err != nil {
+		return err
+	}
+
+	snapshot := s.cfg.Backups().Start(clock.Now(ctx))
+	for _, group := range s.groupUploads(remote) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = s.downloadGroup(ctx, run, retriever, local, snapshot, group)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupUploads groups the sorted paths so each file is with the ones its
+// upload says it is only meaningful alongside, such as a cue sheet's tracks
+// or a playlist's discs, in the order of the first path of each group.
+func (s *syncer) groupUploads(paths []string) [][]string {
+	groups := make([][]string, 0)
+	index := make(map[string]int)
+	for _, p := range paths {
+		root := fs.PathID(p)
+		// Bounded, in case the recorded parents loop.
+		for i := 0; i < len(s.latest); i++ {
+			md, ok := s.latest[root]
+			if !ok || md.Parent == "" {
+				break
+			}
+			root = fs.PathID(md.Parent)
+		}
+		i, ok := index[root]
+		if !ok {
+			i = len(groups)
+			index[root] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+	return groups
+}
+
+// downloadGroup downloads a group of files all or nothing: every file is
+// fetched and checked before any replaces a local copy, and if any local
+// copy changed after its upload the whole group is left alone.
+func (s *syncer) downloadGroup(ctx context.Context, run *history.Run, retriever storage.Retriever, local map[string]string, snapshot *backup.Snapshot, group []string) error {
+	type pending struct {
+		path string
+		dest string
+		md   metadata.FileMetadata
+		tmp  string
+		// placed is set once tmp replaces dest.
+		placed bool
+	}
+	todo := make([]*pending, 0, len(group))
+	for _, p := range group {
+		md := s.latest[fs.PathID(p)]
+		dest, err := s.cfg.placeFile(p, local)
+		if err != nil {
+			return err
+		}
+		if dest == "" {
+			run.Skip("no local path; map it in restore.paths", group...)
+			return nil
+		}
+		info, err := os.Stat(dest)
+		if err == nil {
+			sum, err := fs.ChecksumPath(dest)
+			if err == nil && sum == md.SHA256 {
+				continue
+			}
+			if info.ModTime().After(md.LastModified) && s.seen(dest, md) {
+				// Changed since this device downloaded it; the upload
+				// sends it the other way.
+				log.FromCtx(ctx).Debug("Local file changed after downloading it; not downloading it or its group",
+					zap.String("file", dest),
+					zap.Strings("group", group),
+				)
+				return nil
+			}
+			if info.ModTime().After(md.LastModified) {
+				run.Conflicts = append(run.Conflicts, p)
+				log.FromCtx(ctx).Warn("Local file changed after another device's upload; not downloading it or its group",
+					zap.String("file", dest),
+					zap.String("otherDevice", md.DeviceName),
+					zap.Strings("group", group),
+				)
+				return nil
+			}
+		}
+		todo = append(todo, &pending{path: p, dest: dest, md: md})
+	}
+	defer func() {
+		for _, t := range todo {
+			if t.tmp != "" {
+				os.Remove(t.tmp)
+			}
+		}
+	}()
+
+	failed := func(err error, p string) error {
+		err = eris.Wrapf(err, "failed to download %s", p)
+		if fatal(err) {
+			return err
+		}
+		// Those already placed stay placed; the rest wait for the next sync.
+		dests := make([]string, 0, len(todo))
+		for _, t := range todo {
+			if !t.placed {
+				dests = append(dests, t.dest)
+			}
+		}
+		log.FromCtx(ctx).Error("Failed to download file", zap.String("file", p), zap.Error(err))
+		run.Fail(err, dests...)
+		return nil
+	}
+	for _, t := range todo {
+		log.FromCtx(ctx).Info("Downloading", zap.String("key", t.md.Key), zap.String("file", t.dest))
+		tmp, err := fetch(ctx, retriever, t.md.Key, t.dest, &t.md)
+		if err != nil {
+			return failed(err, t.path)
+		}
+		t.tmp = tmp
+	}
+	for _, t := range todo {
+		err := place(t.tmp, t.dest, snapshot)
+		if err != nil {
+			return failed(err, t.path)
+		}
+		t.tmp = ""
+		t.placed = true
+		run.FilesDownloaded++
+		run.BytesDownloaded += t.md.Size
+		entry := cache.Entry{
+			SHA256:     t.md.SHA256,
+			Size:       t.md.Size,
+			ModTime:    t.md.LastModified,
+			Key:        t.md.Key,
+			UploadedAt: t.md.UploadedAt,
+		}
+		// Otherwise the next upload would send the file straight back.
+		if s.cache != nil {
+			s.cache.Put(t.dest, entry)
+		}
+		// So editing it later isn't taken for a conflict with this upload.
+		if s.downloads != nil {
+			s.downloads.Put(t.dest, entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+)
+
+// NewSyncerWithStorage is NewSyncer syncing to client rather than the
+// configured backends.
+func NewSyncerWithStorage(cfg Config, client storage.Storage) (Syncer, error) {
+	identity, err := cfg.Device()
+	if err != nil {
+		return nil, err
+	}
+	intervals, err := cfg.minIntervals()
+	if err != nil {
+		return nil, err
+	}
+	return &syncer{
+		cfg:          cfg,
+		storage:      client,
+		device:       identity,
+		intervals:    intervals,
+		openMetadata: cfg.MetadataStore,
+	}, nil
+}
+
+// NewSyncerWithStores is NewSyncerWithStorage recording uploads in store
+// rather than the configured metadata store.
+func NewSyncerWithStores(cfg Config, client storage.Storage, store metadata.Store) (Syncer, error) {
+	s, err := NewSyncerWithStorage(cfg, client)
+	if err != nil {
+		return nil, err
+	}
+	s.(*syncer).openMetadata = func() (metadata.Store, error) {
+		return store, nil
+	}
+	return s, nil
+}
+
+// SetMetadataBackoff sets the wait before retrying to record an upload,
+// returning a func that restores it.
+func SetMetadataBackoff(d time.Duration) func() {
+	old := metadataBackoff
+	metadataBackoff = d
+	return func() {
+		metadataBackoff = old
+	}
+}
+
+var MonthUsage = monthUsage
+
+func (c Config) CheckMounted() error {
+	return c.checkMounted()
+}
+
+func (c Config) CheckFound(found int) error {
+	return c.checkFound(found)
+}
+
+var CheckSpace = checkSpace
+
+const SpaceMargin = spaceMargin
+
+func (c Config) LocalPath(ctx context.Context, p string) (string, error) {
+	return c.localPath(ctx, p)
+}
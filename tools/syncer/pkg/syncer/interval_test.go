@@ -0,0 +1,87 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Minimum intervals", func() {
+	var (
+		ctx    context.Context
+		now    *clock.Fake
+		cfg    syncer.Config
+		remote *storagetest.Fake
+		save   string
+	)
+
+	BeforeEach(func() {
+		now = clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+		ctx = clock.ToCtx(context.Background(), now)
+		dir := GinkgoT().TempDir()
+		remote = storagetest.NewFake()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+			DeviceName: "pi",
+		}
+		cfg.Sync.Saves = true
+		cfg.Sync.MinInterval = map[string]time.Duration{"save": time.Hour}
+		cfg.Metadata.Path = filepath.Join(dir, "metadata.db")
+		save = filepath.Join(cfg.RomsFolder, "snes", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(save), os.ModePerm)).To(Succeed())
+	})
+
+	// play changes the save, as a game being played does.
+	play := func(progress string) {
+		Expect(os.WriteFile(save, []byte(progress), 0644)).To(Succeed())
+		modified := now.Now()
+		Expect(os.Chtimes(save, modified, modified)).To(Succeed())
+	}
+
+	sync := func() history.Run {
+		s, err := syncer.NewSyncerWithStorage(cfg, remote)
+		Expect(err).NotTo(HaveOccurred())
+		run, err := s.Sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return run
+	}
+
+	It("uploads a file never uploaded", func() {
+		play("level 1")
+		Expect(sync().FilesUploaded).To(Equal(1))
+	})
+
+	It("defers a file uploaded within its interval until the interval has passed", func() {
+		play("level 1")
+		Expect(sync().FilesUploaded).To(Equal(1))
+
+		now.Advance(30 * time.Minute)
+		play("level 2")
+		run := sync()
+		Expect(run.FilesUploaded).To(Equal(0))
+		Expect(run.Skips).To(ContainElement(history.FileOutcome{
+			Path:   save,
+			Reason: "uploaded within its minimum interval",
+		}))
+
+		now.Advance(30 * time.Minute)
+		Expect(sync().FilesUploaded).To(Equal(1))
+		Expect(remote.Stores()).To(Equal(2))
+	})
+
+	It("rejects an unknown file type", func() {
+		cfg.Sync.MinInterval = map[string]time.Duration{"saves": time.Hour}
+		_, err := syncer.NewSyncerWithStorage(cfg, remote)
+		Expect(err).To(MatchError(ContainSubstring(`invalid file type in sync.minInterval: unknown file type "saves"`)))
+	})
+})
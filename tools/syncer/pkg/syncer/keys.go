@@ -0,0 +1,203 @@
+package syncer
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// KeyMigration is the move of one file's latest upload to the key the
+// configured key template gives it.
+type KeyMigration struct {
+	Path string `json:"path"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// KeyMigrationReport lists the uploads copied to new keys, and those left
+// alone because their key doesn't follow the old template, such as blobs of
+// the content layout.
+type KeyMigrationReport struct {
+	Migrated  []KeyMigration `json:"migrated"`
+	Unmatched []string       `json:"unmatched,omitempty"`
+}
+
+// MigrateKeys copies the latest upload of every file recorded in the
+// metadata store from its key under the from template and encoding to the
+// key the configured template and encoding give it, and records the new
+// key. The original objects, and earlier uploads, are left where they are.
+// With dryRun set, nothing is copied or recorded.
+func MigrateKeys(ctx context.Context, cfg Config, from string, fromEncoding storage.KeyEncoding, dryRun bool) (KeyMigrationReport, error) {
+	if cfg.Backend() != "s3" {
+		return KeyMigrationReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support key templates", cfg.Backend())
+	}
+	s3cfg := cfg.Storage.S3
+	oldKeys, err := storage.NewKeyBuilder(s3cfg.Prefix, from)
+	if err != nil {
+		return KeyMigrationReport{}, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	oldKeys = oldKeys.Encoded(fromEncoding)
+	newKeys, err := storage.NewKeyBuilder(s3cfg.Prefix, s3cfg.KeyTemplate)
+	if err != nil {
+		return KeyMigrationReport{}, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	newKeys = newKeys.Encoded(s3cfg.KeyEncoding)
+	if oldKeys.Template() == newKeys.Template() && oldKeys.Encoding() == newKeys.Encoding() {
+		return KeyMigrationReport{}, errors.WithCategory(eris.Errorf("the key template is already %q, encoded %s", from, newKeys.Encoding()), errors.ConfigCategory)
+	}
+
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return KeyMigrationReport{}, err
+	}
+	if store == nil {
+		return KeyMigrationReport{}, errors.WithCategory(eris.New("migrating keys requires the metadata store; metadata.backend is none"), errors.ConfigCategory)
+	}
+	defer store.Close()
+
+	var copier storage.Copier
+	if !dryRun {
+		client, err := NewStorage(ctx, cfg)
+		if err != nil {
+			return KeyMigrationReport{}, err
+		}
+		var ok bool
+		copier, ok = client.(storage.Copier)
+		if !ok {
+			return KeyMigrationReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support copying", cfg.Backend())
+		}
+		err = client.Init(ctx)
+		if err != nil {
+			return KeyMigrationReport{}, err
+		}
+	}
+
+	uploads, err := store.ListFiles(ctx)
+	if err != nil {
+		return KeyMigrationReport{}, err
+	}
+	report := KeyMigrationReport{Migrated: make([]KeyMigration, 0)}
+	for _, md := range uploads {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		fields, ok := oldKeys.Parse(md.Key)
+		dir, name := path.Split(md.Path)
+		if !ok || fields.Name != name || fields.Dir != strings.TrimSuffix(dir, "/") {
+			report.Unmatched = append(report.Unmatched, md.Path)
+			continue
+		}
+		fields.SHA256 = md.SHA256
+		if fields.Device == "" {
+			fields.Device = md.DeviceID
+		}
+		to := newKeys.Build(fields)
+		if to == md.Key {
+			continue
+		}
+		m := KeyMigration{Path: md.Path, From: md.Key, To: to}
+		if !dryRun {
+			log.FromCtx(ctx).Info("Copying to new key", zap.String("file", m.Path), zap.String("from", m.From), zap.String("to", m.To))
+			err = copier.Copy(ctx, m.From, m.To)
+			if err != nil {
+				return report, err
+			}
+			// The same upload, so it replaces the version recorded with the
+			// old key.
+			md.Key = to
+			err = store.StoreFileMetadata(ctx, md)
+			if err != nil {
+				return report, err
+			}
+		}
+		report.Migrated = append(report.Migrated, m)
+	}
+	return report, nil
+}
+
+// PrefixMoveReport lists the objects moved to the new prefix, and how many
+// metadata records were updated to match.
+type PrefixMoveReport struct {
+	Moved   []storage.Move `json:"moved"`
+	Records int            `json:"records"`
+}
+
+// MovePrefix moves everything stored under the from prefix to the to
+// prefix, then points every upload recorded in the metadata store, earlier
+// versions included, at its new key. It is how a person's uploads in a
+// shared bucket are renamed, since the prefix is part of every key. The
+// config still names the old prefix afterwards unless it is edited. With
+// dryRun set, nothing is moved or recorded.
+func MovePrefix(ctx context.Context, cfg Config, from, to string, dryRun bool) (PrefixMoveReport, error) {
+	from, to = strings.Trim(from, "/"), strings.Trim(to, "/")
+	if from == "" || to == "" {
+		return PrefixMoveReport{}, errors.WithCategory(eris.New("both prefixes must be given; the bucket root can't be moved"), errors.ConfigCategory)
+	}
+	if from == to || strings.HasPrefix(to+"/", from+"/") || strings.HasPrefix(from+"/", to+"/") {
+		return PrefixMoveReport{}, errors.WithCategory(eris.Errorf("can't move %s to %s; neither may contain the other", from, to), errors.ConfigCategory)
+	}
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return PrefixMoveReport{}, err
+	}
+	mover, ok := client.(storage.PrefixMover)
+	if !ok {
+		return PrefixMoveReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support moving prefixes", cfg.Backend())
+	}
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return PrefixMoveReport{}, err
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	err = client.Init(ctx)
+	if err != nil {
+		return PrefixMoveReport{}, err
+	}
+
+	report := PrefixMoveReport{}
+	report.Moved, err = mover.MovePrefix(ctx, from, to, dryRun)
+	if err != nil {
+		return report, err
+	}
+	if store == nil {
+		return report, nil
+	}
+	files, err := store.ListFiles(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, file := range files {
+		versions, err := store.ListVersions(ctx, file.Path)
+		if err != nil {
+			return report, err
+		}
+		// Oldest first, so the newest is left as the latest.
+		for i := len(versions) - 1; i >= 0; i-- {
+			md := versions[i]
+			if !strings.HasPrefix(md.Key, from+"/") {
+				continue
+			}
+			report.Records++
+			if dryRun {
+				continue
+			}
+			// The same upload, so it replaces the version recorded with the
+			// old key.
+			md.Key = to + "/" + strings.TrimPrefix(md.Key, from+"/")
+			err = store.StoreFileMetadata(ctx, md)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	log.FromCtx(ctx).Info("Moved prefix", zap.String("from", from), zap.String("to", to), zap.Int("objects", len(report.Moved)), zap.Int("records", report.Records))
+	return report, nil
+}
@@ -0,0 +1,63 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// checkLimits fails with errors.LimitError if the planned batches exceed the
+// configured limits, unless the sync was confirmed. scanned maps the ID of
+// every local file looked at to its path, to find the ones that have gone
+// missing; checkMissing is unset when some types weren't looked at.
+func (s *syncer) checkLimits(ctx context.Context, batches []batch, scanned map[string]string, checkMissing bool) error {
+	limits := s.cfg.Limits
+	if limits.Confirmed {
+		return nil
+	}
+	exceeded := make([]string, 0)
+	files := 0
+	var bytes int64
+	for _, b := range batches {
+		selected := b.files()
+		files += len(selected)
+		bytes += totalSize(selected)
+	}
+	if limits.MaxFiles > 0 && files > limits.MaxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("%d files to upload, more than %d", files, limits.MaxFiles))
+	}
+	if limits.MaxBytes > 0 && bytes > limits.MaxBytes {
+		exceeded = append(exceeded, fmt.Sprintf("%s to upload, more than %s", progress.FormatBytes(bytes), progress.FormatBytes(limits.MaxBytes)))
+	}
+	if limits.MaxDeletions > 0 && checkMissing {
+		missing := s.missing(scanned)
+		if missing > limits.MaxDeletions {
+			exceeded = append(exceeded, fmt.Sprintf("%d previously uploaded files missing locally, more than %d", missing, limits.MaxDeletions))
+		}
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	log.FromCtx(ctx).Warn("Sync exceeds its limits; confirm it to continue", zap.Strings("exceeded", exceeded))
+	return eris.Wrap(rperrors.LimitError, strings.Join(exceeded, "; "))
+}
+
+// missing counts the files this device last uploaded that a sync with this
+// config would pick up, but which aren't among scanned. It needs the metadata
+// store; without it nothing is missing.
+func (s *syncer) missing(scanned map[string]string) int {
+	missing := 0
+	for id, md := range s.latest {
+		if _, ok := scanned[id]; ok || md.DeviceID != s.device.ID || !s.cfg.covers(md.Path) {
+			continue
+		}
+		missing++
+	}
+	return missing
+}
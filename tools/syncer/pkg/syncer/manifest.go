@@ -0,0 +1,204 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/manifest"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// manifestDir is the remote directory, alongside the synced systems, that
+// holds the manifest for a sync.
+const manifestDir = ".syncer"
+
+// latestManifest is the manifest of the latest sync, kept outside any
+// sync's remote directory so a restore can find it.
+func latestManifest() *fs.File {
+	f := fs.NewFile(manifest.Filename, time.Time{})
+	f.Dir = manifestDir
+	return f
+}
+
+// storeManifest builds a manifest of the synced files and uploads it next to
+// them, and as the latest manifest.
+func (s *syncer) storeManifest(ctx context.Context, files []*fs.File, remoteDir string) error {
+	m, err := manifest.Build(s.cfg.RomsFolder, files, clock.Now(ctx))
+	if err != nil {
+		return err
+	}
+	key, err := s.cfg.signingKey(ctx)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		err = m.Sign(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "syncer-manifest-*")
+	if err != nil {
+		return eris.Wrap(err, "failed to create manifest directory")
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, manifest.Filename)
+	err = m.Write(path)
+	if err != nil {
+		return err
+	}
+
+	f := fs.NewFile(path, m.CreatedAt)
+	f.Dir = manifestDir
+	log.FromCtx(ctx).Info("Uploading manifest", zap.Int("files", len(m.Entries)))
+	err = s.storage.Store(ctx, remoteDir, f)
+	if err != nil {
+		return err
+	}
+	return s.storage.Store(ctx, "", f)
+}
+
+// verifyRestore checks the files a download-only sync covers against the
+// latest manifest, recording each one missing or differing from it as a
+// failure. It fails if there are any; no manifest is only logged.
+func (s *syncer) verifyRestore(ctx context.Context, run *history.Run) error {
+	m, err := s.cfg.fetchManifest(ctx, s.storage)
+	if eris.Is(err, errors.NotFoundError) {
+		log.FromCtx(ctx).Warn("No manifest to verify the restore against", zap.Error(err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	report, err := s.cfg.checkManifest(m)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Missing {
+		run.Failures = append(run.Failures, history.FileOutcome{Path: filepath.Join(s.cfg.RomsFolder, filepath.FromSlash(p)), Reason: "missing after restore"})
+	}
+	for _, p := range report.Mismatched {
+		run.Failures = append(run.Failures, history.FileOutcome{Path: filepath.Join(s.cfg.RomsFolder, filepath.FromSlash(p)), Reason: "differs from the manifest"})
+	}
+	run.FilesFailed += len(report.Missing) + len(report.Mismatched)
+	if !report.OK() {
+		return eris.Errorf("restore incomplete: %d files missing and %d differing from the manifest of %s", len(report.Missing), len(report.Mismatched), m.CreatedAt.Format(time.RFC3339))
+	}
+	log.FromCtx(ctx).Info("Restore verified against the manifest", zap.Int("files", report.Verified), zap.Time("manifest", m.CreatedAt))
+	return nil
+}
+
+// VerifyLatestManifest checks that the library described by the config
+// matches the manifest of the latest sync, as kept in storage, verifying its
+// signature first when a signing key is configured. Only the files the
+// config syncs are checked.
+func VerifyLatestManifest(ctx context.Context, cfg Config) (*manifest.Report, error) {
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := cfg.fetchManifest(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.checkManifest(m)
+}
+
+// fetchManifest downloads the latest manifest from client, verifying its
+// signature when a signing key is configured. It returns
+// errors.NotFoundError if no sync has stored one.
+func (c Config) fetchManifest(ctx context.Context, client storage.Storage) (*manifest.Manifest, error) {
+	retriever, ok := client.(storage.Retriever)
+	if !ok {
+		return nil, eris.Wrapf(errors.NotImplementedError, "%s does not support downloads", c.Backend())
+	}
+	tmp, err := os.CreateTemp("", "syncer-manifest-*.json")
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create manifest file")
+	}
+	defer os.Remove(tmp.Name())
+	err = retriever.Retrieve(ctx, client.Key("", latestManifest()), tmp)
+	closeErr := tmp.Close()
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to download the latest manifest")
+	}
+	if closeErr != nil {
+		return nil, eris.Wrapf(closeErr, "failed to write %s", tmp.Name())
+	}
+	m, err := manifest.Read(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		err = m.VerifySignature(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// checkManifest checks the RomsFolder against the entries of m the config
+// syncs, leaving out e.g. ROMs when only saves are synced.
+func (c Config) checkManifest(m *manifest.Manifest) (*manifest.Report, error) {
+	entries := make([]manifest.Entry, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		if c.covers(e.Path) {
+			entries = append(entries, e)
+		}
+	}
+	m.Entries = entries
+	return m.Check(c.RomsFolder)
+}
+
+// VerifyManifest checks that the library described by the config matches the
+// manifest at manifestPath, verifying its signature first when a signing key
+// is configured.
+func VerifyManifest(ctx context.Context, cfg Config, manifestPath string) (*manifest.Report, error) {
+	m, err := manifest.Read(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := cfg.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		err = m.VerifySignature(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m.Check(cfg.RomsFolder)
+}
+
+// signingKey resolves the manifest signing key, or returns nil if none is
+// configured.
+func (c Config) signingKey(ctx context.Context) ([]byte, error) {
+	key, err := c.Manifest.SigningKey.Resolve(ctx)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to resolve manifest signing key")
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return []byte(key), nil
+}
@@ -0,0 +1,139 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/manifest"
+	"github.com/TrevorEdris/retropie-utils/pkg/secret"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Restore verification", func() {
+	var (
+		ctx    context.Context
+		dir    string
+		remote *storagetest.Fake
+		origin syncer.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir = GinkgoT().TempDir()
+		remote = storagetest.NewFake()
+	})
+
+	device := func(name string, direction syncer.Direction) syncer.Config {
+		cfg := syncer.Config{
+			RomsFolder: filepath.Join(dir, name, "roms"),
+			StateDir:   filepath.Join(dir, name, "state"),
+			DeviceName: name,
+			Direction:  direction,
+		}
+		cfg.Sync.Saves = true
+		cfg.Metadata.Path = filepath.Join(dir, "metadata.db")
+		cfg.Manifest.Enabled = true
+		cfg.Manifest.SigningKey = secret.Secret{Value: "signing-key"}
+		Expect(os.MkdirAll(cfg.RomsFolder, os.ModePerm)).To(Succeed())
+		return cfg
+	}
+
+	write := func(cfg syncer.Config, rel, content string, modified time.Time) string {
+		p := filepath.Join(cfg.RomsFolder, rel)
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		Expect(os.Chtimes(p, modified, modified)).To(Succeed())
+		return p
+	}
+
+	sync := func(cfg syncer.Config) (history.Run, error) {
+		s, err := syncer.NewSyncerWithStorage(cfg, remote)
+		Expect(err).NotTo(HaveOccurred())
+		return s.Sync(ctx)
+	}
+
+	start := time.Now().Add(-time.Hour)
+
+	BeforeEach(func() {
+		origin = device("origin", "upload")
+		write(origin, "snes/Game.srm", "snes save", start)
+		write(origin, "gba/Game.sav", "gba save", start)
+		_, err := sync(origin)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("keeps the latest manifest where a restore can find it", func() {
+		content, err := remote.Content(".syncer/" + manifest.Filename)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("snes/Game.srm"))
+	})
+
+	It("passes a restore that brought back every file", func() {
+		restored := device("restored", "download")
+		run, err := sync(restored)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run.FilesDownloaded).To(Equal(2))
+		Expect(run.Failures).To(BeEmpty())
+	})
+
+	It("fails a restore that left files differing from the manifest", func() {
+		restored := device("restored", "download")
+		// Changed after the upload, so the restore leaves it alone.
+		p := write(restored, "snes/Game.srm", "local progress", time.Now())
+		run, err := sync(restored)
+		Expect(err).To(MatchError(ContainSubstring("restore incomplete")))
+		Expect(run.Failures).To(ConsistOf(history.FileOutcome{Path: p, Reason: "differs from the manifest"}))
+	})
+
+	It("fails a restore that left files missing", func() {
+		restored := device("restored", "download")
+		// Only saves for the snes are synced, so the gba save is left out
+		// of both the restore and the check; a snes save the restore
+		// couldn't bring back is missing.
+		restored.Systems = []string{"snes"}
+		Expect(remote.Trash(ctx, findKey(ctx, remote, "snes/Game.srm"), time.Hour)).To(Succeed())
+		run, err := sync(restored)
+		Expect(err).To(HaveOccurred())
+		Expect(run.Failures).To(ContainElement(history.FileOutcome{
+			Path:   filepath.Join(restored.RomsFolder, "snes", "Game.srm"),
+			Reason: "missing after restore",
+		}))
+		Expect(run.Failures).NotTo(ContainElement(HaveField("Path", ContainSubstring("gba"))))
+	})
+
+	It("rejects a manifest signed with another key", func() {
+		restored := device("restored", "download")
+		restored.Manifest.SigningKey = secret.Secret{Value: "another-key"}
+		_, err := sync(restored)
+		Expect(err).To(MatchError(manifest.InvalidSignatureError))
+	})
+
+	It("skips the check without manifests enabled", func() {
+		restored := device("restored", "download")
+		restored.Manifest.Enabled = false
+		write(restored, "snes/Game.srm", "local progress", time.Now())
+		_, err := sync(restored)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+// findKey returns the key of the stored object whose key ends in suffix.
+func findKey(ctx context.Context, remote *storagetest.Fake, suffix string) string {
+	objects, err := remote.List(ctx)
+	Expect(err).NotTo(HaveOccurred())
+	for _, o := range objects {
+		if strings.HasSuffix(o.Key, suffix) {
+			return o.Key
+		}
+	}
+	Fail("no object ending in " + suffix)
+	return ""
+}
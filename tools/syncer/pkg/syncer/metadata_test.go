@@ -0,0 +1,114 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+// metadataAttempts is how many times strict mode tries to record an upload.
+const metadataAttempts = 3
+
+// failingStore fails to record the first failures uploads.
+type failingStore struct {
+	metadata.Store
+	failures int
+	attempts int
+}
+
+func (s *failingStore) StoreFileMetadata(ctx context.Context, md metadata.FileMetadata) error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return eris.New("database is locked")
+	}
+	return s.Store.StoreFileMetadata(ctx, md)
+}
+
+var _ = Describe("Recording metadata", func() {
+	var (
+		ctx    context.Context
+		cfg    syncer.Config
+		remote *storagetest.Fake
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir := GinkgoT().TempDir()
+		remote = storagetest.NewFake()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+			DeviceName: "pi",
+		}
+		cfg.Sync.Saves = true
+		cfg.Metadata.Path = filepath.Join(dir, "metadata.db")
+		p := filepath.Join(cfg.RomsFolder, "snes", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte("progress"), 0644)).To(Succeed())
+		DeferCleanup(syncer.SetMetadataBackoff(time.Millisecond))
+	})
+
+	// syncFailing syncs with a metadata store that fails failures times.
+	syncFailing := func(failures int) (*failingStore, error) {
+		bolt, err := metadata.NewBoltStore(cfg.Metadata.Path)
+		Expect(err).NotTo(HaveOccurred())
+		store := &failingStore{Store: bolt, failures: failures}
+		s, err := syncer.NewSyncerWithStores(cfg, remote, store)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = s.Sync(ctx)
+		return store, err
+	}
+
+	recorded := func() *metadata.FileMetadata {
+		store, err := metadata.NewBoltStore(cfg.Metadata.Path)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+		md, err := store.GetFileMetadata(ctx, "snes/Game.srm")
+		Expect(err).NotTo(HaveOccurred())
+		return md
+	}
+
+	It("only logs a failure by default", func() {
+		store, err := syncFailing(metadataAttempts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.attempts).To(Equal(1))
+		Expect(remote.Stores()).To(Equal(1))
+		Expect(recorded()).To(BeNil())
+	})
+
+	When("strict", func() {
+		BeforeEach(func() {
+			cfg.Metadata.Strict = true
+		})
+
+		It("retries a failure", func() {
+			store, err := syncFailing(metadataAttempts - 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.attempts).To(Equal(metadataAttempts))
+			Expect(recorded()).NotTo(BeNil())
+		})
+
+		It("fails the sync if recording keeps failing, uploading the file again next time", func() {
+			store, err := syncFailing(metadataAttempts)
+			Expect(err).To(MatchError(ContainSubstring("failed to sync")))
+			Expect(store.attempts).To(Equal(metadataAttempts))
+			Expect(remote.Stores()).To(Equal(1))
+			Expect(recorded()).To(BeNil())
+
+			store, err = syncFailing(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.attempts).To(Equal(1))
+			Expect(remote.Stores()).To(Equal(2))
+			Expect(recorded()).NotTo(BeNil())
+		})
+	})
+})
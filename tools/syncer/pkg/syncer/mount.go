@@ -0,0 +1,83 @@
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// checkMounted fails if the RomsFolder, or its marker file if one is
+// configured, is missing, or the RomsFolder holds fewer files than
+// expected, as when the drive holding it isn't mounted. Syncing then would
+// find nothing to upload, and restore into the empty mount point, so it is
+// checked before anything is downloaded.
+func (c Config) checkMounted() error {
+	info, err := os.Stat(c.RomsFolder)
+	if os.IsNotExist(err) {
+		return errors.WithCategory(eris.Errorf("romsFolder %s does not exist; is the drive holding it mounted?", c.RomsFolder), errors.ConfigCategory)
+	}
+	if err != nil {
+		return eris.Wrapf(err, "failed to stat romsFolder %s", c.RomsFolder)
+	}
+	if !info.IsDir() {
+		return errors.WithCategory(eris.Errorf("romsFolder %s is not a directory", c.RomsFolder), errors.ConfigCategory)
+	}
+	if c.Mount.MarkerFile != "" {
+		marker := filepath.Join(c.RomsFolder, c.Mount.MarkerFile)
+		_, err = os.Stat(marker)
+		if os.IsNotExist(err) {
+			return errors.WithCategory(eris.Errorf("marker file %s does not exist; is the drive holding the romsFolder mounted?", marker), errors.ConfigCategory)
+		}
+		if err != nil {
+			return eris.Wrapf(err, "failed to stat marker file %s", marker)
+		}
+	}
+	if c.Mount.ExpectedMinFiles <= 0 {
+		return nil
+	}
+	found, err := countFiles(c.RomsFolder, c.Mount.ExpectedMinFiles)
+	if err != nil {
+		return err
+	}
+	return c.checkFound(found)
+}
+
+// countFiles counts the files under dir, outside hidden directories, up to
+// limit, so a large library isn't walked in full just to be counted.
+func countFiles(dir string, limit int) (int, error) {
+	found := 0
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			found++
+		}
+		if found >= limit {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return found, eris.Wrapf(err, "failed to count files in romsFolder %s", dir)
+	}
+	return found, nil
+}
+
+// checkFound fails if found, the number of files found in the RomsFolder,
+// is fewer than expected.
+func (c Config) checkFound(found int) error {
+	if found >= c.Mount.ExpectedMinFiles {
+		return nil
+	}
+	return errors.WithCategory(eris.Errorf("found %d files in romsFolder %s, fewer than the %d expected; is the drive holding it mounted?", found, c.RomsFolder, c.Mount.ExpectedMinFiles), errors.ConfigCategory)
+}
@@ -0,0 +1,122 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage/storagetest"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Mount checks", func() {
+	var (
+		dir string
+		cfg syncer.Config
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+		}
+		Expect(os.MkdirAll(cfg.RomsFolder, os.ModePerm)).To(Succeed())
+	})
+
+	write := func(rel string) {
+		p := filepath.Join(cfg.RomsFolder, rel)
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(rel), 0644)).To(Succeed())
+	}
+
+	It("passes for a RomsFolder with no requirements", func() {
+		Expect(cfg.CheckMounted()).To(Succeed())
+	})
+
+	It("fails when the RomsFolder is missing", func() {
+		cfg.RomsFolder = filepath.Join(dir, "unmounted")
+		err := cfg.CheckMounted()
+		Expect(err).To(MatchError(ContainSubstring("does not exist")))
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+	})
+
+	It("fails when the RomsFolder is a file", func() {
+		cfg.RomsFolder = filepath.Join(dir, "roms.txt")
+		Expect(os.WriteFile(cfg.RomsFolder, nil, 0644)).To(Succeed())
+		err := cfg.CheckMounted()
+		Expect(err).To(MatchError(ContainSubstring("is not a directory")))
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+	})
+
+	It("fails when the marker file is missing", func() {
+		cfg.Mount.MarkerFile = ".mounted"
+		err := cfg.CheckMounted()
+		Expect(err).To(MatchError(ContainSubstring("marker file")))
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+
+		write(".mounted")
+		Expect(cfg.CheckMounted()).To(Succeed())
+	})
+
+	It("fails when the RomsFolder holds fewer files than expected", func() {
+		cfg.Mount.ExpectedMinFiles = 3
+		write("snes/A.sfc")
+		write("snes/B.sfc")
+		// Hidden directories aren't counted.
+		write(".trash/C.sfc")
+		err := cfg.CheckMounted()
+		Expect(err).To(MatchError(ContainSubstring("found 2 files")))
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+
+		write("gba/C.gba")
+		Expect(cfg.CheckMounted()).To(Succeed())
+	})
+
+	DescribeTable("checkFound",
+		func(found int, ok bool) {
+			cfg.Mount.ExpectedMinFiles = 10
+			err := cfg.CheckFound(found)
+			if ok {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+			}
+		},
+		Entry("below the minimum", 9, false),
+		Entry("at the minimum", 10, true),
+		Entry("above the minimum", 11, true),
+	)
+
+	It("fails a sync before downloading into a RomsFolder with too few files", func() {
+		ctx := context.Background()
+		remote := storagetest.NewFake()
+		other := syncer.Config{RomsFolder: filepath.Join(dir, "other"), StateDir: filepath.Join(dir, "other-state"), DeviceName: "other"}
+		other.Sync.Saves = true
+		p := filepath.Join(other.RomsFolder, "snes", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte("save"), 0644)).To(Succeed())
+		s, err := syncer.NewSyncerWithStorage(other, remote)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = s.Sync(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Stores()).To(Equal(1))
+
+		for _, direction := range []syncer.Direction{"download", "both"} {
+			cfg.Direction = direction
+			cfg.Sync.Saves = true
+			cfg.Mount.ExpectedMinFiles = 1
+			s, err = syncer.NewSyncerWithStorage(cfg, remote)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = s.Sync(ctx)
+			Expect(errors.CategoryOf(err)).To(Equal(errors.ConfigCategory))
+			entries, err := os.ReadDir(cfg.RomsFolder)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		}
+	})
+})
@@ -0,0 +1,288 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type (
+	// Move renames a file. From and To are absolute paths.
+	Move struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	// OrganizeSkip is a ROM the plan leaves where it is, and why.
+	OrganizeSkip struct {
+		Path   string `json:"path"`
+		Reason string `json:"reason"`
+	}
+
+	// OrganizePlan renames verified ROMs to their canonical names, in the
+	// folder of their system, moving the saves and states named after them
+	// along.
+	OrganizePlan struct {
+		Moves   []Move         `json:"moves"`
+		Skipped []OrganizeSkip `json:"skipped,omitempty"`
+	}
+)
+
+// datSystems maps DAT names to RetroPie's system folders. Config entries in
+// dat.systems take precedence.
+var datSystems = map[string]string{
+	"Nintendo - Nintendo Entertainment System":       "nes",
+	"Nintendo - Family Computer Disk System":         "fds",
+	"Nintendo - Super Nintendo Entertainment System": "snes",
+	"Nintendo - Nintendo 64":                         "n64",
+	"Nintendo - Game Boy":                            "gb",
+	"Nintendo - Game Boy Color":                      "gbc",
+	"Nintendo - Game Boy Advance":                    "gba",
+	"Sega - Master System - Mark III":                "mastersystem",
+	"Sega - Mega Drive - Genesis":                    "megadrive",
+	"Sega - Game Gear":                               "gamegear",
+	"Sega - Mega-CD - Sega CD":                       "segacd",
+	"Sega - Saturn":                                  "saturn",
+	"Sega - Dreamcast":                               "dreamcast",
+	"NEC - PC Engine - TurboGrafx-16":                "pcengine",
+	"Sony - PlayStation":                             "psx",
+	"Atari - 2600":                                   "atari2600",
+	"Atari - Lynx":                                   "atarilynx",
+}
+
+// datQualifier matches the qualifiers some DATs append to their name, e.g.
+// " (Parent-Clone)" or " (Headered)".
+var datQualifier = regexp.MustCompile(`(\s*\([^)]*\))+$`)
+
+// organizeJournalDir holds the journals 'syncer organize --undo' reverts.
+func (c Config) organizeJournalDir() string {
+	return filepath.Join(c.GetStateDir(), "organize")
+}
+
+// systemFolder returns the RetroPie folder for the DAT's system, or "" if it
+// isn't known.
+func (c Config) systemFolder(system string) string {
+	name := strings.ToLower(datQualifier.ReplaceAllString(system, ""))
+	for from, to := range c.Dat.Systems {
+		if strings.ToLower(from) == name {
+			return to
+		}
+	}
+	for from, to := range datSystems {
+		if strings.ToLower(from) == name {
+			return to
+		}
+	}
+	return ""
+}
+
+// PlanOrganize works out how to rename the RomsFolder's verified ROMs to their
+// canonical names and move them into the folder of their system. Nothing is
+// moved.
+func PlanOrganize(ctx context.Context, cfg Config) (OrganizePlan, error) {
+	idx, err := cfg.DatIndex()
+	if err != nil {
+		return OrganizePlan{}, err
+	}
+	if idx == nil {
+		return OrganizePlan{}, errors.WithCategory(eris.New("no DAT folder configured; set dat.folder"), errors.ConfigCategory)
+	}
+	romDir, err := cfg.RomsDirectory(ctx)
+	if err != nil {
+		return OrganizePlan{}, err
+	}
+	all := romDir.GetAllFiles()
+	roms, err := romDir.GetMatchingFiles(fs.Rom)
+	if err != nil {
+		return OrganizePlan{}, err
+	}
+
+	plan := OrganizePlan{Moves: make([]Move, 0)}
+	targets := make(map[string]bool)
+	for _, set := range groupRoms(roms) {
+		moves, reason, err := cfg.planSet(idx, set, all)
+		if err != nil {
+			return OrganizePlan{}, err
+		}
+		if reason == "" {
+			for _, m := range moves {
+				if targets[m.To] {
+					reason = "another ROM is being renamed to " + filepath.Base(m.To)
+					break
+				}
+			}
+		}
+		if reason != "" {
+			rel, _ := filepath.Rel(cfg.RomsFolder, set.Primary.Absolute)
+			plan.Skipped = append(plan.Skipped, OrganizeSkip{Path: filepath.ToSlash(rel), Reason: reason})
+			continue
+		}
+		for _, m := range moves {
+			targets[m.To] = true
+		}
+		plan.Moves = append(plan.Moves, moves...)
+	}
+	return plan, nil
+}
+
+func groupRoms(roms []*fs.File) []*fs.FileSet {
+	sets, orphans := fs.GroupFiles(roms)
+	for _, orphan := range orphans {
+		sets = append(sets, &fs.FileSet{Primary: orphan})
+	}
+	return sets
+}
+
+// planSet plans the moves for one ROM and its tracks, returning why it should
+// be left alone instead if it should. A set is only renamed if every file in
+// it is verified, since a cue sheet names its tracks.
+func (c Config) planSet(idx *dat.Index, set *fs.FileSet, all []*fs.File) ([]Move, string, error) {
+	moves := make([]Move, 0)
+	var folder string
+	for _, f := range set.Files() {
+		sum, err := dat.SHA1File(f.Absolute)
+		if err != nil {
+			return nil, "", err
+		}
+		result := idx.Verify(f.Name, sum)
+		if result.Status != dat.Verified {
+			return nil, "not a verified dump (" + string(result.Status) + ")", nil
+		}
+		if f == set.Primary {
+			folder = c.systemFolder(result.Match.System)
+		}
+		dir := filepath.Dir(f.Absolute)
+		if folder != "" {
+			dir = filepath.Join(c.RomsFolder, folder)
+		}
+		to := filepath.Join(dir, result.Match.Rom)
+		if to == f.Absolute {
+			continue
+		}
+		moves = append(moves, Move{From: f.Absolute, To: to})
+		moves = append(moves, companionMoves(f, to, all)...)
+	}
+	for _, m := range moves {
+		_, err := os.Stat(m.To)
+		if err == nil {
+			return nil, filepath.Base(m.To) + " already exists", nil
+		}
+	}
+	return moves, "", nil
+}
+
+// companionMoves moves the files named after the ROM at rom, such as its
+// saves and states, along with it to to.
+func companionMoves(rom *fs.File, to string, all []*fs.File) []Move {
+	oldBase := strings.TrimSuffix(rom.Name, filepath.Ext(rom.Name))
+	newBase := strings.TrimSuffix(filepath.Base(to), filepath.Ext(to))
+	moves := make([]Move, 0)
+	for _, f := range all {
+		if f == rom || f.FileType == fs.Rom || filepath.Dir(f.Absolute) != filepath.Dir(rom.Absolute) {
+			continue
+		}
+		suffix, ok := strings.CutPrefix(f.Name, oldBase+".")
+		if !ok {
+			continue
+		}
+		moves = append(moves, Move{From: f.Absolute, To: filepath.Join(filepath.Dir(to), newBase+"."+suffix)})
+	}
+	return moves
+}
+
+// ApplyOrganize carries out the plan. Every move is journaled before any is
+// made, so UndoOrganize can put things back even after a crash part way.
+func ApplyOrganize(ctx context.Context, cfg Config, plan OrganizePlan) (string, error) {
+	if len(plan.Moves) == 0 {
+		return "", nil
+	}
+	dir := cfg.organizeJournalDir()
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to create organize journal directory")
+	}
+	journal := filepath.Join(dir, clock.Now(ctx).UTC().Format("20060102T150405Z")+".json")
+	b, err := json.MarshalIndent(plan.Moves, "", "  ")
+	if err != nil {
+		return "", eris.Wrap(err, "failed to marshal organize journal")
+	}
+	err = os.WriteFile(journal, b, 0644)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to write organize journal")
+	}
+
+	for _, m := range plan.Moves {
+		err = moveFile(m.From, m.To)
+		if err != nil {
+			return journal, err
+		}
+		log.FromCtx(ctx).Info("Moved", zap.String("from", m.From), zap.String("to", m.To))
+	}
+	return journal, nil
+}
+
+// UndoOrganize reverts the most recent ApplyOrganize, returning the moves it
+// reverted. Moves that were never made, or whose file has since been moved
+// again, are left alone.
+func UndoOrganize(ctx context.Context, cfg Config) ([]Move, error) {
+	journals, err := filepath.Glob(filepath.Join(cfg.organizeJournalDir(), "*.json"))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to list organize journals")
+	}
+	if len(journals) == 0 {
+		return nil, eris.Wrap(errors.NotFoundError, "nothing to undo")
+	}
+	sort.Strings(journals)
+	journal := journals[len(journals)-1]
+	b, err := os.ReadFile(journal)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read organize journal")
+	}
+	moves := make([]Move, 0)
+	err = json.Unmarshal(b, &moves)
+	if err != nil {
+		return nil, eris.Wrapf(err, "invalid organize journal %s", journal)
+	}
+
+	reverted := make([]Move, 0, len(moves))
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		if _, err := os.Stat(m.To); err != nil {
+			continue
+		}
+		if _, err := os.Stat(m.From); err == nil {
+			continue
+		}
+		err = moveFile(m.To, m.From)
+		if err != nil {
+			return reverted, err
+		}
+		log.FromCtx(ctx).Info("Moved back", zap.String("from", m.To), zap.String("to", m.From))
+		reverted = append(reverted, Move{From: m.To, To: m.From})
+	}
+	return reverted, os.Remove(journal)
+}
+
+func moveFile(from, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), os.ModePerm)
+	if err != nil {
+		return eris.Wrapf(err, "failed to create %s", filepath.Dir(to))
+	}
+	err = os.Rename(from, to)
+	if err != nil {
+		return eris.Wrapf(err, "failed to move %s to %s", from, to)
+	}
+	return nil
+}
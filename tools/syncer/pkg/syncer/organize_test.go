@@ -0,0 +1,158 @@
+package syncer_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+const organizeDat = `<?xml version="1.0"?>
+<datafile>
+	<header>
+		<name>Nintendo - Super Nintendo Entertainment System (Parent-Clone)</name>
+	</header>
+	<game name="Chrono Trigger (USA)">
+		<rom name="Chrono Trigger (USA).sfc" size="6" sha1="%s"/>
+	</game>
+	<game name="Super Metroid (USA)">
+		<rom name="Super Metroid (USA).sfc" size="7" sha1="%s"/>
+	</game>
+</datafile>`
+
+var _ = Describe("Organize", func() {
+	var (
+		ctx context.Context
+		cfg syncer.Config
+	)
+
+	sum := func(content string) string {
+		h := sha1.Sum([]byte(content))
+		return hex.EncodeToString(h[:])
+	}
+
+	// write creates the file at rel, relative to the RomsFolder.
+	write := func(rel, content string) string {
+		p := filepath.Join(cfg.RomsFolder, rel)
+		Expect(os.MkdirAll(filepath.Dir(p), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(p, []byte(content), 0644)).To(Succeed())
+		return p
+	}
+
+	// rom returns the absolute path of rel in the RomsFolder.
+	rom := func(rel string) string {
+		return filepath.Join(cfg.RomsFolder, rel)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir := GinkgoT().TempDir()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+		}
+		cfg.Dat.Folder = filepath.Join(dir, "dats")
+		Expect(os.MkdirAll(cfg.Dat.Folder, os.ModePerm)).To(Succeed())
+		dat := fmt.Sprintf(organizeDat, sum("chrono"), sum("metroid"))
+		Expect(os.WriteFile(filepath.Join(cfg.Dat.Folder, "snes.dat"), []byte(dat), 0644)).To(Succeed())
+	})
+
+	It("renames a verified ROM into its system's folder with its saves and states", func() {
+		write("misc/chrono.sfc", "chrono")
+		write("misc/chrono.srm", "save")
+		write("misc/chrono.state", "state")
+
+		plan, err := syncer.PlanOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Skipped).To(BeEmpty())
+		Expect(plan.Moves).To(ConsistOf(
+			syncer.Move{From: rom("misc/chrono.sfc"), To: rom("snes/Chrono Trigger (USA).sfc")},
+			syncer.Move{From: rom("misc/chrono.srm"), To: rom("snes/Chrono Trigger (USA).srm")},
+			syncer.Move{From: rom("misc/chrono.state"), To: rom("snes/Chrono Trigger (USA).state")},
+		))
+
+		_, err = syncer.ApplyOrganize(ctx, cfg, plan)
+		Expect(err).NotTo(HaveOccurred())
+		for _, m := range plan.Moves {
+			Expect(m.From).NotTo(BeAnExistingFile())
+			Expect(m.To).To(BeAnExistingFile())
+		}
+		content, err := os.ReadFile(rom("snes/Chrono Trigger (USA).srm"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("save"))
+	})
+
+	It("skips unverified ROMs and names already taken", func() {
+		write("snes/homebrew.sfc", "homebrew")
+		write("snes/metroid.sfc", "metroid")
+		write("snes/Super Metroid (USA).sfc", "a hack")
+
+		plan, err := syncer.PlanOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Moves).To(BeEmpty())
+		Expect(plan.Skipped).To(ConsistOf(
+			syncer.OrganizeSkip{Path: "snes/homebrew.sfc", Reason: "not a verified dump (unknown)"},
+			syncer.OrganizeSkip{Path: "snes/metroid.sfc", Reason: "Super Metroid (USA).sfc already exists"},
+			syncer.OrganizeSkip{Path: "snes/Super Metroid (USA).sfc", Reason: "not a verified dump (mismatch)"},
+		))
+	})
+
+	It("renames only one of two ROMs with the same canonical name", func() {
+		write("snes/chrono.sfc", "chrono")
+		write("snes/chrono (copy).sfc", "chrono")
+
+		plan, err := syncer.PlanOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Moves).To(HaveLen(1))
+		Expect(plan.Moves[0].To).To(Equal(rom("snes/Chrono Trigger (USA).sfc")))
+		Expect(plan.Skipped).To(HaveLen(1))
+		Expect(plan.Skipped[0].Reason).To(Equal("another ROM is being renamed to Chrono Trigger (USA).sfc"))
+		Expect(rom(plan.Skipped[0].Path)).NotTo(Equal(plan.Moves[0].From))
+	})
+
+	It("undoes every move", func() {
+		write("misc/chrono.sfc", "chrono")
+		write("misc/chrono.srm", "save")
+		write("snes/metroid.sfc", "metroid")
+		plan, err := syncer.PlanOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Moves).To(HaveLen(3))
+		journal, err := syncer.ApplyOrganize(ctx, cfg, plan)
+		Expect(err).NotTo(HaveOccurred())
+
+		reverted, err := syncer.UndoOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reverted).To(HaveLen(3))
+		for _, m := range plan.Moves {
+			Expect(m.From).To(BeAnExistingFile())
+			Expect(m.To).NotTo(BeAnExistingFile())
+		}
+		Expect(journal).NotTo(BeAnExistingFile())
+	})
+
+	It("undoes a partially applied journal", func() {
+		write("snes/chrono.sfc", "chrono")
+		plan := syncer.OrganizePlan{Moves: []syncer.Move{
+			{From: rom("snes/chrono.sfc"), To: rom("snes/Chrono Trigger (USA).sfc")},
+			{From: rom("snes/gone.sfc"), To: rom("snes/Super Metroid (USA).sfc")},
+		}}
+		journal, err := syncer.ApplyOrganize(ctx, cfg, plan)
+		Expect(err).To(HaveOccurred())
+		Expect(journal).To(BeAnExistingFile())
+
+		reverted, err := syncer.UndoOrganize(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reverted).To(Equal([]syncer.Move{
+			{From: rom("snes/Chrono Trigger (USA).sfc"), To: rom("snes/chrono.sfc")},
+		}))
+		Expect(rom("snes/chrono.sfc")).To(BeAnExistingFile())
+		Expect(journal).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,109 @@
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// Profile is the filesystem layout of a retro gaming distribution. Applying
+// a profile fills in every folder the config leaves unset. Folders starting
+// with "~/" are relative to the home directory.
+type Profile struct {
+	RomsFolder        string
+	SavesFolder       string
+	StatesFolder      string
+	ConfigsFolder     string
+	BiosFolder        string
+	ScreenshotsFolder string
+}
+
+// Layout profile names.
+const (
+	ProfileRetroPie = "retropie"
+	ProfileBatocera = "batocera"
+	ProfileRecalbox = "recalbox"
+	ProfileLakka    = "lakka"
+)
+
+var profiles = map[string]Profile{
+	// RetroPie keeps saves and states next to the games.
+	ProfileRetroPie: {
+		RomsFolder:    "~/RetroPie/roms",
+		ConfigsFolder: defaultConfigsFolder,
+		BiosFolder:    "~/RetroPie/BIOS",
+	},
+	ProfileBatocera: {
+		RomsFolder:        "/userdata/roms",
+		SavesFolder:       "/userdata/saves",
+		ConfigsFolder:     "/userdata/system/configs",
+		BiosFolder:        "/userdata/bios",
+		ScreenshotsFolder: "/userdata/screenshots",
+	},
+	ProfileRecalbox: {
+		RomsFolder:        "/recalbox/share/roms",
+		SavesFolder:       "/recalbox/share/saves",
+		ConfigsFolder:     "/recalbox/share/system/configs",
+		BiosFolder:        "/recalbox/share/bios",
+		ScreenshotsFolder: "/recalbox/share/screenshots",
+	},
+	// Lakka is plain RetroArch, which keeps saves and states apart.
+	ProfileLakka: {
+		RomsFolder:        "/storage/roms",
+		SavesFolder:       "/storage/savefiles",
+		StatesFolder:      "/storage/savestates",
+		ConfigsFolder:     "/storage/.config/retroarch/config",
+		BiosFolder:        "/storage/system",
+		ScreenshotsFolder: "/storage/screenshots",
+	},
+}
+
+// Profiles lists the names of the known layout profiles.
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile fills in the folders the config leaves unset from the
+// selected profile.
+func (c *Config) applyProfile() error {
+	if c.Profile == "" {
+		return nil
+	}
+	p, ok := profiles[strings.ToLower(c.Profile)]
+	if !ok {
+		return errors.WithCategory(eris.Errorf("unknown profile %q; expected one of %s", c.Profile, strings.Join(Profiles(), ", ")), errors.ConfigCategory)
+	}
+	fill := func(field *string, value string) {
+		if *field == "" && value != "" {
+			*field = expandHome(value)
+		}
+	}
+	fill(&c.RomsFolder, p.RomsFolder)
+	fill(&c.Saves.Folder, p.SavesFolder)
+	fill(&c.Saves.StatesFolder, p.StatesFolder)
+	fill(&c.Configs.Folder, p.ConfigsFolder)
+	fill(&c.Bios.Folder, p.BiosFolder)
+	fill(&c.Screenshots.Folder, p.ScreenshotsFolder)
+	return nil
+}
+
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
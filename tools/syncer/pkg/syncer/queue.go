@@ -0,0 +1,73 @@
+package syncer
+
+import (
+	"context"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+)
+
+// connect checks the storage can be reached and initializes it the first
+// time a sync needs it, rather than when the syncer is created, so a sync
+// that can't reach it still plans and queues its uploads. What the check
+// found is recorded in the run.
+func (s *syncer) connect(ctx context.Context, run *history.Run) error {
+	if s.connected {
+		return nil
+	}
+	if preflighter, ok := s.storage.(storage.Preflighter); ok {
+		err := preflighter.Preflight(ctx)
+		run.Connectivity = string(storage.ConnectivityOf(err))
+		if err != nil {
+			return err
+		}
+	}
+	err := s.storage.Init(ctx)
+	if err != nil {
+		return err
+	}
+	s.connected = true
+	return nil
+}
+
+// unreachable reports whether err means storage couldn't be reached, e.g.
+// because the device is offline.
+func unreachable(err error) bool {
+	return err != nil && errors.CategoryOf(err) == errors.NetworkCategory
+}
+
+// queued notes on err, if storage couldn't be reached, how many uploads are
+// left queued for the next sync.
+func (s *syncer) queued(err error) error {
+	if !unreachable(err) || s.queue.Len() == 0 {
+		return err
+	}
+	return eris.Wrapf(err, "storage unreachable; %d uploads queued for the next sync", s.queue.Len())
+}
+
+// Queued returns the uploads left queued by the last sync, e.g. because
+// storage couldn't be reached.
+func Queued(cfg Config) ([]queue.Entry, error) {
+	q, err := queue.Load(cfg.QueueFile())
+	if err != nil {
+		return nil, err
+	}
+	return q.Entries(), nil
+}
+
+// Reachable checks that storage can be reached, with a ping where the
+// backend supports one and otherwise by initializing it.
+func Reachable(ctx context.Context, cfg Config) error {
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if pinger, ok := client.(storage.Pinger); ok {
+		_, err = pinger.Ping(ctx)
+		return err
+	}
+	return client.Init(ctx)
+}
@@ -0,0 +1,175 @@
+package syncer
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+// MetadataRepairReport lists the records rebuilt from uploads the metadata
+// store was missing, the records of uploads that are no longer stored, and
+// the keys of uploads whose file can't be told from the key alone, such as
+// blobs of the content layout.
+type MetadataRepairReport struct {
+	Rebuilt      []metadata.FileMetadata `json:"rebuilt"`
+	Orphaned     []metadata.FileMetadata `json:"orphaned"`
+	Unrecognized []string                `json:"unrecognized,omitempty"`
+}
+
+// RepairMetadata compares the metadata store with what storage holds.
+// Metadata is recorded after each upload succeeds, and a failure to record
+// it doesn't fail the sync, so the two can drift. Every stored upload whose
+// key isn't recorded, and whose path the key template gives, is recorded
+// again, as uploaded and last modified when the object was stored. Records,
+// earlier versions included, whose object is gone are reported but kept,
+// since they are all that is left of the upload. With dryRun set, nothing
+// is recorded.
+func RepairMetadata(ctx context.Context, cfg Config, dryRun bool) (MetadataRepairReport, error) {
+	if cfg.Backend() != "s3" {
+		return MetadataRepairReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support key templates", cfg.Backend())
+	}
+	keys, err := storage.NewKeyBuilder(cfg.Storage.S3.Prefix, cfg.Storage.S3.KeyTemplate)
+	if err != nil {
+		return MetadataRepairReport{}, errors.WithCategory(err, errors.ConfigCategory)
+	}
+	keys = keys.Encoded(cfg.Storage.S3.KeyEncoding)
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return MetadataRepairReport{}, err
+	}
+	if store == nil {
+		return MetadataRepairReport{}, errors.WithCategory(eris.New("repairing metadata requires the metadata store; metadata.backend is none"), errors.ConfigCategory)
+	}
+	defer store.Close()
+
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return MetadataRepairReport{}, err
+	}
+	lister, ok := client.(storage.Lister)
+	if !ok {
+		return MetadataRepairReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support listing", cfg.Backend())
+	}
+	verifier, _ := client.(storage.Verifier)
+	err = client.Init(ctx)
+	if err != nil {
+		return MetadataRepairReport{}, err
+	}
+
+	objects, err := lister.List(ctx)
+	if err != nil {
+		return MetadataRepairReport{}, err
+	}
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+	}
+
+	report := MetadataRepairReport{Rebuilt: make([]metadata.FileMetadata, 0), Orphaned: make([]metadata.FileMetadata, 0)}
+	files, err := store.ListFiles(ctx)
+	if err != nil {
+		return report, err
+	}
+	recorded := make(map[string]bool)
+	for _, file := range files {
+		versions, err := store.ListVersions(ctx, file.Path)
+		if err != nil {
+			return report, err
+		}
+		for _, md := range versions {
+			recorded[md.Key] = true
+			if !stored[md.Key] {
+				report.Orphaned = append(report.Orphaned, md)
+			}
+		}
+	}
+
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		if recorded[obj.Key] {
+			continue
+		}
+		fields, ok := keys.Parse(obj.Key)
+		if obj.Blob || !ok || fields.Name == "" {
+			report.Unrecognized = append(report.Unrecognized, obj.Key)
+			continue
+		}
+		if fields.Dir == manifestDir {
+			// The sync's own manifests are never recorded.
+			continue
+		}
+		md := metadata.FileMetadata{
+			Path:         path.Join(fields.Dir, fields.Name),
+			Key:          obj.Key,
+			SHA256:       fields.SHA256,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			UploadedAt:   obj.LastModified,
+			DeviceID:     fields.Device,
+		}
+		if md.SHA256 == "" && verifier != nil {
+			md.SHA256, err = verifier.RemoteChecksum(ctx, obj.Key, false)
+			if err != nil {
+				return report, err
+			}
+		}
+		report.Rebuilt = append(report.Rebuilt, md)
+	}
+	sort.SliceStable(report.Rebuilt, func(i, j int) bool {
+		a, b := report.Rebuilt[i], report.Rebuilt[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.UploadedAt.Before(b.UploadedAt)
+	})
+
+	if !dryRun {
+		err = restoreRecords(ctx, store, report.Rebuilt)
+		if err != nil {
+			return report, err
+		}
+	}
+	log.FromCtx(ctx).Info("Repaired metadata",
+		zap.Int("rebuilt", len(report.Rebuilt)),
+		zap.Int("orphaned", len(report.Orphaned)),
+		zap.Int("unrecognized", len(report.Unrecognized)),
+		zap.Bool("dryRun", dryRun),
+	)
+	return report, nil
+}
+
+// restoreRecords records the rebuilt uploads, ordered by path and then
+// oldest first. Recording an upload makes it the file's latest, so where a
+// file's recorded latest upload is newer than those rebuilt, it is recorded
+// again, which leaves its version as it was.
+func restoreRecords(ctx context.Context, store metadata.Store, rebuilt []metadata.FileMetadata) error {
+	for i, md := range rebuilt {
+		err := store.StoreFileMetadata(ctx, md)
+		if err != nil {
+			return err
+		}
+		if i+1 < len(rebuilt) && rebuilt[i+1].Path == md.Path {
+			continue
+		}
+		latest, err := store.ListVersions(ctx, md.Path)
+		if err != nil {
+			return err
+		}
+		if len(latest) > 0 && latest[0].UploadedAt.After(md.UploadedAt) {
+			err = store.StoreFileMetadata(ctx, latest[0])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
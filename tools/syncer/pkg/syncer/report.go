@@ -0,0 +1,37 @@
+package syncer
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/library"
+)
+
+// LibraryReport summarizes the RomsFolder, whichever file types are enabled
+// for syncing, checking BIOS requirements against the BIOS folder.
+func LibraryReport(ctx context.Context, cfg Config) (library.Report, error) {
+	romDir, err := cfg.RomsDirectory(ctx)
+	if err != nil {
+		return library.Report{}, err
+	}
+	files := make([]*fs.File, 0)
+	for _, fileType := range []fs.FileType{fs.Rom, fs.Save, fs.State, fs.Screenshot} {
+		matching, err := romDir.GetMatchingFiles(fileType)
+		if err != nil {
+			return library.Report{}, err
+		}
+		files = append(files, matching...)
+	}
+
+	biosFiles, err := cfg.BiosFiles(ctx)
+	if err != nil {
+		return library.Report{}, err
+	}
+	bios := make([]string, 0, len(biosFiles))
+	for _, f := range biosFiles {
+		bios = append(bios, strings.TrimPrefix(path.Join(f.Dir, f.Name), biosRemoteDir+"/"))
+	}
+	return library.Build(ctx, files, bios)
+}
@@ -0,0 +1,65 @@
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/rotisserie/eris"
+)
+
+// spaceMargin is left free on top of what downloads need, for the backups
+// of the files they replace and everything else writing to the disk.
+const spaceMargin int64 = 64 * 1024 * 1024
+
+// checkSpace fails if downloading files, which maps each local path to
+// download to the size of its upload, could fill the disk. Only the growth
+// of a replaced file counts. The files must fit in the free space of every
+// filesystem they are written to, which is exact when, as on most devices,
+// they all live on one. Unless the platform can't tell how much space is
+// free, only skip skips the check.
+func checkSpace(files map[string]int64, skip bool) error {
+	if skip || len(files) == 0 {
+		return nil
+	}
+	var need int64
+	dirs := make(map[string]bool)
+	for dest, size := range files {
+		info, err := os.Stat(dest)
+		if err == nil {
+			size -= info.Size()
+		}
+		if size > 0 {
+			need += size
+		}
+		dirs[existingDir(filepath.Dir(dest))] = true
+	}
+	for dir := range dirs {
+		free, err := fs.FreeSpace(dir)
+		if eris.Is(err, errors.NotImplementedError) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if uint64(need+spaceMargin) > free {
+			return errors.WithCategory(eris.Errorf("downloading needs %s but %s has only %s free; free up space, or pass --ignore-space to download anyway",
+				progress.FormatBytes(need), dir, progress.FormatBytes(int64(free))), errors.ConflictCategory)
+		}
+	}
+	return nil
+}
+
+// existingDir returns dir, or its closest ancestor that exists.
+func existingDir(dir string) string {
+	for {
+		_, err := os.Stat(dir)
+		parent := filepath.Dir(dir)
+		if err == nil || parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,71 @@
+package syncer_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Free space", func() {
+	// slack absorbs whatever else writes to the disk while a spec runs.
+	const slack int64 = 16 * 1024 * 1024
+
+	var (
+		dir  string
+		free int64
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		n, err := fs.FreeSpace(dir)
+		if eris.Is(err, errors.NotImplementedError) {
+			Skip("free space is unknown on this platform")
+		}
+		Expect(err).NotTo(HaveOccurred())
+		free = int64(n)
+	})
+
+	It("passes downloads that fit with the margin to spare", func() {
+		err := syncer.CheckSpace(map[string]int64{
+			filepath.Join(dir, "snes", "Game.sfc"): free - syncer.SpaceMargin - slack,
+		}, false)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails downloads that would eat into the margin", func() {
+		err := syncer.CheckSpace(map[string]int64{
+			filepath.Join(dir, "a.sfc"): free - syncer.SpaceMargin,
+			filepath.Join(dir, "b.sfc"): slack,
+		}, false)
+		Expect(errors.CategoryOf(err)).To(Equal(errors.ConflictCategory))
+		Expect(err.Error()).To(ContainSubstring("--ignore-space"))
+	})
+
+	It("only counts the growth of files being replaced", func() {
+		// A sparse file is as large as the disk's free space without using it.
+		existing := filepath.Join(dir, "Game.iso")
+		f, err := os.Create(existing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Truncate(2 * free)).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		err = syncer.CheckSpace(map[string]int64{existing: 2*free + slack}, false)
+		Expect(err).NotTo(HaveOccurred())
+		err = syncer.CheckSpace(map[string]int64{existing: free}, false)
+		Expect(err).NotTo(HaveOccurred())
+		err = syncer.CheckSpace(map[string]int64{filepath.Join(dir, "Other.iso"): 2*free + slack}, false)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("skips the check when asked to", func() {
+		err := syncer.CheckSpace(map[string]int64{filepath.Join(dir, "Game.iso"): 2 * free}, true)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -2,112 +2,1052 @@ package syncer
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path"
 	"time"
 
+	"github.com/TrevorEdris/retropie-utils/pkg/cache"
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/dat"
+	"github.com/TrevorEdris/retropie-utils/pkg/device"
+	rperrors "github.com/TrevorEdris/retropie-utils/pkg/errors"
 	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/history"
+	"github.com/TrevorEdris/retropie-utils/pkg/lock"
 	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/notify"
+	"github.com/TrevorEdris/retropie-utils/pkg/openfiles"
+	"github.com/TrevorEdris/retropie-utils/pkg/power"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/pkg/queue"
 	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/google/uuid"
 	"github.com/rotisserie/eris"
 	"go.uber.org/zap"
 )
 
 type (
 	Syncer interface {
-		Sync(ctx context.Context) error
+		// Sync uploads the enabled file types and returns a summary of the
+		// run, which is also recorded in the sync history.
+		Sync(ctx context.Context) (history.Run, error)
 	}
 
 	syncer struct {
-		cfg     Config
-		storage storage.Storage
+		cfg       Config
+		storage   storage.Storage
+		notifiers []notify.Notifier
+		device    device.Identity
+		// intervals holds the minimum time between uploads of each file
+		// type with one configured.
+		intervals map[fs.FileType]time.Duration
+		// openMetadata opens the metadata store at the start of a Sync.
+		openMetadata func() (metadata.Store, error)
+		// metadata is open only for the duration of a Sync; nil if disabled.
+		metadata metadata.Store
+		// latest holds the latest upload of every file, by fs.PathID of
+		// its path, loaded from metadata once per Sync so checking a file
+		// is a map lookup.
+		latest map[string]metadata.FileMetadata
+		// cache is loaded for the duration of a Sync; nil if disabled.
+		cache *cache.Cache
+		// downloads records the version of each file downloaded from
+		// another device; loaded for the duration of a Sync along with
+		// metadata.
+		downloads *cache.Cache
+		// writing holds the files open for writing when the Sync started;
+		// nil unless Stability.SkipOpen is set.
+		writing map[string]bool
+		// queue journals the uploads of a Sync until each is stored; loaded
+		// for the duration of a Sync.
+		queue *queue.Queue
+		// connected is set once the storage has been checked and
+		// initialized this Sync.
+		connected bool
+		// prefetched is set once the storage has been prefetched this Sync.
+		prefetched bool
+		// dat is loaded for the duration of a Sync; nil if no DATs are
+		// configured.
+		dat *dat.Index
 	}
 
-	Schedule struct{}
-)
+	// batch is the plan for one kind of file: the sets to upload and the
+	// files the sync cache showed were unchanged.
+	batch struct {
+		sets      []*fs.FileSet
+		unchanged []*fs.File
+		// manifest is set for files in the RomsFolder, which the manifest
+		// describes.
+		manifest bool
+	}
 
-const (
-	// timeToDirFmt describes the folder structure for storing files
-	// in a time-based format, such that the same file uploaded twice
-	// but at separate hours would be stored in two separate locations.
-	//
-	// Example:
-	// December 17, 2023 at 1:18pm EST
-	// 2023/12/17/1
-	timeToDirFmt = "2006/01/02/15"
+	Schedule struct{}
 )
 
 func NewSyncer(ctx context.Context, cfg Config) (Syncer, error) {
-	var storageClient storage.Storage
-	var err error
-	if cfg.Storage.S3.Enabled {
-		storageClient, err = storage.NewS3Storage(ctx, cfg.Storage.S3)
-	} else if cfg.Storage.SFTP.Enabled {
-		storageClient, err = storage.NewSFTPStorage(cfg.Storage.SFTP)
-	} else if cfg.Storage.GoogleDrive.Enabled {
-		storageClient, err = storage.NewGoogleDriveStorage(cfg.Storage.GoogleDrive)
-	} else {
-		err = eris.New("no storage clients enabled")
-	}
+	backends, err := newBackends(ctx, cfg, func(name string, b storage.Storage) storage.Storage {
+		return storage.NewRetryingStorage(storage.NewTimeoutStorage(b, cfg.timeouts(name)), cfg.Storage.Retry)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = storageClient.Init(ctx)
+	storageClient := backends[0].Storage
+	if len(backends) > 1 {
+		storageClient = storage.NewMirroredStorage(backends[0], backends[1:], cfg.MirrorQueueFile())
+	}
+	notifiers, err := cfg.Notifiers()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
+	identity, err := cfg.Device()
 	if err != nil {
 		return nil, err
 	}
+	intervals, err := cfg.minIntervals()
+	if err != nil {
+		return nil, rperrors.WithCategory(err, rperrors.ConfigCategory)
+	}
 	return &syncer{
-		cfg:     cfg,
-		storage: storageClient,
+		cfg:          cfg,
+		storage:      storageClient,
+		notifiers:    notifiers,
+		device:       identity,
+		intervals:    intervals,
+		openMetadata: cfg.MetadataStore,
 	}, nil
 }
 
-func (s *syncer) Sync(ctx context.Context) error {
+// NewStorage creates the primary storage backend, without initializing it.
+func NewStorage(ctx context.Context, cfg Config) (storage.Storage, error) {
+	return newBackend(ctx, cfg, cfg.Backend())
+}
+
+// newBackends creates every enabled storage backend, the primary first,
+// each wrapped by wrap, without initializing them.
+func newBackends(ctx context.Context, cfg Config, wrap func(name string, b storage.Storage) storage.Storage) ([]storage.Mirror, error) {
+	names := cfg.Backends()
+	if len(names) == 0 {
+		// So newBackend reports that none is enabled.
+		names = []string{cfg.Backend()}
+	}
+	backends := make([]storage.Mirror, 0, len(names))
+	for _, name := range names {
+		b, err := newBackend(ctx, cfg, name)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to create %s storage", name)
+		}
+		backends = append(backends, storage.Mirror{Name: name, Storage: wrap(name, b)})
+	}
+	return backends, nil
+}
+
+// newReadStorage creates the primary storage backend, falling back to the
+// mirrors for downloads while it can't be reached.
+func newReadStorage(ctx context.Context, cfg Config) (storage.Storage, error) {
+	backends, err := newBackends(ctx, cfg, func(name string, b storage.Storage) storage.Storage {
+		return b
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(backends) == 1 {
+		return backends[0].Storage, nil
+	}
+	// Nothing is stored through it, so there is nothing to journal.
+	return storage.NewMirroredStorage(backends[0], backends[1:], ""), nil
+}
+
+// newBackend creates the named storage backend, without initializing it.
+func newBackend(ctx context.Context, cfg Config, name string) (storage.Storage, error) {
+	switch name {
+	case "s3":
+		s3cfg := cfg.Storage.S3
+		identity, err := cfg.Device()
+		if err != nil {
+			return nil, err
+		}
+		s3cfg.DeviceID = identity.ID
+		return storage.NewS3Storage(ctx, s3cfg)
+	case "sftp":
+		return storage.NewSFTPStorage(cfg.Storage.SFTP)
+	case "rclone":
+		return storage.NewRcloneStorage(cfg.Storage.Rclone)
+	case "googleDrive":
+		return storage.NewGoogleDriveStorage(cfg.Storage.GoogleDrive)
+	default:
+		return nil, rperrors.WithCategory(eris.New("no storage clients enabled"), rperrors.ConfigCategory)
+	}
+}
+
+func (s *syncer) Sync(ctx context.Context) (result history.Run, err error) {
+	// Only one sync may run at a time, whether started by hand, on a
+	// schedule, or from the dashboard.
+	l, err := lock.Acquire(ctx, s.cfg.LockFile(), s.cfg.LockStaleAfter)
+	if err != nil {
+		return history.Run{}, err
+	}
+	defer func() {
+		releaseErr := l.Release()
+		if releaseErr != nil {
+			log.FromCtx(ctx).Warn("Failed to release sync lock", zap.Error(releaseErr))
+		}
+	}()
+
+	// Scope everything recorded during this run to a single run_id so one
+	// sync can be isolated from the others.
+	run := &history.Run{
+		ID:         uuid.New().String(),
+		StartedAt:  clock.Now(ctx),
+		DeviceID:   s.device.ID,
+		DeviceName: s.device.Name,
+	}
+	ctx = log.ToCtx(ctx, log.FromCtx(ctx).With(zap.String("run_id", run.ID), zap.String("device", s.device.String())))
+	notify.StartAll(ctx, s.notifiers, run.ID)
+	defer func() {
+		// Record and report the run even if it was cancelled.
+		ctx := context.WithoutCancel(ctx)
+		s.record(ctx, run, err)
+		notify.NotifyAll(ctx, s.notifiers, *run)
+		result = *run
+	}()
+
+	s.metadata, err = s.openMetadata()
+	if err != nil {
+		return *run, err
+	}
+	if s.metadata != nil {
+		defer func() {
+			closeErr := s.metadata.Close()
+			if closeErr != nil {
+				log.FromCtx(ctx).Warn("Failed to close metadata store", zap.Error(closeErr))
+			}
+			s.metadata = nil
+			s.latest = nil
+		}()
+		s.latest, err = latestUploads(ctx, s.metadata)
+		if err != nil {
+			return *run, err
+		}
+		s.downloads, err = s.cfg.Downloads()
+		if err != nil {
+			return *run, err
+		}
+		defer func() {
+			saveErr := s.downloads.Save()
+			if saveErr != nil {
+				log.FromCtx(ctx).Warn("Failed to save download record", zap.Error(saveErr))
+			}
+			s.downloads = nil
+		}()
+	}
+
+	s.dat, err = s.cfg.DatIndex()
+	if err != nil {
+		return *run, err
+	}
+	defer func() {
+		s.dat = nil
+	}()
+
+	s.cache, err = s.cfg.SyncCache()
+	if err != nil {
+		return *run, err
+	}
+	defer func() {
+		if s.cache != nil {
+			saveErr := s.cache.Save()
+			if saveErr != nil {
+				log.FromCtx(ctx).Warn("Failed to save sync cache", zap.Error(saveErr))
+			}
+		}
+		s.cache = nil
+		s.connected = false
+		s.prefetched = false
+	}()
+
+	s.queue, err = queue.Load(s.cfg.QueueFile())
+	if err != nil {
+		return *run, err
+	}
+	defer func() {
+		saveErr := s.queue.Save()
+		if saveErr != nil {
+			log.FromCtx(ctx).Warn("Failed to save upload queue", zap.Error(saveErr))
+		}
+		s.queue = nil
+	}()
+	defer func() {
+		// Wait for the mirrors even if the sync was cancelled, so whatever
+		// they didn't store is journaled for the next one.
+		if s.connected {
+			s.flush(context.WithoutCancel(ctx))
+		}
+	}()
+
+	if len(s.intervals) > 0 && s.metadata == nil && s.cache == nil {
+		log.FromCtx(ctx).Warn("sync.minInterval needs the metadata store or sync cache to know when files were uploaded; ignoring it")
+	}
+
+	if s.cfg.Stability.SkipOpen {
+		s.writing, err = openfiles.Writing(openfiles.DefaultProcRoot)
+		if err != nil {
+			return *run, err
+		}
+		defer func() {
+			s.writing = nil
+		}()
+	}
+
+	log.FromCtx(ctx).Info("Syncs enabled", zap.Bool("roms", s.cfg.Sync.Roms), zap.Bool("saves", s.cfg.Sync.Saves), zap.Bool("states", s.cfg.Sync.States), zap.Bool("configs", s.cfg.Sync.Configs), zap.Bool("bios", s.cfg.Sync.Bios), zap.Bool("screenshots", s.cfg.Sync.Screenshots))
+	throttled := s.throttled(ctx)
+	if throttled {
+		log.FromCtx(ctx).Warn("Device is throttled; only syncing saves")
+	}
+	err = s.cfg.checkMounted()
+	if err != nil {
+		return *run, err
+	}
+	// Downloading first lets the upload below see the other devices'
+	// changes, rather than flag them as conflicts.
+	if s.cfg.direction().downloads() {
+		err = s.connect(ctx, run)
+		if err == nil {
+			log.FromCtx(ctx).Info("Downloading other devices' uploads")
+			err = s.download(ctx, run, throttled)
+		}
+		// Offline, the uploads are still worth queuing.
+		if unreachable(err) && s.cfg.direction().uploads() {
+			log.FromCtx(ctx).Warn("Storage unreachable; skipping download", zap.Error(err))
+		} else if err != nil {
+			return *run, err
+		}
+	}
+	if !s.cfg.direction().uploads() {
+		// A download-only sync is a restore, so check nothing is missing.
+		if s.cfg.Manifest.Enabled {
+			err = s.verifyRestore(ctx, run)
+			if err != nil {
+				return *run, err
+			}
+		}
+		return *run, s.checkFailures(run)
+	}
+
 	log.FromCtx(ctx).Info("Looking for roms in subfolders", zap.String("directory", s.cfg.RomsFolder))
-	romDir, err := fs.NewDirectory(ctx, s.cfg.RomsFolder)
+	// Directories are read as they are planned, one at a time, so only the
+	// files to upload are held rather than the whole library.
+	romDir, err := s.cfg.directory(ctx, s.cfg.RomsFolder, fs.WithoutScan())
 	if err != nil {
-		return err
+		return *run, err
 	}
-	if len(romDir.GetAllFiles()) == 0 {
-		log.FromCtx(ctx).Warn("No files found", zap.String("directory", s.cfg.RomsFolder))
+	remoteDir := s.cfg.RemoteDir(run.StartedAt)
+	// Everything is planned before anything is uploaded, so a run over
+	// its limits uploads nothing.
+	batches := make([]batch, 0)
+	// scanned maps the ID of every file looked at to its path.
+	scanned := make(map[string]string)
+	plan := func(files []*fs.File, manifest bool) error {
+		distinct := make([]*fs.File, 0, len(files))
+		for _, f := range files {
+			p := path.Join(f.Dir, f.Name)
+			id := fs.PathID(p)
+			if other, ok := scanned[id]; ok && other != p {
+				// Its uploads couldn't be told apart from the other's.
+				err := eris.Errorf("%s is the same file as %s on other devices; rename one of them", p, other)
+				log.FromCtx(ctx).Error("Failed to sync file", zap.String("file", f.Absolute), zap.Error(err))
+				run.Fail(err, p)
+				continue
+			}
+			scanned[id] = p
+			distinct = append(distinct, f)
+		}
+		b, err := s.plan(ctx, run, distinct)
+		if err != nil {
+			return err
+		}
+		b.manifest = manifest && s.cfg.Manifest.Enabled
+		if !b.manifest {
+			// Only the manifest lists unchanged files.
+			b.unchanged = nil
+		}
+		if len(b.sets) > 0 || len(b.unchanged) > 0 {
+			batches = append(batches, b)
+		}
+		return nil
 	}
-	remoteDir := time.Now().Format(timeToDirFmt)
-	log.FromCtx(ctx).Info("Syncs enabled", zap.Bool("roms", s.cfg.Sync.Roms), zap.Bool("saves", s.cfg.Sync.Saves), zap.Bool("states", s.cfg.Sync.States))
-	if s.cfg.Sync.Roms {
-		log.FromCtx(ctx).Info("Syncing ROMs")
-		err = s.sync(ctx, romDir, fs.Rom, remoteDir)
+	walk := func(dir fs.Directory, filetype fs.FileType, manifest bool) error {
+		found := 0
+		err := dir.WalkMatching(ctx, filetype, func(files []*fs.File) error {
+			found += len(files)
+			return plan(files, manifest)
+		})
 		if err != nil {
 			return err
 		}
+		if found == 0 {
+			log.FromCtx(ctx).Warn("No matching files")
+		} else {
+			log.FromCtx(ctx).Sugar().Infof("Found %d matching files", found)
+		}
+		return nil
+	}
+	if s.cfg.Sync.Roms && !throttled {
+		log.FromCtx(ctx).Info("Looking for ROMs")
+		err = walk(romDir, fs.Rom, true)
+		if err != nil {
+			return *run, err
+		}
+	}
+	savesDir, statesDir, err := s.cfg.saveDirectories(ctx, romDir, fs.WithoutScan())
+	if err != nil {
+		return *run, err
 	}
 	if s.cfg.Sync.Saves {
-		log.FromCtx(ctx).Info("Syncing saves")
-		err = s.sync(ctx, romDir, fs.Save, remoteDir)
+		log.FromCtx(ctx).Info("Looking for saves", zap.String("directory", savesDir.GetAbsolutePath()))
+		// The manifest describes the RomsFolder, so only saves kept there
+		// are listed in it.
+		err = walk(savesDir, fs.Save, savesDir == romDir)
 		if err != nil {
-			return err
+			return *run, err
 		}
 	}
-	if s.cfg.Sync.States {
-		log.FromCtx(ctx).Info("Syncing states")
-		err = s.sync(ctx, romDir, fs.State, remoteDir)
+	if s.cfg.Sync.States && !throttled {
+		log.FromCtx(ctx).Info("Looking for states", zap.String("directory", statesDir.GetAbsolutePath()))
+		err = walk(statesDir, fs.State, statesDir == romDir)
 		if err != nil {
-			return err
+			return *run, err
+		}
+	}
+	if s.cfg.Sync.Screenshots && !throttled {
+		log.FromCtx(ctx).Info("Looking for screenshots")
+		err = walk(romDir, fs.Screenshot, true)
+		if err != nil {
+			return *run, err
+		}
+		if s.cfg.Screenshots.Folder != "" {
+			files, err := s.cfg.ScreenshotFiles(ctx)
+			if err != nil {
+				return *run, err
+			}
+			// Outside the RomsFolder, so left out of the manifest.
+			err = plan(files, false)
+			if err != nil {
+				return *run, err
+			}
+		}
+	}
+	if s.cfg.Sync.Bios && !throttled {
+		log.FromCtx(ctx).Info("Looking for BIOS files")
+		files, err := s.cfg.BiosFiles(ctx)
+		if err != nil {
+			return *run, err
+		}
+		// Like configs, BIOS files live outside the RomsFolder the manifest
+		// describes.
+		err = plan(files, false)
+		if err != nil {
+			return *run, err
+		}
+	}
+	if s.cfg.Sync.Configs && !throttled {
+		log.FromCtx(ctx).Info("Looking for configs")
+		files, err := s.cfg.ConfigFiles(ctx)
+		if err != nil {
+			return *run, err
+		}
+		// The manifest describes the RomsFolder, so configs are left out of it.
+		err = plan(files, false)
+		if err != nil {
+			return *run, err
 		}
 	}
+
+	if len(scanned) == 0 {
+		log.FromCtx(ctx).Warn("No files found", zap.String("directory", s.cfg.RomsFolder))
+	}
+	batches, err = s.applyBudget(ctx, run, batches)
+	if err != nil {
+		return *run, err
+	}
+	// A throttled sync leaves whole types out, which would look like their
+	// files had gone missing.
+	err = s.checkLimits(ctx, batches, scanned, !throttled)
+	if err != nil {
+		return *run, err
+	}
+	synced, err := s.upload(ctx, run, batches, remoteDir)
+	if err != nil {
+		return *run, s.queued(err)
+	}
+	if s.cfg.Manifest.Enabled {
+		err = s.storeManifest(ctx, synced, remoteDir)
+		if err != nil {
+			return *run, err
+		}
+	}
+	return *run, s.checkFailures(run)
+}
+
+// flush waits for storages that store files in the background, such as
+// mirrors, to finish. Failing to flush never fails the sync itself.
+func (s *syncer) flush(ctx context.Context) {
+	flusher, ok := s.storage.(storage.Flusher)
+	if !ok {
+		return
+	}
+	err := flusher.Flush(ctx)
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to flush storage", zap.Error(err))
+	}
+}
+
+// checkFailures fails the sync if more files failed than allowed.
+func (s *syncer) checkFailures(run *history.Run) error {
+	if run.FilesFailed > s.cfg.Sync.MaxFailures {
+		return eris.Errorf("%d files failed to sync, more than the %d allowed", run.FilesFailed, s.cfg.Sync.MaxFailures)
+	}
 	return nil
 }
 
-func (s *syncer) sync(ctx context.Context, sourceDir fs.Directory, filetype fs.FileType, remoteDir string) error {
-	files, err := sourceDir.GetMatchingFiles(filetype)
+// record appends the finished run to the sync history. Failing to record
+// history never fails the sync itself.
+func (s *syncer) record(ctx context.Context, run *history.Run, err error) {
+	run.FinishedAt = clock.Now(ctx)
+	run.Status = history.StatusSucceeded
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = history.StatusCancelled
+		run.Errors = append(run.Errors, err.Error())
+	case err != nil:
+		run.Status = history.StatusFailed
+		run.Errors = append(run.Errors, err.Error())
+	}
+	journalErr := history.NewJournal(s.cfg.HistoryFile()).Append(*run)
+	if journalErr != nil {
+		log.FromCtx(ctx).Warn("Failed to record sync history", zap.Error(journalErr))
+	}
+}
+
+// throttled reports whether large transfers should be deferred because the
+// battery is below, or the temperature above, the configured thresholds.
+func (s *syncer) throttled(ctx context.Context) bool {
+	t := s.cfg.Throttle
+	if t.MinBatteryPercent <= 0 && t.MaxTemperatureCelsius <= 0 {
+		return false
+	}
+	status, err := power.ReadStatus(power.DefaultSysfsRoot)
 	if err != nil {
-		return err
+		log.FromCtx(ctx).Warn("Unable to read power status; not throttling", zap.Error(err))
+		return false
+	}
+	if t.MinBatteryPercent > 0 && status.HasBattery && !status.Charging && status.BatteryPercent < t.MinBatteryPercent {
+		log.FromCtx(ctx).Info("Battery below threshold",
+			zap.Int("battery", status.BatteryPercent),
+			zap.Int("threshold", t.MinBatteryPercent),
+		)
+		return true
+	}
+	if t.MaxTemperatureCelsius > 0 && status.HasTemperature && status.TemperatureCelsius > t.MaxTemperatureCelsius {
+		log.FromCtx(ctx).Info("Temperature above threshold",
+			zap.Float64("temperature", status.TemperatureCelsius),
+			zap.Float64("threshold", t.MaxTemperatureCelsius),
+		)
+		return true
+	}
+	return false
+}
+
+// plan decides which of files to upload, grouped into complete sets so a
+// savestate is never stored without its thumbnail, nor a cue sheet without
+// its tracks. Companion files whose primary file is not being synced are
+// skipped.
+func (s *syncer) plan(ctx context.Context, run *history.Run, files []*fs.File) (batch, error) {
+	sets, orphans := fs.GroupFiles(files)
+	for _, orphan := range orphans {
+		log.FromCtx(ctx).Warn("Skipping companion file without its primary file",
+			zap.String("file", orphan.Absolute),
+			zap.String("parent", orphan.Parent),
+		)
+		run.Skip("companion file without its primary file", orphan.Absolute)
+	}
+	sets = s.oversizedSets(ctx, run, sets)
+	sets = s.stableSets(ctx, run, sets)
+	sets, unchanged := s.changedSets(ctx, sets)
+	run.FilesUnchanged += len(unchanged)
+	sets = s.dueSets(ctx, run, sets)
+	sets, err := s.resolveConflicts(ctx, run, sets)
+	if err != nil {
+		return batch{}, err
+	}
+	return batch{sets: sets, unchanged: unchanged}, nil
+}
+
+// upload stores the planned sets one complete set at a time, returning the
+// files of the batches listed in the manifest that are now stored.
+func (s *syncer) upload(ctx context.Context, run *history.Run, batches []batch, remoteDir string) ([]*fs.File, error) {
+	selected := make([]*fs.File, 0)
+	for _, b := range batches {
+		selected = append(selected, b.files()...)
+	}
+	// Journaled before anything is stored, so what a sync couldn't store,
+	// e.g. while offline, is known to be waiting.
+	s.queue.Replace(clock.Now(ctx), paths(selected))
+	err := s.queue.Save()
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to save upload queue", zap.Error(err))
+	}
+	if len(selected) > 0 {
+		err = s.connect(ctx, run)
+		if err != nil {
+			return nil, err
+		}
+		err = s.prefetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	progress.FromCtx(ctx).AddTotal(len(selected), totalSize(selected))
+
+	synced := make([]*fs.File, 0)
+	for _, b := range batches {
+		stored, err := s.uploadSets(ctx, run, b.sets, remoteDir)
+		if err != nil {
+			return nil, err
+		}
+		if b.manifest {
+			synced = append(synced, b.unchanged...)
+			synced = append(synced, stored...)
+		}
+	}
+	return synced, nil
+}
+
+// uploadSets stores each set, returning the files of those stored whole.
+func (s *syncer) uploadSets(ctx context.Context, run *history.Run, sets []*fs.FileSet, remoteDir string) ([]*fs.File, error) {
+	synced := make([]*fs.File, 0)
+	for _, set := range sets {
+		files := set.Files()
+		stored, err := s.storeSet(ctx, run, remoteDir, files)
+		if err != nil {
+			err = eris.Wrapf(err, "failed to sync %s", set.Primary.Absolute)
+			if fatal(err) {
+				return nil, err
+			}
+			// Carry on with the other sets; the rest of this one waits for
+			// the next sync so it is stored complete.
+			log.FromCtx(ctx).Error("Failed to sync file", zap.String("file", files[stored].Absolute), zap.Error(err))
+			run.Fail(err, paths(files[stored:])...)
+			continue
+		}
+		synced = append(synced, files...)
+	}
+	return synced, nil
+}
+
+// storeSet uploads the files of a set in order, returning how many were
+// stored before any failed.
+func (s *syncer) storeSet(ctx context.Context, run *history.Run, remoteDir string, files []*fs.File) (int, error) {
+	for i, f := range files {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		err := s.store(ctx, remoteDir, f)
+		if err != nil {
+			return i, err
+		}
+		err = s.recordMetadata(ctx, run, remoteDir, f)
+		if err != nil {
+			// Not remembered as uploaded, so the next sync uploads and
+			// records it again.
+			return i, err
+		}
+		run.FilesUploaded++
+		run.BytesUploaded += fileSize(f)
+		s.remember(ctx, remoteDir, f)
+		s.queue.Remove(f.Absolute)
+	}
+	return len(files), nil
+}
+
+// files returns the files of every set in the batch.
+func (b batch) files() []*fs.File {
+	files := make([]*fs.File, 0, len(b.sets))
+	for _, set := range b.sets {
+		files = append(files, set.Files()...)
+	}
+	return files
+}
+
+// paths returns the absolute paths of files.
+func paths(files []*fs.File) []string {
+	p := make([]string, 0, len(files))
+	for _, f := range files {
+		p = append(p, f.Absolute)
+	}
+	return p
+}
+
+// fatal reports whether err from storing one file means the rest can't be
+// stored either, so the sync should stop: it was cancelled, the credentials
+// or config are wrong, or the backend's circuit breaker is open.
+func fatal(err error) bool {
+	if eris.Is(err, rperrors.CircuitOpenError) {
+		return true
+	}
+	switch rperrors.CategoryOf(err) {
+	case rperrors.CancelledCategory, rperrors.AuthCategory, rperrors.ConfigCategory:
+		return true
+	}
+	return false
+}
+
+// stableSets holds back the sets with a file that may still be being
+// written: one modified within the stability window, or open for writing.
+func (s *syncer) stableSets(ctx context.Context, run *history.Run, sets []*fs.FileSet) []*fs.FileSet {
+	window := s.cfg.Stability.Window
+	if window <= 0 && s.writing == nil {
+		return sets
+	}
+	stable := make([]*fs.FileSet, 0, len(sets))
+	for _, set := range sets {
+		files := set.Files()
+		reason := ""
+		for _, f := range files {
+			if window > 0 && run.StartedAt.Sub(f.LastModified) < window {
+				reason = "modified within the stability window"
+			} else if s.writing[f.Absolute] {
+				reason = "open for writing"
+			}
+			if reason != "" {
+				log.FromCtx(ctx).Warn("Skipping file still being written",
+					zap.String("file", f.Absolute),
+					zap.String("reason", reason),
+				)
+				break
+			}
+		}
+		if reason != "" {
+			run.Skip(reason, paths(files)...)
+			continue
+		}
+		stable = append(stable, set)
+	}
+	return stable
+}
+
+// dueSets holds back the sets whose primary file's type has a minimum
+// interval between uploads that hasn't passed since it was last uploaded.
+func (s *syncer) dueSets(ctx context.Context, run *history.Run, sets []*fs.FileSet) []*fs.FileSet {
+	if len(s.intervals) == 0 {
+		return sets
+	}
+	due := make([]*fs.FileSet, 0, len(sets))
+	for _, set := range sets {
+		interval, ok := s.intervals[set.Primary.FileType]
+		if !ok {
+			due = append(due, set)
+			continue
+		}
+		uploaded := s.lastUploaded(set.Primary)
+		if uploaded.IsZero() || run.StartedAt.Sub(uploaded) >= interval {
+			due = append(due, set)
+			continue
+		}
+		log.FromCtx(ctx).Info("Deferring file uploaded recently",
+			zap.String("file", set.Primary.Absolute),
+			zap.Time("uploadedAt", uploaded),
+			zap.Duration("minInterval", interval),
+		)
+		run.Skip("uploaded within its minimum interval", paths(set.Files())...)
+	}
+	return due
+}
+
+// lastUploaded returns when f was last uploaded, according to the metadata
+// store or the sync cache, whichever saw it later; zero if neither has.
+func (s *syncer) lastUploaded(f *fs.File) time.Time {
+	var uploaded time.Time
+	if md, ok := s.latest[fs.PathID(path.Join(f.Dir, f.Name))]; ok {
+		uploaded = md.UploadedAt
+	}
+	if s.cache != nil {
+		if entry, ok := s.cache.Get(f.Absolute); ok && entry.UploadedAt.After(uploaded) {
+			uploaded = entry.UploadedAt
+		}
+	}
+	return uploaded
+}
+
+// changedSets separates the sets with a file that changed since it was
+// last uploaded from the files of those that are wholly unchanged.
+func (s *syncer) changedSets(ctx context.Context, sets []*fs.FileSet) ([]*fs.FileSet, []*fs.File) {
+	if s.cache == nil && len(s.latest) == 0 {
+		return sets, nil
+	}
+	changed := make([]*fs.FileSet, 0, len(sets))
+	unchanged := make([]*fs.File, 0)
+	for _, set := range sets {
+		files := set.Files()
+		same := true
+		for _, f := range files {
+			if !s.unchanged(ctx, f) {
+				same = false
+				break
+			}
+		}
+		if same {
+			unchanged = append(unchanged, files...)
+		} else {
+			changed = append(changed, set)
+		}
+	}
+	return changed, unchanged
+}
+
+// unchanged reports whether f is as it was last uploaded: the sync cache saw
+// it with the same size and modification time, it is as it was downloaded
+// from another device, or it is a large file whose content matches its
+// latest upload in the metadata store, so a disc image that was merely
+// touched isn't sent again.
+func (s *syncer) unchanged(ctx context.Context, f *fs.File) bool {
+	size := fileSize(f)
+	if s.cache != nil && s.cache.Unchanged(f.Absolute, size, f.LastModified) {
+		return true
+	}
+	if s.downloads != nil && s.downloads.Unchanged(f.Absolute, size, f.LastModified) {
+		return true
+	}
+	if size < s.cfg.LargeFiles.threshold() {
+		return false
+	}
+	md, ok := s.latest[fs.PathID(path.Join(f.Dir, f.Name))]
+	if !ok || md.SHA256 == "" || md.Size != size {
+		return false
+	}
+	sum, err := f.Checksum()
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to hash large file; uploading it", zap.String("file", f.Absolute), zap.Error(err))
+		return false
+	}
+	if sum != md.SHA256 {
+		return false
+	}
+	log.FromCtx(ctx).Debug("Large file's content matches its latest upload", zap.String("file", f.Absolute))
+	// So the next sync needn't hash it again.
+	if s.cache != nil {
+		s.cache.Put(f.Absolute, cache.Entry{
+			SHA256:     sum,
+			Size:       size,
+			ModTime:    f.LastModified,
+			Key:        md.Key,
+			UploadedAt: md.UploadedAt,
+		})
+	}
+	return true
+}
+
+// oversizedSets holds back the sets with a file larger than
+// largeFiles.maxSize.
+func (s *syncer) oversizedSets(ctx context.Context, run *history.Run, sets []*fs.FileSet) []*fs.FileSet {
+	max := s.cfg.LargeFiles.MaxSize
+	if max <= 0 {
+		return sets
+	}
+	kept := make([]*fs.FileSet, 0, len(sets))
+	for _, set := range sets {
+		files := set.Files()
+		oversized := false
+		for _, f := range files {
+			if fileSize(f) > max {
+				log.FromCtx(ctx).Info("Skipping file larger than the maximum size",
+					zap.String("file", f.Absolute),
+					zap.Int64("size", fileSize(f)),
+					zap.Int64("maxSize", max),
+				)
+				oversized = true
+				break
+			}
+		}
+		if oversized {
+			run.Skip("larger than largeFiles.maxSize", paths(files)...)
+			continue
+		}
+		kept = append(kept, set)
+	}
+	return kept
+}
+
+// remember records the upload of f in the sync cache. A file that can't be
+// hashed is left out, so it is looked at again next time.
+func (s *syncer) remember(ctx context.Context, remoteDir string, f *fs.File) {
+	if s.cache == nil {
+		return
 	}
-	if len(files) == 0 {
-		log.FromCtx(ctx).Warn("No matching files")
+	sum, err := f.Checksum()
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to cache file", zap.String("file", f.Absolute), zap.Error(err))
+		return
+	}
+	s.cache.Put(f.Absolute, cache.Entry{
+		SHA256:     sum,
+		Size:       fileSize(f),
+		ModTime:    f.LastModified,
+		Key:        s.storage.Key(remoteDir, f),
+		UploadedAt: clock.Now(ctx),
+	})
+}
+
+// prefetch lists what the backend already holds in one go, rather than
+// asking about each file as it is stored. It runs at most once a Sync, and
+// only once there is something to upload.
+func (s *syncer) prefetch(ctx context.Context) error {
+	if s.prefetched {
 		return nil
 	}
-	log.FromCtx(ctx).Sugar().Infof("Found %d matching files", len(files))
-	err = s.storage.StoreAll(ctx, remoteDir, files)
+	p, ok := s.storage.(storage.Prefetcher)
+	if !ok {
+		return nil
+	}
+	err := p.Prefetch(ctx)
 	if err != nil {
 		return err
 	}
+	s.prefetched = true
 	return nil
 }
+
+// store uploads a single file, reporting its progress.
+func (s *syncer) store(ctx context.Context, remoteDir string, f *fs.File) error {
+	reporter := progress.FromCtx(ctx)
+	reporter.StartFile(path.Join(f.Dir, f.Name), fileSize(f))
+	defer reporter.FinishFile()
+	return s.storage.Store(ctx, remoteDir, f)
+}
+
+// metadataAttempts is how many times strict mode tries to record an upload,
+// waiting metadataBackoff after the first failure and twice as long after
+// each one since.
+const metadataAttempts = 3
+
+var metadataBackoff = time.Second
+
+// recordMetadata records the upload of f in the metadata store. The file is
+// already uploaded, so a failure is only logged, unless metadata.strict is
+// set, when recording is retried and a final failure returned.
+func (s *syncer) recordMetadata(ctx context.Context, run *history.Run, remoteDir string, f *fs.File) error {
+	if s.metadata == nil {
+		return nil
+	}
+	upload := metadata.FileMetadata{RunID: run.ID, DeviceID: run.DeviceID, DeviceName: run.DeviceName}
+	if s.dat != nil && f.FileType == fs.Rom {
+		s.verifyDump(ctx, &upload, f)
+	}
+	err := recordUpload(ctx, s.metadata, s.storage, upload, remoteDir, f)
+	if err == nil {
+		return nil
+	}
+	if !s.cfg.Metadata.Strict {
+		log.FromCtx(ctx).Warn("Failed to record file metadata", zap.String("file", f.Absolute), zap.Error(err))
+		return nil
+	}
+	wait := metadataBackoff
+	for attempt := 1; attempt < metadataAttempts; attempt++ {
+		log.FromCtx(ctx).Warn("Failed to record file metadata; retrying",
+			zap.String("file", f.Absolute),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		err = recordUpload(ctx, s.metadata, s.storage, upload, remoteDir, f)
+		if err == nil {
+			return nil
+		}
+	}
+	return eris.Wrapf(err, "failed to record metadata after %d attempts", metadataAttempts)
+}
+
+// verifyDump tags the upload of a ROM with the outcome of verifying it against
+// the DATs.
+func (s *syncer) verifyDump(ctx context.Context, upload *metadata.FileMetadata, f *fs.File) {
+	sum, err := dat.SHA1File(f.Absolute)
+	if err != nil {
+		log.FromCtx(ctx).Warn("Failed to verify ROM", zap.String("file", f.Absolute), zap.Error(err))
+		return
+	}
+	result := s.dat.Verify(f.Name, sum)
+	upload.Dump = string(result.Status)
+	if result.Match != nil {
+		upload.Title = result.Match.Game
+	}
+	if result.Status == dat.BadDump || result.Status == dat.Mismatch {
+		log.FromCtx(ctx).Warn("ROM is not a known good dump", zap.String("file", f.Absolute), zap.String("status", upload.Dump))
+	}
+}
+
+// latestUploads loads the latest upload of every file from the store in one
+// pass, keyed by fs.PathID. Of paths with the same ID, such as the same name
+// written by different systems, the most recent upload is kept.
+func latestUploads(ctx context.Context, store metadata.Store) (map[string]metadata.FileMetadata, error) {
+	files, err := store.ListFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]metadata.FileMetadata, len(files))
+	for _, md := range files {
+		id := fs.PathID(md.Path)
+		if other, ok := latest[id]; ok && other.UploadedAt.After(md.UploadedAt) {
+			continue
+		}
+		latest[id] = md
+	}
+	return latest, nil
+}
+
+// recordUpload records that f was stored to remoteDir. The run and device of
+// the upload are taken from upload.
+func recordUpload(ctx context.Context, store metadata.Store, client storage.Storage, upload metadata.FileMetadata, remoteDir string, f *fs.File) error {
+	sum, err := f.Checksum()
+	if err != nil {
+		return err
+	}
+	upload.Path = path.Join(f.Dir, f.Name)
+	if f.Parent != "" {
+		upload.Parent = path.Join(f.Dir, f.Parent)
+	}
+	upload.Key = client.Key(remoteDir, f)
+	upload.SHA256 = sum
+	upload.Size = fileSize(f)
+	upload.ContentType = f.ContentType()
+	upload.LastModified = f.LastModified
+	upload.UploadedAt = clock.Now(ctx)
+	return store.StoreFileMetadata(ctx, upload)
+}
+
+// fileSize returns the size of f as it was found, or as it is now if it wasn't
+// found by a walk.
+func fileSize(f *fs.File) int64 {
+	if f.Size > 0 {
+		return f.Size
+	}
+	info, err := os.Stat(f.Absolute)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func totalSize(files []*fs.File) int64 {
+	var total int64
+	for _, f := range files {
+		total += fileSize(f)
+	}
+	return total
+}
@@ -0,0 +1,466 @@
+package syncer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/backup"
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type (
+	// Transfer describes one file moved by Push or Pull. Path is the file's
+	// path as recorded in the metadata store, Local where it is on disk, and
+	// Key where it is stored remotely. Skipped is set when Pull found the
+	// local file already identical.
+	Transfer struct {
+		Path    string `json:"path,omitempty"`
+		Local   string `json:"local"`
+		Key     string `json:"key"`
+		Skipped bool   `json:"skipped,omitempty"`
+	}
+
+	// PullOptions control Pull. Output overrides where the file is written,
+	// and is required for files with no local counterpart to infer it from.
+	// Force overwrites a local file that differs from the remote one.
+	// SkipSpaceCheck downloads even if the file may not fit in the free disk
+	// space.
+	PullOptions struct {
+		Output         string
+		Force          bool
+		SkipSpaceCheck bool
+	}
+)
+
+// Push uploads the files matching the given paths or globs, whatever the
+// sync flags and filters say. Paths are relative to the working directory,
+// or to the RomsFolder if nothing matches there; a directory pushes every
+// file under it. Files must be in one of the folders a sync covers, so they
+// are stored where a sync would put them. A device whose direction is
+// download never uploads, so Push refuses to run on it.
+func Push(ctx context.Context, cfg Config, patterns []string) ([]Transfer, error) {
+	if !cfg.direction().uploads() {
+		return nil, errors.WithCategory(eris.New("this device only downloads; set direction to upload or both to push"), errors.ConfigCategory)
+	}
+	candidates, err := cfg.localFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*fs.File, 0)
+	seen := make(map[*fs.File]bool)
+	for _, pattern := range patterns {
+		matched, err := cfg.expand(pattern, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range matched {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	client = storage.NewRetryingStorage(client, cfg.Storage.Retry)
+	err = client.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	identity, err := cfg.Device()
+	if err != nil {
+		return nil, err
+	}
+
+	upload := metadata.FileMetadata{RunID: uuid.New().String(), DeviceID: identity.ID, DeviceName: identity.Name}
+	remoteDir := cfg.RemoteDir(clock.Now(ctx))
+	transfers := make([]Transfer, 0, len(files))
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return transfers, ctx.Err()
+		}
+		err = client.Store(ctx, remoteDir, f)
+		if err != nil {
+			return transfers, eris.Wrapf(err, "failed to push %s", f.Absolute)
+		}
+		if store != nil {
+			err = recordUpload(ctx, store, client, upload, remoteDir, f)
+			if err != nil {
+				return transfers, err
+			}
+		}
+		transfers = append(transfers, Transfer{
+			Path:  path.Join(f.Dir, f.Name),
+			Local: f.Absolute,
+			Key:   client.Key(remoteDir, f),
+		})
+	}
+	return transfers, nil
+}
+
+// Pull downloads the latest upload of the file at id, a path as recorded in
+// the metadata store (e.g. "gba/Pokemon Emerald.sav"), or else a raw storage
+// key. A path with no metadata record is looked up with the storage's
+// latest pointers, when it keeps them. By default the file replaces its
+// local copy, and is only written if it downloads intact; the copy it
+// replaces is backed up first.
+func Pull(ctx context.Context, cfg Config, id string, opts PullOptions) (Transfer, error) {
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return Transfer{}, err
+	}
+	var md *metadata.FileMetadata
+	if store != nil {
+		md, err = store.GetFileMetadata(ctx, path.Clean(filepath.ToSlash(id)))
+		store.Close()
+		if err != nil {
+			return Transfer{}, err
+		}
+	}
+
+	client, err := newReadStorage(ctx, cfg)
+	if err != nil {
+		return Transfer{}, err
+	}
+	if finder, ok := client.(storage.LatestFinder); ok && md == nil {
+		md, err = latestUpload(ctx, finder, path.Clean(filepath.ToSlash(id)))
+		if err != nil {
+			return Transfer{}, err
+		}
+	}
+	transfer := Transfer{Key: id, Local: opts.Output}
+	if md != nil {
+		transfer.Path = md.Path
+		transfer.Key = md.Key
+	}
+	if transfer.Local == "" && transfer.Path != "" {
+		transfer.Local, err = cfg.localPath(ctx, transfer.Path)
+		if err != nil {
+			return Transfer{}, err
+		}
+	}
+	if transfer.Local == "" {
+		return Transfer{}, errors.WithCategory(eris.Errorf("no local path known for %s; pass the path to write it to", id), errors.ConfigCategory)
+	}
+
+	if md != nil {
+		sum, err := fs.ChecksumPath(transfer.Local)
+		if err == nil && sum == md.SHA256 {
+			transfer.Skipped = true
+			return transfer, nil
+		}
+	}
+	_, err = os.Stat(transfer.Local)
+	if err == nil && !opts.Force {
+		return Transfer{}, errors.WithCategory(eris.Errorf("%s already exists and differs from %s; pass --force to overwrite it", transfer.Local, transfer.Key), errors.ConflictCategory)
+	}
+
+	if md != nil {
+		err = checkSpace(map[string]int64{transfer.Local: md.Size}, opts.SkipSpaceCheck)
+		if err != nil {
+			return Transfer{}, err
+		}
+	}
+	retriever, ok := client.(storage.Retriever)
+	if !ok {
+		return Transfer{}, eris.Wrapf(errors.NotImplementedError, "%s does not support downloads", cfg.Backend())
+	}
+	err = client.Init(ctx)
+	if err != nil {
+		return Transfer{}, err
+	}
+	log.FromCtx(ctx).Info("Pulling", zap.String("key", transfer.Key), zap.String("file", transfer.Local))
+	err = retrieve(ctx, retriever, transfer.Key, transfer.Local, md, cfg.Backups().Start(clock.Now(ctx)))
+	if err != nil {
+		return Transfer{}, err
+	}
+	return transfer, nil
+}
+
+// latestUpload looks up the latest upload of the file at p by its pointer,
+// returning nil if there is none, e.g. because p is a key rather than a path.
+func latestUpload(ctx context.Context, finder storage.LatestFinder, p string) (*metadata.FileMetadata, error) {
+	ptr, err := finder.Latest(ctx, p)
+	if eris.Is(err, errors.NotFoundError) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.FileMetadata{
+		Path:         p,
+		Key:          ptr.Key,
+		SHA256:       ptr.SHA256,
+		LastModified: ptr.LastModified,
+		UploadedAt:   ptr.UploadedAt,
+		DeviceID:     ptr.DeviceID,
+	}, nil
+}
+
+// retrieve downloads key to a temporary file beside dest, checks it against
+// the checksum recorded at upload if there is one, and only then moves it
+// into place, first saving any file it replaces to the snapshot.
+func retrieve(ctx context.Context, retriever storage.Retriever, key, dest string, md *metadata.FileMetadata, snapshot *backup.Snapshot) error {
+	tmp, err := fetch(ctx, retriever, key, dest, md)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return place(tmp, dest, snapshot)
+}
+
+// fetch downloads key to a temporary file beside dest and checks it against
+// the checksum recorded at upload if there is one, returning the temporary
+// file's path. The caller removes it if it isn't placed.
+func fetch(ctx context.Context, retriever storage.Retriever, key, dest string, md *metadata.FileMetadata) (string, error) {
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to create %s", filepath.Dir(dest))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return "", eris.Wrap(err, "failed to create temp file")
+	}
+	fetched := false
+	defer func() {
+		if !fetched {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	err = retriever.Retrieve(ctx, key, io.MultiWriter(tmp, h))
+	if err == nil {
+		// Make sure the download is on disk before it replaces the file.
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", eris.Wrapf(closeErr, "failed to write %s", tmp.Name())
+	}
+	if md != nil {
+		sum := hex.EncodeToString(h.Sum(nil))
+		if md.SHA256 != "" && sum != md.SHA256 {
+			return "", eris.Wrapf(errors.ChecksumError, "%s does not match the checksum recorded at upload (%s, want %s)", key, sum, md.SHA256)
+		}
+		// Keep the original modification time so syncs compare it fairly.
+		if !md.LastModified.IsZero() {
+			err = os.Chtimes(tmp.Name(), time.Now(), md.LastModified)
+			if err != nil {
+				return "", eris.Wrapf(err, "failed to set modification time of %s", dest)
+			}
+		}
+	}
+	fetched = true
+	return tmp.Name(), nil
+}
+
+// place moves the fetched file tmp to dest, first saving any file it replaces
+// to the snapshot, or recording that there was none.
+func place(tmp, dest string, snapshot *backup.Snapshot) error {
+	_, err := os.Stat(dest)
+	switch {
+	case err == nil:
+		err = snapshot.Save(dest)
+	case os.IsNotExist(err):
+		err = snapshot.Record(dest)
+	default:
+		err = nil
+	}
+	if err != nil {
+		return eris.Wrapf(err, "failed to back up %s", dest)
+	}
+	err = os.Rename(tmp, dest)
+	if err != nil {
+		return eris.Wrapf(err, "failed to move download to %s", dest)
+	}
+	return nil
+}
+
+// localFiles returns every file in the folders a sync covers, with their Dir
+// set to where they are stored remotely.
+func (c Config) localFiles(ctx context.Context) ([]*fs.File, error) {
+	romDir, err := c.RomsDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := append([]*fs.File{}, romDir.GetAllFiles()...)
+	savesDir, statesDir, err := c.saveDirectories(ctx, romDir)
+	if err != nil {
+		return nil, err
+	}
+	if savesDir != romDir {
+		saves, err := savesDir.GetMatchingFiles(fs.Save)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, saves...)
+	}
+	if statesDir != romDir {
+		states, err := statesDir.GetMatchingFiles(fs.State)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, states...)
+	}
+	configs, err := c.ConfigFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bios, err := c.BiosFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	screenshots, err := c.ScreenshotFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, configs...)
+	files = append(files, bios...)
+	return append(files, screenshots...), nil
+}
+
+// expand returns the candidates matching the path or glob, trying it
+// relative to the working directory and then to the RomsFolder.
+func (c Config) expand(pattern string, candidates []*fs.File) ([]*fs.File, error) {
+	tries := []string{pattern}
+	if !filepath.IsAbs(pattern) {
+		tries = append(tries, filepath.Join(c.RomsFolder, pattern))
+	}
+	var matches []string
+	for _, try := range tries {
+		abs, err := filepath.Abs(try)
+		if err != nil {
+			return nil, eris.Wrapf(err, "failed to resolve %s", try)
+		}
+		matches, err = filepath.Glob(abs)
+		if err != nil {
+			return nil, errors.WithCategory(eris.Wrapf(err, "invalid pattern %q", pattern), errors.ConfigCategory)
+		}
+		if len(matches) > 0 {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return nil, eris.Wrapf(errors.NotFoundError, "nothing matches %s", pattern)
+	}
+
+	files := make([]*fs.File, 0, len(matches))
+	for _, match := range matches {
+		found := false
+		for _, f := range candidates {
+			abs, err := filepath.Abs(f.Absolute)
+			if err != nil {
+				continue
+			}
+			if abs == match || strings.HasPrefix(abs, match+string(filepath.Separator)) {
+				files = append(files, f)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.WithCategory(eris.Errorf("%s is not in the roms, configs, BIOS, or screenshots folders", match), errors.ConfigCategory)
+		}
+	}
+	return files, nil
+}
+
+// localPath returns where the file recorded at p belongs on this device:
+// where Restore.Paths maps it, the file already there, or else the
+// RomsFolder, saves, BIOS, or screenshots folder it was synced from. Configs are
+// mapped between devices, so one missing locally with no Restore.Paths entry
+// has no single place to go and localPath returns "".
+func (c Config) localPath(ctx context.Context, p string) (string, error) {
+	local, err := c.localIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.placeFile(p, local)
+}
+
+// localIndex maps the fs.PathID of every file a sync covers, as recorded in
+// the metadata store, to where it is on disk.
+func (c Config) localIndex(ctx context.Context) (map[string]string, error) {
+	files, err := c.localFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]string, len(files))
+	for _, f := range files {
+		id := fs.PathID(path.Join(f.Dir, f.Name))
+		if _, ok := local[id]; !ok {
+			local[id] = f.Absolute
+		}
+	}
+	return local, nil
+}
+
+// placeFile is localPath given the local files from localIndex.
+func (c Config) placeFile(p string, local map[string]string) (string, error) {
+	if mapped, ok := c.Restore.localPath(p); ok {
+		return mapped, nil
+	}
+	if abs, ok := local[fs.PathID(p)]; ok {
+		return abs, nil
+	}
+	top, rest, _ := strings.Cut(p, "/")
+	switch top {
+	case configsRemoteDir:
+		return "", nil
+	case biosRemoteDir:
+		return filepath.Join(c.Bios.folder(), filepath.FromSlash(rest)), nil
+	case screenshotsRemoteDir:
+		if c.Screenshots.Folder != "" {
+			return filepath.Join(c.Screenshots.Folder, filepath.FromSlash(rest)), nil
+		}
+	}
+	folder := c.RomsFolder
+	types, err := c.fileTypes()
+	if err != nil {
+		return "", err
+	}
+	switch types.TypeOf(path.Base(p)) {
+	case fs.Save:
+		folder = firstNonEmpty(c.Saves.Folder, folder)
+	case fs.State:
+		folder = firstNonEmpty(c.Saves.StatesFolder, c.Saves.Folder, folder)
+	}
+	return filepath.Join(folder, filepath.FromSlash(p)), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+)
+
+var _ = Describe("Local paths", func() {
+	var (
+		ctx context.Context
+		cfg syncer.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dir := GinkgoT().TempDir()
+		cfg = syncer.Config{
+			RomsFolder: filepath.Join(dir, "roms"),
+			StateDir:   filepath.Join(dir, "state"),
+		}
+		cfg.Sync.Roms = true
+		cfg.Sync.Saves = true
+		cfg.Saves.Folder = filepath.Join(dir, "saves")
+		cfg.Restore.Paths = map[string]string{
+			"snes":        "/userdata/roms/snes",
+			"snes/hacks/": "/userdata/hacks",
+			"/bios":       "/userdata/bios",
+		}
+		Expect(os.MkdirAll(cfg.RomsFolder, os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(cfg.Saves.Folder, os.ModePerm)).To(Succeed())
+	})
+
+	DescribeTable("places files where restore.paths maps them, the longest match winning", func(p, expected string) {
+		local, err := cfg.LocalPath(ctx, p)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(local).To(Equal(expected))
+	},
+		Entry("a system", "snes/Game.sfc", "/userdata/roms/snes/Game.sfc"),
+		Entry("a folder within it", "snes/hacks/Game.sfc", "/userdata/hacks/Game.sfc"),
+		Entry("BIOS", "bios/scph1001.bin", "/userdata/bios/scph1001.bin"),
+	)
+
+	It("places an unmapped file where it already is", func() {
+		existing := filepath.Join(cfg.RomsFolder, "gba", "Game.srm")
+		Expect(os.MkdirAll(filepath.Dir(existing), os.ModePerm)).To(Succeed())
+		Expect(os.WriteFile(existing, []byte("progress"), 0644)).To(Succeed())
+
+		local, err := cfg.LocalPath(ctx, "gba/Game.srm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(local).To(Equal(existing))
+	})
+
+	DescribeTable("places an unmapped file missing locally in the folder it syncs from", func(p string, folder func() string) {
+		local, err := cfg.LocalPath(ctx, p)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(local).To(Equal(filepath.Join(folder(), filepath.FromSlash(p))))
+	},
+		Entry("a ROM", "gba/Game.gba", func() string { return cfg.RomsFolder }),
+		Entry("a save", "gba/Game.srm", func() string { return cfg.Saves.Folder }),
+	)
+
+	It("doesn't place a config missing locally", func() {
+		local, err := cfg.LocalPath(ctx, "configs/all/retroarch.cfg")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(local).To(BeEmpty())
+	})
+})
@@ -0,0 +1,73 @@
+package syncer
+
+import (
+	"context"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/rotisserie/eris"
+)
+
+// ListTrash lists the trashed objects.
+func ListTrash(ctx context.Context, cfg Config) ([]storage.TrashEntry, error) {
+	trasher, err := newTrasher(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return trasher.ListTrash(ctx)
+}
+
+// RestoreTrash moves the trashed object back to key.
+func RestoreTrash(ctx context.Context, cfg Config, key string) error {
+	trasher, err := newTrasher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return trasher.RestoreTrash(ctx, key)
+}
+
+// EmptyTrash deletes the expired trashed objects for good, or all of them,
+// and returns those deleted.
+func EmptyTrash(ctx context.Context, cfg Config, all bool) ([]storage.TrashEntry, error) {
+	trasher, err := newTrasher(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := trasher.ListTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Now(ctx)
+	deleted := make([]storage.TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !all && !entry.Expired(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		err = trasher.DeleteTrash(ctx, entry.Key)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, entry)
+	}
+	return deleted, nil
+}
+
+func newTrasher(ctx context.Context, cfg Config) (storage.Trasher, error) {
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	trasher, ok := client.(storage.Trasher)
+	if !ok {
+		return nil, eris.Wrapf(errors.NotImplementedError, "%s does not support the trash", cfg.Backend())
+	}
+	err = client.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return trasher, nil
+}
@@ -0,0 +1,31 @@
+package syncer
+
+import (
+	"github.com/TrevorEdris/retropie-utils/pkg/backup"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/rotisserie/eris"
+)
+
+// Undo puts back the local files overwritten by the pull that took the
+// backup snapshot with the given ID, or the latest one if id is empty, and
+// removes those it created. It returns the snapshot and the paths restored. The snapshot is used up, so
+// undoing again goes back another one.
+func Undo(cfg Config, id string) (backup.Snapshot, []string, error) {
+	backups := cfg.Backups()
+	if id == "" {
+		snapshots, err := backups.List()
+		if err != nil {
+			return backup.Snapshot{}, nil, err
+		}
+		if len(snapshots) == 0 {
+			return backup.Snapshot{}, nil, eris.Wrap(errors.NotFoundError, "there is nothing to undo")
+		}
+		id = snapshots[0].ID
+	}
+	snapshot, err := backups.Get(id)
+	if err != nil {
+		return backup.Snapshot{}, nil, err
+	}
+	restored, err := backups.Restore(id)
+	return snapshot, restored, err
+}
@@ -0,0 +1,233 @@
+package syncer
+
+import (
+	"context"
+	"path"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/clock"
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/metadata"
+	"github.com/TrevorEdris/retropie-utils/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type (
+	VerifyStatus string
+
+	// VerifyOptions control Verify. Download hashes every remote object
+	// instead of trusting the checksum recorded at upload. Reupload stores
+	// missing and corrupt files again from the local copy.
+	VerifyOptions struct {
+		Download bool
+		Reupload bool
+	}
+
+	// VerifyResult is the outcome of verifying one local file against its
+	// latest upload.
+	VerifyResult struct {
+		Path       string       `json:"path"`
+		Key        string       `json:"key,omitempty"`
+		Status     VerifyStatus `json:"status"`
+		Reuploaded bool         `json:"reuploaded,omitempty"`
+	}
+
+	VerifyReport struct {
+		Results []VerifyResult `json:"results"`
+	}
+)
+
+const (
+	// VerifyOK means the remote object matches the local file.
+	VerifyOK VerifyStatus = "ok"
+	// VerifyModified means the remote object is intact, but the local file
+	// has changed since it was uploaded; the next sync will upload it.
+	VerifyModified VerifyStatus = "modified"
+	// VerifyUnsynced means the file has never been uploaded.
+	VerifyUnsynced VerifyStatus = "unsynced"
+	// VerifyMissing means the file was uploaded, but the object is gone.
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyCorrupt means the object's content doesn't match the checksum
+	// recorded when it was uploaded.
+	VerifyCorrupt VerifyStatus = "corrupt"
+)
+
+// Count returns the number of files with the given status.
+func (r VerifyReport) Count(status VerifyStatus) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// OK reports whether every uploaded file is intact, or was repaired.
+func (r VerifyReport) OK() bool {
+	for _, result := range r.Results {
+		if (result.Status == VerifyMissing || result.Status == VerifyCorrupt) && !result.Reuploaded {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks the latest upload of every file a sync would pick up against
+// the checksum recorded in the metadata store when it was uploaded.
+func Verify(ctx context.Context, cfg Config, opts VerifyOptions) (VerifyReport, error) {
+	store, err := cfg.MetadataStore()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	if store == nil {
+		return VerifyReport{}, errors.WithCategory(eris.New("verify requires the metadata store; metadata.backend is none"), errors.ConfigCategory)
+	}
+	defer store.Close()
+
+	client, err := NewStorage(ctx, cfg)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	verifier, ok := client.(storage.Verifier)
+	if !ok {
+		return VerifyReport{}, eris.Wrapf(errors.NotImplementedError, "%s does not support verification", cfg.Backend())
+	}
+	err = client.Init(ctx)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	files, err := cfg.syncedFiles(ctx)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	identity, err := cfg.Device()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	upload := metadata.FileMetadata{RunID: uuid.New().String(), DeviceID: identity.ID, DeviceName: identity.Name}
+	remoteDir := cfg.RemoteDir(clock.Now(ctx))
+	report := VerifyReport{Results: make([]VerifyResult, 0, len(files))}
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		result, err := verifyFile(ctx, store, verifier, f, opts.Download)
+		if err != nil {
+			return report, err
+		}
+		if opts.Reupload && (result.Status == VerifyMissing || result.Status == VerifyCorrupt) {
+			log.FromCtx(ctx).Info("Re-uploading", zap.String("file", result.Path), zap.String("status", string(result.Status)))
+			err = client.Store(storage.WithReplace(ctx), remoteDir, f)
+			if err != nil {
+				return report, eris.Wrapf(err, "failed to re-upload %s", result.Path)
+			}
+			err = recordUpload(ctx, store, client, upload, remoteDir, f)
+			if err != nil {
+				return report, err
+			}
+			result.Reuploaded = true
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func verifyFile(ctx context.Context, store metadata.Store, verifier storage.Verifier, f *fs.File, download bool) (VerifyResult, error) {
+	result := VerifyResult{Path: path.Join(f.Dir, f.Name)}
+	md, err := store.GetFileMetadata(ctx, result.Path)
+	if err != nil {
+		return result, err
+	}
+	if md == nil {
+		result.Status = VerifyUnsynced
+		return result, nil
+	}
+	result.Key = md.Key
+	remoteSum, err := verifier.RemoteChecksum(ctx, md.Key, download)
+	switch {
+	case eris.Is(err, errors.NotFoundError):
+		result.Status = VerifyMissing
+		return result, nil
+	case err != nil:
+		return result, err
+	case remoteSum != md.SHA256:
+		result.Status = VerifyCorrupt
+		return result, nil
+	}
+	localSum, err := f.Checksum()
+	if err != nil {
+		return result, err
+	}
+	result.Status = VerifyOK
+	if localSum != md.SHA256 {
+		result.Status = VerifyModified
+	}
+	return result, nil
+}
+
+// syncedFiles returns every file a sync would pick up: the files of the
+// enabled types in the RomsFolder and saves folders, and in the configs,
+// screenshots, and BIOS folders when those are enabled.
+func (c Config) syncedFiles(ctx context.Context) ([]*fs.File, error) {
+	dir, err := c.RomsDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	savesDir, statesDir, err := c.saveDirectories(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	enabled := map[fs.FileType]bool{
+		fs.Rom:   c.Sync.Roms,
+		fs.Save:  c.Sync.Saves,
+		fs.State: c.Sync.States,
+
+		fs.Screenshot: c.Sync.Screenshots,
+	}
+	dirs := map[fs.FileType]fs.Directory{
+		fs.Rom:   dir,
+		fs.Save:  savesDir,
+		fs.State: statesDir,
+
+		fs.Screenshot: dir,
+	}
+	files := make([]*fs.File, 0)
+	for _, fileType := range []fs.FileType{fs.Rom, fs.Save, fs.State, fs.Screenshot} {
+		if !enabled[fileType] {
+			continue
+		}
+		matching, err := dirs[fileType].GetMatchingFiles(fileType)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matching...)
+	}
+	if c.Sync.Configs {
+		configs, err := c.ConfigFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, configs...)
+	}
+	if c.Sync.Screenshots && c.Screenshots.Folder != "" {
+		screenshots, err := c.ScreenshotFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, screenshots...)
+	}
+	if c.Sync.Bios {
+		bios, err := c.BiosFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bios...)
+	}
+	return files, nil
+}
@@ -0,0 +1,118 @@
+package syncer
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// reloadDelay lets an editor finish writing the config file before it is
+// read, since a save is often seen as several events, some of them while the
+// file is still empty.
+const reloadDelay = 500 * time.Millisecond
+
+// WatchConfig watches the config file loaded by v and sends each changed
+// config on the returned channel, replacing any not yet received, until ctx
+// is cancelled. A change is only sent once it unmarshals and validates, so
+// the active config is never swapped for a broken one; invalid edits are
+// logged and ignored. The sections that changed are logged with every
+// reload. v is read while watching, so nothing else may use it.
+func WatchConfig(ctx context.Context, v *viper.Viper, current Config) <-chan Config {
+	reloads := make(chan Config, 1)
+	file := filepath.Clean(v.ConfigFileUsed())
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.FromCtx(ctx).Warn("Unable to watch the config file", zap.String("file", file), zap.Error(err))
+		return reloads
+	}
+	// Watch the directory, so the file is still seen once an editor
+	// replaces it.
+	err = watcher.Add(filepath.Dir(file))
+	if err != nil {
+		watcher.Close()
+		log.FromCtx(ctx).Warn("Unable to watch the config file", zap.String("file", file), zap.Error(err))
+		return reloads
+	}
+
+	go func() {
+		defer watcher.Close()
+		quiet := time.NewTimer(reloadDelay)
+		quiet.Stop()
+		defer quiet.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-watcher.Errors:
+				log.FromCtx(ctx).Warn("Config watcher error", zap.Error(err))
+			case event := <-watcher.Events:
+				if filepath.Clean(event.Name) == file && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create)) {
+					quiet.Reset(reloadDelay)
+				}
+			case <-quiet.C:
+				next, ok := reloadConfig(ctx, v, current)
+				if !ok {
+					continue
+				}
+				current = next
+				// Only the latest config matters, so replace one not yet
+				// taken rather than wait for it to be.
+				select {
+				case <-reloads:
+				default:
+				}
+				reloads <- next
+			}
+		}
+	}()
+	return reloads
+}
+
+// reloadConfig reads the config file again, returning the config if it is
+// valid and differs from current.
+func reloadConfig(ctx context.Context, v *viper.Viper, current Config) (Config, bool) {
+	err := v.ReadInConfig()
+	next := Config{}
+	if err == nil {
+		next, err = LoadConfig(v)
+	}
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.FromCtx(ctx).Warn("Ignoring invalid config change", zap.String("file", v.ConfigFileUsed()), zap.Error(err))
+		return Config{}, false
+	}
+	changed := ChangedSections(current, next)
+	if len(changed) == 0 {
+		return Config{}, false
+	}
+	log.FromCtx(ctx).Info("Config reloaded", zap.String("file", v.ConfigFileUsed()), zap.Strings("changed", changed))
+	return next, true
+}
+
+// ChangedSections lists the top-level config keys (e.g. "filters", "sync")
+// whose values differ between the two configs.
+func ChangedSections(before, after Config) []string {
+	changed := make([]string, 0)
+	bv, av := reflect.ValueOf(before), reflect.ValueOf(after)
+	t := bv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(bv.Field(i).Interface(), av.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
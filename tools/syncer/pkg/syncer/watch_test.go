@@ -0,0 +1,81 @@
+package syncer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("WatchConfig", func() {
+	var (
+		path    string
+		reloads <-chan syncer.Config
+	)
+
+	write := func(schedule string) {
+		content := "romsFolder: /home/pi/RetroPie/roms\ndaemon:\n  schedule: \"" + schedule + "\"\n"
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "syncer.yaml")
+		write("@every 1h")
+		v := viper.New()
+		v.SetConfigFile(path)
+		Expect(v.ReadInConfig()).To(Succeed())
+		cfg, err := syncer.LoadConfig(v)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(log.ToCtx(context.Background(), zap.NewNop()))
+		DeferCleanup(cancel)
+		reloads = syncer.WatchConfig(ctx, v, cfg)
+	})
+
+	It("sends the changed config", func() {
+		write("@every 5m")
+		Eventually(reloads, 5*time.Second).Should(Receive(HaveField("Daemon.Schedule", "@every 5m")))
+	})
+
+	It("ignores invalid changes", func() {
+		write("whenever")
+		Consistently(reloads, 2*time.Second).ShouldNot(Receive())
+	})
+
+	It("keeps only the latest config not yet received", func() {
+		write("@every 5m")
+		Eventually(func() int { return len(reloads) }, 5*time.Second).Should(Equal(1))
+		write("@every 10m")
+		// Long enough for the second change to be read, without taking the
+		// first.
+		time.Sleep(2 * time.Second)
+		Expect(reloads).To(Receive(HaveField("Daemon.Schedule", "@every 10m")))
+		Expect(reloads).NotTo(Receive())
+	})
+})
+
+var _ = DescribeTable("ChangedSections",
+	func(change func(*syncer.Config), want []string) {
+		before := syncer.Config{RomsFolder: "/home/pi/RetroPie/roms"}
+		before.Daemon.Schedule = "@every 1h"
+		after := before
+		change(&after)
+		Expect(syncer.ChangedSections(before, after)).To(Equal(want))
+	},
+	Entry("nothing", func(c *syncer.Config) {}, []string{}),
+	Entry("a top-level value", func(c *syncer.Config) { c.RomsFolder = "/roms" }, []string{"romsFolder"}),
+	Entry("a nested value", func(c *syncer.Config) { c.Daemon.Schedule = "@daily" }, []string{"daemon"}),
+	Entry("several sections, in field order", func(c *syncer.Config) {
+		c.Daemon.Watch = true
+		c.RomsFolder = "/roms"
+		c.Sync.Saves = true
+	}, []string{"romsFolder", "sync", "daemon"}),
+	Entry("a slice", func(c *syncer.Config) { c.Filters.Exclude = []string{"*.bak"} }, []string{"filters"}),
+)
@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TrevorEdris/retropie-utils/pkg/errors"
+	"github.com/TrevorEdris/retropie-utils/pkg/fs"
+	"github.com/TrevorEdris/retropie-utils/pkg/log"
+	"github.com/TrevorEdris/retropie-utils/pkg/progress"
+	"github.com/TrevorEdris/retropie-utils/tools/syncer/pkg/syncer"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rotisserie/eris"
+	"go.uber.org/zap"
+)
+
+type (
+	model struct {
+		ctx      context.Context
+		cfg      syncer.Config
+		program  *tea.Program
+		systems  []systemCounts
+		scanErr  error
+		syncing  bool
+		progress progress.Snapshot
+		lastSync time.Time
+		lastErr  error
+		reloads  <-chan syncer.Config
+		reloaded time.Time
+	}
+
+	systemCounts struct {
+		name   string
+		roms   int
+		saves  int
+		states int
+	}
+
+	scannedMsg struct {
+		systems []systemCounts
+		err     error
+	}
+
+	progressMsg progress.Snapshot
+
+	syncedMsg struct {
+		err error
+	}
+
+	reloadedMsg syncer.Config
+)
+
+// Run starts the dashboard and blocks until the user quits. Configs received
+// on reloads replace the active one; a sync already running keeps the config
+// it started with.
+func Run(ctx context.Context, cfg syncer.Config, reloads <-chan syncer.Config) error {
+	// Log lines would tear the dashboard apart; errors are shown inline.
+	ctx = log.ToCtx(ctx, zap.NewNop())
+	m := &model{ctx: ctx, cfg: cfg, reloads: reloads}
+	m.program = tea.NewProgram(m, tea.WithAltScreen())
+	_, err := m.program.Run()
+	return err
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(m.scan(), m.waitForReload)
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "r":
+			if !m.syncing {
+				return m, m.scan()
+			}
+		case "s":
+			if !m.syncing {
+				m.syncing = true
+				m.progress = progress.Snapshot{}
+				return m, m.sync(false)
+			}
+		case "y":
+			// Confirm a sync stopped by its limits.
+			if !m.syncing && eris.Is(m.lastErr, errors.LimitError) {
+				m.syncing = true
+				m.progress = progress.Snapshot{}
+				return m, m.sync(true)
+			}
+		}
+	case reloadedMsg:
+		m.cfg = syncer.Config(msg)
+		m.reloaded = time.Now()
+		if m.syncing {
+			return m, m.waitForReload
+		}
+		return m, tea.Batch(m.scan(), m.waitForReload)
+	case scannedMsg:
+		m.systems = msg.systems
+		m.scanErr = msg.err
+	case progressMsg:
+		m.progress = progress.Snapshot(msg)
+	case syncedMsg:
+		m.syncing = false
+		m.lastSync = time.Now()
+		m.lastErr = msg.err
+		return m, m.scan()
+	}
+	return m, nil
+}
+
+func (m *model) View() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "syncer dashboard — %s\n\n", m.cfg.RomsFolder)
+
+	if m.scanErr != nil {
+		fmt.Fprintf(b, "Unable to scan library: %s\n", m.scanErr)
+	} else {
+		fmt.Fprintf(b, "%-20s %8s %8s %8s\n", "SYSTEM", "ROMS", "SAVES", "STATES")
+		for _, s := range m.systems {
+			fmt.Fprintf(b, "%-20s %8d %8d %8d\n", s.name, s.roms, s.saves, s.states)
+		}
+	}
+	b.WriteString("\n")
+
+	switch {
+	case m.syncing:
+		p := m.progress
+		fmt.Fprintf(b, "Syncing: %d/%d files, %s/%s", p.FilesDone, p.FilesTotal,
+			progress.FormatBytes(p.BytesDone), progress.FormatBytes(p.BytesTotal))
+		if p.ETA > 0 {
+			fmt.Fprintf(b, ", ETA %s", p.ETA.Round(time.Second))
+		}
+		if p.CurrentFile != "" {
+			fmt.Fprintf(b, "\n  %s (%.0f%%)", p.CurrentFile, p.CurrentFraction*100)
+		}
+		b.WriteString("\n")
+	case m.lastSync.IsZero():
+		b.WriteString("No sync run yet this session\n")
+	case eris.Is(m.lastErr, errors.LimitError):
+		fmt.Fprintf(b, "Last sync stopped at %s: %s\nPress [y] to sync anyway\n", m.lastSync.Format(time.Kitchen), m.lastErr)
+	case m.lastErr != nil:
+		fmt.Fprintf(b, "Last sync failed at %s: %s\n", m.lastSync.Format(time.Kitchen), m.lastErr)
+	default:
+		fmt.Fprintf(b, "Last sync succeeded at %s\n", m.lastSync.Format(time.Kitchen))
+	}
+
+	if !m.reloaded.IsZero() {
+		fmt.Fprintf(b, "Config reloaded at %s\n", m.reloaded.Format(time.Kitchen))
+	}
+
+	b.WriteString("\n[s] sync  [r] rescan  [q] quit\n")
+	return b.String()
+}
+
+// waitForReload delivers the next reloaded config, if the dashboard is
+// watching for any.
+func (m *model) waitForReload() tea.Msg {
+	if m.reloads == nil {
+		return nil
+	}
+	cfg, ok := <-m.reloads
+	if !ok {
+		return nil
+	}
+	return reloadedMsg(cfg)
+}
+
+// scan counts the library's files using the config active when it is called.
+func (m *model) scan() tea.Cmd {
+	cfg := m.cfg
+	return func() tea.Msg {
+		return m.scanLibrary(cfg)
+	}
+}
+
+func (m *model) scanLibrary(cfg syncer.Config) tea.Msg {
+	dir, err := cfg.RomsDirectory(m.ctx)
+	if err != nil {
+		return scannedMsg{err: err}
+	}
+	bySystem := make(map[string]*systemCounts)
+	for _, fileType := range []fs.FileType{fs.Rom, fs.Save, fs.State} {
+		files, err := dir.GetMatchingFiles(fileType)
+		if err != nil {
+			return scannedMsg{err: err}
+		}
+		for _, f := range files {
+			system, _, _ := strings.Cut(f.Dir, "/")
+			counts, ok := bySystem[system]
+			if !ok {
+				counts = &systemCounts{name: system}
+				bySystem[system] = counts
+			}
+			switch fileType {
+			case fs.Rom:
+				counts.roms++
+			case fs.Save:
+				counts.saves++
+			case fs.State:
+				counts.states++
+			}
+		}
+	}
+	systems := make([]systemCounts, 0, len(bySystem))
+	for _, counts := range bySystem {
+		systems = append(systems, *counts)
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		return systems[i].name < systems[j].name
+	})
+	return scannedMsg{systems: systems}
+}
+
+// sync runs a sync using the config active when it is called, confirming
+// it if it exceeds its limits when confirmed is set.
+func (m *model) sync(confirmed bool) tea.Cmd {
+	cfg := m.cfg
+	cfg.Limits.Confirmed = confirmed
+	return func() tea.Msg {
+		return m.runSync(cfg)
+	}
+}
+
+func (m *model) runSync(cfg syncer.Config) tea.Msg {
+	reporter := progress.NewCallback(func(s progress.Snapshot) {
+		m.program.Send(progressMsg(s))
+	})
+	ctx := progress.ToCtx(m.ctx, reporter)
+	s, err := syncer.NewSyncer(ctx, cfg)
+	if err != nil {
+		return syncedMsg{err: err}
+	}
+	_, err = s.Sync(ctx)
+	return syncedMsg{err: err}
+}